@@ -8,15 +8,20 @@ package build
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
 	"strings"
+	"unicode"
 
 	"go.fuchsia.dev/fuchsia/src/sys/pkg/bin/pm/pkg"
 	"go.fuchsia.dev/fuchsia/src/sys/pkg/lib/far/go"
+	"go.fuchsia.dev/fuchsia/src/sys/pkg/lib/merkle"
 )
 
 func Archive(cfg *Config, outputPath string) error {
@@ -95,3 +100,217 @@ func Archive(cfg *Config, outputPath string) error {
 	defer outputFile.Close()
 	return far.Write(outputFile, archiveFiles)
 }
+
+// ErrBlobNotInArchive indicates that a package archive holds no blob with the
+// requested merkle root
+var ErrBlobNotInArchive = errors.New("blob not found in archive")
+
+// ErrBlobMerkleMismatch indicates that the content stored for a blob doesn't
+// hash to its merkle root
+type ErrBlobMerkleMismatch struct {
+	Want, Got MerkleRoot
+}
+
+func (e ErrBlobMerkleMismatch) Error() string {
+	return fmt.Sprintf("blob %s is corrupt: its content has merkle root %s", e.Want, e.Got)
+}
+
+// ExtractArchiveBlob returns the content of the blob with the given merkle root
+// from a package archive, as written by Archive. Content blobs are found by
+// their entry name; the meta.far is found by hashing it. The content is checked
+// against the merkle root before it's returned.
+func ExtractArchiveBlob(archivePath string, root MerkleRoot) ([]byte, error) {
+	f, err := os.Open(archivePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	fr, err := far.NewReader(f)
+	if err != nil {
+		return nil, err
+	}
+
+	name := root.String()
+	found := false
+	for _, entry := range fr.List() {
+		if entry == name {
+			found = true
+			break
+		}
+	}
+	if !found {
+		name = "meta.far"
+		b, err := fr.ReadFile(name)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", root, ErrBlobNotInArchive)
+		}
+		if got, err := merkleRootOf(b); err != nil {
+			return nil, err
+		} else if got != root {
+			return nil, fmt.Errorf("%s: %w", root, ErrBlobNotInArchive)
+		}
+		return b, nil
+	}
+
+	b, err := fr.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	got, err := merkleRootOf(b)
+	if err != nil {
+		return nil, err
+	}
+	if got != root {
+		return nil, ErrBlobMerkleMismatch{Want: root, Got: got}
+	}
+	return b, nil
+}
+
+// ChecksumAlgos lists the algorithms ArchiveChecksum can compute.
+var ChecksumAlgos = []string{"merkle", "sha256"}
+
+// ArchiveChecksum returns the checksum of the whole archive file at path, in
+// hex, computed with algo, one of ChecksumAlgos. Unlike the merkle roots of
+// the blobs in an archive, it covers every byte of the file, so it can be
+// recorded and checked again after the archive is copied.
+func ArchiveChecksum(path, algo string) (string, error) {
+	if algo != "merkle" && algo != "sha256" {
+		return "", fmt.Errorf("unknown checksum algorithm %q, want one of %v", algo, ChecksumAlgos)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	var sum []byte
+	if algo == "merkle" {
+		var tree merkle.Tree
+		_, err = tree.ReadFrom(f)
+		sum = tree.Root()
+	} else {
+		h := sha256.New()
+		_, err = io.Copy(h, f)
+		sum = h.Sum(nil)
+	}
+	if err != nil {
+		return "", fmt.Errorf("reading %s: %w", path, err)
+	}
+	return hex.EncodeToString(sum), nil
+}
+
+func merkleRootOf(b []byte) (MerkleRoot, error) {
+	var res MerkleRoot
+	var tree merkle.Tree
+	if _, err := tree.ReadFrom(bytes.NewReader(b)); err != nil {
+		return res, err
+	}
+	copy(res[:], tree.Root())
+	return res, nil
+}
+
+// ValidateArchivePath checks that an archive entry name is safe to use as a
+// path relative to the directory the archive is extracted to. The name must be
+// relative, must not have empty, "." or ".." segments, and must not contain
+// control characters.
+func ValidateArchivePath(name string) error {
+	if name == "" {
+		return fmt.Errorf("empty path")
+	}
+	if strings.HasPrefix(name, "/") || filepath.IsAbs(name) {
+		return fmt.Errorf("%q is an absolute path", name)
+	}
+	for _, r := range name {
+		if unicode.IsControl(r) {
+			return fmt.Errorf("%q contains control character %U", name, r)
+		}
+	}
+	for _, segment := range strings.Split(name, "/") {
+		switch segment {
+		case "..":
+			return fmt.Errorf("%q traverses out of its directory", name)
+		case "", ".":
+			return fmt.Errorf("%q has an empty or %q segment", name, ".")
+		}
+	}
+	return nil
+}
+
+// RepackArchive rewrites the archive at inPath to outPath in the canonical
+// layout Archive and Seal produce, with the entries in sorted order, so that
+// archives with the same content are byte-for-byte identical however they were
+// written. It checks that every entry of the new archive has the content, and
+// so the merkle root, of the original entry.
+func RepackArchive(inPath, outPath string) error {
+	in, err := os.Open(inPath)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	r, err := far.NewReader(in)
+	if err != nil {
+		return fmt.Errorf("%s is not a valid archive: %w", inPath, err)
+	}
+
+	staging, err := os.MkdirTemp(filepath.Dir(outPath), ".repack-*")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(staging)
+
+	roots := map[string]MerkleRoot{}
+	inputs := map[string]string{}
+	for i, name := range r.List() {
+		if _, ok := inputs[name]; ok {
+			return fmt.Errorf("%s has more than one entry named %q", inPath, name)
+		}
+		b, err := r.ReadFile(name)
+		if err != nil {
+			return fmt.Errorf("%s: %s: %w", inPath, name, err)
+		}
+		if roots[name], err = merkleRootOf(b); err != nil {
+			return err
+		}
+		// Entry names may not be safe paths, so stage entries by index.
+		src := filepath.Join(staging, fmt.Sprint(i))
+		if err := os.WriteFile(src, b, 0o644); err != nil {
+			return err
+		}
+		inputs[name] = src
+	}
+
+	tmp := filepath.Join(staging, "out.far")
+	out, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if err := far.Write(out, inputs); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+
+	b, err := os.ReadFile(tmp)
+	if err != nil {
+		return err
+	}
+	repacked, err := far.NewReader(bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	for name, want := range roots {
+		b, err := repacked.ReadFile(name)
+		if err != nil {
+			return fmt.Errorf("repacked %s: %s: %w", inPath, name, err)
+		}
+		if got, err := merkleRootOf(b); err != nil {
+			return err
+		} else if got != want {
+			return fmt.Errorf("repacked %s: %s: %w", inPath, name, ErrBlobMerkleMismatch{Want: want, Got: got})
+		}
+	}
+
+	return os.Rename(tmp, outPath)
+}
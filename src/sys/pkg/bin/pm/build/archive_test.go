@@ -0,0 +1,40 @@
+// Copyright 2024 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package build
+
+import (
+	"testing"
+)
+
+func TestValidateArchivePath(t *testing.T) {
+	for _, name := range []string{
+		"meta.far",
+		"meta/contents",
+		"dir/sub/file..txt",
+		"..hidden",
+	} {
+		if err := ValidateArchivePath(name); err != nil {
+			t.Errorf("ValidateArchivePath(%q) = %v, want nil", name, err)
+		}
+	}
+	for _, name := range []string{
+		"",
+		"/etc/passwd",
+		"..",
+		"../evil",
+		"dir/../../evil",
+		"dir/..",
+		"dir//file",
+		"./file",
+		"dir/",
+		"new\nline",
+		"bell\a",
+		"del\x7f",
+	} {
+		if err := ValidateArchivePath(name); err == nil {
+			t.Errorf("ValidateArchivePath(%q) = nil, want error", name)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+// Copyright 2024 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package build
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// AttributionMap maps source path prefixes to the attribution metadata of the
+// files under them, such as the path of their LICENSE or OWNERS file. It is
+// read from a JSON object such as:
+//
+//	{
+//	  "third_party/zlib": "third_party/zlib/LICENSE",
+//	  "src/sys/pkg": "src/sys/pkg/OWNERS"
+//	}
+type AttributionMap map[string]string
+
+// AttributedFile is a file of a package and the attribution of its source.
+type AttributedFile struct {
+	Path   string `json:"path"`
+	Source string `json:"source"`
+	// Prefix is the source path prefix the attribution was found under.
+	Prefix      string `json:"prefix"`
+	Attribution string `json:"attribution"`
+}
+
+// UnattributedFile is a file of a package whose source has no attribution.
+type UnattributedFile struct {
+	Path   string `json:"path"`
+	Source string `json:"source"`
+}
+
+// AttributionReport attributes the files of a package, sorted by path.
+type AttributionReport struct {
+	Package    string             `json:"package"`
+	Attributed []AttributedFile   `json:"attributed"`
+	Missing    []UnattributedFile `json:"missing"`
+}
+
+// LoadAttributionMap reads an AttributionMap from the JSON file at path.
+func LoadAttributionMap(path string) (AttributionMap, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var m AttributionMap
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	for prefix := range m {
+		if prefix == "" {
+			return nil, fmt.Errorf("%s: empty source path prefix", path)
+		}
+	}
+	return m, nil
+}
+
+// Attribute returns the attribution of source: that of the longest prefix of
+// source in m, matched by whole path segments, so that "src/foo" covers
+// "src/foo/bar" but not "src/foobar".
+func (m AttributionMap) Attribute(source string) (prefix, attribution string, ok bool) {
+	source = filepath.Clean(source)
+	for p, a := range m {
+		clean := filepath.Clean(p)
+		if source != clean && !strings.HasPrefix(source, strings.TrimSuffix(clean, string(filepath.Separator))+string(filepath.Separator)) {
+			continue
+		}
+		if !ok || len(clean) > len(filepath.Clean(prefix)) {
+			prefix, attribution, ok = p, a, true
+		}
+	}
+	return prefix, attribution, ok
+}
+
+// BuildAttributionReport attributes each file of the package cfg describes by
+// the source its build manifest gives for it. Files pm generates in the
+// output directory, such as meta/contents, have no source to attribute and
+// are left out.
+func BuildAttributionReport(cfg *Config, m AttributionMap) (*AttributionReport, error) {
+	p, err := cfg.Package()
+	if err != nil {
+		return nil, err
+	}
+	manifest, err := cfg.Manifest()
+	if err != nil {
+		return nil, err
+	}
+
+	r := &AttributionReport{
+		Package:    p.Name,
+		Attributed: []AttributedFile{},
+		Missing:    []UnattributedFile{},
+	}
+	generated := AttributionMap{cfg.OutputDir: ""}
+	for dst, src := range manifest.Paths {
+		if _, _, ok := generated.Attribute(src); ok || dst == "meta/contents" {
+			continue
+		}
+		if prefix, attribution, ok := m.Attribute(src); ok {
+			r.Attributed = append(r.Attributed, AttributedFile{Path: dst, Source: src, Prefix: prefix, Attribution: attribution})
+		} else {
+			r.Missing = append(r.Missing, UnattributedFile{Path: dst, Source: src})
+		}
+	}
+	sort.Slice(r.Attributed, func(i, j int) bool { return r.Attributed[i].Path < r.Attributed[j].Path })
+	sort.Slice(r.Missing, func(i, j int) bool { return r.Missing[i].Path < r.Missing[j].Path })
+	return r, nil
+}
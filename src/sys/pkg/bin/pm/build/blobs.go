@@ -5,8 +5,11 @@
 package build
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"io"
 	"os"
 )
 
@@ -23,6 +26,9 @@ type PackageBlobInfo struct {
 
 	// Size of blob, in bytes
 	Size uint64 `json:"size"`
+
+	// SHA-256 digest of the blob, in hex, when requested with AddExtraDigest
+	SHA256 string `json:"sha256,omitempty"`
 }
 
 // LoadBlobs attempts to read and parse a blobs manifest from the given path
@@ -49,3 +55,29 @@ func LoadBlobs(path string) ([]PackageBlobInfo, error) {
 
 	return members, nil
 }
+
+// ExtraDigests lists the digests AddExtraDigest can record for blobs, besides
+// their merkle roots.
+var ExtraDigests = []string{"sha256"}
+
+// AddExtraDigest records the digest algo of each of blobs, reading them from
+// their source paths.
+func AddExtraDigest(blobs []PackageBlobInfo, algo string) error {
+	if algo != "sha256" {
+		return fmt.Errorf("unknown digest %q, want one of %v", algo, ExtraDigests)
+	}
+	for i := range blobs {
+		f, err := os.Open(blobs[i].SourcePath)
+		if err != nil {
+			return err
+		}
+		h := sha256.New()
+		_, err = io.Copy(h, f)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("reading %s: %w", blobs[i].SourcePath, err)
+		}
+		blobs[i].SHA256 = hex.EncodeToString(h.Sum(nil))
+	}
+	return nil
+}
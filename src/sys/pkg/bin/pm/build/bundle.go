@@ -0,0 +1,195 @@
+// Copyright 2024 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package build
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// bundleSeparator separates the path of an input bundle from the path of a
+// file in it, as in bundle.tar!manifest.json.
+const bundleSeparator = "!"
+
+// bundleExts are the extensions of the input bundles pm can read.
+var bundleExts = []string{".tar", ".tar.gz", ".tgz", ".zip"}
+
+// splitBundlePath splits a path such as bundle.tar!manifest.json into the path
+// of the bundle and the path of the file in it. Paths that don't name a file
+// in a bundle are returned whole, with no bundle.
+func splitBundlePath(path string) (bundle, inner string) {
+	i := strings.Index(path, bundleSeparator)
+	if i < 0 {
+		return "", path
+	}
+	for _, ext := range bundleExts {
+		if strings.HasSuffix(path[:i], ext) {
+			return path[:i], path[i+1:]
+		}
+	}
+	return "", path
+}
+
+// OpenInputBundle extracts the input bundle the configuration reads from, if
+// any, to a new directory in TempDir, and points ManifestPath and KeyPath at
+// the extracted files. The bundle is InputBundle, or the bundle named by
+// ManifestPath or KeyPath in the bundle.tar!path form; ManifestPath and
+// KeyPath are paths in the bundle if InputBundle is set. Relative sources in
+// the manifest are then read from the bundle too. The returned function
+// removes the extracted files.
+func (c *Config) OpenInputBundle() (func(), error) {
+	bundle := c.InputBundle
+	paths := map[*string]string{}
+	for _, p := range []*string{&c.ManifestPath, &c.KeyPath} {
+		b, inner := splitBundlePath(*p)
+		if b == "" {
+			if c.InputBundle == "" || *p == "" {
+				continue
+			}
+			b = c.InputBundle
+		}
+		if bundle == "" {
+			bundle = b
+		}
+		if b != bundle {
+			return nil, fmt.Errorf("build: files are read from two input bundles, %s and %s", bundle, b)
+		}
+		paths[p] = inner
+	}
+	if bundle == "" {
+		return func() {}, nil
+	}
+
+	dir, err := os.MkdirTemp(c.TempDir, "pm-bundle")
+	if err != nil {
+		return nil, err
+	}
+	cleanup := func() { os.RemoveAll(dir) }
+	if err := extractBundle(bundle, dir); err != nil {
+		cleanup()
+		return nil, fmt.Errorf("build: input bundle %s: %w", bundle, err)
+	}
+	for p, inner := range paths {
+		// "." names the bundle itself, as a package directory.
+		if err := ValidateArchivePath(inner); err != nil && inner != "." {
+			cleanup()
+			return nil, fmt.Errorf("build: input bundle %s: %w", bundle, err)
+		}
+		*p = filepath.Join(dir, filepath.FromSlash(inner))
+		if _, err := os.Stat(*p); err != nil {
+			cleanup()
+			return nil, fmt.Errorf("build: input bundle %s has no %s", bundle, inner)
+		}
+	}
+	c.bundleDir = dir
+	c.manifest = nil
+	return cleanup, nil
+}
+
+// resolveBundleSources points the relative sources of m at the files
+// extracted from the input bundle, and checks that the bundle has them.
+func (c *Config) resolveBundleSources(m *Manifest) error {
+	for dst, src := range m.Paths {
+		if filepath.IsAbs(src) {
+			continue
+		}
+		src = filepath.Clean(src)
+		if err := ValidateArchivePath(filepath.ToSlash(src)); err != nil {
+			return fmt.Errorf("build: %s: %w", dst, err)
+		}
+		m.Paths[dst] = filepath.Join(c.bundleDir, src)
+		if _, err := os.Stat(m.Paths[dst]); err != nil {
+			return fmt.Errorf("build: the input bundle has no %s, the source of %s", src, dst)
+		}
+	}
+	return nil
+}
+
+// extractBundle extracts the tar or zip archive at path to dir. Every entry
+// must be safe to extract, as checked by ValidateArchivePath.
+func extractBundle(path, dir string) error {
+	if strings.HasSuffix(path, ".zip") {
+		r, err := zip.OpenReader(path)
+		if err != nil {
+			return err
+		}
+		defer r.Close()
+		for _, f := range r.File {
+			if f.FileInfo().IsDir() {
+				continue
+			}
+			rc, err := f.Open()
+			if err != nil {
+				return err
+			}
+			err = extractBundleFile(dir, f.Name, rc)
+			rc.Close()
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	var r io.Reader = f
+	if strings.HasSuffix(path, ".gz") || strings.HasSuffix(path, ".tgz") {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		r = gz
+	}
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+		case tar.TypeReg:
+			if err := extractBundleFile(dir, hdr.Name, tr); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("%s is not a regular file", hdr.Name)
+		}
+	}
+}
+
+func extractBundleFile(dir, name string, r io.Reader) error {
+	name = strings.TrimPrefix(name, "./")
+	if err := ValidateArchivePath(name); err != nil {
+		return err
+	}
+	path := filepath.Join(dir, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,165 @@
+// Copyright 2024 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package build
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// writeBundle writes files to a tar or zip archive at path, chosen by its
+// extension.
+func writeBundle(t *testing.T, path string, files map[string][]byte) {
+	t.Helper()
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var buf bytes.Buffer
+	if strings.HasSuffix(path, ".zip") {
+		zw := zip.NewWriter(&buf)
+		for _, name := range names {
+			w, err := zw.Create(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			w.Write(files[name])
+		}
+		if err := zw.Close(); err != nil {
+			t.Fatal(err)
+		}
+	} else {
+		tw := tar.NewWriter(&buf)
+		for _, name := range names {
+			if err := tw.WriteHeader(&tar.Header{Typeflag: tar.TypeReg, Name: name, Mode: 0o644, Size: int64(len(files[name]))}); err != nil {
+				t.Fatal(err)
+			}
+			tw.Write(files[name])
+		}
+		if err := tw.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestInputBundle(t *testing.T) {
+	cfg := TestConfig()
+	defer os.RemoveAll(filepath.Dir(cfg.TempDir))
+	TestPackage(cfg)
+	want, err := BuildPackage(context.Background(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantMetaFar, err := os.ReadFile(cfg.MetaFAR())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Bundle the manifest, a key, and the sources, which the bundled
+	// manifest names by their relative paths in the bundle.
+	manifest, err := cfg.Manifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string][]byte{"key": []byte("signing key\n")}
+	var lines []string
+	for dst, src := range manifest.Paths {
+		if dst == "meta/contents" {
+			continue
+		}
+		b, err := os.ReadFile(src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files["sources/"+dst] = b
+		lines = append(lines, fmt.Sprintf("%s=sources/%s", dst, dst))
+	}
+	sort.Strings(lines)
+	files["manifest"] = []byte(strings.Join(lines, "\n") + "\n")
+	dir := t.TempDir()
+	tarPath := filepath.Join(dir, "bundle.tar")
+	writeBundle(t, tarPath, files)
+	zipPath := filepath.Join(dir, "bundle.zip")
+	writeBundle(t, zipPath, files)
+
+	for _, tc := range []struct {
+		name                  string
+		bundle, manifest, key string
+	}{
+		{"tar", "", tarPath + "!manifest", tarPath + "!key"},
+		{"zip", zipPath, "manifest", "key"},
+	} {
+		bcfg := TestConfig()
+		defer os.RemoveAll(filepath.Dir(bcfg.TempDir))
+		bcfg.InputBundle, bcfg.ManifestPath, bcfg.KeyPath = tc.bundle, tc.manifest, tc.key
+		closeBundle, err := bcfg.OpenInputBundle()
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		defer closeBundle()
+
+		got, err := BuildPackage(context.Background(), bcfg)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		metaFar, err := os.ReadFile(bcfg.MetaFAR())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(metaFar, wantMetaFar) {
+			t.Errorf("%s: the bundled build's meta.far differs from the unbundled build's", tc.name)
+		}
+		if len(got.Blobs) != len(want.Blobs) {
+			t.Fatalf("%s: got %d blobs, want %d", tc.name, len(got.Blobs), len(want.Blobs))
+		}
+		for i := range got.Blobs {
+			if got.Blobs[i].Path != want.Blobs[i].Path || got.Blobs[i].Merkle != want.Blobs[i].Merkle {
+				t.Errorf("%s: got blob %s %s, want %s %s", tc.name, got.Blobs[i].Path, got.Blobs[i].Merkle, want.Blobs[i].Path, want.Blobs[i].Merkle)
+			}
+		}
+		if key, err := os.ReadFile(bcfg.KeyPath); err != nil || string(key) != "signing key\n" {
+			t.Errorf("%s: got key %q, %v, want the bundled key", tc.name, key, err)
+		}
+	}
+}
+
+func TestInputBundleMissingPaths(t *testing.T) {
+	dir := t.TempDir()
+	bundle := filepath.Join(dir, "bundle.tar")
+	writeBundle(t, bundle, map[string][]byte{
+		"manifest":             []byte("meta/package=sources/meta/package\na=sources/missing\n"),
+		"sources/meta/package": []byte(`{"name":"bundled","version":"0"}`),
+	})
+
+	cfg := TestConfig()
+	defer os.RemoveAll(filepath.Dir(cfg.TempDir))
+	cfg.ManifestPath = bundle + "!missing-manifest"
+	if _, err := cfg.OpenInputBundle(); err == nil || !strings.Contains(err.Error(), "has no missing-manifest") {
+		t.Errorf("got %v, want an error saying the bundle has no missing-manifest", err)
+	}
+
+	cfg.ManifestPath = bundle + "!manifest"
+	closeBundle, err := cfg.OpenInputBundle()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer closeBundle()
+	if _, err := cfg.Manifest(); err == nil || !strings.Contains(err.Error(), "has no sources/missing") {
+		t.Errorf("got %v, want an error saying the bundle has no sources/missing", err)
+	}
+}
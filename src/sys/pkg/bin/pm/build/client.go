@@ -0,0 +1,160 @@
+// Copyright 2024 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package build
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// RepoClient fetches metadata and blobs from a repository served over HTTP,
+// such as by `pm serve`. Failed requests are retried, and blob downloads
+// resume from where they were interrupted.
+type RepoClient struct {
+	// BaseURL is the URL of the repository's directory, holding the TUF
+	// metadata and the blobs/ directory.
+	BaseURL string
+	// Client makes the requests. It defaults to http.DefaultClient.
+	Client *http.Client
+	// Retries is how many times a failed request is retried.
+	Retries int
+	// Backoff is how long to wait before the first retry. It doubles for
+	// each further retry.
+	Backoff time.Duration
+}
+
+// NewRepoClient returns a client of the repository at baseURL, retrying failed
+// requests 3 times.
+func NewRepoClient(baseURL string) *RepoClient {
+	return &RepoClient{
+		BaseURL: strings.TrimSuffix(baseURL, "/"),
+		Retries: 3,
+		Backoff: 100 * time.Millisecond,
+	}
+}
+
+// FetchMetadata returns the content of the metadata file name, such as
+// "timestamp.json".
+func (c *RepoClient) FetchMetadata(ctx context.Context, name string) ([]byte, error) {
+	var b []byte
+	err := c.retry(ctx, func() error {
+		res, err := c.get(ctx, "/"+name, 0)
+		if err != nil {
+			return err
+		}
+		defer res.Body.Close()
+		if res.StatusCode != http.StatusOK {
+			return fmt.Errorf("fetching %s: %s", name, res.Status)
+		}
+		b, err = io.ReadAll(res.Body)
+		return err
+	})
+	return b, err
+}
+
+// FetchBlob downloads the blob with the merkle root root to path, and checks
+// that its content has that merkle root. The download is written to
+// path.part until it's complete; a download interrupted by an error resumes
+// from the end of path.part with a range request.
+func (c *RepoClient) FetchBlob(ctx context.Context, root MerkleRoot, path string) error {
+	partPath := path + ".part"
+	f, err := os.OpenFile(partPath, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	err = c.retry(ctx, func() error {
+		offset, err := f.Seek(0, io.SeekEnd)
+		if err != nil {
+			return err
+		}
+		res, err := c.get(ctx, "/blobs/"+root.String(), offset)
+		if err != nil {
+			return err
+		}
+		defer res.Body.Close()
+		switch res.StatusCode {
+		case http.StatusPartialContent:
+		case http.StatusOK:
+			// The server sent the whole blob.
+			if err := f.Truncate(0); err != nil {
+				return err
+			}
+			if _, err := f.Seek(0, io.SeekStart); err != nil {
+				return err
+			}
+		case http.StatusRequestedRangeNotSatisfiable:
+			// The download is already complete.
+			return nil
+		default:
+			return fmt.Errorf("fetching blob %s: %s", root, res.Status)
+		}
+		_, err = io.Copy(f, res.Body)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	b, err := io.ReadAll(f)
+	if err != nil {
+		return err
+	}
+	got, err := merkleRootOf(b)
+	if err != nil {
+		return err
+	}
+	if got != root {
+		os.Remove(partPath)
+		return fmt.Errorf("blob %s was downloaded with merkle root %s", root, got)
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(partPath, path)
+}
+
+// get requests the path, relative to the repository, from offset on.
+func (c *RepoClient) get(ctx context.Context, path string, offset int64) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.BaseURL+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	if offset != 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+	client := c.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return client.Do(req)
+}
+
+// retry calls f until it succeeds, it has been retried c.Retries times, or
+// ctx is done, backing off between attempts.
+func (c *RepoClient) retry(ctx context.Context, f func() error) error {
+	backoff := c.Backoff
+	for attempt := 0; ; attempt++ {
+		err := f()
+		if err == nil || attempt == c.Retries {
+			return err
+		}
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return fmt.Errorf("%w (giving up: %s)", err, ctx.Err())
+		}
+		backoff *= 2
+	}
+}
@@ -0,0 +1,153 @@
+// Copyright 2024 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package build
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+// newTestRepoServer serves a repository holding timestamp.json and blob, and
+// cuts the first download of the blob off halfway through. It returns the
+// Range headers of the blob requests.
+func newTestRepoServer(t *testing.T, blob []byte) (*httptest.Server, MerkleRoot, func() []string) {
+	t.Helper()
+	root, err := merkleRootOf(blob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "blobs"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "blobs", root.String()), blob, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "timestamp.json"), []byte(`{"signed":{"version":1}}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var mu sync.Mutex
+	var ranges []string
+	files := http.FileServer(http.Dir(dir))
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/blobs/"+root.String() {
+			files.ServeHTTP(w, r)
+			return
+		}
+		mu.Lock()
+		ranges = append(ranges, r.Header.Get("Range"))
+		first := len(ranges) == 1
+		mu.Unlock()
+		if !first {
+			files.ServeHTTP(w, r)
+			return
+		}
+		// Promise the whole blob, send half of it, and drop the connection.
+		w.Header().Set("Content-Length", strconv.Itoa(len(blob)))
+		w.WriteHeader(http.StatusOK)
+		w.Write(blob[:len(blob)/2])
+		w.(http.Flusher).Flush()
+		panic(http.ErrAbortHandler)
+	}))
+	t.Cleanup(s.Close)
+	return s, root, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string{}, ranges...)
+	}
+}
+
+func TestRepoClientResumesBlob(t *testing.T) {
+	blob := make([]byte, 3*8192+17)
+	if _, err := rand.Read(blob); err != nil {
+		t.Fatal(err)
+	}
+	s, root, ranges := newTestRepoServer(t, blob)
+	c := NewRepoClient(s.URL)
+	c.Backoff = 0
+
+	timestamp, err := c.FetchMetadata(context.Background(), "timestamp.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(timestamp, []byte(`"version":1`)) {
+		t.Errorf("got timestamp.json %q", timestamp)
+	}
+
+	path := filepath.Join(t.TempDir(), root.String())
+	if err := c.FetchBlob(context.Background(), root, path); err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, blob) {
+		t.Errorf("downloaded %d bytes that don't match the blob", len(got))
+	}
+	if _, err := os.Stat(path + ".part"); !os.IsNotExist(err) {
+		t.Errorf("got %v, want the partial download gone", err)
+	}
+
+	want := []string{"", "bytes=" + strconv.Itoa(len(blob)/2) + "-"}
+	if got := ranges(); len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("got blob requests with ranges %q, want %q", got, want)
+	}
+}
+
+func TestRepoClientVerifiesBlob(t *testing.T) {
+	// Serve a blob under a merkle root its content doesn't have.
+	wrong, err := merkleRootOf([]byte("other content\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "blobs"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "blobs", wrong.String()), []byte("blob content\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	s := httptest.NewServer(http.FileServer(http.Dir(dir)))
+	defer s.Close()
+
+	c := NewRepoClient(s.URL)
+	c.Backoff = 0
+	path := filepath.Join(t.TempDir(), "blob")
+	if err := c.FetchBlob(context.Background(), wrong, path); err == nil {
+		t.Error("fetching a blob with the wrong content succeeded")
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("got %v, want no blob written", err)
+	}
+}
+
+func TestRepoClientRetries(t *testing.T) {
+	var requests int
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer s.Close()
+
+	c := NewRepoClient(s.URL)
+	c.Backoff = 0
+	c.Retries = 2
+	if _, err := c.FetchMetadata(context.Background(), "timestamp.json"); err == nil {
+		t.Error("fetching from a failing server succeeded")
+	}
+	if requests != 3 {
+		t.Errorf("got %d requests, want 3", requests)
+	}
+}
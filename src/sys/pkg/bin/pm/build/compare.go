@@ -0,0 +1,174 @@
+// Copyright 2024 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package build
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"go.fuchsia.dev/fuchsia/src/sys/pkg/lib/far/go"
+)
+
+// ArchiveComparison lists the differences between two package archives, A and
+// B, as written by Archive. Blobs are compared by merkle root, so a blob whose
+// content changed is only in A at its old merkle root, and only in B at its
+// new one.
+type ArchiveComparison struct {
+	// OnlyA lists the blobs of A that B doesn't hold.
+	OnlyA []ComparedBlob `json:"only_a"`
+	// OnlyB lists the blobs of B that A doesn't hold.
+	OnlyB []ComparedBlob `json:"only_b"`
+	// Moved lists the blobs both archives hold, at different paths.
+	Moved []MovedBlob `json:"moved"`
+	// Meta lists the files of the meta.fars that differ, other than
+	// meta/contents, whose differences are those of the blobs.
+	Meta []MetaDifference `json:"meta"`
+}
+
+// ComparedBlob is a blob of one of the archives compared.
+type ComparedBlob struct {
+	Merkle MerkleRoot `json:"merkle"`
+	Size   uint64     `json:"size"`
+	// Paths lists the paths of the blob in its package.
+	Paths []string `json:"paths"`
+}
+
+// MovedBlob is a blob that both archives hold, at different paths.
+type MovedBlob struct {
+	Merkle MerkleRoot `json:"merkle"`
+	Size   uint64     `json:"size"`
+	PathsA []string   `json:"paths_a"`
+	PathsB []string   `json:"paths_b"`
+}
+
+// MetaDifference is a file of the meta.fars that differs. A and B are the
+// merkle roots of its content in each archive, or "" if the archive lacks it.
+type MetaDifference struct {
+	Path string `json:"path"`
+	A    string `json:"a,omitempty"`
+	B    string `json:"b,omitempty"`
+}
+
+// Identical reports whether the archives hold the same package.
+func (c *ArchiveComparison) Identical() bool {
+	return len(c.OnlyA) == 0 && len(c.OnlyB) == 0 && len(c.Moved) == 0 && len(c.Meta) == 0
+}
+
+// comparedArchive is what CompareArchives reads of an archive.
+type comparedArchive struct {
+	blobs map[MerkleRoot]*ComparedBlob
+	meta  map[string]MerkleRoot
+}
+
+// CompareArchives compares the package archives at pathA and pathB. Only
+// their meta.fars are read; the blobs are known by the merkle roots
+// meta/contents lists for them.
+func CompareArchives(pathA, pathB string) (*ArchiveComparison, error) {
+	a, err := readComparedArchive(pathA)
+	if err != nil {
+		return nil, err
+	}
+	b, err := readComparedArchive(pathB)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &ArchiveComparison{
+		OnlyA: []ComparedBlob{},
+		OnlyB: []ComparedBlob{},
+		Moved: []MovedBlob{},
+		Meta:  []MetaDifference{},
+	}
+	for root, blobA := range a.blobs {
+		blobB, ok := b.blobs[root]
+		switch {
+		case !ok:
+			c.OnlyA = append(c.OnlyA, *blobA)
+		case strings.Join(blobA.Paths, "\n") != strings.Join(blobB.Paths, "\n"):
+			c.Moved = append(c.Moved, MovedBlob{Merkle: root, Size: blobA.Size, PathsA: blobA.Paths, PathsB: blobB.Paths})
+		}
+	}
+	for root, blobB := range b.blobs {
+		if _, ok := a.blobs[root]; !ok {
+			c.OnlyB = append(c.OnlyB, *blobB)
+		}
+	}
+
+	for p, rootA := range a.meta {
+		if rootB, ok := b.meta[p]; !ok {
+			c.Meta = append(c.Meta, MetaDifference{Path: p, A: rootA.String()})
+		} else if rootA != rootB {
+			c.Meta = append(c.Meta, MetaDifference{Path: p, A: rootA.String(), B: rootB.String()})
+		}
+	}
+	for p, rootB := range b.meta {
+		if _, ok := a.meta[p]; !ok {
+			c.Meta = append(c.Meta, MetaDifference{Path: p, B: rootB.String()})
+		}
+	}
+
+	for _, blobs := range [][]ComparedBlob{c.OnlyA, c.OnlyB} {
+		sort.Slice(blobs, func(i, j int) bool { return blobs[i].Paths[0] < blobs[j].Paths[0] })
+	}
+	sort.Slice(c.Moved, func(i, j int) bool { return c.Moved[i].PathsA[0] < c.Moved[j].PathsA[0] })
+	sort.Slice(c.Meta, func(i, j int) bool { return c.Meta[i].Path < c.Meta[j].Path })
+	return c, nil
+}
+
+func readComparedArchive(path string) (*comparedArchive, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	fr, err := far.NewReader(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s is not a valid archive: %w", path, err)
+	}
+	b, err := fr.ReadFile("meta.far")
+	if err != nil {
+		return nil, fmt.Errorf("%s holds no meta.far: %w", path, err)
+	}
+	mr, err := far.NewReader(bytes.NewReader(b))
+	if err != nil {
+		return nil, fmt.Errorf("%s: meta.far: %w", path, err)
+	}
+
+	a := &comparedArchive{
+		blobs: map[MerkleRoot]*ComparedBlob{},
+		meta:  map[string]MerkleRoot{},
+	}
+	for _, name := range mr.List() {
+		content, err := mr.ReadFile(name)
+		if err != nil {
+			return nil, fmt.Errorf("%s: meta.far: %s: %w", path, name, err)
+		}
+		if name != "meta/contents" {
+			if a.meta[name], err = merkleRootOf(content); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		contents, err := ParseMetaContents(bytes.NewReader(content))
+		if err != nil {
+			return nil, fmt.Errorf("%s: meta/contents: %w", path, err)
+		}
+		for p, root := range contents {
+			blob, ok := a.blobs[root]
+			if !ok {
+				blob = &ComparedBlob{Merkle: root, Size: fr.GetSize(root.String())}
+				a.blobs[root] = blob
+			}
+			blob.Paths = append(blob.Paths, p)
+		}
+	}
+	for _, blob := range a.blobs {
+		sort.Strings(blob.Paths)
+	}
+	return a, nil
+}
@@ -7,6 +7,7 @@ package build
 import (
 	"flag"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"sort"
@@ -28,9 +29,24 @@ type Config struct {
 	PkgVersion      string
 	PkgABIRevision  uint64
 	SubpackagesPath string
+	// CreateOutputDir creates OutputDir if it doesn't exist, rather than
+	// failing the build.
+	CreateOutputDir bool
+	// Progress receives events as the package's blobs are processed.
+	Progress Progress
+	// WarningWriter is where warnings are written. It defaults to stderr.
+	WarningWriter io.Writer
+	// InputBundle is a tar or zip archive that ManifestPath, KeyPath and
+	// the relative sources of the manifest are read from. See
+	// OpenInputBundle.
+	InputBundle string
 
 	// the manifest is memoized lazily, on the first call to Manifest()
 	manifest *Manifest
+	// warnings counts the warnings reported with Warnf.
+	warnings int64
+	// bundleDir is where the input bundle was extracted, if there's one.
+	bundleDir string
 }
 
 // NewConfig initializes a new configuration with conventional defaults
@@ -80,9 +96,17 @@ func (c *Config) InitFlags(fs *flag.FlagSet) {
 	fs.StringVar(&c.ManifestPath, "m", c.ManifestPath, "build manifest (or package directory)")
 	fs.StringVar(&c.KeyPath, "k", c.KeyPath, "deprecated; do not use")
 	fs.StringVar(&c.TempDir, "t", c.TempDir, "temporary directory")
-	fs.StringVar(&c.PkgName, "n", c.PkgName, "name of the packages")
+	fs.StringVar(&c.InputBundle, "input-bundle", c.InputBundle, "tar or zip `archive` to read the -m manifest, the -k key, and the manifest's relative sources from; -m bundle.tar!manifest also reads from a bundle")
+	fs.Func("n", "name of the packages", func(value string) error {
+		if err := ValidatePackageName(value); err != nil {
+			return err
+		}
+		c.PkgName = value
+		return nil
+	})
 	fs.StringVar(&c.PkgRepository, "r", c.PkgRepository, "repository of the packages")
 	fs.StringVar(&c.SubpackagesPath, "subpackages", c.SubpackagesPath, "metafile of subpackages")
+	fs.BoolVar(&c.CreateOutputDir, "create-output-dir", c.CreateOutputDir, "create the output directory if it doesn't exist")
 	fs.Func("api-level", "package API level", func(value string) error {
 		apiLevel, err := strconv.ParseUint(value, 0, 64)
 		if err != nil {
@@ -94,6 +118,32 @@ func (c *Config) InitFlags(fs *flag.FlagSet) {
 	})
 }
 
+// CheckOutputDir verifies that OutputDir exists, creating it if
+// CreateOutputDir is set, and that it is writable. It lets builds fail before
+// doing any expensive work.
+func (c *Config) CheckOutputDir() error {
+	info, err := os.Stat(c.OutputDir)
+	switch {
+	case os.IsNotExist(err) && c.CreateOutputDir:
+		if err := os.MkdirAll(c.OutputDir, os.ModePerm); err != nil {
+			return fmt.Errorf("build: unable to create output directory %q: %w", c.OutputDir, err)
+		}
+	case os.IsNotExist(err):
+		return fmt.Errorf("build: output directory %q does not exist; create it or pass -create-output-dir", c.OutputDir)
+	case err != nil:
+		return fmt.Errorf("build: unable to access output directory %q: %w", c.OutputDir, err)
+	case !info.IsDir():
+		return fmt.Errorf("build: output directory %q is not a directory", c.OutputDir)
+	}
+
+	f, err := os.CreateTemp(c.OutputDir, ".pm-write-check-*")
+	if err != nil {
+		return fmt.Errorf("build: output directory %q is not writable: %w", c.OutputDir, err)
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
+
 // Manifest initializes and returns the configured manifest. The manifest may be
 // modified during the build process to add/remove files.
 func (c *Config) Manifest() (*Manifest, error) {
@@ -114,10 +164,21 @@ func (c *Config) Manifest() (*Manifest, error) {
 			err = os.ErrNotExist
 		}
 		c.manifest, err = NewManifest(sources)
+		if err == nil && c.bundleDir != "" {
+			if err = c.resolveBundleSources(c.manifest); err != nil {
+				c.manifest = nil
+			}
+		}
 	}
 	return c.manifest, err
 }
 
+// ResetManifest forgets the manifest Manifest memoized, so that the next call
+// to Manifest reads it again.
+func (c *Config) ResetManifest() {
+	c.manifest = nil
+}
+
 // MetaFAR returns the path to the meta.far that build.Seal generates
 func (c *Config) MetaFAR() string {
 	return filepath.Join(c.OutputDir, "meta.far")
@@ -9,6 +9,7 @@ import (
 	"os"
 	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -71,3 +72,54 @@ func TestParseAPILevelIntoABIRevision(t *testing.T) {
 		t.Fatalf("expected ABI revision %x, not %x", TestABIRevision, cfg.PkgABIRevision)
 	}
 }
+
+func TestCheckOutputDir(t *testing.T) {
+	cfg := TestConfig()
+	defer os.RemoveAll(filepath.Dir(cfg.TempDir))
+
+	if err := cfg.CheckOutputDir(); err != nil {
+		t.Fatalf("writable output directory: %v", err)
+	}
+	entries, err := os.ReadDir(cfg.OutputDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("CheckOutputDir left %d files behind", len(entries))
+	}
+
+	cfg.OutputDir = filepath.Join(filepath.Dir(cfg.TempDir), "missing")
+	err = cfg.CheckOutputDir()
+	if err == nil || !strings.Contains(err.Error(), "does not exist") {
+		t.Errorf("missing output directory: got %v, want error saying it does not exist", err)
+	}
+
+	cfg.CreateOutputDir = true
+	if err := cfg.CheckOutputDir(); err != nil {
+		t.Fatalf("missing output directory with -create-output-dir: %v", err)
+	}
+	if info, err := os.Stat(cfg.OutputDir); err != nil || !info.IsDir() {
+		t.Errorf("output directory wasn't created: %v", err)
+	}
+}
+
+func TestCheckOutputDirReadOnly(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("permissions aren't enforced for root")
+	}
+	cfg := TestConfig()
+	defer os.RemoveAll(filepath.Dir(cfg.TempDir))
+
+	if err := os.Chmod(cfg.OutputDir, 0o555); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chmod(cfg.OutputDir, 0o755)
+
+	err := cfg.CheckOutputDir()
+	if err == nil || !strings.Contains(err.Error(), "is not writable") {
+		t.Errorf("got %v, want error saying the output directory is not writable", err)
+	}
+	if err := Update(cfg); err == nil || !strings.Contains(err.Error(), "is not writable") {
+		t.Errorf("Update: got %v, want error saying the output directory is not writable", err)
+	}
+}
@@ -0,0 +1,70 @@
+// Copyright 2024 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package build
+
+import (
+	"fmt"
+)
+
+// BlobReuse summarizes how the blobs of a set of packages are shared. Blobs
+// are content addressed, so a blob referenced by several packages, or by
+// several paths of one package, is only stored once.
+type BlobReuse struct {
+	// References is the number of blobs the packages list, counting a blob
+	// once for each path it appears at.
+	References int
+	// UniqueBlobs is the number of distinct blobs the packages list.
+	UniqueBlobs int
+	// DedupedBlobs is the number of distinct blobs listed more than once.
+	DedupedBlobs int
+	// TotalBytes is the size of the blobs, counting a blob once for each path
+	// it appears at.
+	TotalBytes uint64
+	// UniqueBytes is the size of the distinct blobs.
+	UniqueBytes uint64
+}
+
+// SavedBytes is the number of bytes that deduplicating the blobs saves.
+func (r BlobReuse) SavedBytes() uint64 {
+	return r.TotalBytes - r.UniqueBytes
+}
+
+func (r BlobReuse) String() string {
+	return fmt.Sprintf("%d blob references, %d unique blobs, %d deduplicated; %d of %d bytes saved by deduplication",
+		r.References, r.UniqueBlobs, r.DedupedBlobs, r.SavedBytes(), r.TotalBytes)
+}
+
+// ComputeBlobReuse returns the blob reuse across the given package manifests.
+func ComputeBlobReuse(manifests ...*PackageManifest) BlobReuse {
+	var r BlobReuse
+	refs := map[MerkleRoot]int{}
+	for _, m := range manifests {
+		for _, blob := range m.Blobs {
+			r.References++
+			r.TotalBytes += blob.Size
+			refs[blob.Merkle]++
+			switch refs[blob.Merkle] {
+			case 1:
+				r.UniqueBlobs++
+				r.UniqueBytes += blob.Size
+			case 2:
+				r.DedupedBlobs++
+			}
+		}
+	}
+	return r
+}
+
+// CheckSizeBudget checks that the package in manifest, with its blobs
+// deduplicated and including its meta.far, is no larger than maxSize bytes.
+// A maxSize of 0 disables the check.
+func CheckSizeBudget(manifest *PackageManifest, maxSize uint64) error {
+	total := ComputeBlobReuse(manifest).UniqueBytes
+	if maxSize == 0 || total <= maxSize {
+		return nil
+	}
+	return fmt.Errorf("package %s is %d bytes, %d bytes over its budget of %d bytes",
+		manifest.Package.Name, total, total-maxSize, maxSize)
+}
@@ -0,0 +1,76 @@
+// Copyright 2024 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package build
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// buildPackageWithFiles builds a package named name holding files, which maps
+// package paths to their content.
+func buildPackageWithFiles(t *testing.T, name string, files map[string]string) *PackageManifest {
+	t.Helper()
+	cfg := TestConfig()
+	t.Cleanup(func() { os.RemoveAll(filepath.Dir(cfg.TempDir)) })
+	cfg.PkgName = name
+	TestPackage(cfg)
+
+	var manifest strings.Builder
+	pkgJSON := filepath.Join(filepath.Dir(cfg.ManifestPath), "package", "meta", "package")
+	fmt.Fprintf(&manifest, "meta/package=%s\n", pkgJSON)
+	for dst, content := range files {
+		src := filepath.Join(cfg.TempDir, "files", dst)
+		if err := os.MkdirAll(filepath.Dir(src), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(src, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		fmt.Fprintf(&manifest, "%s=%s\n", dst, src)
+	}
+	if err := os.WriteFile(cfg.ManifestPath, []byte(manifest.String()), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := BuildPackage(context.Background(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestComputeBlobReuse(t *testing.T) {
+	shared := "shared between packages\n"
+	first := buildPackageWithFiles(t, "first", map[string]string{"shared": shared, "own": "first\n"})
+	second := buildPackageWithFiles(t, "second", map[string]string{"lib/shared": shared, "own": "second\n"})
+
+	var totalBytes uint64
+	for _, m := range []*PackageManifest{first, second} {
+		for _, blob := range m.Blobs {
+			totalBytes += blob.Size
+		}
+	}
+
+	got := ComputeBlobReuse(first, second)
+	// Each package has its meta.far, its own blob and the shared blob.
+	want := BlobReuse{
+		References:   6,
+		UniqueBlobs:  5,
+		DedupedBlobs: 1,
+		TotalBytes:   totalBytes,
+		UniqueBytes:  totalBytes - uint64(len(shared)),
+	}
+	if got != want {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+	if got, want := got.SavedBytes(), uint64(len(shared)); got != want {
+		t.Errorf("saved %d bytes, want %d", got, want)
+	}
+}
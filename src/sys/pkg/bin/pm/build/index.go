@@ -0,0 +1,86 @@
+// Copyright 2024 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package build
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+)
+
+// The parts of the FAR format IndexArchive reads.
+var farMagic = []byte{0xc8, 0xbf, 0x0b, 0x48, 0xad, 0xab, 0xc5, 0x11}
+
+const (
+	farDirChunk      = 0x2d2d2d2d2d524944 // "DIR-----"
+	farDirNamesChunk = 0x53454d414e524944 // "DIRNAMES"
+	farIndexEntryLen = 24
+	farDirEntryLen   = 32
+)
+
+// ArchiveIndexEntry locates the content of an archive entry within the
+// archive.
+type ArchiveIndexEntry struct {
+	Name string `json:"name"`
+	// Merkle is the merkle root of the entry, for the entries of a package
+	// archive that are named by the merkle roots of their blobs.
+	Merkle string `json:"merkle,omitempty"`
+	Offset uint64 `json:"offset"`
+	Length uint64 `json:"length"`
+}
+
+// IndexArchive returns where the content of each entry of the archive r is,
+// in the order of the archive's directory. Only the archive's header and
+// directory are read, not the content of its entries.
+func IndexArchive(r io.ReaderAt) ([]ArchiveIndexEntry, error) {
+	le := binary.LittleEndian
+	header := make([]byte, len(farMagic)+8)
+	if _, err := r.ReadAt(header, 0); err != nil {
+		return nil, fmt.Errorf("reading archive header: %w", err)
+	}
+	if !bytes.Equal(header[:len(farMagic)], farMagic) {
+		return nil, fmt.Errorf("not an archive")
+	}
+
+	index := make([]byte, le.Uint64(header[len(farMagic):]))
+	if _, err := r.ReadAt(index, int64(len(header))); err != nil {
+		return nil, fmt.Errorf("reading archive index: %w", err)
+	}
+	var dir, names []byte
+	for i := 0; i+farIndexEntryLen <= len(index); i += farIndexEntryLen {
+		chunk := make([]byte, le.Uint64(index[i+16:]))
+		switch le.Uint64(index[i:]) {
+		case farDirChunk:
+			dir = chunk
+		case farDirNamesChunk:
+			names = chunk
+		default:
+			continue
+		}
+		if _, err := r.ReadAt(chunk, int64(le.Uint64(index[i+8:]))); err != nil && len(chunk) != 0 {
+			return nil, fmt.Errorf("reading archive directory: %w", err)
+		}
+	}
+
+	entries := make([]ArchiveIndexEntry, 0, len(dir)/farDirEntryLen)
+	for i := 0; i+farDirEntryLen <= len(dir); i += farDirEntryLen {
+		nameOffset, nameLen := uint64(le.Uint32(dir[i:])), uint64(le.Uint16(dir[i+4:]))
+		if nameOffset+nameLen > uint64(len(names)) {
+			return nil, fmt.Errorf("archive directory entry %d has a name out of bounds", i/farDirEntryLen)
+		}
+		e := ArchiveIndexEntry{
+			Name:   string(names[nameOffset : nameOffset+nameLen]),
+			Offset: le.Uint64(dir[i+8:]),
+			Length: le.Uint64(dir[i+16:]),
+		}
+		if b, err := hex.DecodeString(e.Name); err == nil && len(b) == 32 {
+			e.Merkle = e.Name
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
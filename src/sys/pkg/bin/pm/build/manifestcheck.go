@@ -0,0 +1,160 @@
+// Copyright 2024 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package build
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"go.fuchsia.dev/fuchsia/src/sys/pkg/lib/far/go"
+)
+
+// ManifestCheck lists the differences between a package archive and the
+// package manifest it's expected to match. Each difference is described as
+// "path (merkle)" for blobs the package lists, or by merkle root for archive
+// entries no path refers to.
+type ManifestCheck struct {
+	// Missing lists the blobs the manifest lists that the archive doesn't
+	// hold.
+	Missing []string
+	// Extra lists the blobs the archive holds that the manifest doesn't
+	// list.
+	Extra []string
+	// Mismatched lists the paths whose merkle roots differ between the
+	// manifest and the archive, and archive entries whose content doesn't
+	// match their merkle roots.
+	Mismatched []string
+}
+
+// OK reports whether the archive matches the manifest.
+func (c *ManifestCheck) OK() bool {
+	return len(c.Missing) == 0 && len(c.Extra) == 0 && len(c.Mismatched) == 0
+}
+
+// CheckArchiveManifest compares the package archive at archivePath, as written
+// by Archive, with the blobs listed by manifest. The archive must hold exactly
+// the blobs the manifest lists, with the merkle roots it lists for them.
+//
+// The blobs of an unchanged archive whose merkle roots are in cache aren't
+// hashed again, and the roots computed are recorded in it. cache may be nil.
+func CheckArchiveManifest(archivePath string, manifest *PackageManifest, cache *MerkleCache) (*ManifestCheck, error) {
+	f, err := os.Open(archivePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	fr, err := far.NewReader(f)
+	if err != nil {
+		return nil, err
+	}
+	// Cache keys name the entries of the archive by its absolute path, so
+	// that one cache can serve archives in different directories.
+	absPath, err := filepath.Abs(archivePath)
+	if err != nil {
+		return nil, err
+	}
+
+	check := &ManifestCheck{}
+	var metaRoot MerkleRoot
+	var contents MetaContents
+	// entries holds the merkle roots of the content of the archive's blobs.
+	entries := map[MerkleRoot]bool{}
+	for _, name := range fr.List() {
+		key := absPath + "/" + name
+		if name != "meta.far" && cache.Cached(key, info, name) {
+			root, err := DecodeMerkleRoot([]byte(name))
+			if err != nil {
+				return nil, err
+			}
+			entries[root] = true
+			continue
+		}
+		b, err := fr.ReadFile(name)
+		if err != nil {
+			return nil, err
+		}
+		root, err := merkleRootOf(b)
+		if err != nil {
+			return nil, err
+		}
+		if cache != nil {
+			cache.Hashed++
+		}
+		if name == "meta.far" {
+			metaRoot = root
+			if contents, err = metaFarContents(b); err != nil {
+				return nil, fmt.Errorf("meta.far: %w", err)
+			}
+			continue
+		}
+		if root.String() != name {
+			check.Mismatched = append(check.Mismatched, fmt.Sprintf("archive entry %s has content with merkle root %s", name, root))
+		} else {
+			cache.Record(key, info, name)
+		}
+		entries[root] = true
+	}
+	if contents == nil {
+		return nil, fmt.Errorf("%s holds no meta.far", archivePath)
+	}
+
+	// claimed holds the merkle roots of the blobs the manifest or the package
+	// refer to. Other archive entries are extra.
+	claimed := map[MerkleRoot]bool{}
+	listed := map[string]bool{}
+	for _, blob := range manifest.Blobs {
+		claimed[blob.Merkle] = true
+		if blob.Path == "meta/" {
+			if blob.Merkle != metaRoot {
+				check.Mismatched = append(check.Mismatched, fmt.Sprintf("meta/: manifest has %s, archive has %s", blob.Merkle, metaRoot))
+			}
+			continue
+		}
+		listed[blob.Path] = true
+		root, ok := contents[blob.Path]
+		switch {
+		case !ok || !entries[root]:
+			check.Missing = append(check.Missing, fmt.Sprintf("%s (%s)", blob.Path, blob.Merkle))
+		case root != blob.Merkle:
+			check.Mismatched = append(check.Mismatched, fmt.Sprintf("%s: manifest has %s, archive has %s", blob.Path, blob.Merkle, root))
+		}
+	}
+	for p, root := range contents {
+		claimed[root] = true
+		if !listed[p] {
+			check.Extra = append(check.Extra, fmt.Sprintf("%s (%s)", p, root))
+		}
+	}
+	for root := range entries {
+		if !claimed[root] {
+			check.Extra = append(check.Extra, root.String())
+		}
+	}
+
+	sort.Strings(check.Missing)
+	sort.Strings(check.Extra)
+	sort.Strings(check.Mismatched)
+	return check, nil
+}
+
+// metaFarContents returns the meta/contents of the meta.far b.
+func metaFarContents(b []byte) (MetaContents, error) {
+	fr, err := far.NewReader(bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	contents, err := fr.ReadFile("meta/contents")
+	if err != nil {
+		return nil, fmt.Errorf("meta/contents: %w", err)
+	}
+	return ParseMetaContents(bytes.NewReader(contents))
+}
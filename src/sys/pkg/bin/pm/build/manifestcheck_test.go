@@ -0,0 +1,106 @@
+// Copyright 2024 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package build
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestCheckArchiveManifest(t *testing.T) {
+	cfg := TestConfig()
+	defer os.RemoveAll(filepath.Dir(cfg.TempDir))
+	BuildTestPackage(cfg)
+
+	archivePath := filepath.Join(cfg.TempDir, "testpackage")
+	if err := Archive(cfg, archivePath); err != nil {
+		t.Fatal(err)
+	}
+	archivePath += ".far"
+	manifest, err := LoadPackageManifest(filepath.Join(cfg.OutputDir, "package_manifest.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("match", func(t *testing.T) {
+		check, err := CheckArchiveManifest(archivePath, manifest, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !check.OK() {
+			t.Errorf("got %+v, want the archive to match its manifest", check)
+		}
+	})
+
+	t.Run("extra blob", func(t *testing.T) {
+		extra := []byte("not part of the package\n")
+		root, err := merkleRootOf(extra)
+		if err != nil {
+			t.Fatal(err)
+		}
+		entries := readArchive(t, archivePath)
+		entries[root.String()] = extra
+		extraPath := filepath.Join(cfg.TempDir, "extra.far")
+		writeArchive(t, cfg.TempDir, extraPath, entries)
+
+		check, err := CheckArchiveManifest(extraPath, manifest, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := &ManifestCheck{Extra: []string{root.String()}}
+		if diff := cmp.Diff(want, check); diff != "" {
+			t.Errorf("(-want +got):\n%s", diff)
+		}
+	})
+
+	t.Run("cached", func(t *testing.T) {
+		cache, err := LoadMerkleCache(os.DirFS(t.TempDir()), MerkleCacheFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if check, err := CheckArchiveManifest(archivePath, manifest, cache); err != nil || !check.OK() {
+			t.Fatalf("first check: got %+v, %v, want a match", check, err)
+		}
+		first := cache.Hashed
+		if check, err := CheckArchiveManifest(archivePath, manifest, cache); err != nil || !check.OK() {
+			t.Fatalf("second check: got %+v, %v, want a match", check, err)
+		}
+		// Only the meta.far, which is always read, is hashed again.
+		if got := cache.Hashed - first; got != 1 {
+			t.Errorf("second check hashed %d entries, want 1", got)
+		}
+	})
+
+	t.Run("merkle mismatch", func(t *testing.T) {
+		mismatched := *manifest
+		mismatched.Blobs = append([]PackageBlobInfo{}, manifest.Blobs...)
+		var i int
+		for i = range mismatched.Blobs {
+			if mismatched.Blobs[i].Path != "meta/" {
+				break
+			}
+		}
+		archived := mismatched.Blobs[i].Merkle
+		mismatched.Blobs[i].Merkle, err = merkleRootOf([]byte("something else\n"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		check, err := CheckArchiveManifest(archivePath, &mismatched, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if check.OK() || len(check.Missing) != 0 || len(check.Extra) != 0 || len(check.Mismatched) != 1 {
+			t.Fatalf("got %+v, want a single mismatch", check)
+		}
+		if got := check.Mismatched[0]; !strings.HasPrefix(got, mismatched.Blobs[i].Path+":") || !strings.Contains(got, archived.String()) {
+			t.Errorf("got mismatch %q, want it to name %s and the archived merkle root %s", got, mismatched.Blobs[i].Path, archived)
+		}
+	})
+}
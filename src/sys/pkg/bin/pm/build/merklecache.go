@@ -0,0 +1,84 @@
+// Copyright 2024 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package build
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"time"
+)
+
+// MerkleCacheFile is the conventional name of the file a MerkleCache is saved
+// to.
+const MerkleCacheFile = ".merkle-cache.json"
+
+// merkleCacheEntry records the merkle root computed for a key, and the size
+// and modification time the file backing it had when it was hashed.
+type merkleCacheEntry struct {
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mtime"`
+	Merkle  string    `json:"merkle"`
+}
+
+// MerkleCache maps keys, usually the paths of blob files, to the merkle roots
+// computed for them, so that the content of unchanged files needn't be hashed
+// again. An entry is only used while the file backing it keeps the size and
+// modification time it had when it was hashed. A nil *MerkleCache caches
+// nothing.
+type MerkleCache struct {
+	entries map[string]merkleCacheEntry
+	// Hashed counts the merkle roots computed rather than taken from the
+	// cache, for the callers that hash to maintain.
+	Hashed int
+}
+
+// LoadMerkleCache loads the cache saved to name in fsys. A missing or
+// unreadable cache is treated as empty.
+func LoadMerkleCache(fsys fs.FS, name string) (*MerkleCache, error) {
+	c := &MerkleCache{entries: map[string]merkleCacheEntry{}}
+	b, err := fs.ReadFile(fsys, name)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	if err == nil {
+		if err := json.Unmarshal(b, &c.entries); err != nil {
+			c.entries = map[string]merkleCacheEntry{}
+		}
+	}
+	return c, nil
+}
+
+// Marshal returns the cache in the form LoadMerkleCache reads.
+func (c *MerkleCache) Marshal() ([]byte, error) {
+	return json.Marshal(c.entries)
+}
+
+// Cached reports whether the cache holds the merkle root root for key, whose
+// backing file now has the given info.
+func (c *MerkleCache) Cached(key string, info fs.FileInfo, root string) bool {
+	if c == nil {
+		return false
+	}
+	entry, ok := c.entries[key]
+	if !ok || entry.Merkle != root {
+		return false
+	}
+	if info.Size() != entry.Size || !info.ModTime().Equal(entry.ModTime) {
+		delete(c.entries, key)
+		return false
+	}
+	return true
+}
+
+// Record caches the merkle root computed for key, whose backing file had the
+// given info when it was read. It's only to be called for content that
+// matches root.
+func (c *MerkleCache) Record(key string, info fs.FileInfo, root string) {
+	if c == nil {
+		return
+	}
+	c.entries[key] = merkleCacheEntry{Size: info.Size(), ModTime: info.ModTime(), Merkle: root}
+}
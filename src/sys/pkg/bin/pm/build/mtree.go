@@ -0,0 +1,109 @@
+// Copyright 2024 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package build
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"go.fuchsia.dev/fuchsia/src/sys/pkg/lib/far/go"
+)
+
+// MtreeEntry is a line of the listing of an archive written by WriteMtree.
+type MtreeEntry struct {
+	Path   string
+	Size   uint64
+	Merkle MerkleRoot
+}
+
+// MtreeArchive lists the entries of the archive at path, sorted by path. The
+// blobs of a package archive are listed by their paths in the package, and
+// its meta.far as "meta/", so that the listings of two versions of a package
+// differ only in the paths whose content changed, and meta/. Other entries
+// are listed by name.
+func MtreeArchive(path string) ([]MtreeEntry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	r, err := far.NewReader(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s is not a valid archive: %w", path, err)
+	}
+
+	entries := map[string]MtreeEntry{}
+	for _, name := range r.List() {
+		b, err := r.ReadFile(name)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s: %w", path, name, err)
+		}
+		root, err := merkleRootOf(b)
+		if err != nil {
+			return nil, err
+		}
+		entries[name] = MtreeEntry{Path: name, Size: uint64(len(b)), Merkle: root}
+	}
+
+	// List the blobs of a package archive by their paths in the package.
+	if meta, ok := entries["meta.far"]; ok {
+		b, err := r.ReadFile("meta.far")
+		if err != nil {
+			return nil, err
+		}
+		if contents, err := metaFarContents(b); err == nil {
+			delete(entries, "meta.far")
+			meta.Path = "meta/"
+			entries[meta.Path] = meta
+			for p, root := range contents {
+				blob, ok := entries[root.String()]
+				if !ok {
+					return nil, fmt.Errorf("%s lacks the blob %s of %s", path, root, p)
+				}
+				entries[p] = MtreeEntry{Path: p, Size: blob.Size, Merkle: root}
+			}
+			for _, root := range contents {
+				delete(entries, root.String())
+			}
+		}
+	}
+
+	out := make([]MtreeEntry, 0, len(entries))
+	for _, e := range entries {
+		out = append(out, e)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Path < out[j].Path })
+	return out, nil
+}
+
+// WriteMtree writes entries to w in the style of an mtree(5) specification,
+// one line per entry, with the characters of paths that aren't printable or
+// are spaces or backslashes escaped in octal.
+func WriteMtree(w io.Writer, entries []MtreeEntry) error {
+	if _, err := fmt.Fprintln(w, "#mtree"); err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if _, err := fmt.Fprintf(w, "%s size=%d merkle=%s\n", mtreeEscape(e.Path), e.Size, e.Merkle); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func mtreeEscape(path string) string {
+	var b strings.Builder
+	for _, c := range []byte(path) {
+		if c <= ' ' || c == '\\' || c >= 0x7f {
+			fmt.Fprintf(&b, "\\%03o", c)
+		} else {
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,84 @@
+// Copyright 2024 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package build
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sort"
+)
+
+// NormalizePackageManifest validates the package manifest b and returns its
+// canonical form: blobs sorted by their path in the package, subpackages
+// sorted by name, source paths cleaned, and the JSON indented as pm writes
+// it. Manifests that differ only in those respects normalize to the same
+// bytes, and normalizing a canonical manifest leaves it as it is. Fields pm
+// doesn't know are dropped.
+func NormalizePackageManifest(b []byte) ([]byte, error) {
+	var m packageManifestMaybeRelative
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, err
+	}
+
+	if m.Version != "1" {
+		return nil, fmt.Errorf("unknown version %q", m.Version)
+	}
+	if m.PathsRelativeTo != "" && m.PathsRelativeTo != "file" {
+		return nil, fmt.Errorf("unknown blob_sources_relative %q", m.PathsRelativeTo)
+	}
+	if err := ValidatePackageName(m.Package.Name); err != nil {
+		return nil, err
+	}
+	if err := ValidatePackageVersion(m.Package.Version); err != nil {
+		return nil, err
+	}
+
+	paths := map[string]struct{}{}
+	for i := range m.Blobs {
+		blob := &m.Blobs[i]
+		if blob.Path == "" || blob.SourcePath == "" {
+			return nil, fmt.Errorf("blob %d has no path or no source path", i)
+		}
+		if _, ok := paths[blob.Path]; ok {
+			return nil, fmt.Errorf("more than one blob has path %s", blob.Path)
+		}
+		paths[blob.Path] = struct{}{}
+		blob.SourcePath = filepath.ToSlash(filepath.Clean(blob.SourcePath))
+	}
+	sort.Slice(m.Blobs, func(i, j int) bool { return m.Blobs[i].Path < m.Blobs[j].Path })
+
+	names := map[string]struct{}{}
+	for i := range m.Subpackages {
+		subpackage := &m.Subpackages[i]
+		if subpackage.Name == "" || subpackage.ManifestPath == "" {
+			return nil, fmt.Errorf("subpackage %d has no name or no manifest path", i)
+		}
+		if _, ok := names[subpackage.Name]; ok {
+			return nil, fmt.Errorf("more than one subpackage is named %s", subpackage.Name)
+		}
+		names[subpackage.Name] = struct{}{}
+		subpackage.ManifestPath = filepath.ToSlash(filepath.Clean(subpackage.ManifestPath))
+	}
+	sort.Slice(m.Subpackages, func(i, j int) bool { return m.Subpackages[i].Name < m.Subpackages[j].Name })
+
+	// Only file-relative manifests name how their paths are relative, as
+	// the manifests pm builds don't.
+	var out interface{} = &m
+	if m.PathsRelativeTo == "" {
+		out = &PackageManifest{
+			Version:     m.Version,
+			Repository:  m.Repository,
+			Package:     m.Package,
+			Blobs:       m.Blobs,
+			Subpackages: m.Subpackages,
+		}
+	}
+	content, err := json.MarshalIndent(out, "", "    ")
+	if err != nil {
+		return nil, err
+	}
+	return append(content, '\n'), nil
+}
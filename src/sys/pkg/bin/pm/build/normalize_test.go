@@ -0,0 +1,124 @@
+// Copyright 2024 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package build
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+const (
+	normalizeMerkleA = "0000000000000000000000000000000000000000000000000000000000000001"
+	normalizeMerkleB = "0000000000000000000000000000000000000000000000000000000000000002"
+	normalizeMerkleC = "0000000000000000000000000000000000000000000000000000000000000003"
+)
+
+func TestNormalizePackageManifest(t *testing.T) {
+	manifest := `{"version": "1", "package": {"name": "pkg", "version": "0"},
+		"blobs": [
+			{"source_path": "out/meta.far", "path": "meta/", "merkle": "` + normalizeMerkleA + `", "size": 1},
+			{"source_path": "src/./b/../b", "path": "data/b", "merkle": "` + normalizeMerkleB + `", "size": 2},
+			{"source_path": "src//a", "path": "bin/a", "merkle": "` + normalizeMerkleC + `", "size": 3}
+		],
+		"subpackages": [
+			{"name": "two", "merkle": "` + normalizeMerkleB + `", "manifest_path": "out/two/../two/package_manifest.json"},
+			{"name": "one", "merkle": "` + normalizeMerkleA + `", "manifest_path": "out/one/package_manifest.json"}
+		]}`
+	// The same manifest, in another order and with other spellings of its
+	// paths.
+	reordered := `{
+  "blobs": [
+    {"path": "bin/a", "merkle": "` + normalizeMerkleC + `", "size": 3, "source_path": "src/a"},
+    {"path": "meta/", "merkle": "` + normalizeMerkleA + `", "size": 1, "source_path": "./out/meta.far"},
+    {"path": "data/b", "merkle": "` + normalizeMerkleB + `", "size": 2, "source_path": "src/b"}
+  ],
+  "subpackages": [
+    {"name": "one", "merkle": "` + normalizeMerkleA + `", "manifest_path": "out/one/package_manifest.json"},
+    {"name": "two", "merkle": "` + normalizeMerkleB + `", "manifest_path": "out/two/package_manifest.json"}
+  ],
+  "package": {"version": "0", "name": "pkg"},
+  "version": "1"
+}`
+
+	got, err := NormalizePackageManifest([]byte(manifest))
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := NormalizePackageManifest(got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(string(got), string(again)); diff != "" {
+		t.Errorf("normalizing twice changed the manifest (-once +twice):\n%s", diff)
+	}
+	other, err := NormalizePackageManifest([]byte(reordered))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(string(got), string(other)); diff != "" {
+		t.Errorf("equivalent manifests normalized differently (-first +reordered):\n%s", diff)
+	}
+
+	var normalized PackageManifest
+	if err := json.Unmarshal(got, &normalized); err != nil {
+		t.Fatal(err)
+	}
+	var paths, sources, names []string
+	for _, blob := range normalized.Blobs {
+		paths = append(paths, blob.Path)
+		sources = append(sources, blob.SourcePath)
+	}
+	for _, subpackage := range normalized.Subpackages {
+		names = append(names, subpackage.Name)
+	}
+	if diff := cmp.Diff([]string{"bin/a", "data/b", "meta/"}, paths); diff != "" {
+		t.Errorf("blob paths (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]string{"src/a", "src/b", "out/meta.far"}, sources); diff != "" {
+		t.Errorf("blob source paths (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]string{"one", "two"}, names); diff != "" {
+		t.Errorf("subpackage names (-want +got):\n%s", diff)
+	}
+	if strings.Contains(string(got), "blob_sources_relative") {
+		t.Errorf("got blob_sources_relative in a manifest that had none:\n%s", got)
+	}
+
+	relative := strings.Replace(manifest, `"version": "1",`, `"version": "1", "blob_sources_relative": "file",`, 1)
+	got, err = NormalizePackageManifest([]byte(relative))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(got), `"blob_sources_relative": "file"`) {
+		t.Errorf("file-relative manifest lost blob_sources_relative:\n%s", got)
+	}
+}
+
+func TestNormalizePackageManifestInvalid(t *testing.T) {
+	blob := `{"source_path": "a", "path": "a", "merkle": "` + normalizeMerkleA + `", "size": 1}`
+	for _, tc := range []struct {
+		name, manifest, want string
+	}{
+		{"version", `{"version": "2", "package": {"name": "pkg", "version": "0"}, "blobs": []}`, `unknown version "2"`},
+		{"name", `{"version": "1", "package": {"name": "Pkg", "version": "0"}, "blobs": []}`, "Pkg"},
+		{"relative", `{"version": "1", "blob_sources_relative": "dir", "package": {"name": "pkg", "version": "0"}, "blobs": []}`, "blob_sources_relative"},
+		{"duplicate", `{"version": "1", "package": {"name": "pkg", "version": "0"}, "blobs": [` + blob + `, ` + blob + `]}`, "more than one blob has path a"},
+		{"no source", `{"version": "1", "package": {"name": "pkg", "version": "0"}, "blobs": [{"path": "a", "merkle": "` + normalizeMerkleA + `"}]}`, "no source path"},
+		{"merkle", `{"version": "1", "package": {"name": "pkg", "version": "0"}, "blobs": [{"source_path": "a", "path": "a", "merkle": "x"}]}`, ""},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := NormalizePackageManifest([]byte(tc.manifest))
+			if err == nil {
+				t.Fatal("got nil error")
+			}
+			if !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("got %q, want it to contain %q", err, tc.want)
+			}
+		})
+	}
+}
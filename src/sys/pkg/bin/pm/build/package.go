@@ -6,6 +6,7 @@ package build
 
 import (
 	"bufio"
+	"context"
 	"encoding/binary"
 	"encoding/json"
 	"fmt"
@@ -150,6 +151,10 @@ func Init(cfg *Config) error {
 // Update walks the contents of the package and updates the merkle root values
 // within the contents file.
 func Update(cfg *Config) error {
+	if err := cfg.CheckOutputDir(); err != nil {
+		return err
+	}
+
 	metadir := filepath.Join(cfg.OutputDir, "meta")
 	os.MkdirAll(metadir, os.ModePerm)
 	manifest, err := cfg.Manifest()
@@ -228,6 +233,7 @@ func Update(cfg *Config) error {
 	go func() {
 		for entry := range contentCollector {
 			contents[entry.path] = entry.root
+			cfg.Progress.Report(ProgressEvent{Phase: "hash", Item: entry.path, Current: len(contents), Total: len(pkgContents)})
 		}
 		close(done)
 	}()
@@ -390,6 +396,55 @@ func Seal(cfg *Config) (string, error) {
 	return cfg.MetaFAR(), archive.Close()
 }
 
+// BuildPackage updates the package's meta/contents, seals its metadata into
+// meta.far, and returns the manifest of the built package. It only writes to
+// the output directory and prints nothing, so that other tools can build
+// packages without going through the pm command line.
+func BuildPackage(ctx context.Context, cfg *Config) (*PackageManifest, error) {
+	if err := Update(cfg); err != nil {
+		return nil, fmt.Errorf("failed to update the merkle roots: %w", err)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return SealPackage(ctx, cfg)
+}
+
+// SealPackage seals the package's metadata into meta.far, like Seal, and
+// returns the manifest of the sealed package.
+func SealPackage(ctx context.Context, cfg *Config) (*PackageManifest, error) {
+	if _, err := Seal(cfg); err != nil {
+		return nil, fmt.Errorf("failed to seal the package: %w", err)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	manifest, err := cfg.OutputManifest()
+	if err != nil {
+		return nil, err
+	}
+	cfg.Progress.Report(ProgressEvent{Phase: "build", Current: len(manifest.Blobs), Total: len(manifest.Blobs), Done: true})
+	return manifest, nil
+}
+
+// ContentAddressMetaFar moves the meta.far of the package built with cfg to
+// the output directory under its merkle root, for content-addressed storage,
+// and points the meta/ blob of manifest at it. It returns the new path.
+func ContentAddressMetaFar(cfg *Config, manifest *PackageManifest) (string, error) {
+	for i, blob := range manifest.Blobs {
+		if blob.Path != "meta/" {
+			continue
+		}
+		path := filepath.Join(cfg.OutputDir, blob.Merkle.String())
+		if err := os.Rename(blob.SourcePath, path); err != nil {
+			return "", err
+		}
+		manifest.Blobs[i].SourcePath = path
+		return path, nil
+	}
+	return "", fmt.Errorf("the package %s has no meta.far", manifest.Package.Name)
+}
+
 // Read the build-time subpackage data and output files and generate the
 // "subpackages" meta file
 func writeSubpackagesMeta(cfg *Config, subpackagesPath string) error {
@@ -6,6 +6,7 @@ package build
 
 import (
 	"bytes"
+	"context"
 	"crypto/rand"
 	"encoding/binary"
 	"encoding/json"
@@ -529,3 +530,74 @@ func TestSealValidatesInvalidPackageRepository(t *testing.T) {
 		t.Fatalf("Expected invalid package repository to generate error.")
 	}
 }
+
+func TestBuildPackage(t *testing.T) {
+	cfg := TestConfig()
+	defer os.RemoveAll(filepath.Dir(cfg.TempDir))
+	TestPackage(cfg)
+
+	manifest, err := BuildPackage(context.Background(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Inspect the meta.far independently of the build.
+	b, err := os.ReadFile(cfg.MetaFAR())
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := far.NewReader(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var p pkg.Package
+	pkgJSON, err := r.ReadFile("meta/package")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(pkgJSON, &p); err != nil {
+		t.Fatal(err)
+	}
+	contents, err := r.ReadFile("meta/contents")
+	if err != nil {
+		t.Fatal(err)
+	}
+	metaContents, err := ParseMetaContents(bytes.NewReader(contents))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tree merkle.Tree
+	if _, err := tree.ReadFrom(bytes.NewReader(b)); err != nil {
+		t.Fatal(err)
+	}
+
+	if diff := cmp.Diff(p, manifest.Package); diff != "" {
+		t.Errorf("package (-far +manifest):\n%s", diff)
+	}
+	want := map[string]MerkleRoot{"meta/": MustDecodeMerkleRoot(fmt.Sprintf("%x", tree.Root()))}
+	for path, root := range metaContents {
+		want[path] = root
+	}
+	got := map[string]MerkleRoot{}
+	for _, blob := range manifest.Blobs {
+		got[blob.Path] = blob.Merkle
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("blobs (-far +manifest):\n%s", diff)
+	}
+	if manifest.Blobs[0].Path != "meta/" || manifest.Blobs[0].SourcePath != cfg.MetaFAR() {
+		t.Errorf("got first blob %+v, want the meta.far at %s", manifest.Blobs[0], cfg.MetaFAR())
+	}
+}
+
+func TestBuildPackageCanceled(t *testing.T) {
+	cfg := TestConfig()
+	defer os.RemoveAll(filepath.Dir(cfg.TempDir))
+	TestPackage(cfg)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := BuildPackage(ctx, cfg); !errors.Is(err, context.Canceled) {
+		t.Errorf("got %v, want %v", err, context.Canceled)
+	}
+}
@@ -0,0 +1,131 @@
+// Copyright 2024 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package build
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// PinnedPackage is a package of a package set, pinned to the merkle root of
+// its meta.far.
+type PinnedPackage struct {
+	Name    string     `json:"name"`
+	Version string     `json:"version"`
+	Merkle  MerkleRoot `json:"merkle"`
+}
+
+func (p PinnedPackage) String() string {
+	return fmt.Sprintf("%s/%s %s", p.Name, p.Version, p.Merkle)
+}
+
+// PackageSet is a set of pinned packages, sorted by name and version.
+type PackageSet []PinnedPackage
+
+// add adds p to s, unless s already holds it. A package can't be pinned to
+// two merkle roots.
+func (s *PackageSet) add(p PinnedPackage) error {
+	for _, q := range *s {
+		if q.Name != p.Name || q.Version != p.Version {
+			continue
+		}
+		if q.Merkle != p.Merkle {
+			return fmt.Errorf("package %s/%s is pinned to both %s and %s", p.Name, p.Version, q.Merkle, p.Merkle)
+		}
+		return nil
+	}
+	*s = append(*s, p)
+	return nil
+}
+
+func (s PackageSet) sort() {
+	sort.Slice(s, func(i, j int) bool {
+		if s[i].Name != s[j].Name {
+			return s[i].Name < s[j].Name
+		}
+		return s[i].Version < s[j].Version
+	})
+}
+
+// PackageSetFromManifests pins the packages whose package manifests, as
+// written by `pm build -output-package-manifest`, are the .json files in dir.
+func PackageSetFromManifests(dir string) (PackageSet, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("%s holds no package manifests", dir)
+	}
+	s := PackageSet{}
+	for _, path := range paths {
+		m, err := LoadPackageManifest(path)
+		if err != nil {
+			return nil, err
+		}
+		p := PinnedPackage{Name: m.Package.Name, Version: m.Package.Version}
+		found := false
+		for _, blob := range m.Blobs {
+			if blob.Path == "meta/" {
+				p.Merkle = blob.Merkle
+				found = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("%s lists no meta.far", path)
+		}
+		if err := s.add(p); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	s.sort()
+	return s, nil
+}
+
+// PackageSetFromTargets pins the packages listed by the TUF targets.json of a
+// repository at path. Targets without a merkle root in their custom metadata
+// aren't packages, and are skipped.
+func PackageSetFromTargets(path string) (PackageSet, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var metadata struct {
+		Signed struct {
+			Targets map[string]struct {
+				Custom struct {
+					Merkle string `json:"merkle"`
+				} `json:"custom"`
+			} `json:"targets"`
+		} `json:"signed"`
+	}
+	if err := json.Unmarshal(b, &metadata); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	s := PackageSet{}
+	for name, target := range metadata.Signed.Targets {
+		if target.Custom.Merkle == "" {
+			continue
+		}
+		root, err := DecodeMerkleRoot([]byte(target.Custom.Merkle))
+		if err != nil {
+			return nil, fmt.Errorf("%s: target %s: %w", path, name, err)
+		}
+		i := strings.LastIndex(name, "/")
+		if i < 0 {
+			return nil, fmt.Errorf("%s: target %s isn't named name/version", path, name)
+		}
+		if err := s.add(PinnedPackage{Name: strings.TrimPrefix(name[:i], "/"), Version: name[i+1:], Merkle: root}); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	s.sort()
+	return s, nil
+}
@@ -0,0 +1,85 @@
+// Copyright 2024 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package build
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// PackageTarBlobsDir is the directory of the archive written by
+// WritePackageTar that holds the package's blobs.
+const PackageTarBlobsDir = "blobs"
+
+// WritePackageTar writes the build outputs in outputDir, and blobs, named by
+// their merkle roots under blobs/, to w as a tar archive. The entries are sorted by name, and their headers record
+// nothing but their names and sizes, so that the archive only depends on the
+// package.
+func WritePackageTar(w io.Writer, outputDir string, blobs []PackageBlobInfo) error {
+	files := map[string]string{}
+	if err := filepath.WalkDir(outputDir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return err
+		}
+		rel, err := filepath.Rel(outputDir, p)
+		if err != nil {
+			return err
+		}
+		files[filepath.ToSlash(rel)] = p
+		return nil
+	}); err != nil {
+		return err
+	}
+	for _, blob := range blobs {
+		files[path.Join(PackageTarBlobsDir, blob.Merkle.String())] = blob.SourcePath
+	}
+
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	tw := tar.NewWriter(w)
+	for _, name := range names {
+		if err := writeTarFile(tw, name, files[name]); err != nil {
+			return err
+		}
+	}
+	return tw.Close()
+}
+
+// writeTarFile writes the file at p to tw as name.
+func writeTarFile(tw *tar.Writer, name, p string) error {
+	f, err := os.Open(p)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if err := tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Mode:     0o644,
+		Size:     info.Size(),
+		ModTime:  time.Unix(0, 0),
+	}); err != nil {
+		return err
+	}
+	if _, err := io.Copy(tw, f); err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	return nil
+}
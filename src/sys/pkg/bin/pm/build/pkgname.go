@@ -0,0 +1,67 @@
+// Copyright 2024 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package build
+
+import (
+	"errors"
+	"fmt"
+
+	"go.fuchsia.dev/fuchsia/src/sys/pkg/bin/pm/pkg"
+)
+
+// The errors ValidatePackageName and ValidatePackageVersion report.
+var (
+	ErrPackageNameEmpty          = errors.New("package name is empty")
+	ErrPackageNameTooLong        = errors.New("package name is too long")
+	ErrPackageNameInvalidChar    = errors.New("package name may only contain lowercase letters, digits, '-', '_' and '.'")
+	ErrPackageNameDots           = errors.New("package name may not be \".\" or \"..\"")
+	ErrPackageVersionEmpty       = errors.New("package version is empty")
+	ErrPackageVersionTooLong     = errors.New("package version is too long")
+	ErrPackageVersionInvalidChar = errors.New("package version may only contain lowercase letters, digits, '-', '_' and '.'")
+	ErrPackageVersionDots        = errors.New("package version may not be \".\" or \"..\"")
+)
+
+// packageIDErrors are the errors reported for one kind of package identifier,
+// a name or a version.
+type packageIDErrors struct {
+	empty, tooLong, invalidChar, dots error
+}
+
+var (
+	packageNameErrors    = packageIDErrors{ErrPackageNameEmpty, ErrPackageNameTooLong, ErrPackageNameInvalidChar, ErrPackageNameDots}
+	packageVersionErrors = packageIDErrors{ErrPackageVersionEmpty, ErrPackageVersionTooLong, ErrPackageVersionInvalidChar, ErrPackageVersionDots}
+)
+
+// ValidatePackageName checks that name is a valid package name, by the rules
+// pkg.Package.Validate applies, and that it isn't "." or "..".
+func ValidatePackageName(name string) error {
+	return validatePackageID(name, packageNameErrors)
+}
+
+// ValidatePackageVersion checks that version is a valid package version, which
+// follows the same rules as package names.
+func ValidatePackageVersion(version string) error {
+	return validatePackageID(version, packageVersionErrors)
+}
+
+// validatePackageID checks id as a package name with pkg.Package.Validate,
+// reporting its failures as the matching errors of errs.
+func validatePackageID(id string, errs packageIDErrors) error {
+	if id == "." || id == ".." {
+		return errs.dots
+	}
+	p := pkg.Package{Name: id, Version: "0"}
+	err := p.Validate()
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, pkg.ErrNameEmpty):
+		return errs.empty
+	case errors.Is(err, pkg.ErrNameTooLong):
+		return fmt.Errorf("%w: %w", errs.tooLong, err)
+	default:
+		return fmt.Errorf("%w: %q: %w", errs.invalidChar, id, err)
+	}
+}
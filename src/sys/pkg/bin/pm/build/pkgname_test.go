@@ -0,0 +1,81 @@
+// Copyright 2024 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package build
+
+import (
+	"errors"
+	"flag"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestValidatePackageName(t *testing.T) {
+	for _, name := range []string{
+		"a",
+		"system_image",
+		"fuchsia.example-2",
+		"..hidden",
+		strings.Repeat("x", 255),
+	} {
+		if err := ValidatePackageName(name); err != nil {
+			t.Errorf("ValidatePackageName(%q) = %v, want nil", name, err)
+		}
+	}
+	for _, tc := range []struct {
+		name string
+		want error
+	}{
+		{"", ErrPackageNameEmpty},
+		{strings.Repeat("x", 256), ErrPackageNameTooLong},
+		{"Upper", ErrPackageNameInvalidChar},
+		{"with space", ErrPackageNameInvalidChar},
+		{"slash/name", ErrPackageNameInvalidChar},
+		{"café", ErrPackageNameInvalidChar},
+		{".", ErrPackageNameDots},
+		{"..", ErrPackageNameDots},
+	} {
+		if err := ValidatePackageName(tc.name); !errors.Is(err, tc.want) {
+			t.Errorf("ValidatePackageName(%q) = %v, want %v", tc.name, err, tc.want)
+		}
+	}
+}
+
+func TestValidatePackageVersion(t *testing.T) {
+	for _, version := range []string{"0", "1.2.3", "beta-1"} {
+		if err := ValidatePackageVersion(version); err != nil {
+			t.Errorf("ValidatePackageVersion(%q) = %v, want nil", version, err)
+		}
+	}
+	for _, tc := range []struct {
+		version string
+		want    error
+	}{
+		{"", ErrPackageVersionEmpty},
+		{strings.Repeat("1", 256), ErrPackageVersionTooLong},
+		{"1+build", ErrPackageVersionInvalidChar},
+		{"..", ErrPackageVersionDots},
+	} {
+		if err := ValidatePackageVersion(tc.version); !errors.Is(err, tc.want) {
+			t.Errorf("ValidatePackageVersion(%q) = %v, want %v", tc.version, err, tc.want)
+		}
+	}
+}
+
+func TestPackageNameFlag(t *testing.T) {
+	cfg := NewConfig()
+	fs := flag.NewFlagSet("pm", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	cfg.InitFlags(fs)
+	if err := fs.Parse([]string{"-n", "Bad Name"}); err == nil || !strings.Contains(err.Error(), ErrPackageNameInvalidChar.Error()) {
+		t.Errorf("got %v, want an invalid package name error", err)
+	}
+	if err := fs.Parse([]string{"-n", "good-name"}); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.PkgName != "good-name" {
+		t.Errorf("got package name %q, want good-name", cfg.PkgName)
+	}
+}
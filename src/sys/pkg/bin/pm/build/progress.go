@@ -0,0 +1,47 @@
+// Copyright 2024 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package build
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+)
+
+// ProgressEvent reports how far a phase of a long-running operation has got.
+type ProgressEvent struct {
+	// Phase names the work being done, such as "hash" or "publish".
+	Phase string `json:"phase"`
+	// Item names what the phase is working on, if it works on several
+	// things in turn.
+	Item string `json:"item,omitempty"`
+	// Current is the number of units of work done so far, out of Total.
+	Current int `json:"current"`
+	Total   int `json:"total"`
+	// Done is set on the last event of an operation.
+	Done bool `json:"done,omitempty"`
+}
+
+// Progress receives ProgressEvents. A nil Progress discards them.
+type Progress func(ProgressEvent)
+
+// Report passes e to p, if p is set.
+func (p Progress) Report(e ProgressEvent) {
+	if p != nil {
+		p(e)
+	}
+}
+
+// JSONProgress returns a Progress that writes each event to w as a line of
+// JSON, for tools that drive pm as a subprocess.
+func JSONProgress(w io.Writer) Progress {
+	var mu sync.Mutex
+	enc := json.NewEncoder(w)
+	return func(e ProgressEvent) {
+		mu.Lock()
+		defer mu.Unlock()
+		enc.Encode(e)
+	}
+}
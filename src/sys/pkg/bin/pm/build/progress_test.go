@@ -0,0 +1,57 @@
+// Copyright 2024 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package build
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestJSONProgress(t *testing.T) {
+	cfg := TestConfig()
+	defer os.RemoveAll(filepath.Dir(cfg.TempDir))
+	TestPackage(cfg)
+
+	var buf bytes.Buffer
+	cfg.Progress = JSONProgress(&buf)
+	manifest, err := BuildPackage(context.Background(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var events []ProgressEvent
+	scanner := bufio.NewScanner(&buf)
+	for scanner.Scan() {
+		var e ProgressEvent
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			t.Fatalf("event %q: %v", scanner.Text(), err)
+		}
+		events = append(events, e)
+	}
+	if len(events) < 3 {
+		t.Fatalf("got %d events, want an event per hashed blob and a completion event", len(events))
+	}
+
+	hashed := 0
+	for _, e := range events[:len(events)-1] {
+		if e.Phase != "hash" || e.Done {
+			t.Fatalf("got event %+v before the completion event, want a hash event", e)
+		}
+		hashed++
+		if e.Current != hashed || e.Total != len(events)-1 || e.Item == "" {
+			t.Errorf("got event %+v, want blob %d of %d", e, hashed, len(events)-1)
+		}
+	}
+
+	last := events[len(events)-1]
+	if !last.Done || last.Current != len(manifest.Blobs) || last.Total != len(manifest.Blobs) {
+		t.Errorf("got final event %+v, want completion of %d blobs", last, len(manifest.Blobs))
+	}
+}
@@ -0,0 +1,150 @@
+// Copyright 2024 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package build
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"go.fuchsia.dev/fuchsia/src/sys/pkg/bin/pm/pkg"
+	"go.fuchsia.dev/fuchsia/src/sys/pkg/lib/far/go"
+)
+
+// SetArchiveMeta rewrites the package archive at inPath, as written by
+// Archive, to outPath with the name and version of its meta/package replaced.
+// An empty name or version is left as it was. Only the meta.far changes, and
+// so its merkle root; the blobs keep their content and merkle roots. The
+// merkle root of the new meta.far is returned.
+//
+// A meta.far with an embedded signature is refused, since the signature
+// covers meta/package and would no longer verify.
+func SetArchiveMeta(inPath, outPath, name, version string) (MerkleRoot, error) {
+	var root MerkleRoot
+	if name != "" {
+		if err := ValidatePackageName(name); err != nil {
+			return root, err
+		}
+	}
+	if version != "" {
+		if err := ValidatePackageVersion(version); err != nil {
+			return root, err
+		}
+	}
+
+	in, err := os.Open(inPath)
+	if err != nil {
+		return root, err
+	}
+	defer in.Close()
+	r, err := far.NewReader(in)
+	if err != nil {
+		return root, fmt.Errorf("%s is not a valid archive: %w", inPath, err)
+	}
+	metaFar, err := r.ReadFile("meta.far")
+	if err != nil {
+		return root, fmt.Errorf("%s holds no meta.far: %w", inPath, err)
+	}
+
+	staging, err := os.MkdirTemp(filepath.Dir(outPath), ".set-meta-*")
+	if err != nil {
+		return root, err
+	}
+	defer os.RemoveAll(staging)
+
+	metaFar, err = setMetaPackage(metaFar, filepath.Join(staging, "meta"), name, version)
+	if err != nil {
+		return root, fmt.Errorf("%s: meta.far: %w", inPath, err)
+	}
+	if root, err = merkleRootOf(metaFar); err != nil {
+		return root, err
+	}
+
+	// Entry names may not be safe paths, so stage entries by index.
+	inputs := map[string]string{}
+	for i, entry := range r.List() {
+		b := metaFar
+		if entry != "meta.far" {
+			if b, err = r.ReadFile(entry); err != nil {
+				return root, fmt.Errorf("%s: %s: %w", inPath, entry, err)
+			}
+		}
+		src := filepath.Join(staging, fmt.Sprint(i))
+		if err := os.WriteFile(src, b, 0o644); err != nil {
+			return root, err
+		}
+		inputs[entry] = src
+	}
+
+	tmp := filepath.Join(staging, "out.far")
+	out, err := os.Create(tmp)
+	if err != nil {
+		return root, err
+	}
+	if err := far.Write(out, inputs); err != nil {
+		out.Close()
+		return root, err
+	}
+	if err := out.Close(); err != nil {
+		return root, err
+	}
+	return root, os.Rename(tmp, outPath)
+}
+
+// setMetaPackage returns the meta.far b with the name and version of its
+// meta/package replaced, leaving an empty name or version as it was. Its
+// entries are staged in the new directory staging.
+func setMetaPackage(b []byte, staging, name, version string) ([]byte, error) {
+	r, err := far.NewReader(bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Mkdir(staging, 0o755); err != nil {
+		return nil, err
+	}
+	var p pkg.Package
+	inputs := map[string]string{}
+	for i, entry := range r.List() {
+		if entry == SignatureFile {
+			return nil, fmt.Errorf("it is signed, and its %s would not verify with a new meta/package", SignatureFile)
+		}
+		b, err := r.ReadFile(entry)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", entry, err)
+		}
+		if entry == "meta/package" {
+			if err := json.Unmarshal(b, &p); err != nil {
+				return nil, fmt.Errorf("meta/package: %w", err)
+			}
+			if name != "" {
+				p.Name = name
+			}
+			if version != "" {
+				p.Version = version
+			}
+			// Written as Init writes it, with a trailing newline.
+			if b, err = json.Marshal(p); err != nil {
+				return nil, err
+			}
+			b = append(b, '\n')
+		}
+		src := filepath.Join(staging, fmt.Sprint(i))
+		if err := os.WriteFile(src, b, 0o644); err != nil {
+			return nil, err
+		}
+		inputs[entry] = src
+	}
+	if p.Name == "" {
+		return nil, fmt.Errorf("it holds no meta/package")
+	}
+
+	var buf bytes.Buffer
+	if err := far.Write(&buf, inputs); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,126 @@
+// Copyright 2024 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package build
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"sort"
+
+	"go.fuchsia.dev/fuchsia/src/sys/pkg/lib/far/go"
+	"go.fuchsia.dev/fuchsia/src/sys/pkg/lib/merkle"
+)
+
+const (
+	// SignatureFile is the archive entry holding an embedded ed25519
+	// signature over the archive's signing message.
+	SignatureFile = "meta/signature"
+	// PubkeyFile is the archive entry recording the ed25519 public key the
+	// archive was signed with.
+	PubkeyFile = "meta/pubkey"
+)
+
+// SignatureCheck describes the key and signature checked by
+// VerifyArchiveSignature.
+type SignatureCheck struct {
+	// Key is the public key the signature was checked against.
+	Key ed25519.PublicKey
+	// KeySource is the path of the key file, or PubkeyFile if the key was
+	// recorded in the archive.
+	KeySource string
+	// SignatureSource is the path of the detached signature, or SignatureFile
+	// if the signature was embedded in the archive.
+	SignatureSource string
+}
+
+func (c SignatureCheck) String() string {
+	return fmt.Sprintf("signature %s with key %s (%s)", c.SignatureSource, hex.EncodeToString(c.Key), c.KeySource)
+}
+
+// ArchiveSigningMessage returns the message covered by an embedded signature:
+// a "path=merkle" line for every entry of the archive other than
+// SignatureFile, sorted by path.
+func ArchiveSigningMessage(r *far.Reader) ([]byte, error) {
+	paths := r.List()
+	sort.Strings(paths)
+
+	var buf bytes.Buffer
+	for _, path := range paths {
+		if path == SignatureFile {
+			continue
+		}
+		b, err := r.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		var tree merkle.Tree
+		if _, err := tree.ReadFrom(bytes.NewReader(b)); err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(&buf, "%s=%x\n", path, tree.Root())
+	}
+	return buf.Bytes(), nil
+}
+
+// VerifyArchiveSignature checks the signature of the archive at archivePath.
+//
+// If signaturePath is set, it holds a detached signature over the bytes of the
+// whole archive; otherwise the signature is read from the archive's
+// SignatureFile and covers its ArchiveSigningMessage. If keyPath is set, it
+// holds the public key to check against; otherwise the key recorded in the
+// archive's PubkeyFile is used, which anyone who can rewrite the archive can
+// replace, so callers must treat such a check as untrusted. The returned
+// SignatureCheck says which key and signature were checked, even if
+// verification failed.
+func VerifyArchiveSignature(archivePath, keyPath, signaturePath string) (SignatureCheck, error) {
+	check := SignatureCheck{KeySource: keyPath, SignatureSource: signaturePath}
+
+	archive, err := os.ReadFile(archivePath)
+	if err != nil {
+		return check, err
+	}
+	r, err := far.NewReader(bytes.NewReader(archive))
+	if err != nil {
+		return check, fmt.Errorf("build: %s is not a valid archive: %w", archivePath, err)
+	}
+
+	var key []byte
+	if keyPath != "" {
+		key, err = os.ReadFile(keyPath)
+	} else {
+		check.KeySource = PubkeyFile
+		key, err = r.ReadFile(PubkeyFile)
+	}
+	if err != nil {
+		return check, fmt.Errorf("build: reading public key %s: %w", check.KeySource, err)
+	}
+	if len(key) != ed25519.PublicKeySize {
+		return check, fmt.Errorf("build: public key %s is %d bytes, want %d", check.KeySource, len(key), ed25519.PublicKeySize)
+	}
+	check.Key = ed25519.PublicKey(key)
+
+	var sig, message []byte
+	if signaturePath != "" {
+		sig, err = os.ReadFile(signaturePath)
+		message = archive
+	} else {
+		check.SignatureSource = SignatureFile
+		sig, err = r.ReadFile(SignatureFile)
+		if err == nil {
+			message, err = ArchiveSigningMessage(r)
+		}
+	}
+	if err != nil {
+		return check, fmt.Errorf("build: reading signature %s: %w", check.SignatureSource, err)
+	}
+
+	if !ed25519.Verify(check.Key, message, sig) {
+		return check, fmt.Errorf("build: %s does not verify %s", check, archivePath)
+	}
+	return check, nil
+}
@@ -0,0 +1,174 @@
+// Copyright 2024 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package build
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.fuchsia.dev/fuchsia/src/sys/pkg/lib/far/go"
+)
+
+// writeArchive writes an archive holding entries to path, staging the entry
+// contents under dir.
+func writeArchive(t *testing.T, dir, path string, entries map[string][]byte) {
+	t.Helper()
+	inputs := map[string]string{}
+	for name, content := range entries {
+		src := filepath.Join(dir, "staging", name)
+		if err := os.MkdirAll(filepath.Dir(src), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(src, content, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		inputs[name] = src
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := far.Write(f, inputs); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// readArchive returns the entries of the archive at path.
+func readArchive(t *testing.T, path string) map[string][]byte {
+	t.Helper()
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := far.NewReader(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries := map[string][]byte{}
+	for _, name := range r.List() {
+		if entries[name], err = r.ReadFile(name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return entries
+}
+
+// signArchive rewrites the archive at path with an embedded signature made
+// with priv, recording pub as its public key.
+func signArchive(t *testing.T, dir, path string, pub ed25519.PublicKey, priv ed25519.PrivateKey) {
+	t.Helper()
+	entries := readArchive(t, path)
+	entries[PubkeyFile] = pub
+	writeArchive(t, dir, path, entries)
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := far.NewReader(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	message, err := ArchiveSigningMessage(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries[SignatureFile] = ed25519.Sign(priv, message)
+	writeArchive(t, dir, path, entries)
+}
+
+func TestVerifyArchiveSignature(t *testing.T) {
+	cfg := TestConfig()
+	defer os.RemoveAll(filepath.Dir(cfg.TempDir))
+	BuildTestPackage(cfg)
+
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherPub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyPath := filepath.Join(cfg.TempDir, "key.pub")
+	if err := os.WriteFile(keyPath, pub, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	otherKeyPath := filepath.Join(cfg.TempDir, "other.pub")
+	if err := os.WriteFile(otherKeyPath, otherPub, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("detached", func(t *testing.T) {
+		archive, err := os.ReadFile(cfg.MetaFAR())
+		if err != nil {
+			t.Fatal(err)
+		}
+		sigPath := filepath.Join(cfg.TempDir, "meta.far.sig")
+		if err := os.WriteFile(sigPath, ed25519.Sign(priv, archive), 0o644); err != nil {
+			t.Fatal(err)
+		}
+
+		check, err := VerifyArchiveSignature(cfg.MetaFAR(), keyPath, sigPath)
+		if err != nil {
+			t.Fatalf("valid signature: %v", err)
+		}
+		if check.KeySource != keyPath || check.SignatureSource != sigPath || !check.Key.Equal(pub) {
+			t.Errorf("got check %v, want key %s and signature %s", check, keyPath, sigPath)
+		}
+
+		if _, err := VerifyArchiveSignature(cfg.MetaFAR(), otherKeyPath, sigPath); err == nil || !strings.Contains(err.Error(), "does not verify") {
+			t.Errorf("wrong key: got %v, want verification failure", err)
+		}
+
+		tampered := filepath.Join(cfg.TempDir, "tampered.far")
+		entries := readArchive(t, cfg.MetaFAR())
+		entries["meta/tampered"] = []byte("tampered\n")
+		writeArchive(t, cfg.TempDir, tampered, entries)
+		if _, err := VerifyArchiveSignature(tampered, keyPath, sigPath); err == nil || !strings.Contains(err.Error(), "does not verify") {
+			t.Errorf("tampered archive: got %v, want verification failure", err)
+		}
+	})
+
+	t.Run("embedded", func(t *testing.T) {
+		signed := filepath.Join(cfg.TempDir, "signed.far")
+		writeArchive(t, cfg.TempDir, signed, readArchive(t, cfg.MetaFAR()))
+		signArchive(t, cfg.TempDir, signed, pub, priv)
+
+		check, err := VerifyArchiveSignature(signed, "", "")
+		if err != nil {
+			t.Fatalf("valid signature with recorded key: %v", err)
+		}
+		if check.KeySource != PubkeyFile || check.SignatureSource != SignatureFile {
+			t.Errorf("got check %v, want key %s and signature %s", check, PubkeyFile, SignatureFile)
+		}
+		if _, err := VerifyArchiveSignature(signed, keyPath, ""); err != nil {
+			t.Errorf("valid signature with provided key: %v", err)
+		}
+
+		if _, err := VerifyArchiveSignature(signed, otherKeyPath, ""); err == nil || !strings.Contains(err.Error(), "does not verify") {
+			t.Errorf("wrong key: got %v, want verification failure", err)
+		}
+
+		entries := readArchive(t, signed)
+		entries["meta/package"] = append(entries["meta/package"], ' ')
+		writeArchive(t, cfg.TempDir, signed, entries)
+		if _, err := VerifyArchiveSignature(signed, "", ""); err == nil || !strings.Contains(err.Error(), "does not verify") {
+			t.Errorf("tampered archive: got %v, want verification failure", err)
+		}
+	})
+
+	t.Run("unsigned", func(t *testing.T) {
+		if _, err := VerifyArchiveSignature(cfg.MetaFAR(), keyPath, ""); err == nil || !strings.Contains(err.Error(), SignatureFile) {
+			t.Errorf("got %v, want error about missing %s", err, SignatureFile)
+		}
+	})
+}
@@ -0,0 +1,176 @@
+// Copyright 2024 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package build
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// UpdateConfig is the board and product configuration of an update package,
+// read from a JSON file such as:
+//
+//	{
+//	  "board": "x64",
+//	  "repository": "fuchsia.com",
+//	  "images": {"zbi": "out/fuchsia.zbi", "fuchsia.vbmeta": "out/fuchsia.vbmeta"}
+//	}
+type UpdateConfig struct {
+	// Board is the name of the board the update is for.
+	Board string `json:"board"`
+	// Repository is the host of the package URLs in packages.json, for
+	// packages whose manifests don't name their repository. It defaults to
+	// fuchsia.com.
+	Repository string `json:"repository,omitempty"`
+	// Images maps the names of the image entries of the update package to
+	// the files holding them.
+	Images map[string]string `json:"images"`
+}
+
+// UpdatePackagesJSON is the content of the packages.json of an update package.
+type UpdatePackagesJSON struct {
+	Version string `json:"version"`
+	// Content lists the URLs of the packages of the update, pinned to the
+	// merkle roots of their meta.fars.
+	Content []string `json:"content"`
+}
+
+// ErrNoUpdatePackages indicates that an update package was assembled from no
+// packages.
+var ErrNoUpdatePackages = errors.New("the update package lists no packages")
+
+// The files BuildUpdatePackage writes to an update package, besides its
+// images.
+const (
+	updatePackagesJSON = "packages.json"
+	updateBoard        = "board"
+)
+
+// LoadUpdateConfig reads an UpdateConfig from the JSON file at path. Relative
+// image paths are relative to the directory of path.
+func LoadUpdateConfig(path string) (*UpdateConfig, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var c UpdateConfig
+	if err := json.Unmarshal(b, &c); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	for name, image := range c.Images {
+		if !filepath.IsAbs(image) {
+			c.Images[name] = filepath.Join(filepath.Dir(path), image)
+		}
+	}
+	return &c, nil
+}
+
+// BuildUpdatePackage builds an update package in cfg.OutputDir, like
+// BuildPackage, holding a packages.json that pins the packages of manifests,
+// a board file naming update.Board, and the images of update. It writes the
+// package's generated files and its build manifest to cfg.OutputDir, and
+// points cfg.ManifestPath at the latter.
+func BuildUpdatePackage(ctx context.Context, cfg *Config, update *UpdateConfig, manifests []*PackageManifest) (*PackageManifest, error) {
+	if update.Board == "" {
+		return nil, fmt.Errorf("the update configuration names no board")
+	}
+	if len(manifests) == 0 {
+		return nil, ErrNoUpdatePackages
+	}
+	repository := update.Repository
+	if repository == "" {
+		repository = "fuchsia.com"
+	}
+
+	packages := UpdatePackagesJSON{Version: "1", Content: []string{}}
+	names := map[string]bool{}
+	for _, m := range manifests {
+		if names[m.Package.Name] {
+			return nil, fmt.Errorf("the update package lists the package %s twice", m.Package.Name)
+		}
+		names[m.Package.Name] = true
+		var meta *PackageBlobInfo
+		for i := range m.Blobs {
+			if m.Blobs[i].Path == "meta/" {
+				meta = &m.Blobs[i]
+			}
+		}
+		if meta == nil {
+			return nil, fmt.Errorf("the manifest of the package %s lists no meta.far", m.Package.Name)
+		}
+		host := m.Repository
+		if host == "" {
+			host = repository
+		}
+		packages.Content = append(packages.Content,
+			fmt.Sprintf("fuchsia-pkg://%s/%s/%s?hash=%s", host, m.Package.Name, m.Package.Version, meta.Merkle))
+	}
+	sort.Strings(packages.Content)
+
+	if err := cfg.CheckOutputDir(); err != nil {
+		return nil, err
+	}
+	p, err := cfg.Package()
+	if err != nil {
+		return nil, err
+	}
+	packagesJSON, err := json.Marshal(packages)
+	if err != nil {
+		return nil, err
+	}
+	metaPackage, err := json.Marshal(p)
+	if err != nil {
+		return nil, err
+	}
+	generated := map[string][]byte{
+		updatePackagesJSON: packagesJSON,
+		updateBoard:        []byte(update.Board + "\n"),
+		"meta/package":     metaPackage,
+	}
+	paths := map[string]string{}
+	for dst, b := range generated {
+		paths[dst] = filepath.Join(cfg.OutputDir, filepath.FromSlash(dst))
+		if err := os.MkdirAll(filepath.Dir(paths[dst]), 0o755); err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(paths[dst], b, 0o644); err != nil {
+			return nil, err
+		}
+	}
+	for name, image := range update.Images {
+		if _, ok := paths[name]; ok || strings.HasPrefix(name, "meta/") {
+			return nil, fmt.Errorf("the image %s would replace the update package's own %s", name, name)
+		}
+		if _, err := os.Stat(image); err != nil {
+			return nil, fmt.Errorf("the image %s: %w", name, err)
+		}
+		paths[name] = image
+	}
+
+	dsts := make([]string, 0, len(paths))
+	for dst := range paths {
+		dsts = append(dsts, dst)
+	}
+	sort.Strings(dsts)
+	var manifest bytes.Buffer
+	for _, dst := range dsts {
+		fmt.Fprintf(&manifest, "%s=%s\n", dst, paths[dst])
+	}
+	manifestPath := filepath.Join(cfg.OutputDir, "update.manifest")
+	if err := os.WriteFile(manifestPath, manifest.Bytes(), 0o644); err != nil {
+		return nil, err
+	}
+
+	cfg.ManifestPath = manifestPath
+	cfg.manifest = nil
+	return BuildPackage(ctx, cfg)
+}
@@ -0,0 +1,28 @@
+// Copyright 2024 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package build
+
+import (
+	"fmt"
+	"os"
+	"sync/atomic"
+)
+
+// Warnf reports a problem that doesn't stop the command from completing. The
+// warning is written to WarningWriter, or to stderr if that isn't set, and is
+// counted so that it can be treated as a failure once the command completes.
+func (c *Config) Warnf(format string, args ...interface{}) {
+	atomic.AddInt64(&c.warnings, 1)
+	w := c.WarningWriter
+	if w == nil {
+		w = os.Stderr
+	}
+	fmt.Fprintf(w, "WARNING: "+format+"\n", args...)
+}
+
+// Warnings returns the number of warnings reported with Warnf.
+func (c *Config) Warnings() int {
+	return int(atomic.LoadInt64(&c.warnings))
+}
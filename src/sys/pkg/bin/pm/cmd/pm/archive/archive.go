@@ -36,7 +36,7 @@ func Run(cfg *build.Config, args []string) error {
 	}
 
 	if len(fs.Args()) != 0 {
-		fmt.Fprintf(os.Stderr, "WARNING: unused arguments: %s\n", fs.Args())
+		cfg.Warnf("unused arguments: %s", fs.Args())
 	}
 
 	return build.Archive(cfg, *output)
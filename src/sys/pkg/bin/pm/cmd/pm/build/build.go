@@ -7,6 +7,7 @@ package build
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"flag"
 	"fmt"
@@ -16,21 +17,37 @@ import (
 	"strings"
 
 	"go.fuchsia.dev/fuchsia/src/sys/pkg/bin/pm/build"
-	"go.fuchsia.dev/fuchsia/src/sys/pkg/bin/pm/cmd/pm/seal"
-	"go.fuchsia.dev/fuchsia/src/sys/pkg/bin/pm/cmd/pm/update"
 )
 
 const usage = `Usage: %s build
 perform update and seal in order
+
+With -tar-stdout, or the output directory "-", the outputs and the blobs of
+the package are written to stdout as a tar archive instead.
+
+With -watch, the package is rebuilt whenever its manifest or one of its source
+files changes, and the result of each build is printed, until interrupted.
 `
 
+// stdout is where the package is written with -tar-stdout.
+var stdout io.Writer = os.Stdout
+
 func Run(cfg *build.Config, args []string) error {
 	fs := flag.NewFlagSet("build", flag.ExitOnError)
 
 	var depfile = fs.Bool("depfile", true, "Produce a depfile")
 	var pkgManifestPath = fs.String("output-package-manifest", "", "If set, produce a package manifest at the given path")
+	var attributionMap = fs.String("attribution-map", "", "JSON `file` mapping source path prefixes to attribution metadata, such as LICENSE files, for -attribution-out")
+	var attributionOut = fs.String("attribution-out", "", "If set, write a JSON report attributing each file of the package by its source, with -attribution-map, to this `file`")
 	var blobsfile = fs.Bool("blobsfile", false, "Produce blobs.json file")
 	var blobsmani = fs.Bool("blobs-manifest", false, "Produce blobs.manifest file")
+	var contentAddressMeta = fs.Bool("content-address-meta", false, "Store meta.far in the output directory under its merkle root rather than as meta.far; the JSON outputs give its path")
+	var extraDigest = fs.String("extra-digest", "", fmt.Sprintf("Also record this digest of each blob in the JSON outputs, one of %v", build.ExtraDigests))
+	var maxTotalSize = fs.Uint64("max-total-size", 0, "Fail if the package's deduplicated blobs and meta.far add up to more than this many bytes; 0 disables the check")
+	var metaOnly = fs.Bool("meta-only", false, "Only produce meta.far, with the merkle roots of the blobs in meta/contents, and none of the outputs listing the blobs")
+	var tarStdout = fs.Bool("tar-stdout", false, "Write the outputs, and the package's blobs under blobs/, to stdout as a tar archive instead of to the output directory")
+	var watch = fs.Bool("watch", false, "Build, then rebuild whenever the manifest or a source file of the package changes, until interrupted")
+	var stamp = fs.String("stamp", "", "Touch this `file` once the package and all the requested outputs are built")
 
 	fs.Usage = func() {
 		fmt.Fprintf(os.Stderr, usage, filepath.Base(os.Args[0]))
@@ -43,75 +60,175 @@ func Run(cfg *build.Config, args []string) error {
 	}
 
 	if len(fs.Args()) != 0 {
-		fmt.Fprintf(os.Stderr, "WARNING: unused arguments: %s\n", fs.Args())
+		cfg.Warnf("unused arguments: %s", fs.Args())
 	}
 
-	if err := update.Run(cfg, []string{}); err != nil {
-		return fmt.Errorf("failed to update the merkle roots: %s", err)
+	if *metaOnly && (*blobsfile || *blobsmani || *pkgManifestPath != "" || *extraDigest != "") {
+		return fmt.Errorf("-meta-only can't be combined with -blobsfile, -blobs-manifest, -output-package-manifest or -extra-digest")
 	}
 
-	if err := seal.Run(cfg, []string{}); err != nil {
-		return fmt.Errorf("failed to seal the package: %s", err)
+	if (*attributionOut == "") != (*attributionMap == "") {
+		return fmt.Errorf("-attribution-out and -attribution-map must be given together")
 	}
 
-	if *depfile {
-		if cfg.ManifestPath == "" {
-			return fmt.Errorf("the -depfile option requires the use of the -m manifest option")
+	if cfg.OutputDir == "-" {
+		*tarStdout = true
+	}
+	if *tarStdout {
+		if *watch {
+			return fmt.Errorf("-tar-stdout can't be combined with -watch, which prints the result of each build to stdout")
 		}
-
-		content, err := buildDepfile(cfg)
+		dir, err := os.MkdirTemp("", "pm-build")
 		if err != nil {
-			return fmt.Errorf("failed to build dep file: %s", err)
-		}
-		if err := os.WriteFile(cfg.MetaFAR()+".d", content, 0644); err != nil {
 			return err
 		}
+		defer os.RemoveAll(dir)
+		outputDir := cfg.OutputDir
+		defer func() { cfg.OutputDir = outputDir }()
+		cfg.OutputDir = dir
 	}
 
-	if cfg.ManifestPath == "" {
-		return fmt.Errorf("the -blobsfile option requires the use of the -m manifest option")
-	}
-
-	blobs, err := cfg.BlobInfo()
-	if err != nil {
-		return err
-	}
+	buildPackage := func() error {
+		// Remove any stamp left by an earlier build, so that a failed build
+		// doesn't leave one behind.
+		if *stamp != "" {
+			if err := os.Remove(*stamp); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
 
-	if *blobsfile {
-		content, err := json.MarshalIndent(blobs, "", "    ")
+		pkgManifest, err := build.BuildPackage(context.Background(), cfg)
 		if err != nil {
 			return err
 		}
-		if err := os.WriteFile(filepath.Join(cfg.OutputDir, "blobs.json"), content, 0644); err != nil {
+
+		if err := build.CheckSizeBudget(pkgManifest, *maxTotalSize); err != nil {
 			return err
 		}
-	}
 
-	if *blobsmani {
-		var buf bytes.Buffer
-		for _, blob := range blobs {
-			fmt.Fprintf(&buf, "%s=%s\n", blob.Merkle.String(), blob.SourcePath)
+		// metaFAR is where meta.far ends up, which the depfile names as its
+		// target.
+		metaFAR := cfg.MetaFAR()
+		if *contentAddressMeta {
+			if metaFAR, err = build.ContentAddressMetaFar(cfg, pkgManifest); err != nil {
+				return err
+			}
 		}
-		if err := os.WriteFile(filepath.Join(cfg.OutputDir, "blobs.manifest"), buf.Bytes(), 0644); err != nil {
-			return err
+
+		if *extraDigest != "" {
+			if err := build.AddExtraDigest(pkgManifest.Blobs, *extraDigest); err != nil {
+				return err
+			}
 		}
-	}
 
-	if *pkgManifestPath != "" {
-		pkgManifest, err := cfg.OutputManifest()
-		if err != nil {
-			return err
+		if *attributionOut != "" {
+			if err := writeAttributionReport(cfg, *attributionMap, *attributionOut); err != nil {
+				return err
+			}
 		}
-		content, err := json.MarshalIndent(pkgManifest, "", "    ")
-		if err != nil {
-			return err
+
+		if *depfile {
+			if cfg.ManifestPath == "" {
+				return fmt.Errorf("the -depfile option requires the use of the -m manifest option")
+			}
+
+			content, err := buildDepfile(cfg, metaFAR)
+			if err != nil {
+				return fmt.Errorf("failed to build dep file: %s", err)
+			}
+			if err := os.WriteFile(cfg.MetaFAR()+".d", content, 0644); err != nil {
+				return err
+			}
 		}
-		if err := os.WriteFile(*pkgManifestPath, content, 0644); err != nil {
-			return err
+
+		if *metaOnly {
+			if *tarStdout {
+				if err := build.WritePackageTar(stdout, cfg.OutputDir, nil); err != nil {
+					return err
+				}
+			}
+			return writeStamp(*stamp)
 		}
+
+		if cfg.ManifestPath == "" {
+			return fmt.Errorf("the -blobsfile option requires the use of the -m manifest option")
+		}
+
+		blobs := pkgManifest.Blobs
+
+		if *blobsfile {
+			content, err := json.MarshalIndent(blobs, "", "    ")
+			if err != nil {
+				return err
+			}
+			if err := os.WriteFile(filepath.Join(cfg.OutputDir, "blobs.json"), content, 0644); err != nil {
+				return err
+			}
+		}
+
+		if *blobsmani {
+			var buf bytes.Buffer
+			for _, blob := range blobs {
+				fmt.Fprintf(&buf, "%s=%s\n", blob.Merkle.String(), blob.SourcePath)
+			}
+			if err := os.WriteFile(filepath.Join(cfg.OutputDir, "blobs.manifest"), buf.Bytes(), 0644); err != nil {
+				return err
+			}
+		}
+
+		if *pkgManifestPath != "" {
+			content, err := json.MarshalIndent(pkgManifest, "", "    ")
+			if err != nil {
+				return err
+			}
+			if err := os.WriteFile(*pkgManifestPath, content, 0644); err != nil {
+				return err
+			}
+		}
+
+		if *tarStdout {
+			if err := build.WritePackageTar(stdout, cfg.OutputDir, blobs); err != nil {
+				return err
+			}
+		}
+
+		return writeStamp(*stamp)
 	}
 
-	return nil
+	if *watch {
+		return watchBuild(cfg, buildPackage)
+	}
+	return buildPackage()
+}
+
+// writeAttributionReport attributes the files of the package by the map at
+// mapPath, and writes the report to outPath. Files without attribution are
+// warned about.
+func writeAttributionReport(cfg *build.Config, mapPath, outPath string) error {
+	m, err := build.LoadAttributionMap(mapPath)
+	if err != nil {
+		return err
+	}
+	report, err := build.BuildAttributionReport(cfg, m)
+	if err != nil {
+		return err
+	}
+	for _, f := range report.Missing {
+		cfg.Warnf("%s: no attribution for its source %s", f.Path, f.Source)
+	}
+	content, err := json.MarshalIndent(report, "", "    ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(outPath, content, 0644)
+}
+
+// writeStamp touches the stamp file at path, if one was asked for.
+func writeStamp(path string) error {
+	if path == "" {
+		return nil
+	}
+	return os.WriteFile(path, nil, 0644)
 }
 
 // computedOutputs are files that are produced by the `build` composite command
@@ -121,8 +238,8 @@ var computedOutputs = map[string]struct{}{
 }
 
 // buildDepfile computes and returns the contents of a ninja compatible depfile
-// for meta.far for the composite `build` action.
-func buildDepfile(cfg *build.Config) ([]byte, error) {
+// for meta.far, built at target, for the composite `build` action.
+func buildDepfile(cfg *build.Config, target string) ([]byte, error) {
 	manifest, err := cfg.Manifest()
 	if err != nil {
 		return nil, err
@@ -130,7 +247,7 @@ func buildDepfile(cfg *build.Config) ([]byte, error) {
 
 	var buf bytes.Buffer
 
-	if _, err := io.WriteString(&buf, cfg.MetaFAR()+":"); err != nil {
+	if _, err := io.WriteString(&buf, target+":"); err != nil {
 		return nil, err
 	}
 
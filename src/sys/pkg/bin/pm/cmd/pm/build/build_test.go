@@ -0,0 +1,438 @@
+// Copyright 2024 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package build
+
+import (
+	"archive/tar"
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.fuchsia.dev/fuchsia/src/sys/pkg/bin/pm/build"
+	"go.fuchsia.dev/fuchsia/src/sys/pkg/lib/far/go"
+	"go.fuchsia.dev/fuchsia/src/sys/pkg/lib/merkle"
+)
+
+func TestStamp(t *testing.T) {
+	cfg := build.TestConfig()
+	defer os.RemoveAll(filepath.Dir(cfg.TempDir))
+	build.TestPackage(cfg)
+	stamp := filepath.Join(cfg.TempDir, "build.stamp")
+
+	if err := Run(cfg, []string{"-stamp", stamp}); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(stamp)
+	if err != nil {
+		t.Fatalf("no stamp after a successful build: %v", err)
+	}
+	manifest, err := cfg.Manifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	inputs := []string{cfg.ManifestPath}
+	for _, src := range manifest.Paths {
+		inputs = append(inputs, src)
+	}
+	for _, src := range inputs {
+		input, err := os.Stat(src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if input.ModTime().After(info.ModTime()) {
+			t.Errorf("input %s was modified at %s, after the stamp at %s", src, input.ModTime(), info.ModTime())
+		}
+	}
+
+	// A failed build removes the stamp of the earlier build.
+	if err := os.Remove(manifest.Paths["a"]); err != nil {
+		t.Fatal(err)
+	}
+	if err := Run(cfg, []string{"-stamp", stamp}); err == nil {
+		t.Fatal("building with a missing input succeeded")
+	}
+	if _, err := os.Stat(stamp); !os.IsNotExist(err) {
+		t.Errorf("got %v, want no stamp after a failed build", err)
+	}
+}
+
+func TestExtraDigest(t *testing.T) {
+	cfg := build.TestConfig()
+	defer os.RemoveAll(filepath.Dir(cfg.TempDir))
+	build.TestPackage(cfg)
+	manifestPath := filepath.Join(cfg.TempDir, "package_manifest.json")
+
+	if err := Run(cfg, []string{"-extra-digest", "sha256", "-blobsfile", "-output-package-manifest", manifestPath}); err != nil {
+		t.Fatal(err)
+	}
+	blobsJSON, err := build.LoadBlobs(filepath.Join(cfg.OutputDir, "blobs.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifest, err := build.LoadPackageManifest(manifestPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, blobs := range map[string][]build.PackageBlobInfo{"blobs.json": blobsJSON, "package manifest": manifest.Blobs} {
+		if len(blobs) == 0 {
+			t.Fatalf("%s lists no blobs", name)
+		}
+		for _, blob := range blobs {
+			content, err := os.ReadFile(blob.SourcePath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := fmt.Sprintf("%x", sha256.Sum256(content)); blob.SHA256 != want {
+				t.Errorf("%s: blob %s has SHA-256 %q, want %q", name, blob.Path, blob.SHA256, want)
+			}
+			if blob.Merkle == (build.MerkleRoot{}) {
+				t.Errorf("%s: blob %s has no merkle root", name, blob.Path)
+			}
+		}
+	}
+
+	if err := Run(cfg, []string{"-extra-digest", "md5"}); err == nil || !strings.Contains(err.Error(), `unknown digest "md5"`) {
+		t.Errorf("got %v, want an unknown digest error", err)
+	}
+}
+
+func TestMetaOnly(t *testing.T) {
+	cfg := build.TestConfig()
+	defer os.RemoveAll(filepath.Dir(cfg.TempDir))
+	build.TestPackage(cfg)
+
+	if err := Run(cfg, []string{"-meta-only"}); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(cfg.MetaFAR())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	r, err := far.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := r.ReadFile("meta/contents")
+	if err != nil {
+		t.Fatal(err)
+	}
+	contents, err := build.ParseMetaContents(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifest, err := cfg.Manifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	content := manifest.Content()
+	if len(contents) != len(content) {
+		t.Errorf("meta/contents lists %d blobs, want %d", len(contents), len(content))
+	}
+	for path, src := range content {
+		b, err := os.ReadFile(src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var tree merkle.Tree
+		if _, err := tree.ReadFrom(bytes.NewReader(b)); err != nil {
+			t.Fatal(err)
+		}
+		if got, want := contents[path].String(), fmt.Sprintf("%x", tree.Root()); got != want {
+			t.Errorf("%s: meta/contents has merkle root %s, want %s", path, got, want)
+		}
+	}
+
+	// Only the package's metadata is written to the output directory.
+	if err := filepath.Walk(cfg.OutputDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(cfg.OutputDir, path)
+		if err != nil {
+			return err
+		}
+		if rel != "meta.far" && rel != "meta.far.d" && !strings.HasPrefix(rel, "meta"+string(filepath.Separator)) {
+			t.Errorf("a meta-only build wrote %s", rel)
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Run(cfg, []string{"-meta-only", "-blobsfile"}); err == nil {
+		t.Error("-meta-only with -blobsfile succeeded")
+	}
+}
+
+func TestMaxTotalSize(t *testing.T) {
+	cfg := build.TestConfig()
+	defer os.RemoveAll(filepath.Dir(cfg.TempDir))
+	build.TestPackage(cfg)
+
+	// List one of the blobs at a second path, so that it's shared.
+	manifestFile, err := os.OpenFile(cfg.ManifestPath, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = fmt.Fprintf(manifestFile, "shared/a=%s\n", filepath.Join(filepath.Dir(cfg.ManifestPath), "package", "a"))
+	manifestFile.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Run(cfg, nil); err != nil {
+		t.Fatal(err)
+	}
+	manifest, err := cfg.OutputManifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	reuse := build.ComputeBlobReuse(manifest)
+	if reuse.DedupedBlobs != 1 {
+		t.Fatalf("got %d shared blobs, want 1", reuse.DedupedBlobs)
+	}
+	total := reuse.UniqueBytes
+
+	if err := Run(cfg, []string{"-max-total-size", fmt.Sprint(total)}); err != nil {
+		t.Errorf("building a package of %d bytes with a budget of as many bytes: %v", total, err)
+	}
+	err = Run(cfg, []string{"-max-total-size", fmt.Sprint(total - 1)})
+	if err == nil {
+		t.Fatalf("building a package of %d bytes with a budget of %d bytes succeeded", total, total-1)
+	}
+	if want := fmt.Sprintf("is %d bytes, 1 bytes over its budget of %d bytes", total, total-1); !strings.Contains(err.Error(), want) {
+		t.Errorf("got %q, want it to contain %q", err, want)
+	}
+}
+
+func TestTarStdout(t *testing.T) {
+	cfg := build.TestConfig()
+	defer os.RemoveAll(filepath.Dir(cfg.TempDir))
+	build.TestPackage(cfg)
+	outputDir := cfg.OutputDir
+	cfg.OutputDir = "-"
+
+	var buf bytes.Buffer
+	stdout = &buf
+	defer func() { stdout = os.Stdout }()
+	if err := Run(cfg, nil); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.OutputDir != "-" {
+		t.Errorf("got output directory %q after the build, want it restored to -", cfg.OutputDir)
+	}
+	if _, err := os.Stat(filepath.Join(outputDir, "meta.far")); !os.IsNotExist(err) {
+		t.Errorf("got %v, want no meta.far written to the output directory", err)
+	}
+
+	files := map[string][]byte{}
+	tr := tar.NewReader(&buf)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := io.ReadAll(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[hdr.Name] = b
+	}
+
+	metaFar, ok := files["meta.far"]
+	if !ok {
+		t.Fatalf("got tar entries %v, want meta.far", files)
+	}
+	r, err := far.NewReader(bytes.NewReader(metaFar))
+	if err != nil {
+		t.Fatalf("meta.far isn't a valid archive: %v", err)
+	}
+	contents, err := r.ReadFile("meta/contents")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	manifest, err := cfg.Manifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range strings.Split(strings.TrimSpace(string(contents)), "\n") {
+		path, root, _ := strings.Cut(line, "=")
+		blob, ok := files["blobs/"+root]
+		if !ok {
+			t.Errorf("got no blob %s of %s", root, path)
+			continue
+		}
+		want, err := os.ReadFile(manifest.Paths[path])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(blob, want) {
+			t.Errorf("got blob %s of %s with content %q, want %q", root, path, blob, want)
+		}
+		var tree merkle.Tree
+		if _, err := tree.ReadFrom(bytes.NewReader(blob)); err != nil {
+			t.Fatal(err)
+		}
+		if got := fmt.Sprintf("%x", tree.Root()); got != root {
+			t.Errorf("got blob %s with merkle root %s", root, got)
+		}
+	}
+}
+
+func TestContentAddressMeta(t *testing.T) {
+	cfg := build.TestConfig()
+	defer os.RemoveAll(filepath.Dir(cfg.TempDir))
+	build.TestPackage(cfg)
+	manifestPath := filepath.Join(cfg.TempDir, "package_manifest.json")
+
+	if err := Run(cfg, []string{"-content-address-meta", "-blobsfile", "-output-package-manifest", manifestPath}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(cfg.MetaFAR()); !os.IsNotExist(err) {
+		t.Errorf("got %v, want no meta.far", err)
+	}
+
+	manifest, err := build.LoadPackageManifest(manifestPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	blobsJSON, err := build.LoadBlobs(filepath.Join(cfg.OutputDir, "blobs.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, blobs := range map[string][]build.PackageBlobInfo{"package manifest": manifest.Blobs, "blobs.json": blobsJSON} {
+		var meta *build.PackageBlobInfo
+		for i := range blobs {
+			if blobs[i].Path == "meta/" {
+				meta = &blobs[i]
+			}
+		}
+		if meta == nil {
+			t.Fatalf("the %s lists no meta.far", name)
+		}
+		if want := filepath.Join(cfg.OutputDir, meta.Merkle.String()); meta.SourcePath != want {
+			t.Errorf("the %s gives meta.far the path %s, want %s", name, meta.SourcePath, want)
+		}
+		b, err := os.ReadFile(meta.SourcePath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var tree merkle.Tree
+		if _, err := tree.ReadFrom(bytes.NewReader(b)); err != nil {
+			t.Fatal(err)
+		}
+		if got := fmt.Sprintf("%x", tree.Root()); got != meta.Merkle.String() {
+			t.Errorf("the %s gives meta.far the merkle root %s, but its content has %s", name, meta.Merkle, got)
+		}
+		if _, err := far.NewReader(bytes.NewReader(b)); err != nil {
+			t.Errorf("%s isn't an archive: %v", meta.SourcePath, err)
+		}
+	}
+
+	// The depfile is where it always is, but names the content-addressed
+	// meta.far as its target.
+	depfile, err := os.ReadFile(cfg.MetaFAR() + ".d")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, blob := range manifest.Blobs {
+		if blob.Path != "meta/" {
+			continue
+		}
+		if want := blob.SourcePath + ":"; !strings.HasPrefix(string(depfile), want) {
+			t.Errorf("got depfile %q, want it to start with %q", depfile, want)
+		}
+	}
+}
+
+func TestAttribution(t *testing.T) {
+	cfg := build.TestConfig()
+	defer os.RemoveAll(filepath.Dir(cfg.TempDir))
+	build.TestPackage(cfg)
+	var warnings bytes.Buffer
+	cfg.WarningWriter = &warnings
+
+	// Add a file whose source is outside the attributed directories.
+	unmapped := filepath.Join(cfg.TempDir, "unmapped")
+	if err := os.WriteFile(unmapped, []byte("unmapped\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.OpenFile(cfg.ManifestPath, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fmt.Fprintf(f, "extra=%s\n", unmapped)
+	f.Close()
+
+	pkgDir := filepath.Join(filepath.Dir(cfg.ManifestPath), "package")
+	mapPath := filepath.Join(cfg.TempDir, "attribution.json")
+	attributions := map[string]string{
+		pkgDir:                         "package/LICENSE",
+		filepath.Join(pkgDir, "dir"):   "dir/LICENSE",
+		filepath.Join(pkgDir, "di"):    "di/LICENSE",
+		filepath.Join(pkgDir, "a", ""): "a/LICENSE",
+	}
+	b, err := json.Marshal(attributions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(mapPath, b, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	outPath := filepath.Join(cfg.TempDir, "attribution_report.json")
+
+	if err := Run(cfg, []string{"-attribution-map", mapPath, "-attribution-out", outPath}); err != nil {
+		t.Fatal(err)
+	}
+	b, err = os.ReadFile(outPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var report build.AttributionReport
+	if err := json.Unmarshal(b, &report); err != nil {
+		t.Fatal(err)
+	}
+
+	got := map[string]string{}
+	for _, f := range report.Attributed {
+		got[f.Path] = f.Attribution
+	}
+	for path, want := range map[string]string{
+		"a":            "a/LICENSE",
+		"b":            "package/LICENSE",
+		"dir/c":        "dir/LICENSE",
+		"meta/package": "package/LICENSE",
+	} {
+		if got[path] != want {
+			t.Errorf("%s: got attribution %q, want %q", path, got[path], want)
+		}
+	}
+	if _, ok := got["meta/contents"]; ok {
+		t.Errorf("got an attribution for the generated meta/contents")
+	}
+	if len(report.Missing) != 1 || report.Missing[0].Path != "extra" || report.Missing[0].Source != unmapped {
+		t.Errorf("got missing attributions %+v, want only extra", report.Missing)
+	}
+	if !strings.Contains(warnings.String(), "extra: no attribution") {
+		t.Errorf("got warnings %q, want one about extra", warnings.String())
+	}
+
+	if err := Run(cfg, []string{"-attribution-out", outPath}); err == nil {
+		t.Error("-attribution-out without -attribution-map succeeded")
+	}
+}
@@ -0,0 +1,150 @@
+// Copyright 2024 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package build
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"go.fuchsia.dev/fuchsia/src/sys/pkg/bin/pm/build"
+	"go.fuchsia.dev/fuchsia/src/sys/pkg/bin/pm/fswatch"
+)
+
+// WatchDebounce is how long -watch waits for more changes after one, so that
+// a burst of changes, such as an editor saving several files, rebuilds once.
+const WatchDebounce = 100 * time.Millisecond
+
+// eventSource is a source of file system events, which tests fake.
+type eventSource interface {
+	// Add watches the directory dir for events on the files in it.
+	Add(dir string) error
+	Events() <-chan fswatch.Event
+	Errors() <-chan error
+	Close() error
+}
+
+// fswatchSource is the eventSource of an fswatch.Watcher.
+type fswatchSource struct {
+	w *fswatch.Watcher
+}
+
+func (s fswatchSource) Add(dir string) error         { return s.w.Add(dir) }
+func (s fswatchSource) Events() <-chan fswatch.Event { return s.w.Events }
+func (s fswatchSource) Errors() <-chan error         { return s.w.Errors }
+func (s fswatchSource) Close() error                 { return s.w.Close() }
+
+// watchBuild builds the package with buildPackage, then rebuilds it whenever
+// its manifest or one of its source files changes, until interrupted.
+func watchBuild(cfg *build.Config, buildPackage func() error) error {
+	w, err := fswatch.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("failed to initialize fsnotify: %s", err)
+	}
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	defer signal.Stop(interrupt)
+	return watch(cfg, fswatchSource{w}, interrupt, WatchDebounce, buildPackage)
+}
+
+// watch implements watchBuild with the events of src, stopping cleanly once
+// interrupt receives. A change rebuilds once no other change has followed it
+// for debounce. The manifest is read again for each build, and the files
+// watched are worked out again after it, as the manifest may have changed.
+func watch(cfg *build.Config, src eventSource, interrupt <-chan os.Signal, debounce time.Duration, buildPackage func() error) error {
+	defer src.Close()
+
+	files := map[string]struct{}{}
+	dirs := map[string]struct{}{}
+	rebuild := func() error {
+		cfg.ResetManifest()
+		start := time.Now()
+		if err := buildPackage(); err != nil {
+			fmt.Fprintf(stdout, "build failed: %s\n", err)
+		} else {
+			fmt.Fprintf(stdout, "build succeeded in %s\n", time.Since(start).Round(time.Millisecond))
+		}
+		// A manifest that can't be read keeps the files of the last one
+		// watched, along with itself, until it is fixed.
+		watched, err := watchedFiles(cfg)
+		if err != nil {
+			watched = files
+		}
+		files = watched
+		for f := range files {
+			dir := filepath.Dir(f)
+			if _, ok := dirs[dir]; ok {
+				continue
+			}
+			if err := src.Add(dir); err != nil {
+				return fmt.Errorf("unable to watch %q: %s", dir, err)
+			}
+			dirs[dir] = struct{}{}
+		}
+		return nil
+	}
+	if err := rebuild(); err != nil {
+		return err
+	}
+
+	var pending <-chan time.Time
+	for {
+		select {
+		case event := <-src.Events():
+			if event.Op == fswatch.Chmod {
+				continue
+			}
+			name, err := filepath.Abs(event.Name)
+			if err != nil {
+				continue
+			}
+			if _, ok := files[name]; ok {
+				pending = time.After(debounce)
+			}
+		case err := <-src.Errors():
+			return fmt.Errorf("watching for changes: %s", err)
+		case <-pending:
+			pending = nil
+			if err := rebuild(); err != nil {
+				return err
+			}
+		case <-interrupt:
+			return nil
+		}
+	}
+}
+
+// watchedFiles returns the absolute paths of the manifest and the source files
+// of the package cfg describes, leaving out files pm generates in the output
+// directory.
+func watchedFiles(cfg *build.Config) (map[string]struct{}, error) {
+	manifestPath, err := filepath.Abs(cfg.ManifestPath)
+	if err != nil {
+		return nil, err
+	}
+	outputDir, err := filepath.Abs(cfg.OutputDir)
+	if err != nil {
+		return nil, err
+	}
+	files := map[string]struct{}{manifestPath: {}}
+	manifest, err := cfg.Manifest()
+	if err != nil {
+		return files, err
+	}
+	for _, src := range manifest.Paths {
+		src, err := filepath.Abs(src)
+		if err != nil {
+			return files, err
+		}
+		if strings.HasPrefix(src, outputDir+string(filepath.Separator)) {
+			continue
+		}
+		files[src] = struct{}{}
+	}
+	return files, nil
+}
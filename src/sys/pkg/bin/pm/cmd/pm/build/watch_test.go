@@ -0,0 +1,154 @@
+// Copyright 2024 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package build
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"go.fuchsia.dev/fuchsia/src/sys/pkg/bin/pm/build"
+	"go.fuchsia.dev/fuchsia/src/sys/pkg/bin/pm/fswatch"
+)
+
+// fakeEventSource is an eventSource whose events the test sends.
+type fakeEventSource struct {
+	dirs   []string
+	events chan fswatch.Event
+	errors chan error
+}
+
+func (s *fakeEventSource) Add(dir string) error {
+	s.dirs = append(s.dirs, dir)
+	return nil
+}
+func (s *fakeEventSource) Events() <-chan fswatch.Event { return s.events }
+func (s *fakeEventSource) Errors() <-chan error         { return s.errors }
+func (s *fakeEventSource) Close() error                 { return nil }
+
+func TestWatch(t *testing.T) {
+	cfg := build.TestConfig()
+	defer os.RemoveAll(filepath.Dir(cfg.TempDir))
+	build.TestPackage(cfg)
+	manifest, err := cfg.Manifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	source := manifest.Paths["a"]
+
+	var out bytes.Buffer
+	stdout = &out
+	defer func() { stdout = os.Stdout }()
+
+	src := &fakeEventSource{events: make(chan fswatch.Event), errors: make(chan error)}
+	interrupt := make(chan os.Signal)
+	builds := make(chan struct{}, 10)
+	// built is the manifest of the last build, which is set before the
+	// build is sent on builds.
+	var built map[string]string
+	done := make(chan error)
+	go func() {
+		done <- watch(cfg, src, interrupt, 10*time.Millisecond, func() error {
+			m, err := cfg.Manifest()
+			if err == nil {
+				built = m.Paths
+			}
+			builds <- struct{}{}
+			return err
+		})
+	}()
+
+	// waitBuilds waits for n more builds, then makes sure no other follows.
+	waitBuilds := func(n int) {
+		t.Helper()
+		for i := 0; i < n; i++ {
+			select {
+			case <-builds:
+			case <-time.After(5 * time.Second):
+				t.Fatalf("got %d builds, want %d", i, n)
+			}
+		}
+		select {
+		case <-builds:
+			t.Fatalf("got more than %d builds", n)
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+	waitBuilds(1)
+
+	// A burst of changes to a source rebuilds once.
+	src.events <- fswatch.Event{Name: source, Op: fswatch.Write}
+	src.events <- fswatch.Event{Name: source, Op: fswatch.Create}
+	waitBuilds(1)
+
+	// Changes to other files in the same directory, and to the outputs,
+	// don't rebuild.
+	src.events <- fswatch.Event{Name: filepath.Join(filepath.Dir(source), "unrelated"), Op: fswatch.Write}
+	src.events <- fswatch.Event{Name: cfg.MetaFAR(), Op: fswatch.Write}
+	src.events <- fswatch.Event{Name: source, Op: fswatch.Chmod}
+	waitBuilds(0)
+
+	src.events <- fswatch.Event{Name: cfg.ManifestPath, Op: fswatch.Write}
+	waitBuilds(1)
+
+	// A source added to the manifest is built, and watched from then on.
+	added := filepath.Join(t.TempDir(), "added")
+	if err := os.WriteFile(added, []byte("added"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.OpenFile(cfg.ManifestPath, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fmt.Fprintf(f, "data/added=%s\n", added); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	src.events <- fswatch.Event{Name: cfg.ManifestPath, Op: fswatch.Write}
+	waitBuilds(1)
+	if got := built["data/added"]; got != added {
+		t.Errorf("built data/added from %q, want %q", got, added)
+	}
+	src.events <- fswatch.Event{Name: added, Op: fswatch.Write}
+	waitBuilds(1)
+
+	interrupt <- os.Interrupt
+	if err := <-done; err != nil {
+		t.Fatalf("watch returned %v after an interrupt, want nil", err)
+	}
+	if got := strings.Count(out.String(), "build succeeded"); got != 5 {
+		t.Errorf("got %d build results, want 5:\n%s", got, out.String())
+	}
+
+	dir, err := filepath.Abs(filepath.Dir(source))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{dir, filepath.Dir(added)} {
+		found := false
+		for _, d := range src.dirs {
+			found = found || d == want
+		}
+		if !found {
+			t.Errorf("watched %v, want %s among them", src.dirs, want)
+		}
+	}
+}
+
+func TestWatchTarStdout(t *testing.T) {
+	cfg := build.TestConfig()
+	defer os.RemoveAll(filepath.Dir(cfg.TempDir))
+	build.TestPackage(cfg)
+
+	if err := Run(cfg, []string{"-watch", "-tar-stdout"}); err == nil {
+		t.Error("-watch with -tar-stdout: got nil error")
+	}
+}
@@ -0,0 +1,75 @@
+// Copyright 2024 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"go.fuchsia.dev/fuchsia/src/sys/pkg/bin/pm/build"
+)
+
+const dedupReportUsage = `Usage: %s dedup-report -m <package manifest> [-m <package manifest>...]
+summarize how the blobs of the given packages are shared: the blob references
+they list, the unique blobs among them, how many are deduplicated, and the
+bytes deduplication saves. Blobs are content addressed, so a blob shared by
+several packages, or listed at several paths of one, is only stored once.
+`
+
+// dedupReportStdout is where the report is written.
+var dedupReportStdout io.Writer = os.Stdout
+
+// manifestPaths is a repeatable flag collecting package manifest paths.
+type manifestPaths []string
+
+func (m *manifestPaths) Set(value string) error {
+	*m = append(*m, value)
+	return nil
+}
+
+func (m *manifestPaths) String() string {
+	return strings.Join(*m, ", ")
+}
+
+func dedupReportFlags(fs *flag.FlagSet) {
+	fs.Var(&manifestPaths{}, "m", "package manifest `file` to include in the report; may be repeated")
+}
+
+func runDedupReport(cfg *build.Config, args []string) error {
+	fs := flag.NewFlagSet("dedup-report", flag.ExitOnError)
+	dedupReportFlags(fs)
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, dedupReportUsage, filepath.Base(os.Args[0]))
+		fmt.Fprintln(os.Stderr)
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if len(fs.Args()) != 0 {
+		cfg.Warnf("unused arguments: %s", fs.Args())
+	}
+	paths := *fs.Lookup("m").Value.(*manifestPaths)
+	if len(paths) == 0 {
+		return fmt.Errorf("dedup-report: at least one -m is required")
+	}
+
+	var manifests []*build.PackageManifest
+	for _, p := range paths {
+		m, err := build.LoadPackageManifest(p)
+		if err != nil {
+			return fmt.Errorf("dedup-report: %s: %w", p, err)
+		}
+		manifests = append(manifests, m)
+	}
+	fmt.Fprintf(dedupReportStdout, "%d packages: %s\n", len(manifests), build.ComputeBlobReuse(manifests...))
+	return nil
+}
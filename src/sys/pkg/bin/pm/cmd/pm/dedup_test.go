@@ -0,0 +1,57 @@
+// Copyright 2024 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go.fuchsia.dev/fuchsia/src/sys/pkg/bin/pm/build"
+)
+
+func TestDedupReport(t *testing.T) {
+	var out bytes.Buffer
+	dedupReportStdout = &out
+	defer func() { dedupReportStdout = os.Stdout }()
+
+	dir := t.TempDir()
+	shared := build.MustDecodeMerkleRoot("0000000000000000000000000000000000000000000000000000000000000001")
+	writeManifest := func(name string, blobs ...build.PackageBlobInfo) string {
+		t.Helper()
+		m := build.PackageManifest{Version: "1", Blobs: blobs}
+		m.Package.Name = name
+		m.Package.Version = "0"
+		b, err := json.Marshal(m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		p := filepath.Join(dir, name+".json")
+		if err := os.WriteFile(p, b, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+	first := writeManifest("first",
+		build.PackageBlobInfo{SourcePath: "shared", Path: "shared", Merkle: shared, Size: 100},
+		build.PackageBlobInfo{SourcePath: "a", Path: "a", Merkle: build.MustDecodeMerkleRoot("0000000000000000000000000000000000000000000000000000000000000002"), Size: 10})
+	second := writeManifest("second",
+		build.PackageBlobInfo{SourcePath: "shared", Path: "lib/shared", Merkle: shared, Size: 100},
+		build.PackageBlobInfo{SourcePath: "b", Path: "b", Merkle: build.MustDecodeMerkleRoot("0000000000000000000000000000000000000000000000000000000000000003"), Size: 20})
+
+	if err := runDedupReport(build.NewConfig(), []string{"-m", first, "-m", second}); err != nil {
+		t.Fatal(err)
+	}
+	want := "2 packages: 4 blob references, 3 unique blobs, 1 deduplicated; 100 of 230 bytes saved by deduplication\n"
+	if got := out.String(); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	if err := runDedupReport(build.NewConfig(), nil); err == nil {
+		t.Error("dedup-report without -m: got nil error")
+	}
+}
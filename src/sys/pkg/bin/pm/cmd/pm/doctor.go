@@ -0,0 +1,153 @@
+// Copyright 2024 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"go.fuchsia.dev/fuchsia/src/sys/pkg/bin/pm/build"
+)
+
+const doctorUsage = `Usage: %s doctor [-format text|json]
+check that ffx is available, and list the ffx invocation that replaces each
+deprecated pm command, given the global flags pm was run with
+`
+
+// doctorStdout is where the doctor report is written.
+var doctorStdout io.Writer = os.Stdout
+
+// doctorReport is the result of `pm doctor`.
+type doctorReport struct {
+	FFX struct {
+		Found   bool   `json:"found"`
+		Path    string `json:"path,omitempty"`
+		Version string `json:"version,omitempty"`
+		Error   string `json:"error,omitempty"`
+	} `json:"ffx"`
+	Commands []migration `json:"commands"`
+}
+
+// migration describes what to use instead of a deprecated command.
+type migration struct {
+	Command string `json:"command"`
+	// Invocation is the ffx command line to use instead, if there's one.
+	Invocation string `json:"invocation,omitempty"`
+	Note       string `json:"note,omitempty"`
+}
+
+// ffxArgs gives the arguments of the ffx replacements of commands that take
+// the global flags, to follow the replacement.
+var ffxArgs = map[string]func(cfg *build.Config) []string{
+	"build": func(cfg *build.Config) []string {
+		args := []string{cfg.ManifestPath, "-o", cfg.OutputDir}
+		if cfg.PkgName != "" {
+			args = append(args, "--published-name", cfg.PkgName)
+		}
+		return args
+	},
+	"archive": func(cfg *build.Config) []string {
+		name := cfg.PkgName
+		if name == "" {
+			name = "package"
+		}
+		return []string{"-o", filepath.Join(cfg.OutputDir, name+".far"), filepath.Join(cfg.OutputDir, "package_manifest.json")}
+	},
+}
+
+func doctorFlags(fs *flag.FlagSet) {
+	fs.String("format", "text", "output format, one of: text, json")
+}
+
+func runDoctor(cfg *build.Config, args []string) error {
+	fs := flag.NewFlagSet("doctor", flag.ExitOnError)
+	doctorFlags(fs)
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, doctorUsage, filepath.Base(os.Args[0]))
+		fmt.Fprintln(os.Stderr)
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if len(fs.Args()) != 0 {
+		cfg.Warnf("unused arguments: %s", fs.Args())
+	}
+	format := fs.Lookup("format").Value.String()
+	if format != "text" && format != "json" {
+		return fmt.Errorf("doctor: unknown format %q, want text or json", format)
+	}
+
+	r := diagnose(cfg)
+	if format == "json" {
+		enc := json.NewEncoder(doctorStdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(r)
+	}
+	return r.writeText(doctorStdout)
+}
+
+// diagnose looks for ffx on the PATH, and lists the replacements of the
+// deprecated commands.
+func diagnose(cfg *build.Config) *doctorReport {
+	r := &doctorReport{Commands: []migration{}}
+	if path, err := exec.LookPath("ffx"); err == nil {
+		r.FFX.Found = true
+		r.FFX.Path = path
+		out, err := exec.Command(path, "version").Output()
+		if err != nil {
+			r.FFX.Error = fmt.Sprintf("running ffx version: %s", err)
+		} else {
+			r.FFX.Version = strings.TrimSpace(strings.SplitN(string(out), "\n", 2)[0])
+		}
+	}
+
+	for _, c := range commands {
+		m := migration{Command: c.Name}
+		switch {
+		case c.Status == statusActive:
+			continue
+		case c.Status == statusDeprecated:
+			m.Invocation = c.Replacement
+			if f, ok := ffxArgs[c.Name]; ok {
+				m.Invocation += " " + strings.Join(f(cfg), " ")
+			}
+		case c.message != "":
+			m.Note = c.message
+		default:
+			m.Note = "deprecated without replacement"
+		}
+		r.Commands = append(r.Commands, m)
+	}
+	return r
+}
+
+func (r *doctorReport) writeText(w io.Writer) error {
+	switch {
+	case !r.FFX.Found:
+		fmt.Fprintln(w, "ffx: missing, it isn't on the PATH")
+	case r.FFX.Error != "":
+		fmt.Fprintf(w, "ffx: %s (%s)\n", r.FFX.Path, r.FFX.Error)
+	default:
+		fmt.Fprintf(w, "ffx: %s (%s)\n", r.FFX.Path, r.FFX.Version)
+	}
+	fmt.Fprintln(w)
+	for _, m := range r.Commands {
+		if m.Invocation != "" {
+			fmt.Fprintf(w, "pm %s: use '%s'\n", m.Command, m.Invocation)
+		} else {
+			fmt.Fprintf(w, "pm %s: %s\n", m.Command, m.Note)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+// Copyright 2024 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.fuchsia.dev/fuchsia/src/sys/pkg/bin/pm/build"
+)
+
+// runTestDoctor runs `pm doctor` with args and returns what it writes.
+func runTestDoctor(t *testing.T, cfg *build.Config, args ...string) string {
+	t.Helper()
+	var out bytes.Buffer
+	doctorStdout = &out
+	defer func() { doctorStdout = os.Stdout }()
+	if err := runDoctor(cfg, args); err != nil {
+		t.Fatal(err)
+	}
+	return out.String()
+}
+
+func TestDoctorFFXFound(t *testing.T) {
+	dir := t.TempDir()
+	ffx := filepath.Join(dir, "ffx")
+	if err := os.WriteFile(ffx, []byte("#!/bin/sh\necho 'Version: 1.2.3-test'\necho 'Build: 42'\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir)
+
+	cfg := build.NewConfig()
+	cfg.ManifestPath = "pkg/manifest"
+	cfg.OutputDir = "out"
+	cfg.PkgName = "example"
+
+	var r doctorReport
+	if err := json.Unmarshal([]byte(runTestDoctor(t, cfg, "-format", "json")), &r); err != nil {
+		t.Fatal(err)
+	}
+	if !r.FFX.Found || r.FFX.Path != ffx || r.FFX.Version != "Version: 1.2.3-test" {
+		t.Errorf("got ffx %+v, want %s with its version", r.FFX, ffx)
+	}
+
+	invocations := map[string]string{}
+	for _, m := range r.Commands {
+		if m.Invocation == "" && m.Note == "" {
+			t.Errorf("command %q has neither an invocation nor a note", m.Command)
+		}
+		invocations[m.Command] = m.Invocation
+	}
+	if _, ok := invocations["far"]; ok {
+		t.Error("the report lists active command far")
+	}
+	for name, want := range map[string]string{
+		"build":   "ffx package build pkg/manifest -o out --published-name example",
+		"newrepo": "ffx repository create",
+	} {
+		if got := invocations[name]; got != want {
+			t.Errorf("pm %s: got invocation %q, want %q", name, got, want)
+		}
+	}
+
+	if text := runTestDoctor(t, cfg); !strings.Contains(text, "Version: 1.2.3-test") {
+		t.Errorf("text report %q doesn't show the ffx version", text)
+	}
+}
+
+func TestDoctorFFXMissing(t *testing.T) {
+	t.Setenv("PATH", t.TempDir())
+
+	text := runTestDoctor(t, build.NewConfig())
+	if !strings.Contains(text, "ffx: missing") {
+		t.Errorf("text report %q doesn't report ffx missing", text)
+	}
+
+	var r doctorReport
+	if err := json.Unmarshal([]byte(runTestDoctor(t, build.NewConfig(), "-format=json")), &r); err != nil {
+		t.Fatal(err)
+	}
+	if r.FFX.Found || r.FFX.Path != "" {
+		t.Errorf("got ffx %+v, want it missing", r.FFX)
+	}
+}
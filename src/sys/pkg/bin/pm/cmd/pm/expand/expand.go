@@ -51,7 +51,7 @@ func Run(cfg *build.Config, args []string) error {
 	}
 
 	if len(fs.Args()) > 1 {
-		fmt.Fprintf(os.Stderr, "WARNING: unused arguments: %s\n", fs.Args()[1:])
+		cfg.Warnf("unused arguments: %s", fs.Args()[1:])
 	}
 
 	af, err := os.Open(fs.Arg(0))
@@ -303,6 +303,9 @@ func writeEntries(p *far.Reader, outputDir string, names []string) error {
 
 // Extract out a specified file from the .far and write it to the outputDir.
 func writeEntry(p *far.Reader, outputDir string, name string) error {
+	if err := build.ValidateArchivePath(name); err != nil {
+		return err
+	}
 	dst := filepath.Join(outputDir, name)
 	log.Printf("writing %s to %s", name, dst)
 
@@ -0,0 +1,401 @@
+// Copyright 2024 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+// Package far implements the `pm far` command
+package far
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"go.fuchsia.dev/fuchsia/src/sys/pkg/bin/pm/build"
+	"go.fuchsia.dev/fuchsia/src/sys/pkg/lib/far/go"
+)
+
+const usage = `Usage: %s far <subcommand> [-help]
+inspect Fuchsia archives. Subcommands are:
+
+  verify-signature [-key file] [-signature file] [archive]
+    verify the ed25519 signature of an archive, which defaults to the meta.far
+    in the output directory. The signature is read from -signature if given,
+    or from the archive's meta/signature otherwise. The public key is read
+    from -key if given, or from the archive's meta/pubkey otherwise. A key
+    taken from the archive is untrusted: it only shows that the archive is
+    consistent with itself, not who signed it, so pass -key to check the
+    signer.
+
+  checksum -f archive.far [-algo merkle|sha256]
+    print the checksum of the whole archive file, its merkle root by default,
+    so that it can be recorded and checked again after the archive is copied.
+    Unlike the merkle roots of the blobs in it, it covers every byte of the
+    file.
+
+  compare -a a.far -b b.far [-format text|json]
+    compare two package archives by the merkle roots of their blobs: list the
+    blobs only in a, only in b, and in both at different paths, and the files
+    of their meta.fars that differ. Only the meta.fars are read.
+
+  extract-blob -f package.far -merkle <hex> -o file
+    write the blob with the given merkle root from a package archive to file,
+    checking that its content matches the merkle root.
+
+  index -f package.far -o index.json
+    write the offset and length of each entry of an archive as JSON, along
+    with the merkle roots of the entries named by them, so that entries can be
+    fetched with range requests. Only the archive's directory is read.
+
+  mtree -f package.far
+    print a sorted listing of the entries of an archive, with their sizes and
+    merkle roots, in the style of mtree(5), for comparing archives with diff.
+    The blobs of a package archive are listed by their paths in the package,
+    and its meta.far as meta/.
+
+  repack -f in.far -o out.far
+    rewrite an archive in the canonical layout pm produces, with its entries
+    sorted, so that archives with the same content are identical. Every
+    entry keeps its content and merkle root. Archive entries are stored
+    uncompressed, so there is nothing to recompress.
+
+  set-meta -f in.far -o out.far [-name name] [-version version]
+    rewrite a package archive with the name or version of its meta/package
+    replaced, for local iteration without a rebuild. Only the meta.far, and
+    so its merkle root, changes; the blobs are copied as they are. Signed
+    meta.fars are refused, since their signatures would no longer verify.
+
+  validate-paths -f archive.far
+    check that every entry of an archive can be extracted safely: that no
+    entry name is absolute, traverses out of the extraction directory with
+    "..", or contains control characters. Unsafe entries are reported and
+    cause a non-zero exit.
+`
+
+// stdout is where the results of subcommands are written.
+var stdout io.Writer = os.Stdout
+
+// subcommands maps the name of each subcommand to the function that runs it.
+var subcommands = map[string]func(cfg *build.Config, args []string) error{
+	"verify-signature": verifySignature,
+	"checksum":         checksum,
+	"compare":          compare,
+	"extract-blob":     extractBlob,
+	"index":            index,
+	"mtree":            mtree,
+	"repack":           repack,
+	"set-meta":         setMeta,
+	"validate-paths":   validatePaths,
+}
+
+// Run runs a `pm far` subcommand
+func Run(cfg *build.Config, args []string) error {
+	if len(args) == 0 {
+		fmt.Fprintf(os.Stderr, usage, filepath.Base(os.Args[0]))
+		return fmt.Errorf("far: no subcommand given")
+	}
+	run, ok := subcommands[args[0]]
+	if !ok {
+		fmt.Fprintf(os.Stderr, usage, filepath.Base(os.Args[0]))
+		return fmt.Errorf("far: unknown subcommand %q", args[0])
+	}
+	return run(cfg, args[1:])
+}
+
+func newFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet("far "+name, flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, usage, filepath.Base(os.Args[0]))
+		fmt.Fprintln(os.Stderr)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+func verifySignature(cfg *build.Config, args []string) error {
+	fs := newFlagSet("verify-signature")
+	keyPath := fs.String("key", "", "path to the trusted raw ed25519 public key; defaults to the untrusted key recorded in the archive")
+	signaturePath := fs.String("signature", "", "path to a detached raw ed25519 signature over the archive; defaults to the embedded signature")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	archivePath := cfg.MetaFAR()
+	switch fs.NArg() {
+	case 0:
+	case 1:
+		archivePath = fs.Arg(0)
+	default:
+		cfg.Warnf("unused arguments: %s", fs.Args()[1:])
+		archivePath = fs.Arg(0)
+	}
+
+	if *keyPath == "" {
+		cfg.Warnf("no -key given: checking %s against the key in its own %s, which is untrusted and doesn't show who signed it", archivePath, build.PubkeyFile)
+	}
+	check, err := build.VerifyArchiveSignature(archivePath, *keyPath, *signaturePath)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(stdout, "verified %s of %s\n", check, archivePath)
+	return nil
+}
+
+func checksum(cfg *build.Config, args []string) error {
+	fs := newFlagSet("checksum")
+	archivePath := fs.String("f", "", "path to the archive")
+	algo := fs.String("algo", "merkle", fmt.Sprintf("checksum algorithm, one of %v", build.ChecksumAlgos))
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if len(fs.Args()) != 0 {
+		cfg.Warnf("unused arguments: %s", fs.Args())
+	}
+	if *archivePath == "" {
+		return fmt.Errorf("far checksum: -f is required")
+	}
+
+	sum, err := build.ArchiveChecksum(*archivePath, *algo)
+	if err != nil {
+		return fmt.Errorf("far checksum: %w", err)
+	}
+	fmt.Fprintf(stdout, "%s  %s\n", sum, *archivePath)
+	return nil
+}
+
+func compare(cfg *build.Config, args []string) error {
+	fs := newFlagSet("compare")
+	pathA := fs.String("a", "", "path to the first package archive")
+	pathB := fs.String("b", "", "path to the second package archive")
+	format := fs.String("format", "text", "output format, one of: text, json")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if len(fs.Args()) != 0 {
+		cfg.Warnf("unused arguments: %s", fs.Args())
+	}
+	if *pathA == "" || *pathB == "" {
+		return fmt.Errorf("far compare: -a and -b are required")
+	}
+	if *format != "text" && *format != "json" {
+		return fmt.Errorf("far compare: unknown format %q, want text or json", *format)
+	}
+
+	c, err := build.CompareArchives(*pathA, *pathB)
+	if err != nil {
+		return fmt.Errorf("far compare: %w", err)
+	}
+	if *format == "json" {
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(c)
+	}
+
+	if c.Identical() {
+		fmt.Fprintf(stdout, "%s and %s hold the same package\n", *pathA, *pathB)
+		return nil
+	}
+	for _, blob := range c.OnlyA {
+		fmt.Fprintf(stdout, "only in a: %s %s size=%d\n", strings.Join(blob.Paths, ","), blob.Merkle, blob.Size)
+	}
+	for _, blob := range c.OnlyB {
+		fmt.Fprintf(stdout, "only in b: %s %s size=%d\n", strings.Join(blob.Paths, ","), blob.Merkle, blob.Size)
+	}
+	for _, blob := range c.Moved {
+		fmt.Fprintf(stdout, "moved: %s -> %s %s size=%d\n", strings.Join(blob.PathsA, ","), strings.Join(blob.PathsB, ","), blob.Merkle, blob.Size)
+	}
+	for _, d := range c.Meta {
+		switch {
+		case d.A == "":
+			fmt.Fprintf(stdout, "meta only in b: %s\n", d.Path)
+		case d.B == "":
+			fmt.Fprintf(stdout, "meta only in a: %s\n", d.Path)
+		default:
+			fmt.Fprintf(stdout, "meta differs: %s\n", d.Path)
+		}
+	}
+	return nil
+}
+
+func extractBlob(cfg *build.Config, args []string) error {
+	fs := newFlagSet("extract-blob")
+	archivePath := fs.String("f", "", "path to the package archive")
+	merkle := fs.String("merkle", "", "merkle root of the blob to extract, in hex")
+	outputPath := fs.String("o", "", "path to write the blob to")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if len(fs.Args()) != 0 {
+		cfg.Warnf("unused arguments: %s", fs.Args())
+	}
+	if *archivePath == "" || *merkle == "" || *outputPath == "" {
+		return fmt.Errorf("far extract-blob: -f, -merkle and -o are required")
+	}
+
+	root, err := build.DecodeMerkleRoot([]byte(*merkle))
+	if err != nil {
+		return fmt.Errorf("far extract-blob: invalid merkle root %q: %w", *merkle, err)
+	}
+	b, err := build.ExtractArchiveBlob(*archivePath, root)
+	if err != nil {
+		return fmt.Errorf("far extract-blob: %s: %w", *archivePath, err)
+	}
+	if err := os.WriteFile(*outputPath, b, 0o644); err != nil {
+		return err
+	}
+	fmt.Fprintf(stdout, "extracted blob %s from %s to %s\n", root, *archivePath, *outputPath)
+	return nil
+}
+
+func validatePaths(cfg *build.Config, args []string) error {
+	fs := newFlagSet("validate-paths")
+	archivePath := fs.String("f", "", "path to the archive")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if len(fs.Args()) != 0 {
+		cfg.Warnf("unused arguments: %s", fs.Args())
+	}
+	if *archivePath == "" {
+		return fmt.Errorf("far validate-paths: -f is required")
+	}
+
+	f, err := os.Open(*archivePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	r, err := far.NewReader(f)
+	if err != nil {
+		return fmt.Errorf("far validate-paths: %s: %w", *archivePath, err)
+	}
+
+	var unsafe []string
+	for _, name := range r.List() {
+		if err := build.ValidateArchivePath(name); err != nil {
+			fmt.Fprintf(stdout, "unsafe entry: %s\n", err)
+			unsafe = append(unsafe, fmt.Sprintf("%q", name))
+		}
+	}
+	if len(unsafe) != 0 {
+		return fmt.Errorf("far validate-paths: %s has unsafe entries: %s", *archivePath, strings.Join(unsafe, ", "))
+	}
+	fmt.Fprintf(stdout, "all entries of %s are safe to extract\n", *archivePath)
+	return nil
+}
+
+func index(cfg *build.Config, args []string) error {
+	fs := newFlagSet("index")
+	archivePath := fs.String("f", "", "path to the archive")
+	outputPath := fs.String("o", "", "path to write the index to")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if len(fs.Args()) != 0 {
+		cfg.Warnf("unused arguments: %s", fs.Args())
+	}
+	if *archivePath == "" || *outputPath == "" {
+		return fmt.Errorf("far index: -f and -o are required")
+	}
+
+	f, err := os.Open(*archivePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	entries, err := build.IndexArchive(f)
+	if err != nil {
+		return fmt.Errorf("far index: %s: %w", *archivePath, err)
+	}
+	b, err := json.MarshalIndent(struct {
+		Entries []build.ArchiveIndexEntry `json:"entries"`
+	}{entries}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(*outputPath, append(b, '\n'), 0o644); err != nil {
+		return err
+	}
+	fmt.Fprintf(stdout, "indexed %d entries of %s\n", len(entries), *archivePath)
+	return nil
+}
+
+func mtree(cfg *build.Config, args []string) error {
+	fs := newFlagSet("mtree")
+	archivePath := fs.String("f", "", "path to the archive")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if len(fs.Args()) != 0 {
+		cfg.Warnf("unused arguments: %s", fs.Args())
+	}
+	if *archivePath == "" {
+		return fmt.Errorf("far mtree: -f is required")
+	}
+
+	entries, err := build.MtreeArchive(*archivePath)
+	if err != nil {
+		return fmt.Errorf("far mtree: %w", err)
+	}
+	return build.WriteMtree(stdout, entries)
+}
+
+func repack(cfg *build.Config, args []string) error {
+	fs := newFlagSet("repack")
+	inPath := fs.String("f", "", "path to the archive to repack")
+	outPath := fs.String("o", "", "path to write the repacked archive to")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if len(fs.Args()) != 0 {
+		cfg.Warnf("unused arguments: %s", fs.Args())
+	}
+	if *inPath == "" || *outPath == "" {
+		return fmt.Errorf("far repack: -f and -o are required")
+	}
+
+	if err := build.RepackArchive(*inPath, *outPath); err != nil {
+		return fmt.Errorf("far repack: %w", err)
+	}
+	fmt.Fprintf(stdout, "repacked %s to %s\n", *inPath, *outPath)
+	return nil
+}
+
+func setMeta(cfg *build.Config, args []string) error {
+	fs := newFlagSet("set-meta")
+	inPath := fs.String("f", "", "path to the package archive")
+	outPath := fs.String("o", "", "path to write the rewritten archive to")
+	name := fs.String("name", "", "new package name")
+	version := fs.String("version", "", "new package version")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if len(fs.Args()) != 0 {
+		cfg.Warnf("unused arguments: %s", fs.Args())
+	}
+	if *inPath == "" || *outPath == "" {
+		return fmt.Errorf("far set-meta: -f and -o are required")
+	}
+	if *name == "" && *version == "" {
+		return fmt.Errorf("far set-meta: -name or -version is required")
+	}
+
+	root, err := build.SetArchiveMeta(*inPath, *outPath, *name, *version)
+	if err != nil {
+		return fmt.Errorf("far set-meta: %w", err)
+	}
+	fmt.Fprintf(stdout, "wrote %s with meta.far %s\n", *outPath, root)
+	return nil
+}
@@ -0,0 +1,794 @@
+// Copyright 2024 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package far
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"go.fuchsia.dev/fuchsia/src/sys/pkg/bin/pm/build"
+	"go.fuchsia.dev/fuchsia/src/sys/pkg/lib/far/go"
+	"go.fuchsia.dev/fuchsia/src/sys/pkg/lib/merkle"
+)
+
+func TestVerifySignature(t *testing.T) {
+	cfg := build.TestConfig()
+	defer os.RemoveAll(filepath.Dir(cfg.TempDir))
+	build.BuildTestPackage(cfg)
+
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	archive, err := os.ReadFile(cfg.MetaFAR())
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyPath := filepath.Join(cfg.TempDir, "key.pub")
+	if err := os.WriteFile(keyPath, pub, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	sigPath := filepath.Join(cfg.TempDir, "meta.far.sig")
+	if err := os.WriteFile(sigPath, ed25519.Sign(priv, archive), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	stdout = &out
+	defer func() { stdout = os.Stdout }()
+
+	if err := Run(cfg, []string{"verify-signature", "-key", keyPath, "-signature", sigPath}); err != nil {
+		t.Fatal(err)
+	}
+	if got := out.String(); !strings.Contains(got, keyPath) || !strings.Contains(got, sigPath) {
+		t.Errorf("got %q, want the key and signature that were checked", got)
+	}
+
+	otherPub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyPath, otherPub, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	err = Run(cfg, []string{"verify-signature", "-key", keyPath, "-signature", sigPath, cfg.MetaFAR()})
+	if err == nil || !strings.Contains(err.Error(), keyPath) {
+		t.Errorf("wrong key: got %v, want failure naming %s", err, keyPath)
+	}
+
+	var warnings bytes.Buffer
+	cfg.WarningWriter = &warnings
+	Run(cfg, []string{"verify-signature", "-signature", sigPath})
+	if got := warnings.String(); !strings.Contains(got, "untrusted") || !strings.Contains(got, build.PubkeyFile) {
+		t.Errorf("no -key: got warnings %q, want one that the key in %s is untrusted", got, build.PubkeyFile)
+	}
+	warnings.Reset()
+	Run(cfg, []string{"verify-signature", "-key", keyPath, "-signature", sigPath})
+	if got := warnings.String(); got != "" {
+		t.Errorf("-key: got warnings %q, want none", got)
+	}
+
+	if err := Run(cfg, []string{"verify"}); err == nil {
+		t.Errorf("unknown subcommand: got nil error")
+	}
+}
+
+func TestExtractBlob(t *testing.T) {
+	cfg := build.TestConfig()
+	defer os.RemoveAll(filepath.Dir(cfg.TempDir))
+	build.BuildTestPackage(cfg)
+
+	name := filepath.Join(cfg.TempDir, "testpackage-0")
+	if err := build.Archive(cfg, name); err != nil {
+		t.Fatal(err)
+	}
+	archivePath := name + ".far"
+
+	blobs, err := cfg.BlobInfo()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stdout = &bytes.Buffer{}
+	defer func() { stdout = os.Stdout }()
+
+	outputPath := filepath.Join(cfg.TempDir, "blob")
+	for _, blob := range blobs {
+		if err := Run(cfg, []string{"extract-blob", "-f", archivePath, "-merkle", blob.Merkle.String(), "-o", outputPath}); err != nil {
+			t.Fatalf("extracting %s: %v", blob.Path, err)
+		}
+		got, err := os.ReadFile(outputPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want, err := os.ReadFile(blob.SourcePath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("extracted %s: got %q, want %q", blob.Path, got, want)
+		}
+	}
+
+	missing := strings.Repeat("0", 64)
+	err = Run(cfg, []string{"extract-blob", "-f", archivePath, "-merkle", missing, "-o", outputPath})
+	if !errors.Is(err, build.ErrBlobNotInArchive) {
+		t.Errorf("missing blob: got %v, want %v", err, build.ErrBlobNotInArchive)
+	}
+
+	// Replace the content of a blob in the archive.
+	var corrupt build.MerkleRoot
+	inputs := map[string]string{}
+	f, err := os.Open(archivePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	r, err := far.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range r.List() {
+		b, err := r.ReadFile(entry)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if entry != "meta.far" && corrupt == (build.MerkleRoot{}) {
+			corrupt = build.MustDecodeMerkleRoot(entry)
+			b = append(b, "corrupt"...)
+		}
+		src := filepath.Join(cfg.TempDir, "entries", entry)
+		if err := os.MkdirAll(filepath.Dir(src), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(src, b, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		inputs[entry] = src
+	}
+	corruptPath := filepath.Join(cfg.TempDir, "corrupt.far")
+	out, err := os.Create(corruptPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := far.Write(out, inputs); err != nil {
+		t.Fatal(err)
+	}
+	if err := out.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	os.Remove(outputPath)
+	err = Run(cfg, []string{"extract-blob", "-f", corruptPath, "-merkle", corrupt.String(), "-o", outputPath})
+	var mismatch build.ErrBlobMerkleMismatch
+	if !errors.As(err, &mismatch) || mismatch.Want != corrupt {
+		t.Errorf("corrupt blob: got %v, want merkle mismatch for %s", err, corrupt)
+	}
+	if _, err := os.Stat(outputPath); !os.IsNotExist(err) {
+		t.Errorf("corrupt blob was written to %s", outputPath)
+	}
+}
+
+func TestValidatePaths(t *testing.T) {
+	cfg := build.TestConfig()
+	defer os.RemoveAll(filepath.Dir(cfg.TempDir))
+	build.BuildTestPackage(cfg)
+
+	name := filepath.Join(cfg.TempDir, "testpackage-0")
+	if err := build.Archive(cfg, name); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	stdout = &out
+	defer func() { stdout = os.Stdout }()
+
+	if err := Run(cfg, []string{"validate-paths", "-f", name + ".far"}); err != nil {
+		t.Errorf("safe archive: %v", err)
+	}
+
+	src := filepath.Join(cfg.TempDir, "evil")
+	if err := os.WriteFile(src, []byte("evil\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	unsafePath := filepath.Join(cfg.TempDir, "unsafe.far")
+	f, err := os.Create(unsafePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := far.Write(f, map[string]string{"meta.far": cfg.MetaFAR(), "../evil": src}); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	out.Reset()
+	err = Run(cfg, []string{"validate-paths", "-f", unsafePath})
+	if err == nil || !strings.Contains(err.Error(), `"../evil"`) {
+		t.Errorf("unsafe archive: got %v, want failure naming ../evil", err)
+	}
+	if strings.Contains(err.Error(), "meta.far") {
+		t.Errorf("unsafe archive: got %v, want only the unsafe entry named", err)
+	}
+	if got := out.String(); !strings.Contains(got, "../evil") {
+		t.Errorf("got output %q, want the unsafe entry reported", got)
+	}
+}
+
+// writeUnsortedArchive writes an archive of entries as an older tool might
+// have: the directory is sorted as the format requires, but the names and
+// contents are laid out in reverse order.
+func writeUnsortedArchive(t *testing.T, path string, names []string, entries map[string][]byte) {
+	t.Helper()
+	const (
+		dirChunk      = 0x2d2d2d2d2d524944 // "DIR-----"
+		dirNamesChunk = 0x53454d414e524944 // "DIRNAMES"
+		blockSize     = 4096
+	)
+	align := func(n, a uint64) uint64 { return (n + a - 1) / a * a }
+
+	var namesChunk []byte
+	nameOffsets := map[string]uint64{}
+	for i := len(names) - 1; i >= 0; i-- {
+		nameOffsets[names[i]] = uint64(len(namesChunk))
+		namesChunk = append(namesChunk, names[i]...)
+	}
+	namesLen := align(uint64(len(namesChunk)), 8)
+	namesChunk = append(namesChunk, make([]byte, namesLen-uint64(len(namesChunk)))...)
+
+	indexLen := uint64(2 * 24)
+	dirLen := uint64(len(names)) * 32
+	offset := align(16+indexLen+dirLen+namesLen, blockSize)
+	dataOffsets := map[string]uint64{}
+	for i := len(names) - 1; i >= 0; i-- {
+		dataOffsets[names[i]] = offset
+		offset = align(offset+uint64(len(entries[names[i]])), blockSize)
+	}
+
+	le := binary.LittleEndian
+	var b bytes.Buffer
+	b.Write([]byte{0xc8, 0xbf, 0x0b, 0x48, 0xad, 0xab, 0xc5, 0x11})
+	binary.Write(&b, le, []uint64{indexLen, dirChunk, 16 + indexLen, dirLen, dirNamesChunk, 16 + indexLen + dirLen, namesLen})
+	for _, name := range names {
+		binary.Write(&b, le, uint32(nameOffsets[name]))
+		binary.Write(&b, le, uint16(len(name)))
+		binary.Write(&b, le, uint16(0))
+		binary.Write(&b, le, []uint64{dataOffsets[name], uint64(len(entries[name])), 0})
+	}
+	b.Write(namesChunk)
+	for i := len(names) - 1; i >= 0; i-- {
+		b.Write(make([]byte, dataOffsets[names[i]]-uint64(b.Len())))
+		b.Write(entries[names[i]])
+	}
+	b.Write(make([]byte, align(uint64(b.Len()), blockSize)-uint64(b.Len())))
+	if err := os.WriteFile(path, b.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func merkleRoots(t *testing.T, path string) map[string]string {
+	t.Helper()
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := far.NewReader(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots := map[string]string{}
+	for _, name := range r.List() {
+		content, err := r.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var tree merkle.Tree
+		if _, err := tree.ReadFrom(bytes.NewReader(content)); err != nil {
+			t.Fatal(err)
+		}
+		roots[name] = fmt.Sprintf("%x", tree.Root())
+	}
+	return roots
+}
+
+func TestRepack(t *testing.T) {
+	dir := t.TempDir()
+	names := []string{"a", "b", "dir/c", "meta/package"}
+	entries := map[string][]byte{
+		"a":            []byte("a\n"),
+		"b":            bytes.Repeat([]byte("b"), 5000),
+		"dir/c":        {},
+		"meta/package": []byte(`{"name":"fixture","version":"0"}`),
+	}
+	inPath := filepath.Join(dir, "unsorted.far")
+	writeUnsortedArchive(t, inPath, names, entries)
+
+	stdout = &bytes.Buffer{}
+	defer func() { stdout = os.Stdout }()
+
+	firstPath := filepath.Join(dir, "first.far")
+	secondPath := filepath.Join(dir, "second.far")
+	for _, outPath := range []string{firstPath, secondPath} {
+		if err := Run(&build.Config{}, []string{"repack", "-f", inPath, "-o", outPath}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	in, err := os.ReadFile(inPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, err := os.ReadFile(firstPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := os.ReadFile(secondPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(first, second) {
+		t.Errorf("repacking the same archive twice gave different archives")
+	}
+	if bytes.Equal(in, first) {
+		t.Errorf("repacked archive is identical to the unsorted one")
+	}
+
+	want := merkleRoots(t, inPath)
+	if len(want) != len(names) {
+		t.Fatalf("fixture has entries %v, want %v", want, names)
+	}
+	got := merkleRoots(t, firstPath)
+	if len(got) != len(want) {
+		t.Errorf("repacked archive has entries %v, want %v", got, want)
+	}
+	for name, root := range want {
+		if got[name] != root {
+			t.Errorf("entry %s: got merkle root %s, want %s", name, got[name], root)
+		}
+	}
+
+	// Repacking a canonical archive leaves it unchanged.
+	thirdPath := filepath.Join(dir, "third.far")
+	if err := Run(&build.Config{}, []string{"repack", "-f", firstPath, "-o", thirdPath}); err != nil {
+		t.Fatal(err)
+	}
+	third, err := os.ReadFile(thirdPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(first, third) {
+		t.Errorf("repacking a repacked archive changed it")
+	}
+}
+
+func TestIndex(t *testing.T) {
+	cfg := build.TestConfig()
+	defer os.RemoveAll(filepath.Dir(cfg.TempDir))
+	build.BuildTestPackage(cfg)
+
+	name := filepath.Join(cfg.TempDir, "testpackage-0")
+	if err := build.Archive(cfg, name); err != nil {
+		t.Fatal(err)
+	}
+	archivePath := name + ".far"
+	indexPath := filepath.Join(cfg.TempDir, "index.json")
+
+	stdout = &bytes.Buffer{}
+	defer func() { stdout = os.Stdout }()
+	if err := Run(cfg, []string{"index", "-f", archivePath, "-o", indexPath}); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := os.ReadFile(indexPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var index struct {
+		Entries []build.ArchiveIndexEntry `json:"entries"`
+	}
+	if err := json.Unmarshal(b, &index); err != nil {
+		t.Fatal(err)
+	}
+	archive, err := os.Open(archivePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer archive.Close()
+
+	blobs, err := cfg.BlobInfo()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]bool{}
+	for _, blob := range blobs {
+		if blob.Path != "meta/" {
+			want[blob.Merkle.String()] = true
+		}
+	}
+
+	metaFar, err := os.ReadFile(cfg.MetaFAR())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range index.Entries {
+		// Extract the entry using nothing but the index.
+		content := make([]byte, e.Length)
+		if _, err := archive.ReadAt(content, int64(e.Offset)); err != nil && e.Length != 0 {
+			t.Fatalf("reading %s: %v", e.Name, err)
+		}
+		if e.Name == "meta.far" {
+			if !bytes.Equal(content, metaFar) {
+				t.Errorf("meta.far at offset %d, length %d doesn't match the package's meta.far", e.Offset, e.Length)
+			}
+			continue
+		}
+		if e.Merkle != e.Name {
+			t.Errorf("entry %s has merkle %q, want its name", e.Name, e.Merkle)
+		}
+		var tree merkle.Tree
+		if _, err := tree.ReadFrom(bytes.NewReader(content)); err != nil {
+			t.Fatal(err)
+		}
+		if got := fmt.Sprintf("%x", tree.Root()); got != e.Merkle {
+			t.Errorf("blob at offset %d, length %d has merkle %s, want %s", e.Offset, e.Length, got, e.Merkle)
+		}
+		delete(want, e.Merkle)
+	}
+	if len(want) != 0 {
+		t.Errorf("the index is missing blobs %v", want)
+	}
+
+	if err := Run(cfg, []string{"index", "-f", indexPath, "-o", filepath.Join(cfg.TempDir, "bad.json")}); err == nil || !strings.Contains(err.Error(), "not an archive") {
+		t.Errorf("got %v, want error saying the input isn't an archive", err)
+	}
+}
+
+func TestMtree(t *testing.T) {
+	cfg := build.TestConfig()
+	defer os.RemoveAll(filepath.Dir(cfg.TempDir))
+	build.BuildTestPackage(cfg)
+
+	mtreeOf := func(name string) []string {
+		t.Helper()
+		path := filepath.Join(cfg.TempDir, name)
+		if err := build.Archive(cfg, path); err != nil {
+			t.Fatal(err)
+		}
+		var out bytes.Buffer
+		stdout = &out
+		defer func() { stdout = os.Stdout }()
+		if err := Run(cfg, []string{"mtree", "-f", path + ".far"}); err != nil {
+			t.Fatal(err)
+		}
+		return strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	}
+	before := mtreeOf("before")
+	if again := mtreeOf("again"); strings.Join(again, "\n") != strings.Join(before, "\n") {
+		t.Errorf("listings of the same package differ:\n%s\n\n%s", strings.Join(before, "\n"), strings.Join(again, "\n"))
+	}
+	if before[0] != "#mtree" || !sort.StringsAreSorted(before[1:]) {
+		t.Errorf("got listing\n%s\nwant a #mtree header and sorted entries", strings.Join(before, "\n"))
+	}
+
+	// Change the content of one blob, and rebuild the package.
+	manifest, err := cfg.Manifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(manifest.Paths["dir/c"], []byte("changed\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := build.BuildPackage(context.Background(), cfg); err != nil {
+		t.Fatal(err)
+	}
+	after := mtreeOf("after")
+
+	// The listings differ only in the changed blob and meta.far, which lists
+	// it.
+	removed := map[string]bool{}
+	for _, line := range before {
+		removed[line] = true
+	}
+	var added []string
+	for _, line := range after {
+		if removed[line] {
+			delete(removed, line)
+		} else {
+			added = append(added, strings.Fields(line)[0])
+		}
+	}
+	var gone []string
+	for line := range removed {
+		gone = append(gone, strings.Fields(line)[0])
+	}
+	sort.Strings(gone)
+	if want := []string{"dir/c", "meta/"}; strings.Join(added, " ") != strings.Join(want, " ") || strings.Join(gone, " ") != strings.Join(want, " ") {
+		t.Errorf("got lines for %q removed and %q added, want just %q", gone, added, want)
+	}
+}
+
+func TestCompare(t *testing.T) {
+	cfg := build.TestConfig()
+	defer os.RemoveAll(filepath.Dir(cfg.TempDir))
+	build.BuildTestPackage(cfg)
+	pathA := filepath.Join(cfg.TempDir, "a")
+	if err := build.Archive(cfg, pathA); err != nil {
+		t.Fatal(err)
+	}
+
+	// Build package b from the same files, except that a moves to moved/a,
+	// dir/c has new content, and meta/package has a new name.
+	dir := filepath.Dir(cfg.ManifestPath)
+	newC := filepath.Join(dir, "c2")
+	if err := os.WriteFile(newC, []byte("changed\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	newPackage := filepath.Join(dir, "package2")
+	if err := os.WriteFile(newPackage, []byte(`{"name":"otherpackage","version":"0"}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(cfg.ManifestPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var lines []string
+	for _, line := range strings.Split(strings.TrimSpace(string(b)), "\n") {
+		switch dst, _, _ := strings.Cut(line, "="); dst {
+		case "a":
+			line = "moved/" + line
+		case "dir/c":
+			line = "dir/c=" + newC
+		case "meta/package":
+			line = "meta/package=" + newPackage
+		}
+		lines = append(lines, line)
+	}
+	cfgB := build.TestConfig()
+	defer os.RemoveAll(filepath.Dir(cfgB.TempDir))
+	cfgB.PkgName = "otherpackage"
+	if err := os.WriteFile(cfgB.ManifestPath, []byte(strings.Join(lines, "\n")+"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := build.BuildPackage(context.Background(), cfgB); err != nil {
+		t.Fatal(err)
+	}
+	pathB := filepath.Join(cfgB.TempDir, "b")
+	if err := build.Archive(cfgB, pathB); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	stdout = &out
+	defer func() { stdout = os.Stdout }()
+	if err := Run(cfg, []string{"compare", "-a", pathA + ".far", "-b", pathB + ".far", "-format", "json"}); err != nil {
+		t.Fatal(err)
+	}
+	var c build.ArchiveComparison
+	if err := json.Unmarshal(out.Bytes(), &c); err != nil {
+		t.Fatalf("got %q, which isn't a comparison: %v", out.String(), err)
+	}
+
+	paths := func(blobs []build.ComparedBlob) string {
+		var ps []string
+		for _, blob := range blobs {
+			ps = append(ps, strings.Join(blob.Paths, ","))
+		}
+		return strings.Join(ps, " ")
+	}
+	if got := paths(c.OnlyA); got != "dir/c" {
+		t.Errorf("got blobs only in a %q, want dir/c", got)
+	}
+	if got := paths(c.OnlyB); got != "dir/c" {
+		t.Errorf("got blobs only in b %q, want dir/c", got)
+	}
+	if len(c.OnlyA) == 1 && len(c.OnlyB) == 1 {
+		if c.OnlyA[0].Merkle == c.OnlyB[0].Merkle {
+			t.Errorf("got dir/c with merkle root %s in both archives, want it to differ", c.OnlyA[0].Merkle)
+		}
+		if c.OnlyB[0].Size != uint64(len("changed\n")) {
+			t.Errorf("got dir/c of %d bytes in b, want %d", c.OnlyB[0].Size, len("changed\n"))
+		}
+	}
+	if len(c.Moved) != 1 || strings.Join(c.Moved[0].PathsA, ",") != "a" || strings.Join(c.Moved[0].PathsB, ",") != "moved/a" {
+		t.Errorf("got moved blobs %+v, want a moved to moved/a", c.Moved)
+	}
+	if len(c.Meta) != 1 || c.Meta[0].Path != "meta/package" || c.Meta[0].A == "" || c.Meta[0].B == "" {
+		t.Errorf("got meta differences %+v, want meta/package", c.Meta)
+	}
+
+	out.Reset()
+	if err := Run(cfg, []string{"compare", "-a", pathA + ".far", "-b", pathB + ".far"}); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"only in a: dir/c ", "only in b: dir/c ", "moved: a -> moved/a ", "meta differs: meta/package\n"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("got\n%s\nwant it to contain %q", out.String(), want)
+		}
+	}
+
+	out.Reset()
+	if err := Run(cfg, []string{"compare", "-a", pathA + ".far", "-b", pathA + ".far"}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "hold the same package") {
+		t.Errorf("comparing an archive with itself printed %q", out.String())
+	}
+}
+
+func TestSetMeta(t *testing.T) {
+	cfg := build.TestConfig()
+	defer os.RemoveAll(filepath.Dir(cfg.TempDir))
+	build.BuildTestPackage(cfg)
+	inPath := filepath.Join(cfg.TempDir, "in")
+	if err := build.Archive(cfg, inPath); err != nil {
+		t.Fatal(err)
+	}
+	inPath += ".far"
+	outPath := filepath.Join(cfg.TempDir, "out.far")
+
+	var out bytes.Buffer
+	stdout = &out
+	defer func() { stdout = os.Stdout }()
+	if err := Run(cfg, []string{"set-meta", "-f", inPath, "-o", outPath, "-name", "renamed", "-version", "1"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// The blobs are unchanged, and the new meta.far is the one reported.
+	want := merkleRoots(t, inPath)
+	got := merkleRoots(t, outPath)
+	if len(got) != len(want) {
+		t.Errorf("got entries %v, want %v", got, want)
+	}
+	for name, root := range want {
+		if name == "meta.far" {
+			if got[name] == root {
+				t.Errorf("meta.far is unchanged, want a new meta/package")
+			}
+			continue
+		}
+		if got[name] != root {
+			t.Errorf("blob %s: got merkle root %s, want %s", name, got[name], root)
+		}
+	}
+	if !strings.Contains(out.String(), got["meta.far"]) {
+		t.Errorf("got %q, want the merkle root of the new meta.far, %s", out.String(), got["meta.far"])
+	}
+
+	c, err := build.CompareArchives(inPath, outPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(c.OnlyA) != 0 || len(c.OnlyB) != 0 || len(c.Moved) != 0 || len(c.Meta) != 1 || c.Meta[0].Path != "meta/package" {
+		t.Errorf("got differences %+v, want only meta/package", c)
+	}
+
+	f, err := os.Open(outPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	r, err := far.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	metaFar, err := r.ReadFile("meta.far")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mr, err := far.NewReader(bytes.NewReader(metaFar))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := mr.ReadFile("meta/package")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var p struct{ Name, Version string }
+	if err := json.Unmarshal(b, &p); err != nil {
+		t.Fatal(err)
+	}
+	if p.Name != "renamed" || p.Version != "1" {
+		t.Errorf("got package %s/%s, want renamed/1", p.Name, p.Version)
+	}
+
+	// Setting only the version keeps the name.
+	if err := Run(cfg, []string{"set-meta", "-f", outPath, "-o", outPath, "-version", "2"}); err != nil {
+		t.Fatal(err)
+	}
+	c, err = build.CompareArchives(inPath, outPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(c.OnlyA) != 0 || len(c.OnlyB) != 0 || len(c.Moved) != 0 {
+		t.Errorf("got blob differences %+v after setting the version, want none", c)
+	}
+
+	for _, args := range [][]string{
+		{"-name", "Invalid"},
+		{"-version", ".."},
+		{},
+	} {
+		args = append([]string{"set-meta", "-f", inPath, "-o", filepath.Join(cfg.TempDir, "bad.far")}, args...)
+		if err := Run(cfg, args); err == nil {
+			t.Errorf("%v succeeded, want an error", args)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(cfg.TempDir, "bad.far")); !os.IsNotExist(err) {
+		t.Errorf("a failed set-meta wrote an archive: %v", err)
+	}
+}
+
+func TestChecksum(t *testing.T) {
+	cfg := build.TestConfig()
+	defer os.RemoveAll(filepath.Dir(cfg.TempDir))
+	build.BuildTestPackage(cfg)
+	archivePath := filepath.Join(cfg.TempDir, "package")
+	if err := build.Archive(cfg, archivePath); err != nil {
+		t.Fatal(err)
+	}
+	archivePath += ".far"
+	b, err := os.ReadFile(archivePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	stdout = &out
+	defer func() { stdout = os.Stdout }()
+	checksum := func(algo string) string {
+		t.Helper()
+		out.Reset()
+		if err := Run(cfg, []string{"checksum", "-f", archivePath, "-algo", algo}); err != nil {
+			t.Fatal(err)
+		}
+		sum, path, _ := strings.Cut(strings.TrimSpace(out.String()), "  ")
+		if path != archivePath {
+			t.Errorf("got %q, want the checksum of %s", out.String(), archivePath)
+		}
+		return sum
+	}
+
+	var tree merkle.Tree
+	if _, err := tree.ReadFrom(bytes.NewReader(b)); err != nil {
+		t.Fatal(err)
+	}
+	merkleRoot := checksum("merkle")
+	if want := fmt.Sprintf("%x", tree.Root()); merkleRoot != want {
+		t.Errorf("got merkle root %s, want %s", merkleRoot, want)
+	}
+	sha := checksum("sha256")
+	if want := fmt.Sprintf("%x", sha256.Sum256(b)); sha != want {
+		t.Errorf("got SHA-256 %s, want %s", sha, want)
+	}
+
+	// Flipping a byte of the archive changes both checksums.
+	b[len(b)/2] ^= 0xff
+	if err := os.WriteFile(archivePath, b, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if got := checksum("merkle"); got == merkleRoot {
+		t.Errorf("the merkle root %s didn't change when a byte of the archive did", got)
+	}
+	if got := checksum("sha256"); got == sha {
+		t.Errorf("the SHA-256 %s didn't change when a byte of the archive did", got)
+	}
+
+	if err := Run(cfg, []string{"checksum", "-f", archivePath, "-algo", "md5"}); err == nil {
+		t.Error("checksum with an unknown algorithm succeeded")
+	}
+}
@@ -33,7 +33,7 @@ func Run(cfg *build.Config, args []string) error {
 	}
 
 	if len(fs.Args()) != 0 {
-		fmt.Fprintf(os.Stderr, "WARNING: unused arguments: %s\n", fs.Args())
+		cfg.Warnf("unused arguments: %s", fs.Args())
 	}
 
 	fmt.Fprintln(os.Stderr, "package signing is deprecated")
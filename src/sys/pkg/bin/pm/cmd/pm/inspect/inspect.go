@@ -0,0 +1,201 @@
+// Copyright 2024 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+// Package inspect implements the `pm inspect` command
+package inspect
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"text/tabwriter"
+
+	"go.fuchsia.dev/fuchsia/src/sys/pkg/bin/pm/build"
+	"go.fuchsia.dev/fuchsia/src/sys/pkg/bin/pm/pkg"
+	"go.fuchsia.dev/fuchsia/src/sys/pkg/lib/far/go"
+)
+
+const usage = `Usage: %s inspect -f <archive> [-format text|json]
+print the metadata a package declares: its name and version from meta/package,
+its ABI revision, its subpackages and the number of blobs it lists in
+meta/contents. The archive may be a meta.far, or a package archive holding one.
+Optional metadata the package doesn't have is reported as absent.
+`
+
+const (
+	metaFar         = "meta.far"
+	abiRevisionPath = "meta/fuchsia.abi/abi-revision"
+	subpackagesPath = "meta/fuchsia.pkg/subpackages"
+	contentsPath    = "meta/contents"
+)
+
+// stdout is where the report is written.
+var stdout io.Writer = os.Stdout
+
+// report is the metadata of a package. Optional metadata the package doesn't
+// have is nil.
+type report struct {
+	Name        string            `json:"name"`
+	Version     string            `json:"version"`
+	ABIRevision *string           `json:"abi_revision"`
+	Subpackages map[string]string `json:"subpackages"`
+	Blobs       *int              `json:"blobs"`
+}
+
+// Run runs the `pm inspect` command
+func Run(cfg *build.Config, args []string) error {
+	fs := flag.NewFlagSet("inspect", flag.ExitOnError)
+	archivePath := fs.String("f", "", "path to the meta.far or package archive")
+	format := fs.String("format", "text", "output format, one of: text, json")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, usage, filepath.Base(os.Args[0]))
+		fmt.Fprintln(os.Stderr)
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if len(fs.Args()) != 0 {
+		cfg.Warnf("unused arguments: %s", fs.Args())
+	}
+	if *archivePath == "" {
+		return fmt.Errorf("inspect: -f is required")
+	}
+	if *format != "text" && *format != "json" {
+		return fmt.Errorf("inspect: unknown format %q, want text or json", *format)
+	}
+
+	b, err := os.ReadFile(*archivePath)
+	if err != nil {
+		return err
+	}
+	r, err := inspect(b)
+	if err != nil {
+		return fmt.Errorf("inspect: %s: %w", *archivePath, err)
+	}
+
+	if *format == "json" {
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(r)
+	}
+	return r.writeText(stdout)
+}
+
+// inspect reads the metadata of the meta.far b, or of the meta.far in the
+// package archive b.
+func inspect(b []byte) (*report, error) {
+	archive, err := far.NewReader(bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	if hasEntry(archive, metaFar) {
+		if b, err = archive.ReadFile(metaFar); err != nil {
+			return nil, err
+		}
+		if archive, err = far.NewReader(bytes.NewReader(b)); err != nil {
+			return nil, fmt.Errorf("%s: %w", metaFar, err)
+		}
+	}
+
+	pkgJSON, err := archive.ReadFile("meta/package")
+	if err != nil {
+		return nil, fmt.Errorf("meta/package: %w", err)
+	}
+	var p pkg.Package
+	if err := json.Unmarshal(pkgJSON, &p); err != nil {
+		return nil, fmt.Errorf("meta/package: %w", err)
+	}
+	r := &report{Name: p.Name, Version: p.Version}
+
+	if hasEntry(archive, abiRevisionPath) {
+		b, err := archive.ReadFile(abiRevisionPath)
+		if err != nil {
+			return nil, err
+		}
+		if len(b) != 8 {
+			return nil, fmt.Errorf("%s is %d bytes, want 8", abiRevisionPath, len(b))
+		}
+		abiRevision := fmt.Sprintf("0x%X", binary.LittleEndian.Uint64(b))
+		r.ABIRevision = &abiRevision
+	}
+
+	if hasEntry(archive, subpackagesPath) {
+		b, err := archive.ReadFile(subpackagesPath)
+		if err != nil {
+			return nil, err
+		}
+		var subpackages build.MetaSubpackages
+		if err := json.Unmarshal(b, &subpackages); err != nil {
+			return nil, fmt.Errorf("%s: %w", subpackagesPath, err)
+		}
+		r.Subpackages = subpackages.Subpackages
+		if r.Subpackages == nil {
+			r.Subpackages = map[string]string{}
+		}
+	}
+
+	if hasEntry(archive, contentsPath) {
+		b, err := archive.ReadFile(contentsPath)
+		if err != nil {
+			return nil, err
+		}
+		contents, err := build.ParseMetaContents(bytes.NewReader(b))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", contentsPath, err)
+		}
+		blobs := len(contents)
+		r.Blobs = &blobs
+	}
+
+	return r, nil
+}
+
+func hasEntry(archive *far.Reader, name string) bool {
+	for _, entry := range archive.List() {
+		if entry == name {
+			return true
+		}
+	}
+	return false
+}
+
+// writeText writes the report as a table.
+func (r *report) writeText(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(tw, "name:\t%s\n", r.Name)
+	fmt.Fprintf(tw, "version:\t%s\n", r.Version)
+	if r.ABIRevision != nil {
+		fmt.Fprintf(tw, "abi revision:\t%s\n", *r.ABIRevision)
+	} else {
+		fmt.Fprintf(tw, "abi revision:\tabsent\n")
+	}
+	if r.Subpackages != nil {
+		fmt.Fprintf(tw, "subpackages:\t%d\n", len(r.Subpackages))
+		names := make([]string, 0, len(r.Subpackages))
+		for name := range r.Subpackages {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Fprintf(tw, "  %s\t%s\n", name, r.Subpackages[name])
+		}
+	} else {
+		fmt.Fprintf(tw, "subpackages:\tabsent\n")
+	}
+	if r.Blobs != nil {
+		fmt.Fprintf(tw, "blobs:\t%d\n", *r.Blobs)
+	} else {
+		fmt.Fprintf(tw, "blobs:\tabsent\n")
+	}
+	return tw.Flush()
+}
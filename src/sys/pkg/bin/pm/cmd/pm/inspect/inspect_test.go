@@ -0,0 +1,146 @@
+// Copyright 2024 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package inspect
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"go.fuchsia.dev/fuchsia/src/sys/pkg/bin/pm/build"
+	"go.fuchsia.dev/fuchsia/src/sys/pkg/lib/far/go"
+)
+
+const subpackageMerkle = "1111111111111111111111111111111111111111111111111111111111111111"
+
+// writeMetaFar writes a meta.far holding entries to dir, returning its path.
+func writeMetaFar(t *testing.T, dir string, entries map[string][]byte) string {
+	t.Helper()
+	inputs := map[string]string{}
+	for name, content := range entries {
+		src := filepath.Join(dir, "staging", name)
+		if err := os.MkdirAll(filepath.Dir(src), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(src, content, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		inputs[name] = src
+	}
+	path := filepath.Join(dir, "meta.far")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := far.Write(f, inputs); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// fixtureEntries returns the entries of a meta.far declaring every kind of
+// metadata pm inspect reports.
+func fixtureEntries() map[string][]byte {
+	abiRevision := make([]byte, 8)
+	binary.LittleEndian.PutUint64(abiRevision, build.TestABIRevision)
+	return map[string][]byte{
+		"meta/package":                  []byte(`{"name":"fixture","version":"0"}`),
+		"meta/fuchsia.abi/abi-revision": abiRevision,
+		"meta/fuchsia.pkg/subpackages":  []byte(`{"version":"1","subpackages":{"child":"` + subpackageMerkle + `"}}`),
+		"meta/contents": []byte(
+			"a=" + strings.Repeat("2", 64) + "\n" +
+				"b=" + strings.Repeat("3", 64) + "\n"),
+	}
+}
+
+// runInspect runs pm inspect, returning its output.
+func runInspect(t *testing.T, args ...string) string {
+	t.Helper()
+	var out bytes.Buffer
+	stdout = &out
+	defer func() { stdout = os.Stdout }()
+	if err := Run(&build.Config{}, args); err != nil {
+		t.Fatal(err)
+	}
+	return out.String()
+}
+
+func TestInspect(t *testing.T) {
+	path := writeMetaFar(t, t.TempDir(), fixtureEntries())
+
+	var got report
+	if err := json.Unmarshal([]byte(runInspect(t, "-f", path, "-format", "json")), &got); err != nil {
+		t.Fatal(err)
+	}
+	abiRevision := "0xE9CACD17EA11859D"
+	blobs := 2
+	want := report{
+		Name:        "fixture",
+		Version:     "0",
+		ABIRevision: &abiRevision,
+		Subpackages: map[string]string{"child": subpackageMerkle},
+		Blobs:       &blobs,
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("json report (-want +got):\n%s", diff)
+	}
+
+	text := runInspect(t, "-f", path)
+	for _, line := range []string{"fixture", abiRevision, "child", subpackageMerkle, "blobs:"} {
+		if !strings.Contains(text, line) {
+			t.Errorf("text report %q is missing %q", text, line)
+		}
+	}
+	if strings.Contains(text, "absent") {
+		t.Errorf("text report %q reports absent metadata", text)
+	}
+}
+
+func TestInspectMissingABIRevision(t *testing.T) {
+	entries := fixtureEntries()
+	delete(entries, "meta/fuchsia.abi/abi-revision")
+	delete(entries, "meta/fuchsia.pkg/subpackages")
+	path := writeMetaFar(t, t.TempDir(), entries)
+
+	var got report
+	if err := json.Unmarshal([]byte(runInspect(t, "-f", path, "-format", "json")), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Name != "fixture" || got.ABIRevision != nil || got.Subpackages != nil || got.Blobs == nil || *got.Blobs != 2 {
+		t.Errorf("got report %+v, want fixture/0 with 2 blobs, and no ABI revision or subpackages", got)
+	}
+
+	text := runInspect(t, "-f", path)
+	for _, line := range []string{"abi revision:  absent", "subpackages:   absent"} {
+		if !strings.Contains(text, line) {
+			t.Errorf("text report %q is missing %q", text, line)
+		}
+	}
+}
+
+func TestInspectPackageArchive(t *testing.T) {
+	cfg := build.TestConfig()
+	defer os.RemoveAll(filepath.Dir(cfg.TempDir))
+	build.BuildTestPackage(cfg)
+	name := filepath.Join(cfg.TempDir, "testpackage-0")
+	if err := build.Archive(cfg, name); err != nil {
+		t.Fatal(err)
+	}
+
+	var got report
+	if err := json.Unmarshal([]byte(runInspect(t, "-f", name+".far", "-format", "json")), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Name != cfg.PkgName || got.Version != cfg.PkgVersion || got.ABIRevision == nil {
+		t.Errorf("got report %+v, want %s/%s with an ABI revision", got, cfg.PkgName, cfg.PkgVersion)
+	}
+}
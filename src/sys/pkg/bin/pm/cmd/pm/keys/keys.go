@@ -0,0 +1,90 @@
+// Copyright 2024 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+// Package keys implements the `pm keys` command
+package keys
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"go.fuchsia.dev/fuchsia/src/sys/pkg/bin/pm/build"
+	pmrepo "go.fuchsia.dev/fuchsia/src/sys/pkg/bin/pm/repo"
+)
+
+const usage = `Usage: %s keys rotate -role root|targets|snapshot|timestamp [-repo dir] [-revoke]
+rotate the key of a repository role: generate a new key, list it in root.json,
+and re-sign the metadata with it. With -revoke, the role's old keys are removed
+from root.json. A new root.json is also signed with the old root keys, so that
+clients trusting the previous root.json accept it.
+`
+
+// stdout is where the IDs of the new keys are written.
+var stdout io.Writer = os.Stdout
+
+// Run runs a `pm keys` subcommand
+func Run(cfg *build.Config, args []string) error {
+	if len(args) == 0 || args[0] != "rotate" {
+		fmt.Fprintf(os.Stderr, usage, filepath.Base(os.Args[0]))
+		if len(args) == 0 {
+			return fmt.Errorf("keys: no subcommand given")
+		}
+		return fmt.Errorf("keys: unknown subcommand %q", args[0])
+	}
+
+	fs := flag.NewFlagSet("keys rotate", flag.ExitOnError)
+
+	config := &pmrepo.Config{}
+	config.Vars(fs)
+	role := fs.String("role", "", "role whose key to rotate, one of: root, targets, snapshot, timestamp")
+	revoke := fs.Bool("revoke", false, "remove the role's old keys from root.json")
+	lockTimeout := fs.Duration("lock-timeout", 5*time.Minute, "how long to wait for another process publishing to the repository to finish")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, usage, filepath.Base(os.Args[0]))
+		fmt.Fprintln(os.Stderr)
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+	if len(fs.Args()) != 0 {
+		cfg.Warnf("unused arguments: %s", fs.Args())
+	}
+	config.ApplyDefaults()
+
+	if *role == "" {
+		return fmt.Errorf("keys: -role is required")
+	}
+	if _, err := os.Stat(filepath.Join(config.RepoDir, "repository", "root.json")); err != nil {
+		return fmt.Errorf("keys: %s is not a repository: %w", config.RepoDir, err)
+	}
+
+	lock, err := pmrepo.AcquireLock(config.RepoDir, *lockTimeout)
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+	defer lock.UnlockOnInterrupt()()
+
+	r, err := pmrepo.New(config.RepoDir, filepath.Join(config.RepoDir, "repository", "blobs"))
+	if err != nil {
+		return err
+	}
+	ids, err := r.RotateKey(*role, *revoke)
+	if err != nil {
+		return fmt.Errorf("keys: rotating %s key: %w", *role, err)
+	}
+	if err := r.CommitUpdates(config.TimeVersioned); err != nil {
+		return fmt.Errorf("keys: committing repository: %w", err)
+	}
+	fmt.Fprintf(stdout, "new %s key: %s\n", *role, strings.Join(ids, ", "))
+	return nil
+}
@@ -0,0 +1,120 @@
+// Copyright 2024 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package keys
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.fuchsia.dev/fuchsia/src/sys/pkg/bin/pm/build"
+	pmrepo "go.fuchsia.dev/fuchsia/src/sys/pkg/bin/pm/repo"
+
+	tufData "github.com/theupdateframework/go-tuf/data"
+)
+
+// readMetadata reads the signed metadata name from the repository at dir,
+// decoding its signed portion into v.
+func readMetadata(t *testing.T, dir, name string, v interface{}) *tufData.Signed {
+	t.Helper()
+	b, err := os.ReadFile(filepath.Join(dir, "repository", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &tufData.Signed{}
+	if err := json.Unmarshal(b, s); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(s.Signed, v); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestRotateTargetsKey(t *testing.T) {
+	cfg := build.TestConfig()
+	defer os.RemoveAll(filepath.Dir(cfg.TempDir))
+	build.BuildTestPackage(cfg)
+
+	repoDir := t.TempDir()
+	r, err := pmrepo.New(repoDir, filepath.Join(repoDir, "repository", "blobs"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Init(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.PublishManifest(filepath.Join(cfg.OutputDir, "package_manifest.json")); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.CommitUpdates(false); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Run(cfg, []string{"rotate", "-repo", repoDir, "-role", "mirror"}); err == nil || !strings.Contains(err.Error(), `unknown role "mirror"`) {
+		t.Errorf("got %v, want unknown role error", err)
+	}
+
+	var oldRoot tufData.Root
+	readMetadata(t, repoDir, "root.json", &oldRoot)
+	oldIDs := oldRoot.Roles["targets"].KeyIDs
+
+	var out bytes.Buffer
+	stdout = &out
+	defer func() { stdout = os.Stdout }()
+	if err := Run(cfg, []string{"rotate", "-repo", repoDir, "-role", "targets", "-revoke"}); err != nil {
+		t.Fatal(err)
+	}
+
+	var root tufData.Root
+	readMetadata(t, repoDir, "root.json", &root)
+	if root.Version != oldRoot.Version+1 {
+		t.Errorf("got root version %d, want %d", root.Version, oldRoot.Version+1)
+	}
+	newIDs := map[string]bool{}
+	for _, id := range root.Roles["targets"].KeyIDs {
+		newIDs[id] = true
+		if !strings.Contains(out.String(), id) {
+			t.Errorf("output %q doesn't report new key %s", out.String(), id)
+		}
+	}
+	for _, id := range oldIDs {
+		if newIDs[id] {
+			t.Errorf("revoked key %s is still listed for targets", id)
+		}
+		if _, ok := root.Keys[id]; ok {
+			t.Errorf("revoked key %s is still listed in root.json", id)
+		}
+	}
+	if len(newIDs) == 0 {
+		t.Fatal("no targets keys listed in root.json")
+	}
+
+	var targets tufData.Targets
+	signed := readMetadata(t, repoDir, "targets.json", &targets)
+	if len(signed.Signatures) == 0 {
+		t.Fatal("targets.json isn't signed")
+	}
+	for _, sig := range signed.Signatures {
+		if !newIDs[sig.KeyID] {
+			t.Errorf("targets.json is signed by %s, which isn't a targets key", sig.KeyID)
+		}
+	}
+	if len(targets.Targets) == 0 {
+		t.Error("rotating the key dropped the targets")
+	}
+
+	// The repository, including the updated root.json, still verifies.
+	r, err = pmrepo.New(repoDir, filepath.Join(repoDir, "repository", "blobs"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if problems := r.Verify(false); len(problems) != 0 {
+		t.Errorf("rotated repository has problems: %v", problems)
+	}
+}
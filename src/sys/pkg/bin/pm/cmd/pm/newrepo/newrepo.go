@@ -36,7 +36,7 @@ func Run(cfg *build.Config, args []string) error {
 		return err
 	}
 	if len(fs.Args()) != 0 {
-		fmt.Fprintf(os.Stderr, "WARNING: unused arguments: %s\n", fs.Args())
+		cfg.Warnf("unused arguments: %s", fs.Args())
 	}
 	config.ApplyDefaults()
 
@@ -50,7 +50,7 @@ func Run(cfg *build.Config, args []string) error {
 		return err
 	}
 
-	if err := r.Repo.AddTargets([]string{}, json.RawMessage{}); err != nil {
+	if err := r.AddTargets([]string{}, json.RawMessage{}); err != nil {
 		return err
 	}
 
@@ -0,0 +1,58 @@
+// Copyright 2024 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"go.fuchsia.dev/fuchsia/src/sys/pkg/bin/pm/build"
+)
+
+const normalizeManifestUsage = `Usage: %s normalize-manifest -m <package manifest> -o <output>
+rewrite a package manifest in its canonical form, with blobs sorted by path,
+subpackages sorted by name and source paths cleaned, so that diffs between
+manifests show only real changes. Normalizing a canonical manifest leaves it
+as it is.
+`
+
+func normalizeManifestFlags(fs *flag.FlagSet) {
+	fs.String("m", "", "package manifest `file` to normalize")
+	fs.String("o", "", "`file` to write the normalized manifest to, which may be the input")
+}
+
+func runNormalizeManifest(cfg *build.Config, args []string) error {
+	fs := flag.NewFlagSet("normalize-manifest", flag.ExitOnError)
+	normalizeManifestFlags(fs)
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, normalizeManifestUsage, filepath.Base(os.Args[0]))
+		fmt.Fprintln(os.Stderr)
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if len(fs.Args()) != 0 {
+		cfg.Warnf("unused arguments: %s", fs.Args())
+	}
+	in, out := fs.Lookup("m").Value.String(), fs.Lookup("o").Value.String()
+	if in == "" || out == "" {
+		return fmt.Errorf("normalize-manifest: -m and -o are required")
+	}
+
+	b, err := os.ReadFile(in)
+	if err != nil {
+		return err
+	}
+	normalized, err := build.NormalizePackageManifest(b)
+	if err != nil {
+		return fmt.Errorf("normalize-manifest: %s: %w", in, err)
+	}
+	return os.WriteFile(out, normalized, 0o644)
+}
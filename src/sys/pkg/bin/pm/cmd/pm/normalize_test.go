@@ -0,0 +1,54 @@
+// Copyright 2024 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go.fuchsia.dev/fuchsia/src/sys/pkg/bin/pm/build"
+)
+
+func TestNormalizeManifest(t *testing.T) {
+	cfg := build.TestConfig()
+	defer os.RemoveAll(filepath.Dir(cfg.TempDir))
+	build.BuildTestPackage(cfg)
+	in := filepath.Join(cfg.OutputDir, "package_manifest.json")
+	out := filepath.Join(t.TempDir(), "normalized.json")
+
+	if err := runNormalizeManifest(cfg, []string{"-m", in, "-o", out}); err != nil {
+		t.Fatal(err)
+	}
+	once, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Normalizing in place leaves a normalized manifest as it is.
+	if err := runNormalizeManifest(cfg, []string{"-m", out, "-o", out}); err != nil {
+		t.Fatal(err)
+	}
+	twice, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(once, twice) {
+		t.Errorf("normalizing twice changed the manifest from\n%s\nto\n%s", once, twice)
+	}
+	if _, err := build.LoadPackageManifest(out); err != nil {
+		t.Errorf("normalized manifest doesn't load: %s", err)
+	}
+
+	if err := runNormalizeManifest(cfg, []string{"-m", in}); err == nil {
+		t.Error("normalize-manifest without -o: got nil error")
+	}
+	if err := os.WriteFile(out, []byte(`{"version": "1"}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := runNormalizeManifest(cfg, []string{"-m", out, "-o", out}); err == nil {
+		t.Error("normalizing a manifest without a package: got nil error")
+	}
+}
@@ -5,41 +5,314 @@
 package main
 
 import (
+	"encoding/json"
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"path/filepath"
 	"runtime/trace"
+	"strings"
+	"time"
 
 	"go.fuchsia.dev/fuchsia/src/sys/pkg/bin/pm/build"
+	"go.fuchsia.dev/fuchsia/src/sys/pkg/bin/pm/cmd/pm/far"
+	"go.fuchsia.dev/fuchsia/src/sys/pkg/bin/pm/cmd/pm/inspect"
+	"go.fuchsia.dev/fuchsia/src/sys/pkg/bin/pm/cmd/pm/keys"
+	"go.fuchsia.dev/fuchsia/src/sys/pkg/bin/pm/cmd/pm/repo"
+	"go.fuchsia.dev/fuchsia/src/sys/pkg/bin/pm/cmd/pm/snapshot"
+	"go.fuchsia.dev/fuchsia/src/sys/pkg/bin/pm/cmd/pm/update"
+	"go.fuchsia.dev/fuchsia/src/sys/pkg/bin/pm/cmd/pm/verify"
 )
 
 const usage = `Usage: %s [-k key] [-m manifest] [-o output dir] [-t tempdir] <command> [-help]
 
+Arguments may also be read from a response file, named as @file, holding
+whitespace separated arguments.
+
 IMPORTANT: Please note that pm is being sunset and will be removed.
            Building packages and serving repositories is supported
            through ffx. Please adapt workflows accordingly.
 `
 
-var tracePath = flag.String("trace", "", "write runtime trace to `file`")
+var (
+	tracePath     = flag.String("trace", "", "write runtime trace to `file`")
+	listCommands  = flag.Bool("list-commands", false, "print all commands and their status as JSON and exit")
+	outputFormat  = flag.String("output-format", "text", "format of error output, one of: text, json")
+	failOnWarning = flag.Bool("fail-on-warning", false, "exit with an error if the command reports any warnings, once it completes")
+	profileName   = flag.String("profile", "", "apply the flag defaults of the named profile in the -profile-file")
+	profileFile   = flag.String("profile-file", "pm-profiles.json", "`file` defining the profiles -profile chooses from")
+	progress      = flag.String("progress", "none", "format of progress events written to stderr as blobs are built or published, one of: none, json")
+	usageReport   = flag.String("usage-report", os.Getenv("PM_USAGE_REPORT"), "append a JSON line to `file` each time a deprecated command runs; defaults to $PM_USAGE_REPORT")
+)
+
+// errorCategory classifies the errors pm reports. It determines both the exit
+// code and the code reported in JSON error envelopes.
+type errorCategory struct {
+	code     string
+	exitCode int
+}
+
+var (
+	// errUsage is reported when pm is invoked incorrectly.
+	errUsage = errorCategory{code: "usage", exitCode: 2}
+	// errFailed is reported when a command fails.
+	errFailed = errorCategory{code: "failed", exitCode: 1}
+	// errWarnings is reported when a command completes, but reports warnings
+	// and --fail-on-warning is set.
+	errWarnings = errorCategory{code: "warnings", exitCode: 3}
+)
+
+// textUsageExitCode is the exit code when pm prints its usage because it was
+// given no command or an unknown one, as pm has always exited. Only JSON
+// output reports these with the exit code of errUsage.
+const textUsageExitCode = 1
+
+// errorEnvelope is the JSON form of an error, written to stderr when
+// --output-format=json is set.
+type errorEnvelope struct {
+	Error struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// reportError writes err to w in the given output format and returns the exit
+// code for its category.
+func reportError(w io.Writer, format string, category errorCategory, err error) int {
+	if format == "json" {
+		var envelope errorEnvelope
+		envelope.Error.Code = category.code
+		envelope.Error.Message = err.Error()
+		if err := json.NewEncoder(w).Encode(envelope); err == nil {
+			return category.exitCode
+		}
+	}
+	fmt.Fprintf(w, "%s\n", err)
+	return category.exitCode
+}
+
+// commandStatus describes whether a command still does anything.
+type commandStatus string
+
+const (
+	statusActive                  commandStatus = "active"
+	statusDeprecated              commandStatus = "deprecated"
+	statusDeprecatedNoReplacement commandStatus = "deprecated-no-replacement"
+)
+
+// command is an entry in the table of pm commands.
+type command struct {
+	Name   string        `json:"name"`
+	Status commandStatus `json:"status"`
+	// Replacement is the ffx command that replaces a deprecated command.
+	Replacement string `json:"replacement,omitempty"`
+
+	// message overrides the message printed when a deprecated command is run.
+	message string
+	// action runs an active command.
+	action CommandFunc
+	// flags defines the command's own flags, for `pm schema`.
+	flags func(fs *flag.FlagSet)
+}
+
+// CommandFunc runs a command with the arguments that follow its name.
+type CommandFunc func(cfg *build.Config, args []string) error
+
+// CommandMeta describes a command registered with RegisterCommand.
+type CommandMeta struct {
+	Status commandStatus
+	// Replacement is the ffx command that replaces a deprecated command.
+	Replacement string
+	// Message overrides the message printed when a deprecated command is run.
+	Message string
+	// Flags, if set, defines the command's own flags on fs, so that `pm
+	// schema` can describe them.
+	Flags func(fs *flag.FlagSet)
+}
+
+// commands lists every command pm knows about, in the order they're listed by
+// --list-commands.
+var commands []command
+
+// RegisterCommand adds a command to pm. Active commands run fn; deprecated
+// commands have no fn and explain what to use instead. Commands are listed in
+// the order they're registered, and their names must be unique.
+func RegisterCommand(name string, fn CommandFunc, meta CommandMeta) error {
+	if name == "" || strings.HasPrefix(name, "-") || strings.ContainsAny(name, " \t\n") {
+		return fmt.Errorf("invalid command name %q", name)
+	}
+	if _, ok := lookupCommand(name); ok {
+		return fmt.Errorf("command %q is already registered", name)
+	}
+	switch meta.Status {
+	case statusActive:
+		if fn == nil {
+			return fmt.Errorf("active command %q has nothing to run", name)
+		}
+	case statusDeprecated, statusDeprecatedNoReplacement:
+		if fn != nil {
+			return fmt.Errorf("deprecated command %q can't run anything", name)
+		}
+		if (meta.Status == statusDeprecated) != (meta.Replacement != "") {
+			return fmt.Errorf("command %q has status %q but replacement %q", name, meta.Status, meta.Replacement)
+		}
+	default:
+		return fmt.Errorf("command %q has unknown status %q", name, meta.Status)
+	}
+	commands = append(commands, command{
+		Name:        name,
+		Status:      meta.Status,
+		Replacement: meta.Replacement,
+		message:     meta.Message,
+		action:      fn,
+		flags:       meta.Flags,
+	})
+	return nil
+}
+
+func mustRegisterCommand(name string, fn CommandFunc, meta CommandMeta) {
+	if err := RegisterCommand(name, fn, meta); err != nil {
+		panic(err)
+	}
+}
+
+func init() {
+	deprecated := func(replacement string) CommandMeta {
+		return CommandMeta{Status: statusDeprecated, Replacement: replacement}
+	}
+	noReplacement := CommandMeta{Status: statusDeprecatedNoReplacement}
+	active := CommandMeta{Status: statusActive}
+
+	mustRegisterCommand("archive", nil, deprecated("ffx package archive"))
+	mustRegisterCommand("build", nil, deprecated("ffx package build"))
+	mustRegisterCommand("delta", nil, noReplacement)
+	mustRegisterCommand("dedup-report", runDedupReport, CommandMeta{Status: statusActive, Flags: dedupReportFlags})
+	mustRegisterCommand("doctor", runDoctor, CommandMeta{Status: statusActive, Flags: doctorFlags})
+	mustRegisterCommand("expand", nil, deprecated("ffx package archive extract"))
+	mustRegisterCommand("far", far.Run, active)
+	mustRegisterCommand("genkey", nil, noReplacement)
+	mustRegisterCommand("init", nil, CommandMeta{
+		Status: statusDeprecatedNoReplacement,
+		Message: "please create the meta directory and the meta package file according to " +
+			"https://fuchsia.dev/fuchsia-src/development/idk/documentation/packages",
+	})
+	mustRegisterCommand("inspect", inspect.Run, active)
+	mustRegisterCommand("keys", keys.Run, active)
+	mustRegisterCommand("normalize-manifest", runNormalizeManifest, CommandMeta{Status: statusActive, Flags: normalizeManifestFlags})
+	mustRegisterCommand("publish", nil, deprecated("ffx repository publish"))
+	mustRegisterCommand("repo", repo.Run, active)
+	mustRegisterCommand("schema", runSchema, active)
+	mustRegisterCommand("seal", nil, deprecated("ffx package far create"))
+	mustRegisterCommand("sign", nil, noReplacement)
+	mustRegisterCommand("serve", nil, deprecated("ffx repository serve"))
+	mustRegisterCommand("snapshot", snapshot.Run, active)
+	mustRegisterCommand("update", update.Run, active)
+	mustRegisterCommand("verify", verify.Run, active)
+	mustRegisterCommand("newrepo", nil, deprecated("ffx repository create"))
+}
+
+func lookupCommand(name string) (command, bool) {
+	for _, c := range commands {
+		if c.Name == name {
+			return c, true
+		}
+	}
+	return command{}, false
+}
+
+// run runs an active command, or explains what to do instead of running a
+// deprecated one.
+func (c command) run(cfg *build.Config, args []string) error {
+	switch {
+	case c.Status == statusActive:
+		return c.action(cfg, args)
+	case c.message != "":
+		fmt.Fprintf(os.Stderr, "%s", c.message)
+	case c.Status == statusDeprecated:
+		fmt.Fprintf(os.Stderr, "please use '%s' instead", c.Replacement)
+	default:
+		fmt.Fprintf(os.Stderr, "%s is deprecated without replacement", c.Name)
+	}
+	return nil
+}
+
+// writeCommandIndex writes the table of commands to w as JSON, for tools that
+// want to list pm's commands without scraping its usage message.
+func writeCommandIndex(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(commands)
+}
+
+// writeUsage writes pm's usage message, with the commands it has, to w.
+func writeUsage(w io.Writer) {
+	fmt.Fprintf(w, usage, filepath.Base(os.Args[0]))
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Commands:")
+	for _, c := range commands {
+		switch c.Status {
+		case statusActive:
+			fmt.Fprintf(w, "  %s\n", c.Name)
+		case statusDeprecated:
+			fmt.Fprintf(w, "  %s (deprecated, use '%s')\n", c.Name, c.Replacement)
+		default:
+			fmt.Fprintf(w, "  %s (deprecated)\n", c.Name)
+		}
+	}
+}
 
 func doMain() int {
 	cfg := build.NewConfig()
 	cfg.InitFlags(flag.CommandLine)
 
 	flag.Usage = func() {
-		fmt.Fprintf(os.Stderr, usage, filepath.Base(os.Args[0]))
+		writeUsage(os.Stderr)
 		fmt.Fprintln(os.Stderr)
 		flag.PrintDefaults()
 	}
 
-	flag.Parse()
+	expanded, err := expandResponseFiles(os.Args[1:])
+	if err != nil {
+		return reportError(os.Stderr, "text", errUsage, err)
+	}
+	flag.CommandLine.Parse(expanded)
+
+	args := flag.Args()
+	if *profileName != "" {
+		p, err := loadProfile(*profileFile, *profileName)
+		if err == nil {
+			err = p.applyFlags(flag.CommandLine)
+		}
+		if err != nil {
+			return reportError(os.Stderr, *outputFormat, errUsage, err)
+		}
+		args = p.commandArgs(args)
+	}
+
+	if *outputFormat != "text" && *outputFormat != "json" {
+		return reportError(os.Stderr, "text", errUsage, fmt.Errorf("unknown output format %q", *outputFormat))
+	}
+
+	switch *progress {
+	case "none":
+	case "json":
+		cfg.Progress = build.JSONProgress(os.Stderr)
+	default:
+		return reportError(os.Stderr, *outputFormat, errUsage, fmt.Errorf("unknown progress format %q", *progress))
+	}
+
+	closeBundle, err := cfg.OpenInputBundle()
+	if err != nil {
+		return reportError(os.Stderr, *outputFormat, errFailed, err)
+	}
+	defer closeBundle()
 
 	if *tracePath != "" {
 		tracef, err := os.Create(*tracePath)
 		if err != nil {
-			log.Fatal(err)
+			return reportError(os.Stderr, *outputFormat, errFailed, err)
 		}
 		defer func() {
 			if err := tracef.Sync(); err != nil {
@@ -50,80 +323,48 @@ func doMain() int {
 			}
 		}()
 		if err := trace.Start(tracef); err != nil {
-			log.Fatal(err)
+			return reportError(os.Stderr, *outputFormat, errFailed, err)
 		}
 		defer trace.Stop()
 	}
 
-	var err error
-	switch flag.Arg(0) {
-	case "archive":
-		fmt.Fprintf(os.Stderr, "please use 'ffx package archive' instead")
-		err = nil
-
-	case "build":
-		fmt.Fprintf(os.Stderr, "please use 'ffx package build' instead")
-		err = nil
-
-	case "delta":
-		fmt.Fprintf(os.Stderr, "delta is deprecated without replacement")
-		err = nil
-
-	case "expand":
-		fmt.Fprintf(os.Stderr, "please use 'ffx package archive extract' instead")
-		err = nil
-
-	case "genkey":
-		fmt.Fprintf(os.Stderr, "genkey is deprecated without replacement")
-		err = nil
-
-	case "init":
-		url := "https://fuchsia.dev/fuchsia-src/development/idk/documentation/packages"
-		fmt.Fprintf(os.Stderr, "please create the meta directory and the meta package file according to %v", url)
-		err = nil
-
-	case "publish":
-		fmt.Fprintf(os.Stderr, "please use 'ffx repository publish' instead")
-		err = nil
-
-	case "seal":
-		fmt.Fprintf(os.Stderr, "please use 'ffx package far create' instead")
-		err = nil
-
-	case "sign":
-		fmt.Fprintf(os.Stderr, "sign is deprecated without replacement")
-		err = nil
-
-	case "serve":
-		fmt.Fprintf(os.Stderr, "please use 'ffx repository serve' instead")
-		err = nil
-
-	case "snapshot":
-		fmt.Fprintf(os.Stderr, "snapshot is deprecated without replacement")
-		err = nil
-
-	case "update":
-		fmt.Fprintf(os.Stderr, "update is deprecated without replacement")
-		err = nil
-
-	case "verify":
-		fmt.Fprintf(os.Stderr, "verify is deprecated without replacement")
-		err = nil
+	if *listCommands {
+		if err := writeCommandIndex(os.Stdout); err != nil {
+			return reportError(os.Stderr, *outputFormat, errFailed, err)
+		}
+		return 0
+	}
 
-	case "newrepo":
-		fmt.Fprintf(os.Stderr, "please use 'ffx repository create' instead")
-		err = nil
+	return runCommand(cfg, *outputFormat, args, os.Stderr)
+}
 
-	default:
+// runCommand runs the command named by args[0], reporting any error to stderr
+// in the given output format, and returns the exit code.
+func runCommand(cfg *build.Config, format string, args []string, stderr io.Writer) int {
+	if len(args) == 0 {
+		if format == "json" {
+			return reportError(stderr, format, errUsage, fmt.Errorf("no command given"))
+		}
 		flag.Usage()
-		return 1
+		return textUsageExitCode
 	}
-
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "%s\n", err)
-		return 1
+	cmd, ok := lookupCommand(args[0])
+	if !ok {
+		if format == "json" {
+			return reportError(stderr, format, errUsage, fmt.Errorf("unknown command %q", args[0]))
+		}
+		flag.Usage()
+		return textUsageExitCode
+	}
+	if cmd.Status != statusActive && *usageReport != "" {
+		reportUsage(*usageReport, cmd.Name, time.Now())
+	}
+	if err := cmd.run(cfg, args[1:]); err != nil {
+		return reportError(stderr, format, errFailed, err)
+	}
+	if n := cfg.Warnings(); *failOnWarning && n != 0 {
+		return reportError(stderr, format, errWarnings, fmt.Errorf("%s reported %d warnings and --fail-on-warning is set", args[0], n))
 	}
-
 	return 0
 }
 
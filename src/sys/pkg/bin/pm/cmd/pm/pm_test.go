@@ -0,0 +1,248 @@
+// Copyright 2024 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.fuchsia.dev/fuchsia/src/sys/pkg/bin/pm/build"
+)
+
+func TestCommandIndex(t *testing.T) {
+	var b bytes.Buffer
+	if err := writeCommandIndex(&b); err != nil {
+		t.Fatal(err)
+	}
+
+	var index []struct {
+		Name        string `json:"name"`
+		Status      string `json:"status"`
+		Replacement string `json:"replacement"`
+	}
+	if err := json.Unmarshal(b.Bytes(), &index); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{
+		"archive":            "deprecated",
+		"build":              "deprecated",
+		"dedup-report":       "active",
+		"delta":              "deprecated-no-replacement",
+		"doctor":             "active",
+		"expand":             "deprecated",
+		"far":                "active",
+		"genkey":             "deprecated-no-replacement",
+		"init":               "deprecated-no-replacement",
+		"inspect":            "active",
+		"keys":               "active",
+		"newrepo":            "deprecated",
+		"normalize-manifest": "active",
+		"publish":            "deprecated",
+		"repo":               "active",
+		"schema":             "active",
+		"seal":               "deprecated",
+		"serve":              "deprecated",
+		"sign":               "deprecated-no-replacement",
+		"snapshot":           "active",
+		"update":             "active",
+		"verify":             "active",
+	}
+	seen := map[string]bool{}
+	for _, c := range index {
+		if seen[c.Name] {
+			t.Errorf("command %q is listed more than once", c.Name)
+		}
+		seen[c.Name] = true
+
+		if _, ok := lookupCommand(c.Name); !ok {
+			t.Errorf("listed command %q isn't handled", c.Name)
+		}
+		if status, ok := want[c.Name]; !ok {
+			t.Errorf("unexpected command %q", c.Name)
+		} else if c.Status != status {
+			t.Errorf("command %q has status %q, want %q", c.Name, c.Status, status)
+		}
+		if (c.Status == "deprecated") != (c.Replacement != "") {
+			t.Errorf("command %q has status %q but replacement %q", c.Name, c.Status, c.Replacement)
+		}
+	}
+	for name := range want {
+		if !seen[name] {
+			t.Errorf("command %q is missing from the index", name)
+		}
+	}
+}
+
+func TestJSONErrorEnvelope(t *testing.T) {
+	failing := command{
+		Name:   "fail",
+		Status: statusActive,
+		action: func(cfg *build.Config, args []string) error {
+			return errors.New("deliberate failure")
+		},
+	}
+	defer func(c []command) { commands = c }(commands)
+	commands = append(commands, failing)
+
+	for _, tc := range []struct {
+		args     []string
+		code     string
+		message  string
+		exitCode int
+	}{
+		{[]string{"fail"}, "failed", "deliberate failure", 1},
+		{[]string{"bogus"}, "usage", `unknown command "bogus"`, 2},
+		{nil, "usage", "no command given", 2},
+	} {
+		var stderr bytes.Buffer
+		if got := runCommand(build.NewConfig(), "json", tc.args, &stderr); got != tc.exitCode {
+			t.Errorf("runCommand(%q) = %d, want %d", tc.args, got, tc.exitCode)
+		}
+
+		var envelope errorEnvelope
+		if err := json.Unmarshal(stderr.Bytes(), &envelope); err != nil {
+			t.Fatalf("runCommand(%q) wrote %q, which isn't a JSON error envelope: %v", tc.args, stderr.String(), err)
+		}
+		if envelope.Error.Code != tc.code || envelope.Error.Message != tc.message {
+			t.Errorf("runCommand(%q) reported %+v, want code %q and message %q",
+				tc.args, envelope.Error, tc.code, tc.message)
+		}
+	}
+
+	// In text mode, a missing or unknown command exits 1, as it always has.
+	for _, args := range [][]string{{"bogus"}, nil} {
+		var stderr bytes.Buffer
+		if got := runCommand(build.NewConfig(), "text", args, &stderr); got != 1 {
+			t.Errorf("runCommand(%q) in text mode = %d, want 1", args, got)
+		}
+	}
+}
+
+func TestFailOnWarning(t *testing.T) {
+	warning := command{
+		Name:   "build-with-warning",
+		Status: statusActive,
+		action: func(cfg *build.Config, args []string) error {
+			build.BuildTestPackage(cfg)
+			cfg.Warnf("unused arguments: %s", args)
+			return nil
+		},
+	}
+	defer func(c []command) { commands = c }(commands)
+	commands = append(commands, warning)
+	defer func() { *failOnWarning = false }()
+
+	for _, tc := range []struct {
+		failOnWarning bool
+		exitCode      int
+	}{
+		{false, 0},
+		{true, 3},
+	} {
+		*failOnWarning = tc.failOnWarning
+		cfg := build.TestConfig()
+		defer os.RemoveAll(filepath.Dir(cfg.TempDir))
+		var warnings, stderr bytes.Buffer
+		cfg.WarningWriter = &warnings
+
+		got := runCommand(cfg, "json", []string{"build-with-warning", "extra"}, &stderr)
+		if got != tc.exitCode {
+			t.Errorf("with --fail-on-warning=%t, got exit code %d, want %d", tc.failOnWarning, got, tc.exitCode)
+		}
+		if want := "WARNING: unused arguments: [extra]\n"; warnings.String() != want {
+			t.Errorf("got warnings %q, want %q", warnings.String(), want)
+		}
+		if _, err := os.Stat(cfg.MetaFAR()); err != nil {
+			t.Errorf("the build didn't complete: %v", err)
+		}
+
+		if !tc.failOnWarning {
+			if stderr.Len() != 0 {
+				t.Errorf("got error %q, want none", stderr.String())
+			}
+			continue
+		}
+		var envelope errorEnvelope
+		if err := json.Unmarshal(stderr.Bytes(), &envelope); err != nil {
+			t.Fatalf("wrote %q, which isn't a JSON error envelope: %v", stderr.String(), err)
+		}
+		if envelope.Error.Code != "warnings" || !strings.Contains(envelope.Error.Message, "1 warnings") {
+			t.Errorf("reported %+v, want code %q and the number of warnings", envelope.Error, "warnings")
+		}
+	}
+}
+
+func TestTextError(t *testing.T) {
+	var stderr bytes.Buffer
+	if got := reportError(&stderr, "text", errFailed, errors.New("deliberate failure")); got != 1 {
+		t.Errorf("got exit code %d, want 1", got)
+	}
+	if got, want := stderr.String(), "deliberate failure\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestRegisterCommand(t *testing.T) {
+	defer func(c []command) { commands = c }(commands)
+
+	var ran []string
+	custom := func(cfg *build.Config, args []string) error {
+		ran = args
+		return nil
+	}
+	if err := RegisterCommand("custom", custom, CommandMeta{Status: statusActive}); err != nil {
+		t.Fatal(err)
+	}
+
+	var stderr bytes.Buffer
+	if got := runCommand(build.NewConfig(), "json", []string{"custom", "-x", "arg"}, &stderr); got != 0 {
+		t.Errorf("running the custom command exited with %d: %s", got, stderr.String())
+	}
+	if want := []string{"-x", "arg"}; strings.Join(ran, " ") != strings.Join(want, " ") {
+		t.Errorf("custom command ran with %q, want %q", ran, want)
+	}
+
+	var index bytes.Buffer
+	if err := writeCommandIndex(&index); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(index.String(), `"name": "custom"`) {
+		t.Errorf("command index %s doesn't list the custom command", index.String())
+	}
+	var help bytes.Buffer
+	writeUsage(&help)
+	if !strings.Contains(help.String(), "\n  custom\n") {
+		t.Errorf("usage %q doesn't list the custom command", help.String())
+	}
+
+	for _, tc := range []struct {
+		name string
+		fn   CommandFunc
+		meta CommandMeta
+		want string
+	}{
+		{"custom", custom, CommandMeta{Status: statusActive}, "already registered"},
+		{"repo", nil, CommandMeta{Status: statusDeprecatedNoReplacement}, "already registered"},
+		{"", custom, CommandMeta{Status: statusActive}, "invalid command name"},
+		{"-custom", custom, CommandMeta{Status: statusActive}, "invalid command name"},
+		{"idle", nil, CommandMeta{Status: statusActive}, "nothing to run"},
+		{"stub", custom, CommandMeta{Status: statusDeprecatedNoReplacement}, "can't run anything"},
+		{"old", nil, CommandMeta{Status: statusDeprecated}, "replacement"},
+		{"odd", custom, CommandMeta{Status: "experimental"}, "unknown status"},
+	} {
+		if err := RegisterCommand(tc.name, tc.fn, tc.meta); err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("RegisterCommand(%q) = %v, want an error containing %q", tc.name, err, tc.want)
+		}
+	}
+	if n := len(commands); commands[n-1].Name != "custom" {
+		t.Errorf("a rejected command was registered: %+v", commands[n-1])
+	}
+}
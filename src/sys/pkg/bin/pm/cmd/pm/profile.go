@@ -0,0 +1,123 @@
+// Copyright 2024 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// profile is a named set of flag defaults, read from a profile file such as:
+//
+//	{
+//	  "profiles": {
+//	    "release": {
+//	      "flags": {"o": "out/release", "create-output-dir": true},
+//	      "commands": {"repo export": {"e": "release.key"}}
+//	    }
+//	  }
+//	}
+//
+// Flags holds defaults for pm's global flags. Commands holds defaults for the
+// flags of commands, keyed by the command name, followed by the subcommand
+// name for commands that have subcommands. Flags given on the command line
+// override the profile's.
+type profile struct {
+	Flags    map[string]interface{}            `json:"flags"`
+	Commands map[string]map[string]interface{} `json:"commands"`
+}
+
+// loadProfile reads the profile name from the profile file at path.
+func loadProfile(path, name string) (*profile, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading profile %q: %w", name, err)
+	}
+	var file struct {
+		Profiles map[string]*profile `json:"profiles"`
+	}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	if err := dec.Decode(&file); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	p, ok := file.Profiles[name]
+	if !ok || p == nil {
+		names := make([]string, 0, len(file.Profiles))
+		for n := range file.Profiles {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("unknown profile %q, %s defines: %s", name, path, strings.Join(names, ", "))
+	}
+	return p, nil
+}
+
+// applyFlags sets the flags of fs that the profile has defaults for, unless
+// they were set on the command line.
+func (p *profile) applyFlags(fs *flag.FlagSet) error {
+	explicit := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { explicit[f.Name] = true })
+	for _, name := range sortedKeys(p.Flags) {
+		if fs.Lookup(name) == nil {
+			return fmt.Errorf("profile sets unknown flag -%s", name)
+		}
+		if explicit[name] {
+			continue
+		}
+		if err := fs.Set(name, fmt.Sprint(p.Flags[name])); err != nil {
+			return fmt.Errorf("profile flag -%s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// commandArgs returns the arguments of a command, args, with the profile's
+// defaults for the command's flags inserted ahead of the flags given on the
+// command line, so that those override them.
+func (p *profile) commandArgs(args []string) []string {
+	// Look for the defaults of the most specific command the arguments name.
+	var words int
+	var defaults map[string]interface{}
+	for name, flags := range p.Commands {
+		fields := strings.Fields(name)
+		if len(fields) <= words || len(fields) > len(args) {
+			continue
+		}
+		match := true
+		for i, field := range fields {
+			if args[i] != field {
+				match = false
+				break
+			}
+		}
+		if match {
+			words, defaults = len(fields), flags
+		}
+	}
+	if defaults == nil {
+		return args
+	}
+
+	out := append([]string{}, args[:words]...)
+	for _, name := range sortedKeys(defaults) {
+		out = append(out, fmt.Sprintf("-%s=%v", name, defaults[name]))
+	}
+	return append(out, args[words:]...)
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,129 @@
+// Copyright 2024 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"go.fuchsia.dev/fuchsia/src/sys/pkg/bin/pm/build"
+)
+
+const testProfiles = `{
+  "profiles": {
+    "dev": {},
+    "release": {
+      "flags": {"o": "out/release", "n": "release-package", "create-output-dir": true},
+      "commands": {
+        "inspect": {"format": "json"},
+        "repo export": {"repo": "out/repo", "o": "out/repo.tar"}
+      }
+    },
+    "bogus": {
+      "flags": {"no-such-flag": "value"}
+    }
+  }
+}`
+
+func writeProfiles(t *testing.T) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "pm-profiles.json")
+	if err := os.WriteFile(path, []byte(testProfiles), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestProfileFlags(t *testing.T) {
+	p, err := loadProfile(writeProfiles(t), "release")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := build.NewConfig()
+	fs := flag.NewFlagSet("pm", flag.ContinueOnError)
+	cfg.InitFlags(fs)
+	if err := fs.Parse([]string{"-o", "explicit", "build"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.applyFlags(fs); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.OutputDir != "explicit" {
+		t.Errorf("got output dir %q, want the command line's to override the profile's", cfg.OutputDir)
+	}
+	if cfg.PkgName != "release-package" || !cfg.CreateOutputDir {
+		t.Errorf("got package name %q and create output dir %t, want the profile's", cfg.PkgName, cfg.CreateOutputDir)
+	}
+}
+
+func TestProfileCommandArgs(t *testing.T) {
+	p, err := loadProfile(writeProfiles(t), "release")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		args []string
+		want []string
+	}{
+		{
+			[]string{"repo", "export", "-o", "explicit.tar"},
+			[]string{"repo", "export", "-o=out/repo.tar", "-repo=out/repo", "-o", "explicit.tar"},
+		},
+		{
+			[]string{"inspect", "-f", "meta.far"},
+			[]string{"inspect", "-format=json", "-f", "meta.far"},
+		},
+		{
+			[]string{"repo", "verify"},
+			[]string{"repo", "verify"},
+		},
+	} {
+		if diff := cmp.Diff(tc.want, p.commandArgs(tc.args)); diff != "" {
+			t.Errorf("commandArgs(%q) (-want +got):\n%s", tc.args, diff)
+		}
+	}
+
+	// The flags given on the command line override the profile's.
+	args := p.commandArgs([]string{"repo", "export", "-o", "explicit.tar"})
+	fs := flag.NewFlagSet("repo export", flag.ContinueOnError)
+	repoDir := fs.String("repo", "", "")
+	output := fs.String("o", "", "")
+	if err := fs.Parse(args[2:]); err != nil {
+		t.Fatal(err)
+	}
+	if *repoDir != "out/repo" || *output != "explicit.tar" {
+		t.Errorf("got -repo %q and -o %q, want the profile's repository and the command line's output", *repoDir, *output)
+	}
+}
+
+func TestProfileErrors(t *testing.T) {
+	path := writeProfiles(t)
+
+	if _, err := loadProfile(path, "staging"); err == nil ||
+		!strings.Contains(err.Error(), `unknown profile "staging"`) || !strings.Contains(err.Error(), "bogus, dev, release") {
+		t.Errorf("got %v, want an error naming the unknown profile and the defined ones", err)
+	}
+
+	p, err := loadProfile(path, "bogus")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fs := flag.NewFlagSet("pm", flag.ContinueOnError)
+	build.NewConfig().InitFlags(fs)
+	if err := p.applyFlags(fs); err == nil || !strings.Contains(err.Error(), "-no-such-flag") {
+		t.Errorf("got %v, want an error naming the unknown flag", err)
+	}
+
+	if _, err := loadProfile(filepath.Join(t.TempDir(), "missing.json"), "release"); err == nil {
+		t.Error("loading a profile from a missing file succeeded")
+	}
+}
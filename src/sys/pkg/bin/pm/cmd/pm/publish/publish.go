@@ -10,12 +10,13 @@ import (
 	"encoding/json"
 	"flag"
 	"fmt"
-	"log"
+	"io"
 	"os"
 	"path/filepath"
 	"runtime/debug"
 	"strconv"
 	"strings"
+	"time"
 
 	"go.fuchsia.dev/fuchsia/src/sys/pkg/bin/pm/build"
 	"go.fuchsia.dev/fuchsia/src/sys/pkg/bin/pm/pkg"
@@ -26,10 +27,15 @@ import (
 const (
 	usage = `Usage: %s publish [-a|-lp] -C -f <file> [-repo <repository directory>]
 		Pass any one of the mode flags [-a|-lp], and at least one file to pubish.
+		With -dry-run, print the changes publishing would make to an existing
+		repository, without making them.
 `
 	metaFar = "meta.far"
 )
 
+// stdout is where the plan of a dry run is written.
+var stdout io.Writer = os.Stdout
+
 type RepeatedArg []string
 
 func (r *RepeatedArg) Set(s string) error {
@@ -59,10 +65,17 @@ func Run(cfg *build.Config, args []string) error {
 	filePaths := RepeatedArg{}
 	fs.Var(&filePaths, "f", "Path(s) of the file(s) to publish")
 
+	targetCustom := RepeatedArg{}
+	fs.Var(&targetCustom, "target-custom", "key=value field to add to the custom metadata of each published target (may be repeated)")
+
 	clean := fs.Bool("C", false, "\"clean\" the repository. only new publications remain.")
 	noCreateRepo := fs.Bool("n", false, "If the specified repository path does not exist, do NOT attempt to create it.")
 
 	depfilePath := fs.String("depfile", "", "Path to a depfile to write to")
+	forceSign := fs.Bool("force-sign", false, "Re-sign the repository metadata even if the published targets didn't change.")
+	dryRun := fs.Bool("dry-run", false, "Print the blob copies, target additions and removals, and metadata version bumps publishing would make, without changing the repository.")
+	format := fs.String("format", "text", "Output format of -dry-run, one of: text, json.")
+	lockTimeout := fs.Duration("lock-timeout", 5*time.Minute, "How long to wait for another process publishing to the repository to finish.")
 
 	// NOTE(raggi): encryption as implemented is not intended to be a generally used
 	// feature, as such this flag is deliberately not included in the usage line
@@ -78,7 +91,7 @@ func Run(cfg *build.Config, args []string) error {
 	}
 
 	if len(fs.Args()) != 0 {
-		fmt.Fprintf(os.Stderr, "WARNING: unused arguments: %s\n", fs.Args())
+		cfg.Warnf("unused arguments: %s", fs.Args())
 	}
 
 	config.ApplyDefaults()
@@ -98,6 +111,38 @@ func Run(cfg *build.Config, args []string) error {
 		return fmt.Errorf("no file path supplied")
 	}
 
+	if *format != "text" && *format != "json" {
+		return fmt.Errorf("unknown format %q, want text or json", *format)
+	}
+
+	// A dry run publishes to a clone of the repository, and compares it with
+	// another clone, so that the repository itself is left untouched.
+	var pristineDir string
+	if *dryRun {
+		if fi, err := os.Stat(config.RepoDir); err != nil || !fi.IsDir() {
+			return fmt.Errorf("-dry-run needs an existing repository, %q is not one", config.RepoDir)
+		}
+		lock, err := repo.AcquireLock(config.RepoDir, *lockTimeout)
+		if err != nil {
+			return err
+		}
+		defer lock.Unlock()
+		dir, err := os.MkdirTemp("", "pm-publish-dry-run")
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(dir)
+		pristineDir = filepath.Join(dir, "before")
+		if err := repo.CloneRepository(config.RepoDir, pristineDir); err != nil {
+			return err
+		}
+		clone := filepath.Join(dir, "after")
+		if err := repo.CloneRepository(config.RepoDir, clone); err != nil {
+			return err
+		}
+		config.RepoDir = clone
+	}
+
 	// deps collects a list of all inputs to the publish process to be written to
 	// depfilePath if requested.
 	var deps []string
@@ -120,6 +165,15 @@ func Run(cfg *build.Config, args []string) error {
 		return fmt.Errorf("repository path %q is not a directory", config.RepoDir)
 	}
 
+	// Hold the repository lock until publishing finishes, so that concurrent
+	// publishes can't interleave their metadata updates.
+	lock, err := repo.AcquireLock(config.RepoDir, *lockTimeout)
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+	defer lock.UnlockOnInterrupt()()
+
 	repo, err := repo.New(config.RepoDir, filepath.Join(config.RepoDir, "repository", "blobs"))
 	if err != nil {
 		return fmt.Errorf("error initializing repo: %s", err)
@@ -142,6 +196,8 @@ func Run(cfg *build.Config, args []string) error {
 		}
 	}
 
+	repo.SetProgress(cfg.Progress)
+
 	if *clean {
 		// Remove any staged items from the repository that are yet to be published.
 		if err := repo.Clean(); err != nil {
@@ -153,6 +209,16 @@ func Run(cfg *build.Config, args []string) error {
 		}
 	}
 
+	if len(targetCustom) != 0 {
+		fields, err := parseTargetCustom(targetCustom)
+		if err != nil {
+			return err
+		}
+		if err := repo.SetTargetCustom(fields); err != nil {
+			return err
+		}
+	}
+
 	if *encryptionKey != "" {
 		if err := repo.EncryptWith(*encryptionKey); err != nil {
 			return err
@@ -197,8 +263,8 @@ func Run(cfg *build.Config, args []string) error {
 		if *verbose {
 			fmt.Printf("committing updates\n")
 		}
-		if err := repo.CommitUpdates(config.TimeVersioned); err != nil {
-			log.Fatalf("error committing repository updates: %s", err)
+		if err := commitUpdates(repo, config.TimeVersioned, *forceSign, *verbose); err != nil {
+			return fmt.Errorf("error committing repository updates: %s", err)
 		}
 	case *archiveMode:
 		if len(filePaths) != 1 {
@@ -256,8 +322,8 @@ func Run(cfg *build.Config, args []string) error {
 				return err
 			}
 		}
-		if err := repo.CommitUpdates(config.TimeVersioned); err != nil {
-			log.Fatalf("error committing repository updates: %s", err)
+		if err := commitUpdates(repo, config.TimeVersioned, *forceSign, *verbose); err != nil {
+			return fmt.Errorf("error committing repository updates: %s", err)
 		}
 
 	// WARNING: the following two modes are load bearing in infra, but are
@@ -281,8 +347,8 @@ func Run(cfg *build.Config, args []string) error {
 		}); err != nil {
 			return err
 		}
-		if err := repo.CommitUpdates(config.TimeVersioned); err != nil {
-			log.Fatalf("error committing repository updates: %s", err)
+		if err := commitUpdates(repo, config.TimeVersioned, *forceSign, *verbose); err != nil {
+			return fmt.Errorf("error committing repository updates: %s", err)
 		}
 	case *blobSetMode:
 		if len(filePaths) != 1 {
@@ -308,6 +374,12 @@ func Run(cfg *build.Config, args []string) error {
 		panic("unhandled mode")
 	}
 
+	cfg.Progress.Report(build.ProgressEvent{Phase: "publish", Done: true})
+
+	if *dryRun {
+		return writePlan(pristineDir, config.RepoDir, *format)
+	}
+
 	if *depfilePath != "" {
 		timestampPath := filepath.Join(config.RepoDir, "repository", "timestamp.json")
 		for i, str := range deps {
@@ -342,6 +414,72 @@ func Run(cfg *build.Config, args []string) error {
 	return nil
 }
 
+// commitUpdates commits the staged changes to the repository, unless they
+// leave its targets unchanged and force is false, so that republishing the same
+// packages doesn't churn the signed metadata.
+func commitUpdates(r *repo.Repo, timeVersioned, force, verbose bool) error {
+	committed, err := r.CommitUpdatesIfChanged(timeVersioned, force)
+	if err != nil {
+		return err
+	}
+	if !committed && verbose {
+		fmt.Printf("targets unchanged, not re-signing\n")
+	}
+	return nil
+}
+
+// writePlan writes the changes publishing made to the repository at before,
+// giving the repository at after, in format.
+func writePlan(before, after, format string) error {
+	var repos []*repo.Repo
+	for _, dir := range []string{before, after} {
+		r, err := repo.New(dir, filepath.Join(dir, "repository", "blobs"))
+		if err != nil {
+			return err
+		}
+		repos = append(repos, r)
+	}
+	plan, err := repos[0].PlanPublish(repos[1])
+	if err != nil {
+		return err
+	}
+
+	if format == "json" {
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(plan)
+	}
+	for _, blob := range plan.Blobs {
+		fmt.Fprintf(stdout, "copy blob %s size=%d\n", blob.Merkle, blob.Size)
+	}
+	for _, target := range plan.TargetsRemoved {
+		fmt.Fprintf(stdout, "remove target %s %s\n", target.Name, target.Merkle)
+	}
+	for _, target := range plan.TargetsAdded {
+		fmt.Fprintf(stdout, "add target %s %s\n", target.Name, target.Merkle)
+	}
+	for _, v := range plan.Versions {
+		fmt.Fprintf(stdout, "bump %s.json version %d -> %d\n", v.Role, v.From, v.To)
+	}
+	return nil
+}
+
+// parseTargetCustom parses the key=value arguments of -target-custom.
+func parseTargetCustom(args []string) (map[string]string, error) {
+	fields := map[string]string{}
+	for _, arg := range args {
+		parts := strings.SplitN(arg, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("-target-custom %q: want key=value", arg)
+		}
+		if _, ok := fields[parts[0]]; ok {
+			return nil, fmt.Errorf("-target-custom %q: %q is given more than once", arg, parts[0])
+		}
+		fields[parts[0]] = parts[1]
+	}
+	return fields, nil
+}
+
 func eachEntry(path string, cb func(dest, src string) error) error {
 	f, err := os.Open(path)
 	if err != nil {
@@ -7,11 +7,15 @@ package publish
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"reflect"
 	"sort"
 	"strconv"
 	"testing"
+	"time"
 
 	"go.fuchsia.dev/fuchsia/src/sys/pkg/bin/pm/build"
 	"go.fuchsia.dev/fuchsia/src/sys/pkg/bin/pm/repo"
@@ -65,6 +69,57 @@ func TestPublishArchive(t *testing.T) {
 	}
 }
 
+func TestPublishUnchangedDoesNotResign(t *testing.T) {
+	cfg := build.TestConfig()
+	defer os.RemoveAll(filepath.Dir(cfg.TempDir))
+
+	build.BuildTestPackage(cfg)
+	name := filepath.Join(t.TempDir(), "testpackage-0")
+	if err := build.Archive(cfg, name); err != nil {
+		t.Fatal(err)
+	}
+	archivePath := name + ".far"
+	repoDir := t.TempDir()
+
+	readMetadata := func() map[string][]byte {
+		t.Helper()
+		m := map[string][]byte{}
+		for _, jsonPath := range []string{"targets.json", "snapshot.json", "timestamp.json"} {
+			b, err := os.ReadFile(filepath.Join(repoDir, "repository", jsonPath))
+			if err != nil {
+				t.Fatal(err)
+			}
+			m[jsonPath] = b
+		}
+		return m
+	}
+
+	if err := Run(cfg, []string{"-repo", repoDir, "-a", "-f", archivePath}); err != nil {
+		t.Fatal(err)
+	}
+	first := readMetadata()
+
+	if err := Run(cfg, []string{"-repo", repoDir, "-a", "-f", archivePath}); err != nil {
+		t.Fatal(err)
+	}
+	for jsonPath, b := range readMetadata() {
+		if !bytes.Equal(b, first[jsonPath]) {
+			t.Errorf("republishing the same package changed %s", jsonPath)
+		}
+	}
+	if entries, err := os.ReadDir(filepath.Join(repoDir, "staged", "targets")); err != nil || len(entries) != 0 {
+		t.Errorf("republishing the same package left staged targets %v: %v", entries, err)
+	}
+
+	if err := Run(cfg, []string{"-repo", repoDir, "-a", "-f", archivePath, "-force-sign"}); err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(readMetadata()["targets.json"], first["targets.json"]) {
+		t.Errorf("-force-sign didn't re-sign targets.json")
+	}
+	assertHasTestPackage(t, repoDir)
+}
+
 func TestPublishListOfPackages(t *testing.T) {
 	cfg := build.TestConfig()
 	defer os.RemoveAll(filepath.Dir(cfg.TempDir))
@@ -144,6 +199,246 @@ func TestPublishValidatesPackageName(t *testing.T) {
 	}
 }
 
+func TestPublishWaitsForRepositoryLock(t *testing.T) {
+	cfg := build.TestConfig()
+	defer os.RemoveAll(filepath.Dir(cfg.TempDir))
+
+	build.BuildTestPackage(cfg)
+
+	outputManifestPath := filepath.Join(cfg.OutputDir, "package_manifest.json")
+	packagesListPath := filepath.Join(cfg.OutputDir, "packages.list")
+	if err := os.WriteFile(packagesListPath, []byte(outputManifestPath+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// Hold the lock as a concurrent publish would.
+	repoDir := t.TempDir()
+	lock, err := repo.AcquireLock(repoDir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = Run(cfg, []string{"-repo", repoDir, "-lock-timeout", "100ms", "-lp", "-f", packagesListPath})
+	if !errors.Is(err, repo.ErrLocked) {
+		t.Fatalf("publish while locked: got %v, want %v", err, repo.ErrLocked)
+	}
+	if _, err := os.Stat(filepath.Join(repoDir, "repository")); !os.IsNotExist(err) {
+		t.Errorf("publish while locked modified the repository: %v", err)
+	}
+
+	released := make(chan struct{})
+	go func() {
+		time.Sleep(200 * time.Millisecond)
+		lock.Unlock()
+		close(released)
+	}()
+	if err := Run(cfg, []string{"-repo", repoDir, "-lock-timeout", "10s", "-lp", "-f", packagesListPath}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-released:
+	default:
+		t.Errorf("publish finished before the lock was released")
+	}
+	assertHasTestPackage(t, repoDir)
+}
+
+func TestPublishTargetCustom(t *testing.T) {
+	cfg := build.TestConfig()
+	defer os.RemoveAll(filepath.Dir(cfg.TempDir))
+
+	build.BuildTestPackage(cfg)
+
+	outputManifestPath := filepath.Join(cfg.OutputDir, "package_manifest.json")
+	packagesListPath := filepath.Join(cfg.OutputDir, "packages.list")
+	if err := os.WriteFile(packagesListPath, []byte(outputManifestPath+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	repoDir := t.TempDir()
+	if err := Run(cfg, []string{"-repo", repoDir, "-lp", "-f", packagesListPath, "-target-custom", "type=base", "-target-custom", "note=a=b"}); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := os.ReadFile(filepath.Join(repoDir, "repository", "targets.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var targets struct {
+		Signed struct {
+			Targets map[string]struct {
+				Custom map[string]json.RawMessage `json:"custom"`
+			} `json:"targets"`
+		} `json:"signed"`
+	}
+	if err := json.Unmarshal(b, &targets); err != nil {
+		t.Fatal(err)
+	}
+	custom := targets.Signed.Targets["testpackage/0"].Custom
+	for key, want := range map[string]string{"type": `"base"`, "note": `"a=b"`} {
+		if got := string(custom[key]); got != want {
+			t.Errorf("custom %s: got %s, want %s", key, got, want)
+		}
+	}
+	if _, ok := custom["merkle"]; !ok {
+		t.Errorf("custom metadata %v is missing the merkle root", custom)
+	}
+
+	for _, arg := range []string{"merkle=0", "size=1", "novalue", "=value"} {
+		if err := Run(cfg, []string{"-repo", repoDir, "-lp", "-f", packagesListPath, "-target-custom", arg}); err == nil {
+			t.Errorf("-target-custom %q: got nil error", arg)
+		}
+	}
+}
+
+func TestPublishDryRun(t *testing.T) {
+	repoDir := t.TempDir()
+	var listPaths []string
+	for _, name := range []string{"testpackage", "otherpackage"} {
+		cfg := build.TestConfig()
+		defer os.RemoveAll(filepath.Dir(cfg.TempDir))
+		cfg.PkgName = name
+		build.BuildTestPackage(cfg)
+		listPath := filepath.Join(cfg.OutputDir, "packages.list")
+		if err := os.WriteFile(listPath, []byte(filepath.Join(cfg.OutputDir, "package_manifest.json")+"\n"), 0600); err != nil {
+			t.Fatal(err)
+		}
+		listPaths = append(listPaths, listPath)
+	}
+	cfg := build.TestConfig()
+	defer os.RemoveAll(filepath.Dir(cfg.TempDir))
+
+	if err := Run(cfg, []string{"-repo", filepath.Join(t.TempDir(), "missing"), "-dry-run", "-lp", "-f", listPaths[0]}); err == nil {
+		t.Error("dry run of a missing repository: got nil error")
+	}
+	if err := Run(cfg, []string{"-repo", repoDir, "-lp", "-f", listPaths[0]}); err != nil {
+		t.Fatal(err)
+	}
+	beforeTree := readTree(t, repoDir)
+	before, err := repo.New(repoDir, filepath.Join(repoDir, "repository", "blobs"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	beforeTargets, err := before.Targets()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	stdout = &out
+	defer func() { stdout = os.Stdout }()
+	if err := Run(cfg, []string{"-repo", repoDir, "-dry-run", "-format", "json", "-lp", "-f", listPaths[1]}); err != nil {
+		t.Fatal(err)
+	}
+	var plan repo.PublishPlan
+	if err := json.Unmarshal(out.Bytes(), &plan); err != nil {
+		t.Fatalf("%v: %s", err, out.String())
+	}
+	if afterTree := readTree(t, repoDir); !reflect.DeepEqual(afterTree, beforeTree) {
+		t.Fatal("dry run changed the repository")
+	}
+	if err := Run(cfg, []string{"-repo", repoDir, "-dry-run", "-format", "yaml", "-lp", "-f", listPaths[1]}); err == nil {
+		t.Error("-format yaml: got nil error")
+	}
+
+	if err := Run(cfg, []string{"-repo", repoDir, "-lp", "-f", listPaths[1]}); err != nil {
+		t.Fatal(err)
+	}
+	afterTree := readTree(t, repoDir)
+	after, err := repo.New(repoDir, filepath.Join(repoDir, "repository", "blobs"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	afterTargets, err := after.Targets()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	blobs := []repo.PlannedBlob{}
+	for p, b := range afterTree {
+		dir, name := filepath.Split(p)
+		if _, ok := beforeTree[p]; !ok && dir == "repository/blobs/" {
+			blobs = append(blobs, repo.PlannedBlob{Merkle: name, Size: int64(len(b))})
+		}
+	}
+	sort.Slice(blobs, func(i, j int) bool { return blobs[i].Merkle < blobs[j].Merkle })
+	if len(blobs) == 0 || !reflect.DeepEqual(plan.Blobs, blobs) {
+		t.Errorf("planned blobs %v, publish copied %v", plan.Blobs, blobs)
+	}
+
+	added := []repo.PlannedTarget{}
+	for name, target := range afterTargets {
+		if _, ok := beforeTargets[name]; !ok {
+			var custom struct {
+				Merkle string `json:"merkle"`
+			}
+			if err := json.Unmarshal(*target.Custom, &custom); err != nil {
+				t.Fatal(err)
+			}
+			added = append(added, repo.PlannedTarget{Name: name, Merkle: custom.Merkle})
+		}
+	}
+	if len(added) != 1 || !reflect.DeepEqual(plan.TargetsAdded, added) {
+		t.Errorf("planned target additions %v, publish added %v", plan.TargetsAdded, added)
+	}
+	if len(plan.TargetsRemoved) != 0 || len(afterTargets) != len(beforeTargets)+len(added) {
+		t.Errorf("planned target removals %v, publish went from %d to %d targets", plan.TargetsRemoved, len(beforeTargets), len(afterTargets))
+	}
+
+	versions := []repo.VersionBump{}
+	for _, role := range []string{"root", "targets", "snapshot", "timestamp"} {
+		from, to := metadataVersion(t, beforeTree, role), metadataVersion(t, afterTree, role)
+		if from != to {
+			versions = append(versions, repo.VersionBump{Role: role, From: from, To: to})
+		}
+	}
+	if len(versions) == 0 || !reflect.DeepEqual(plan.Versions, versions) {
+		t.Errorf("planned version bumps %v, publish bumped %v", plan.Versions, versions)
+	}
+}
+
+// readTree returns the contents of the regular files under dir, by slash
+// separated path relative to dir.
+func readTree(t *testing.T, dir string) map[string][]byte {
+	t.Helper()
+	tree := map[string][]byte{}
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		b, err := os.ReadFile(p)
+		tree[filepath.ToSlash(rel)] = b
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tree
+}
+
+// metadataVersion returns the version of the committed metadata of role in
+// the repository tree, or 0 if there is none.
+func metadataVersion(t *testing.T, tree map[string][]byte, role string) int64 {
+	t.Helper()
+	b, ok := tree["repository/"+role+".json"]
+	if !ok {
+		return 0
+	}
+	var metadata struct {
+		Signed struct {
+			Version int64 `json:"version"`
+		} `json:"signed"`
+	}
+	if err := json.Unmarshal(b, &metadata); err != nil {
+		t.Fatal(err)
+	}
+	return metadata.Signed.Version
+}
+
 // mustRelativePath converts the input path relative to the current working
 // directory. Input path is unchanged if it's not an absolute path.
 func mustRelativePath(t *testing.T, p string) string {
@@ -0,0 +1,208 @@
+// Copyright 2024 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+// Package repo implements the `pm repo` command
+package repo
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"go.fuchsia.dev/fuchsia/src/sys/pkg/bin/pm/build"
+	pmrepo "go.fuchsia.dev/fuchsia/src/sys/pkg/bin/pm/repo"
+)
+
+const usage = `Usage: %s repo <subcommand> [-help]
+work with package repositories. Subcommands are:
+
+  verify [-repo dir] [-allow-expired] [-e key] [-no-cache]
+    check that a repository is consistent: its metadata is signed by the keys
+    in root.json and hasn't expired, and every blob its packages refer to is
+    present with the right merkle root. All problems found are reported. The
+    merkle roots computed are cached in the repository directory, and blobs
+    whose size and modification time are unchanged aren't hashed again unless
+    -no-cache is given.
+
+  export [-repo dir] [-e key] -o repo.tar
+    write a repository's metadata, and the blobs of the packages it publishes,
+    to a tar archive for transport. Keys, staged changes and unreferenced
+    blobs are left out. Exporting the same repository always produces the
+    same archive.
+
+  import [-repo dir] -f repo.tar
+    create a repository from an archive written by export. The blobs aren't
+    checked; run verify on the imported repository for that.
+`
+
+// subcommands maps the name of each subcommand to the function that runs it.
+var subcommands = map[string]func(cfg *build.Config, args []string) error{
+	"verify": verify,
+	"export": export,
+	"import": importRepo,
+}
+
+// Run runs a `pm repo` subcommand
+func Run(cfg *build.Config, args []string) error {
+	if len(args) == 0 {
+		fmt.Fprintf(os.Stderr, usage, filepath.Base(os.Args[0]))
+		return fmt.Errorf("repo: no subcommand given")
+	}
+	run, ok := subcommands[args[0]]
+	if !ok {
+		fmt.Fprintf(os.Stderr, usage, filepath.Base(os.Args[0]))
+		return fmt.Errorf("repo: unknown subcommand %q", args[0])
+	}
+	return run(cfg, args[1:])
+}
+
+func newFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet("repo "+name, flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, usage, filepath.Base(os.Args[0]))
+		fmt.Fprintln(os.Stderr)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+func verify(cfg *build.Config, args []string) error {
+	fs := newFlagSet("verify")
+
+	config := &pmrepo.Config{}
+	config.Vars(fs)
+	allowExpired := fs.Bool("allow-expired", false, "don't report expired metadata")
+	encryptionKey := fs.String("e", "", "path to AES private key for blob encryption")
+	noCache := fs.Bool("no-cache", false, "hash every blob, rather than skipping the blobs that are unchanged since they were last verified")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if len(fs.Args()) != 0 {
+		cfg.Warnf("unused arguments: %s", fs.Args())
+	}
+	config.ApplyDefaults()
+
+	r, err := openRepo(config.RepoDir, *encryptionKey)
+	if err != nil {
+		return err
+	}
+
+	if !*noCache {
+		if err := r.EnableMerkleCache(); err != nil {
+			return err
+		}
+	}
+
+	problems := r.Verify(*allowExpired)
+	if !*noCache {
+		if err := r.SaveMerkleCache(); err != nil {
+			cfg.Warnf("unable to save the merkle cache: %s", err)
+		}
+	}
+	if len(problems) != 0 {
+		return fmt.Errorf("repository %s has %d problems:\n%w", config.RepoDir, len(problems), errors.Join(problems...))
+	}
+	return nil
+}
+
+func export(cfg *build.Config, args []string) error {
+	fs := newFlagSet("export")
+
+	config := &pmrepo.Config{}
+	config.Vars(fs)
+	encryptionKey := fs.String("e", "", "path to AES private key for blob encryption")
+	outputPath := fs.String("o", "", "path to write the archive to")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if len(fs.Args()) != 0 {
+		cfg.Warnf("unused arguments: %s", fs.Args())
+	}
+	config.ApplyDefaults()
+	if *outputPath == "" {
+		return fmt.Errorf("repo export: -o is required")
+	}
+
+	r, err := openRepo(config.RepoDir, *encryptionKey)
+	if err != nil {
+		return err
+	}
+
+	// Write to a temporary file first, so that a failed export doesn't leave
+	// a truncated archive behind.
+	f, err := os.CreateTemp(filepath.Dir(*outputPath), filepath.Base(*outputPath))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	w := bufio.NewWriter(f)
+	if err := r.Export(w); err != nil {
+		f.Close()
+		return fmt.Errorf("repo export: %w", err)
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), *outputPath)
+}
+
+func importRepo(cfg *build.Config, args []string) error {
+	fs := newFlagSet("import")
+
+	config := &pmrepo.Config{}
+	config.Vars(fs)
+	archivePath := fs.String("f", "", "path to the archive written by repo export")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if len(fs.Args()) != 0 {
+		cfg.Warnf("unused arguments: %s", fs.Args())
+	}
+	config.ApplyDefaults()
+	if *archivePath == "" {
+		return fmt.Errorf("repo import: -f is required")
+	}
+
+	f, err := os.Open(*archivePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	r, err := pmrepo.New(config.RepoDir, filepath.Join(config.RepoDir, "repository", "blobs"))
+	if err != nil {
+		return err
+	}
+	if err := r.Import(bufio.NewReader(f)); err != nil {
+		return fmt.Errorf("repo import: %w", err)
+	}
+	return nil
+}
+
+// openRepo opens the existing repository at dir, decrypting blobs with the
+// key at encryptionKey if it's set.
+func openRepo(dir, encryptionKey string) (*pmrepo.Repo, error) {
+	if _, err := os.Stat(filepath.Join(dir, "repository", "root.json")); err != nil {
+		return nil, fmt.Errorf("repo: %s is not a repository: %w", dir, err)
+	}
+	r, err := pmrepo.New(dir, filepath.Join(dir, "repository", "blobs"))
+	if err != nil {
+		return nil, err
+	}
+	if encryptionKey != "" {
+		if err := r.EncryptWith(encryptionKey); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
@@ -0,0 +1,183 @@
+// Copyright 2024 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package repo
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"go.fuchsia.dev/fuchsia/src/sys/pkg/bin/pm/build"
+	pmrepo "go.fuchsia.dev/fuchsia/src/sys/pkg/bin/pm/repo"
+)
+
+// newTestRepo returns the directory of a repository publishing the test
+// package built with cfg.
+func newTestRepo(t *testing.T, cfg *build.Config) string {
+	t.Helper()
+	build.BuildTestPackage(cfg)
+
+	repoDir := t.TempDir()
+	r, err := pmrepo.New(repoDir, filepath.Join(repoDir, "repository", "blobs"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Init(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.PublishManifest(filepath.Join(cfg.OutputDir, "package_manifest.json")); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.CommitUpdates(false); err != nil {
+		t.Fatal(err)
+	}
+	return repoDir
+}
+
+func TestVerify(t *testing.T) {
+	cfg := build.TestConfig()
+	defer os.RemoveAll(filepath.Dir(cfg.TempDir))
+	repoDir := newTestRepo(t, cfg)
+
+	if err := Run(cfg, []string{"verify", "-repo", repoDir, "-no-cache"}); err != nil {
+		t.Fatalf("healthy repository: %v", err)
+	}
+	cachePath := filepath.Join(repoDir, pmrepo.MerkleCacheFile)
+	if _, err := os.Stat(cachePath); !os.IsNotExist(err) {
+		t.Errorf("verify with -no-cache wrote %s", cachePath)
+	}
+	for i := 0; i < 2; i++ {
+		if err := Run(cfg, []string{"verify", "-repo", repoDir}); err != nil {
+			t.Fatalf("healthy repository, run %d: %v", i, err)
+		}
+		if _, err := os.Stat(cachePath); err != nil {
+			t.Errorf("run %d: %v", i, err)
+		}
+	}
+
+	for _, name := range []string{"snapshot.json", "targets.json"} {
+		if err := os.Remove(filepath.Join(repoDir, "repository", name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := Run(cfg, []string{"verify", "-repo", repoDir})
+	if err == nil || !strings.Contains(err.Error(), "2 problems") ||
+		!strings.Contains(err.Error(), "snapshot.json") || !strings.Contains(err.Error(), "targets.json") {
+		t.Errorf("got %v, want both missing metadata files reported", err)
+	}
+
+	if err := Run(cfg, []string{"verify", "-repo", t.TempDir()}); err == nil || !strings.Contains(err.Error(), "is not a repository") {
+		t.Errorf("got %v, want error saying the directory is not a repository", err)
+	}
+}
+
+// readTree returns the content of the files under dir, by their paths
+// relative to dir.
+func readTree(t *testing.T, dir string) map[string]string {
+	t.Helper()
+	files := map[string]string{}
+	if err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		b, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		files[filepath.ToSlash(rel)] = string(b)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+func TestExportImport(t *testing.T) {
+	cfg := build.TestConfig()
+	defer os.RemoveAll(filepath.Dir(cfg.TempDir))
+	repoDir := newTestRepo(t, cfg)
+	want := readTree(t, filepath.Join(repoDir, "repository"))
+
+	// A blob no package refers to isn't exported.
+	unused := filepath.Join(repoDir, "repository", "blobs", strings.Repeat("0", 64))
+	if err := os.WriteFile(unused, []byte("unused"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	outDir := t.TempDir()
+	first := filepath.Join(outDir, "first.tar")
+	if err := Run(cfg, []string{"export", "-repo", repoDir, "-o", first}); err != nil {
+		t.Fatal(err)
+	}
+	// Touching the files doesn't change the export.
+	touched := time.Now().Add(time.Hour)
+	for name := range want {
+		if err := os.Chtimes(filepath.Join(repoDir, "repository", filepath.FromSlash(name)), touched, touched); err != nil {
+			t.Fatal(err)
+		}
+	}
+	second := filepath.Join(outDir, "second.tar")
+	if err := Run(cfg, []string{"export", "-repo", repoDir, "-o", second}); err != nil {
+		t.Fatal(err)
+	}
+	firstBytes, err := os.ReadFile(first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secondBytes, err := os.ReadFile(second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(firstBytes, secondBytes) {
+		t.Error("exporting the same repository twice produced different archives")
+	}
+
+	var names []string
+	tr := tar.NewReader(bytes.NewReader(firstBytes))
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, hdr.Name)
+		if !hdr.ModTime.Equal(time.Unix(0, 0)) || hdr.Uid != 0 || hdr.Gid != 0 || hdr.Mode != 0o644 {
+			t.Errorf("entry %s has header %+v, want a normalized header", hdr.Name, hdr)
+		}
+	}
+	if !sort.StringsAreSorted(names) {
+		t.Errorf("archive entries %v aren't sorted", names)
+	}
+
+	importDir := filepath.Join(t.TempDir(), "imported")
+	if err := Run(cfg, []string{"import", "-repo", importDir, "-f", first}); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(want, readTree(t, filepath.Join(importDir, "repository"))); diff != "" {
+		t.Errorf("imported repository (-want +got):\n%s", diff)
+	}
+	if err := Run(cfg, []string{"verify", "-repo", importDir}); err != nil {
+		t.Errorf("imported repository: %v", err)
+	}
+
+	if err := Run(cfg, []string{"import", "-repo", importDir, "-f", first}); err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Errorf("importing over a repository: got %v, want error saying it already exists", err)
+	}
+}
@@ -0,0 +1,47 @@
+// Copyright 2024 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// expandResponseFiles replaces each argument of the form @file with the
+// whitespace separated arguments in file, so that invocations with too many
+// arguments for the OS can pass them in a file instead. Response files may
+// refer to other response files.
+func expandResponseFiles(args []string) ([]string, error) {
+	return expandResponseFilesFrom(args, map[string]bool{})
+}
+
+// expandResponseFilesFrom expands args, with open holding the response files
+// being expanded, to catch those that refer to themselves.
+func expandResponseFilesFrom(args []string, open map[string]bool) ([]string, error) {
+	var out []string
+	for _, arg := range args {
+		path := strings.TrimPrefix(arg, "@")
+		if path == arg || path == "" {
+			out = append(out, arg)
+			continue
+		}
+		if open[path] {
+			return nil, fmt.Errorf("response file %s includes itself", path)
+		}
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("reading response file: %w", err)
+		}
+		open[path] = true
+		expanded, err := expandResponseFilesFrom(strings.Fields(string(b)), open)
+		delete(open, path)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, expanded...)
+	}
+	return out, nil
+}
@@ -0,0 +1,77 @@
+// Copyright 2024 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"go.fuchsia.dev/fuchsia/src/sys/pkg/bin/pm/build"
+)
+
+// flagConfig holds the settings of a build.Config that its flags set.
+type flagConfig struct {
+	OutputDir, ManifestPath, KeyPath, TempDir, PkgName, PkgRepository string
+}
+
+// parseConfig returns the config args set, and the arguments left.
+func parseConfig(t *testing.T, args []string) (flagConfig, []string) {
+	t.Helper()
+	cfg := build.NewConfig()
+	fs := flag.NewFlagSet("pm", flag.ContinueOnError)
+	cfg.InitFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		t.Fatal(err)
+	}
+	return flagConfig{cfg.OutputDir, cfg.ManifestPath, cfg.KeyPath, cfg.TempDir, cfg.PkgName, cfg.PkgRepository}, fs.Args()
+}
+
+func TestResponseFiles(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	flat := write("flat.rsp", "-m manifest -o out")
+	inner := write("inner.rsp", "-o\n\tout\n")
+	nested := write("nested.rsp", "-m manifest\n@"+inner+"\n")
+
+	wantCfg, wantArgs := parseConfig(t, []string{"-m", "manifest", "-o", "out", "build", "-depfile"})
+	for _, rsp := range []string{flat, nested} {
+		args, err := expandResponseFiles([]string{"@" + rsp, "build", "-depfile"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		cfg, rest := parseConfig(t, args)
+		if diff := cmp.Diff(wantCfg, cfg); diff != "" {
+			t.Errorf("@%s: config (-want +got):\n%s", filepath.Base(rsp), diff)
+		}
+		if diff := cmp.Diff(wantArgs, rest); diff != "" {
+			t.Errorf("@%s: arguments (-want +got):\n%s", filepath.Base(rsp), diff)
+		}
+	}
+
+	// A lone @ is an argument like any other.
+	if args, err := expandResponseFiles([]string{"@"}); err != nil || len(args) != 1 || args[0] != "@" {
+		t.Errorf("got %q, %v, want @ left as is", args, err)
+	}
+
+	loop := filepath.Join(dir, "loop.rsp")
+	write("loop.rsp", "-m manifest @"+loop)
+	if _, err := expandResponseFiles([]string{"@" + loop}); err == nil || !strings.Contains(err.Error(), "includes itself") {
+		t.Errorf("got %v, want an error for a response file including itself", err)
+	}
+	if _, err := expandResponseFiles([]string{"@" + filepath.Join(dir, "missing.rsp")}); err == nil {
+		t.Error("expanding a missing response file succeeded")
+	}
+}
@@ -0,0 +1,127 @@
+// Copyright 2024 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"time"
+
+	"go.fuchsia.dev/fuchsia/src/sys/pkg/bin/pm/build"
+)
+
+const schemaUsage = `Usage: %s schema <command>
+print a JSON schema of the flags a command accepts: pm's global flags,
+including those of the build configuration, and the command's own flags,
+for the commands that describe them
+`
+
+// schemaStdout is where schemas are written.
+var schemaStdout io.Writer = os.Stdout
+
+// flagSchema is the JSON schema of a flag.
+type flagSchema struct {
+	Type        string      `json:"type"`
+	Default     interface{} `json:"default"`
+	Description string      `json:"description"`
+	// Scope is "global" for flags given before the command name, and
+	// "command" for flags given after it.
+	Scope string `json:"x-pm-scope"`
+}
+
+// commandSchema is the JSON schema of the flags of a command, as an object
+// with a property per flag.
+type commandSchema struct {
+	Schema     string                `json:"$schema"`
+	Title      string                `json:"title"`
+	Type       string                `json:"type"`
+	Properties map[string]flagSchema `json:"properties"`
+}
+
+func runSchema(cfg *build.Config, args []string) error {
+	fs := flag.NewFlagSet("schema", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, schemaUsage, filepath.Base(os.Args[0]))
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return fmt.Errorf("schema: no command given")
+	}
+	if len(fs.Args()) > 1 {
+		cfg.Warnf("unused arguments: %s", fs.Args()[1:])
+	}
+	name := fs.Arg(0)
+	c, ok := lookupCommand(name)
+	if !ok {
+		return fmt.Errorf("schema: unknown command %q", name)
+	}
+
+	enc := json.NewEncoder(schemaStdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(schemaOf(c))
+}
+
+// schemaOf returns the schema of the flags of c.
+func schemaOf(c command) *commandSchema {
+	s := &commandSchema{
+		Schema:     "https://json-schema.org/draft/2020-12/schema",
+		Title:      "pm " + c.Name,
+		Type:       "object",
+		Properties: map[string]flagSchema{},
+	}
+
+	// The build configuration's flags are only added to the global flags by
+	// doMain, so define them anew.
+	config := flag.NewFlagSet("pm", flag.ContinueOnError)
+	build.NewConfig().InitFlags(config)
+	for _, fs := range []*flag.FlagSet{config, flag.CommandLine} {
+		fs.VisitAll(func(f *flag.Flag) { s.Properties[f.Name] = schemaOfFlag(f, "global") })
+	}
+
+	if c.flags != nil {
+		fs := flag.NewFlagSet(c.Name, flag.ContinueOnError)
+		c.flags(fs)
+		fs.VisitAll(func(f *flag.Flag) { s.Properties[f.Name] = schemaOfFlag(f, "command") })
+	}
+	return s
+}
+
+func schemaOfFlag(f *flag.Flag, scope string) flagSchema {
+	s := flagSchema{Type: "string", Default: f.DefValue, Description: f.Usage, Scope: scope}
+	getter, ok := f.Value.(flag.Getter)
+	if !ok {
+		return s
+	}
+	switch v := getter.Get().(type) {
+	case bool:
+		s.Type = "boolean"
+		s.Default, _ = strconv.ParseBool(f.DefValue)
+	case time.Duration:
+		// Durations are given in Go's syntax, such as "1m30s".
+	default:
+		switch reflect.TypeOf(v).Kind() {
+		case reflect.Int, reflect.Int64, reflect.Uint, reflect.Uint64:
+			s.Type = "integer"
+			if n, err := strconv.ParseInt(f.DefValue, 0, 64); err == nil {
+				s.Default = n
+			}
+		case reflect.Float64:
+			s.Type = "number"
+			if n, err := strconv.ParseFloat(f.DefValue, 64); err == nil {
+				s.Default = n
+			}
+		}
+	}
+	return s
+}
@@ -0,0 +1,72 @@
+// Copyright 2024 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"go.fuchsia.dev/fuchsia/src/sys/pkg/bin/pm/build"
+)
+
+// runTestSchema runs `pm schema` with args and returns the schema it writes.
+func runTestSchema(t *testing.T, args ...string) commandSchema {
+	t.Helper()
+	var out bytes.Buffer
+	schemaStdout = &out
+	defer func() { schemaStdout = os.Stdout }()
+	if err := runSchema(build.NewConfig(), args); err != nil {
+		t.Fatal(err)
+	}
+	var s commandSchema
+	if err := json.Unmarshal(out.Bytes(), &s); err != nil {
+		t.Fatalf("schema %s isn't valid JSON: %v", out.String(), err)
+	}
+	return s
+}
+
+func TestSchema(t *testing.T) {
+	s := runTestSchema(t, "build")
+	if s.Title != "pm build" || s.Type != "object" {
+		t.Errorf("got title %q and type %q, want pm build and object", s.Title, s.Type)
+	}
+	defaults := build.NewConfig()
+	for name, want := range map[string]flagSchema{
+		"k":                 {Type: "string", Default: defaults.KeyPath, Scope: "global"},
+		"m":                 {Type: "string", Default: defaults.ManifestPath, Scope: "global"},
+		"o":                 {Type: "string", Default: defaults.OutputDir, Scope: "global"},
+		"t":                 {Type: "string", Default: defaults.TempDir, Scope: "global"},
+		"create-output-dir": {Type: "boolean", Default: false, Scope: "global"},
+		"fail-on-warning":   {Type: "boolean", Default: false, Scope: "global"},
+		"output-format":     {Type: "string", Default: "text", Scope: "global"},
+	} {
+		got, ok := s.Properties[name]
+		if !ok {
+			t.Errorf("the schema of build lacks -%s", name)
+			continue
+		}
+		if got.Description == "" {
+			t.Errorf("-%s has no description", name)
+		}
+		got.Description = ""
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Errorf("-%s (-want +got):\n%s", name, diff)
+		}
+	}
+
+	// Commands that describe their flags have them listed too.
+	s = runTestSchema(t, "doctor")
+	if got := s.Properties["format"]; got.Type != "string" || got.Default != "text" || got.Scope != "command" {
+		t.Errorf("got -format %+v, want a string defaulting to text, given to the command", got)
+	}
+
+	if err := runSchema(build.NewConfig(), []string{"bogus"}); err == nil {
+		t.Error("the schema of an unknown command succeeded")
+	}
+}
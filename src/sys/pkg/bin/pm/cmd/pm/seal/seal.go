@@ -6,6 +6,7 @@
 package seal
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"os"
@@ -33,9 +34,9 @@ func Run(cfg *build.Config, args []string) error {
 	}
 
 	if len(fs.Args()) != 0 {
-		fmt.Fprintf(os.Stderr, "WARNING: unused arguments: %s\n", fs.Args())
+		cfg.Warnf("unused arguments: %s", fs.Args())
 	}
 
-	_, err := build.Seal(cfg)
+	_, err := build.SealPackage(context.Background(), cfg)
 	return err
 }
@@ -0,0 +1,82 @@
+// Copyright 2024 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package serve
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// basicAuth requires HTTP basic authentication with one of a set of
+// credentials before passing requests to the wrapped handler.
+type basicAuth struct {
+	// credentials maps user names to passwords.
+	credentials map[string]string
+	handler     http.Handler
+}
+
+func (a *basicAuth) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	user, password, ok := r.BasicAuth()
+	if ok {
+		want, known := a.credentials[user]
+		// Compare the password even for unknown users, so that the time
+		// taken doesn't tell which users exist.
+		match := subtle.ConstantTimeCompare([]byte(password), []byte(want)) == 1
+		if known && match {
+			a.handler.ServeHTTP(w, r)
+			return
+		}
+	}
+	w.Header().Set("WWW-Authenticate", `Basic realm="pm", charset="UTF-8"`)
+	http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+}
+
+// loadCredentials returns the credentials given by -auth, as user:password,
+// and in the -auth-file, which holds one user:password per line. Empty lines
+// and lines starting with # are ignored.
+func loadCredentials(auth, authFile string) (map[string]string, error) {
+	credentials := map[string]string{}
+	add := func(source, line string) error {
+		user, password, ok := strings.Cut(line, ":")
+		if !ok || user == "" {
+			return fmt.Errorf("%s: want user:password", source)
+		}
+		credentials[user] = password
+		return nil
+	}
+	if auth != "" {
+		if err := add("-auth", auth); err != nil {
+			return nil, err
+		}
+	}
+	if authFile != "" {
+		b, err := os.ReadFile(authFile)
+		if err != nil {
+			return nil, err
+		}
+		s := bufio.NewScanner(bytes.NewReader(b))
+		for n := 1; s.Scan(); n++ {
+			line := strings.TrimSpace(s.Text())
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			if err := add(fmt.Sprintf("%s:%d", authFile, n), line); err != nil {
+				return nil, err
+			}
+		}
+		if err := s.Err(); err != nil {
+			return nil, err
+		}
+		if len(credentials) == 0 {
+			return nil, fmt.Errorf("%s holds no credentials", authFile)
+		}
+	}
+	return credentials, nil
+}
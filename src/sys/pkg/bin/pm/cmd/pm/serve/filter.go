@@ -0,0 +1,204 @@
+// Copyright 2024 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package serve
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"go.fuchsia.dev/fuchsia/src/sys/pkg/bin/pm/repo"
+)
+
+// versionedTargetsPat matches the consistent snapshot copies of targets.json.
+var versionedTargetsPat = regexp.MustCompile(`^/[0-9]+\.targets\.json$`)
+
+// hashedTargetPat matches the hash prefix of the consistent snapshot copies of
+// target files.
+var hashedTargetPat = regexp.MustCompile(`^[0-9a-f]+\.`)
+
+// targetsFilter serves a view of a repository holding only the targets whose
+// names match a glob. The targets metadata is served with the other targets
+// removed, but with its original signatures, so only clients that don't check
+// the targets signature will accept it. Blobs and target files that only belong
+// to the other targets are not served.
+type targetsFilter struct {
+	pattern  string
+	serveDir string
+	repo     *repo.Repo
+	next     http.Handler
+
+	mu sync.Mutex
+	// modTime and size identify the targets.json that blobs was computed for.
+	modTime time.Time
+	size    int64
+	blobs   map[string]struct{}
+}
+
+func newTargetsFilter(pattern, serveDir string, r *repo.Repo, next http.Handler) (*targetsFilter, error) {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, fmt.Errorf("invalid targets filter %q: %w", pattern, err)
+	}
+	return &targetsFilter{pattern: pattern, serveDir: serveDir, repo: r, next: next}, nil
+}
+
+func (f *targetsFilter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	p := path.Clean(r.URL.Path)
+	switch {
+	case p == "/targets.json" || versionedTargetsPat.MatchString(p):
+		f.serveTargets(w, r, p)
+	case strings.HasPrefix(p, "/blobs/"):
+		allowed, err := f.allowedBlobs()
+		if err != nil {
+			log.Printf("[pm serve] filtering blobs: %s", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if _, ok := allowed[path.Base(p)]; !ok {
+			http.NotFound(w, r)
+			return
+		}
+		f.next.ServeHTTP(w, r)
+	case strings.HasPrefix(p, "/targets/"):
+		name := strings.TrimPrefix(p, "/targets/")
+		dir, base := path.Split(name)
+		if !f.match(name) && !f.match(dir+hashedTargetPat.ReplaceAllString(base, "")) {
+			http.NotFound(w, r)
+			return
+		}
+		f.next.ServeHTTP(w, r)
+	default:
+		f.next.ServeHTTP(w, r)
+	}
+}
+
+func (f *targetsFilter) match(name string) bool {
+	ok, _ := path.Match(f.pattern, name)
+	return ok
+}
+
+// serveTargets serves the targets metadata at p with the non-matching targets
+// removed.
+func (f *targetsFilter) serveTargets(w http.ResponseWriter, r *http.Request, p string) {
+	b, err := os.ReadFile(filepath.Join(f.serveDir, filepath.FromSlash(p)))
+	if os.IsNotExist(err) {
+		http.NotFound(w, r)
+		return
+	}
+	if err == nil {
+		b, err = f.filterTargets(b)
+	}
+	if err != nil {
+		log.Printf("[pm serve] filtering %s: %s", p, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(b)
+}
+
+// filterTargets returns the targets metadata b with the non-matching targets
+// removed.
+func (f *targetsFilter) filterTargets(b []byte) ([]byte, error) {
+	var metadata struct {
+		Signed     map[string]json.RawMessage `json:"signed"`
+		Signatures json.RawMessage            `json:"signatures"`
+	}
+	if err := json.Unmarshal(b, &metadata); err != nil {
+		return nil, err
+	}
+	targets, err := f.matchingTargets(metadata.Signed["targets"])
+	if err != nil {
+		return nil, err
+	}
+	if metadata.Signed["targets"], err = json.Marshal(targets); err != nil {
+		return nil, err
+	}
+	return json.Marshal(metadata)
+}
+
+// matchingTargets decodes the targets of a targets.json, keeping the ones
+// whose names match.
+func (f *targetsFilter) matchingTargets(b json.RawMessage) (map[string]json.RawMessage, error) {
+	var targets map[string]json.RawMessage
+	if err := json.Unmarshal(b, &targets); err != nil {
+		return nil, err
+	}
+	for name := range targets {
+		if !f.match(name) {
+			delete(targets, name)
+		}
+	}
+	return targets, nil
+}
+
+// allowedBlobs returns the merkle roots of the blobs of the matching targets
+// in the current targets.json.
+func (f *targetsFilter) allowedBlobs() (map[string]struct{}, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	targetsPath := filepath.Join(f.serveDir, "targets.json")
+	fi, err := os.Stat(targetsPath)
+	if err != nil {
+		return nil, err
+	}
+	if f.blobs != nil && fi.ModTime().Equal(f.modTime) && fi.Size() == f.size {
+		return f.blobs, nil
+	}
+
+	b, err := os.ReadFile(targetsPath)
+	if err != nil {
+		return nil, err
+	}
+	var metadata struct {
+		Signed struct {
+			Targets json.RawMessage `json:"targets"`
+		} `json:"signed"`
+	}
+	if err := json.Unmarshal(b, &metadata); err != nil {
+		return nil, err
+	}
+	targets, err := f.matchingTargets(metadata.Signed.Targets)
+	if err != nil {
+		return nil, err
+	}
+
+	blobs := map[string]struct{}{}
+	for name, target := range targets {
+		var meta struct {
+			Custom struct {
+				Merkle string `json:"merkle"`
+			} `json:"custom"`
+		}
+		if err := json.Unmarshal(target, &meta); err != nil {
+			return nil, fmt.Errorf("target %s: %w", name, err)
+		}
+		if meta.Custom.Merkle == "" {
+			continue
+		}
+		blobs[meta.Custom.Merkle] = struct{}{}
+		contents, err := f.repo.PackageContents(meta.Custom.Merkle)
+		if err != nil {
+			// A broken package is still served, as far as it can be.
+			log.Printf("[pm serve] target %s: %s", name, err)
+			continue
+		}
+		for _, merkle := range contents {
+			blobs[merkle.String()] = struct{}{}
+		}
+	}
+
+	f.modTime, f.size, f.blobs = fi.ModTime(), fi.Size(), blobs
+	return blobs, nil
+}
@@ -0,0 +1,126 @@
+// Copyright 2024 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package serve
+
+import (
+	"bytes"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// metadataFile is the contents of a metadata file, and the modification time
+// and size the file had when it was read.
+type metadataFile struct {
+	content []byte
+	modTime time.Time
+	size    int64
+}
+
+// metadataCache serves the TUF metadata files at the top of a repository from
+// memory, rereading a file once its modification time or size changes. All
+// other requests, such as for blobs, are passed to next.
+type metadataCache struct {
+	dir  string
+	next http.Handler
+
+	mu    sync.RWMutex
+	files map[string]*metadataFile
+
+	wg   sync.WaitGroup
+	done chan struct{}
+}
+
+// newMetadataCache returns a metadataCache for the repository served from dir,
+// which checks every interval whether the cached files have changed.
+func newMetadataCache(dir string, interval time.Duration, next http.Handler) *metadataCache {
+	c := &metadataCache{
+		dir:   dir,
+		next:  next,
+		files: map[string]*metadataFile{},
+		done:  make(chan struct{}),
+	}
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				c.Refresh()
+			case <-c.done:
+				return
+			}
+		}
+	}()
+	return c
+}
+
+// Close stops checking the cached files for changes.
+func (c *metadataCache) Close() {
+	close(c.done)
+	c.wg.Wait()
+}
+
+// Refresh drops the cached files that have changed since they were read.
+func (c *metadataCache) Refresh() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for name, f := range c.files {
+		fi, err := os.Stat(filepath.Join(c.dir, name))
+		if err != nil || !fi.ModTime().Equal(f.modTime) || fi.Size() != f.size {
+			delete(c.files, name)
+		}
+	}
+}
+
+func (c *metadataCache) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	p := path.Clean(r.URL.Path)
+	if path.Dir(p) != "/" || !strings.HasSuffix(p, ".json") {
+		c.next.ServeHTTP(w, r)
+		return
+	}
+	name := strings.TrimPrefix(p, "/")
+	f, err := c.get(name)
+	if err != nil {
+		// Let the file server report the error, as it would without the cache.
+		c.next.ServeHTTP(w, r)
+		return
+	}
+	http.ServeContent(w, r, name, f.modTime, bytes.NewReader(f.content))
+}
+
+// get returns the metadata file name, reading it if it isn't cached.
+func (c *metadataCache) get(name string) (*metadataFile, error) {
+	c.mu.RLock()
+	f, ok := c.files[name]
+	c.mu.RUnlock()
+	if ok {
+		return f, nil
+	}
+
+	p := filepath.Join(c.dir, name)
+	fi, err := os.Stat(p)
+	if err != nil {
+		return nil, err
+	}
+	content, err := os.ReadFile(p)
+	if err != nil {
+		return nil, err
+	}
+	// The file may have been replaced between the stat and the read, in which
+	// case the next refresh drops it.
+	f = &metadataFile{content: content, modTime: fi.ModTime(), size: fi.Size()}
+
+	c.mu.Lock()
+	c.files[name] = f
+	c.mu.Unlock()
+	return f, nil
+}
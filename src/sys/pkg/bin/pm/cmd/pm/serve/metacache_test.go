@@ -0,0 +1,107 @@
+// Copyright 2024 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package serve
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func get(t testing.TB, h http.Handler, path string) (int, string) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	b, err := io.ReadAll(rec.Result().Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rec.Code, string(b)
+}
+
+func TestMetadataCache(t *testing.T) {
+	dir := t.TempDir()
+	targetsPath := filepath.Join(dir, "targets.json")
+	if err := os.WriteFile(targetsPath, []byte(`{"version":1}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(dir, "blobs"), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "blobs", "abc"), []byte("blob"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	const interval = 100 * time.Millisecond
+	c := newMetadataCache(dir, interval, http.FileServer(http.Dir(dir)))
+	defer c.Close()
+
+	if code, body := get(t, c, "/targets.json"); code != http.StatusOK || body != `{"version":1}` {
+		t.Fatalf("got %d %q, want version 1", code, body)
+	}
+	if code, body := get(t, c, "/blobs/abc"); code != http.StatusOK || body != "blob" {
+		t.Errorf("blob: got %d %q, want the blob", code, body)
+	}
+	if code, _ := get(t, c, "/missing.json"); code != http.StatusNotFound {
+		t.Errorf("missing metadata: got %d, want %d", code, http.StatusNotFound)
+	}
+
+	// A change the size of the file doesn't reveal is still noticed through the
+	// modification time.
+	if err := os.WriteFile(targetsPath, []byte(`{"version":2}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	changed := time.Now().Add(time.Hour)
+	if err := os.Chtimes(targetsPath, changed, changed); err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	for {
+		_, body := get(t, c, "/targets.json")
+		if body == `{"version":2}` {
+			break
+		}
+		if time.Since(start) > 2*interval {
+			t.Fatalf("still serving %q after %v, want the change picked up within the %v poll interval", body, time.Since(start), interval)
+		}
+		time.Sleep(interval / 10)
+	}
+}
+
+func BenchmarkMetadata(b *testing.B) {
+	dir := b.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "targets.json"), []byte(strings.Repeat("x", 64*1024)), 0o644); err != nil {
+		b.Fatal(err)
+	}
+	files := http.FileServer(http.Dir(dir))
+
+	for _, bc := range []struct {
+		name    string
+		handler func() (http.Handler, func())
+	}{
+		{"uncached", func() (http.Handler, func()) { return files, func() {} }},
+		{"cached", func() (http.Handler, func()) {
+			c := newMetadataCache(dir, time.Second, files)
+			return c, c.Close
+		}},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			h, done := bc.handler()
+			defer done()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if code, _ := get(b, h, "/targets.json"); code != http.StatusOK {
+					b.Fatalf("got %d, want %d", code, http.StatusOK)
+				}
+			}
+			b.ReportMetric(float64(b.N)/b.Elapsed().Seconds(), "req/s")
+		})
+	}
+}
@@ -6,6 +6,7 @@ package serve
 
 import (
 	"compress/gzip"
+	"context"
 	"flag"
 	"fmt"
 	"log"
@@ -26,25 +27,48 @@ import (
 // server is a default http server only parameterized for tests.
 var server http.Server
 
-var (
-	fs            = flag.NewFlagSet("serve", flag.ExitOnError)
-	repoServeDir  = fs.String("d", "", "(deprecated, use -repo) path to the repository")
-	listen        = fs.String("l", ":8083", "HTTP listen address")
-	auto          = fs.Bool("a", true, "Host auto endpoint for realtime client updates")
-	quiet         = fs.Bool("q", false, "Don't print out information about requests")
-	encryptionKey = fs.String("e", "", "Path to a symmetric blob encryption key *UNSAFE*")
-	publishList   = fs.String("p", "", "path to a package list file to be auto-published")
-	portFile      = fs.String("f", "", "path to a file to write the HTTP listen port")
-	configVersion = fs.Int("c", 1, "component framework version for config.json")
-	persist       = fs.Bool("persist", false, "request clients to persist TUF metadata for this repository (supported only with `-c 2`)")
-	config        = &repo.Config{}
-	initOnce      sync.Once
-)
+// serveFlags are the options of one serve call, as parsed by parseFlags.
+type serveFlags struct {
+	repoServeDir  string
+	listen        string
+	auto          bool
+	quiet         bool
+	encryptionKey string
+	publishList   string
+	portFile      string
+	configVersion int
+	persist       bool
+	targetsGlob   string
+	cacheMetadata bool
+	cachePoll     time.Duration
+	auth          string
+	authFile      string
+	blobType      string
+	config        repo.Config
+}
 
-func ParseFlags(args []string) error {
-	// the flags added by vars can't be added more than once, so when tests invoke
-	// this func more than once, it causes a failure.
-	initOnce.Do(func() { config.Vars(fs) })
+// parseFlags parses the flags of a serve call. Each call has its own flag set
+// and repository configuration, so that servers started in the same process
+// don't share options.
+func parseFlags(cfg *build.Config, args []string) (*serveFlags, error) {
+	f := &serveFlags{}
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	fs.StringVar(&f.repoServeDir, "d", "", "(deprecated, use -repo) path to the repository")
+	fs.StringVar(&f.listen, "l", ":8083", "HTTP listen address")
+	fs.BoolVar(&f.auto, "a", true, "Host auto endpoint for realtime client updates")
+	fs.BoolVar(&f.quiet, "q", false, "Don't print out information about requests")
+	fs.StringVar(&f.encryptionKey, "e", "", "Path to a symmetric blob encryption key *UNSAFE*")
+	fs.StringVar(&f.publishList, "p", "", "path to a package list file to be auto-published")
+	fs.StringVar(&f.portFile, "f", "", "path to a file to write the HTTP listen port")
+	fs.IntVar(&f.configVersion, "c", 1, "component framework version for config.json")
+	fs.BoolVar(&f.persist, "persist", false, "request clients to persist TUF metadata for this repository (supported only with `-c 2`)")
+	fs.StringVar(&f.targetsGlob, "targets-filter", "", "only serve the targets whose names match this glob, and their blobs; the filtered targets.json keeps its original signatures")
+	fs.BoolVar(&f.cacheMetadata, "cache-metadata", false, "serve the TUF metadata from memory, rereading files that change")
+	fs.DurationVar(&f.cachePoll, "cache-metadata-poll", time.Second, "how often to check cached metadata for changes (with -cache-metadata)")
+	fs.StringVar(&f.auth, "auth", "", "require HTTP basic authentication with these credentials, as user:password")
+	fs.StringVar(&f.authFile, "auth-file", "", "require HTTP basic authentication with the credentials in this file, one user:password per line")
+	fs.StringVar(&f.blobType, "blob-content-type", "", "Content-Type of blob responses, such as application/octet-stream; by default it's detected from the blob's content")
+	f.config.Vars(fs)
 
 	fs.Usage = func() {
 		fmt.Fprintf(os.Stderr, "usage: %s serve", filepath.Base(os.Args[0]))
@@ -53,68 +77,159 @@ func ParseFlags(args []string) error {
 	}
 
 	if err := fs.Parse(args); err != nil {
-		return err
+		return nil, err
 	}
 	if len(fs.Args()) != 0 {
-		fmt.Fprintf(os.Stderr, "WARNING: unused arguments: %s\n", fs.Args())
+		cfg.Warnf("unused arguments: %s", fs.Args())
 	}
-	config.ApplyDefaults()
+	f.config.ApplyDefaults()
 
 	// The -d flag points at $reporoot/repository, so the "repo" for publishing is
 	// one directory above that.
 	// If -d is passed, it takes priority.
-	if *repoServeDir == "" {
-		*repoServeDir = filepath.Join(config.RepoDir, "repository")
+	if f.repoServeDir == "" {
+		f.repoServeDir = filepath.Join(f.config.RepoDir, "repository")
 	} else {
-		config.RepoDir = filepath.Dir(*repoServeDir)
+		f.config.RepoDir = filepath.Dir(f.repoServeDir)
 	}
-	return nil
+	return f, nil
 }
 
-func Run(cfg *build.Config, args []string, addrChan chan string) error {
-	if err := ParseFlags(args); err != nil {
+// Server is a running repository server, as started by Serve.
+type Server struct {
+	server *http.Server
+	addr   string
+	// cleanups are run in reverse order once the server stops.
+	cleanups []func()
+	done     chan struct{}
+	err      error
+}
+
+// Addr returns the address the server is listening on, with the port it was
+// given if it was asked to listen on port 0.
+func (s *Server) Addr() string {
+	return s.addr
+}
+
+// Shutdown stops the server gracefully, as http.Server.Shutdown does, and
+// waits until the server's background work has stopped or ctx is done.
+func (s *Server) Shutdown(ctx context.Context) error {
+	if err := s.server.Shutdown(ctx); err != nil {
 		return err
 	}
+	select {
+	case <-s.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Wait waits for the server to stop and returns the reason it stopped, which
+// is http.ErrServerClosed once it's shut down.
+func (s *Server) Wait() error {
+	<-s.done
+	return s.err
+}
+
+func (s *Server) onStop(f func()) {
+	s.cleanups = append(s.cleanups, f)
+}
+
+func (s *Server) cleanup() {
+	for i := len(s.cleanups) - 1; i >= 0; i-- {
+		s.cleanups[i]()
+	}
+	s.cleanups = nil
+}
 
-	repo, err := repo.New(config.RepoDir, filepath.Join(config.RepoDir, "repository", "blobs"))
+// Run serves the repository named by the flags in args until the server is
+// closed, sending the address it listens on to addrChan, if given.
+func Run(cfg *build.Config, args []string, addrChan chan string) error {
+	s, err := serve(context.Background(), cfg, args, &server)
 	if err != nil {
 		return err
 	}
-	if *encryptionKey != "" {
-		repo.EncryptWith(*encryptionKey)
+	if addrChan != nil {
+		addrChan <- s.Addr()
+	}
+	return s.Wait()
+}
+
+// Serve starts serving the repository named by the flags in args, as `pm
+// serve` does, and returns once the server is listening. The server is shut
+// down when ctx is done, or by Server.Shutdown.
+func Serve(ctx context.Context, cfg *build.Config, args []string) (*Server, error) {
+	return serve(ctx, cfg, args, &http.Server{})
+}
+
+func serve(ctx context.Context, cfg *build.Config, args []string, srv *http.Server) (_ *Server, err error) {
+	f, err := parseFlags(cfg, args)
+	if err != nil {
+		return nil, err
+	}
+	credentials, err := loadCredentials(f.auth, f.authFile)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Server{server: srv, done: make(chan struct{})}
+	defer func() {
+		if err != nil {
+			s.cleanup()
+		}
+	}()
+
+	repo, err := repo.New(f.config.RepoDir, filepath.Join(f.config.RepoDir, "repository", "blobs"))
+	if err != nil {
+		return nil, err
+	}
+	if f.encryptionKey != "" {
+		repo.EncryptWith(f.encryptionKey)
 	}
 
 	if err := repo.Init(); err != nil && err != os.ErrExist {
-		return fmt.Errorf("repository at %q is not valid or could not be initialized: %s", config.RepoDir, err)
+		return nil, fmt.Errorf("repository at %q is not valid or could not be initialized: %s", f.config.RepoDir, err)
 	}
 
 	mux := http.NewServeMux()
 
-	if *auto {
+	var dirServer http.Handler = http.FileServer(http.Dir(f.repoServeDir))
+	var metaCache *metadataCache
+	if f.cacheMetadata {
+		metaCache = newMetadataCache(f.repoServeDir, f.cachePoll, dirServer)
+		s.onStop(metaCache.Close)
+		dirServer = metaCache
+	}
+
+	if f.auto {
 		as := pmhttp.NewAutoServer()
 
-		// This needs to be the first defer to guarantee the channels ranged over in the
-		// waited-upon goroutines are closed by subsequent defer cleanup.
+		// This needs to be the first cleanup to guarantee the channels ranged over in
+		// the waited-upon goroutines are closed by subsequent cleanups.
 		var wg sync.WaitGroup
-		defer wg.Wait()
+		s.onStop(wg.Wait)
 
 		w, err := fswatch.NewWatcher()
 		if err != nil {
-			return fmt.Errorf("failed to initialize fsnotify: %s", err)
+			return nil, fmt.Errorf("failed to initialize fsnotify: %s", err)
 		}
-		defer w.Close()
+		s.onStop(func() { w.Close() })
 
-		timestampPath := filepath.Join(*repoServeDir, "timestamp.json")
+		timestampPath := filepath.Join(f.repoServeDir, "timestamp.json")
 		timestampMonitor := NewMetadataMonitor(timestampPath, w)
-		defer timestampMonitor.Close()
+		s.onStop(timestampMonitor.Close)
 
 		wg.Add(3)
 		go func() {
 			defer wg.Done()
 			for metadata := range timestampMonitor.Events {
-				if !*quiet {
+				if !f.quiet {
 					log.Printf("[pm auto] notify new timestamp.json version: %v", metadata.Version)
 				}
+				if metaCache != nil {
+					metaCache.Refresh()
+				}
 				as.Broadcast("timestamp.json", fmt.Sprintf("%v", metadata.Version))
 			}
 		}()
@@ -140,12 +255,12 @@ func Run(cfg *build.Config, args []string, addrChan chan string) error {
 
 		mux.Handle("/auto", as)
 
-		if *publishList != "" {
-			mw, err := NewManifestWatcher(publishList, quiet)
+		if f.publishList != "" {
+			mw, err := NewManifestWatcher(&f.publishList, &f.quiet)
 			if err != nil {
-				return fmt.Errorf("[pm auto] unable to create incremental manifest watcher: %s", err)
+				return nil, fmt.Errorf("[pm auto] unable to create incremental manifest watcher: %s", err)
 			}
-			defer mw.stop()
+			s.onStop(mw.stop)
 			wg.Add(1)
 			go func() {
 				defer wg.Done()
@@ -154,18 +269,23 @@ func Run(cfg *build.Config, args []string, addrChan chan string) error {
 					if err != nil {
 						log.Fatalf("[pm auto] unable to publish manifests %v: %s", manifests, err)
 					}
-					if err := repo.CommitUpdates(config.TimeVersioned); err != nil {
+					if err := repo.CommitUpdates(f.config.TimeVersioned); err != nil {
 						log.Fatalf("[pm auto] committing repo: %s", err)
 					}
 				}
 			}()
 			if err := mw.start(); err != nil {
-				return fmt.Errorf("[pm auto] failed to start incremental manifest watcher: %s", err)
+				return nil, fmt.Errorf("[pm auto] failed to start incremental manifest watcher: %s", err)
 			}
 		}
 	}
 
-	dirServer := http.FileServer(http.Dir(*repoServeDir))
+	if f.targetsGlob != "" {
+		dirServer, err = newTargetsFilter(f.targetsGlob, f.repoServeDir, repo, dirServer)
+		if err != nil {
+			return nil, err
+		}
+	}
 	mux.Handle("/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		switch r.URL.Path {
 		case "/":
@@ -173,34 +293,42 @@ func Run(cfg *build.Config, args []string, addrChan chan string) error {
 		case "/js":
 			pmhttp.ServeJS(w)
 		default:
+			if f.blobType != "" && strings.HasPrefix(r.URL.Path, "/blobs/") {
+				w.Header().Set("Content-Type", f.blobType)
+			}
 			dirServer.ServeHTTP(w, r)
 		}
 	}))
 
-	switch *configVersion {
+	switch f.configVersion {
 	case 1:
 		cs := pmhttp.NewConfigServer(func() []byte {
-			b, err := os.ReadFile(filepath.Join(*repoServeDir, "root.json"))
+			b, err := os.ReadFile(filepath.Join(f.repoServeDir, "root.json"))
 			if err != nil {
 				log.Printf("%s", err)
 			}
 			return b
-		}, *encryptionKey)
+		}, f.encryptionKey)
 		mux.Handle("/config.json", cs)
 	case 2:
 		cs := pmhttp.NewConfigServerV2(func() []byte {
-			b, err := os.ReadFile(filepath.Join(*repoServeDir, "root.json"))
+			b, err := os.ReadFile(filepath.Join(f.repoServeDir, "root.json"))
 			if err != nil {
 				log.Printf("%s", err)
 			}
 			return b
-		}, *persist)
+		}, f.persist)
 		mux.Handle("/config.json", cs)
 	default:
-		return fmt.Errorf("[pm auto] invalid component version specified: %v", *configVersion)
+		return nil, fmt.Errorf("[pm auto] invalid component version specified: %v", f.configVersion)
 	}
 
-	server.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	var handler http.Handler = mux
+	if len(credentials) != 0 {
+		handler = &basicAuth{credentials: credentials, handler: mux}
+	}
+
+	srv.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if !strings.HasPrefix(r.RequestURI, "/blobs") && strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
 			gw := &pmhttp.GZIPWriter{
 				w,
@@ -211,8 +339,8 @@ func Run(cfg *build.Config, args []string, addrChan chan string) error {
 			w = gw
 		}
 		lw := &pmhttp.LoggingWriter{w, 0, 0}
-		mux.ServeHTTP(lw, r)
-		if !*quiet {
+		handler.ServeHTTP(lw, r)
+		if !f.quiet {
 			fmt.Printf("%s [pm serve] %s \"%s %s %s\" %d %d\n",
 				time.Now().Format("2006-01-02 15:04:05"),
 				r.RemoteAddr,
@@ -224,34 +352,45 @@ func Run(cfg *build.Config, args []string, addrChan chan string) error {
 		}
 	})
 
-	listener, err := getListener(*listen)
+	listener, err := getListener(f.listen)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	s.onStop(func() { listener.Close() })
 
 	addr := listener.Addr().String()
-	if addrChan != nil {
-		addrChan <- addr
-	}
+	s.addr = addr
 
-	if *portFile != "" {
+	if f.portFile != "" {
 		_, port, err := net.SplitHostPort(addr)
 		if err != nil {
-			return fmt.Errorf("error splitting addr into host and port %s: %s", addr, err)
+			return nil, fmt.Errorf("error splitting addr into host and port %s: %s", addr, err)
 		}
-		portFileTmp := fmt.Sprintf("%s.tmp", *portFile)
+		portFileTmp := fmt.Sprintf("%s.tmp", f.portFile)
 		if err := os.WriteFile(portFileTmp, []byte(port), 0644); err != nil {
-			return fmt.Errorf("error creating tmp port file %s: %s", portFileTmp, err)
+			return nil, fmt.Errorf("error creating tmp port file %s: %s", portFileTmp, err)
 		}
-		if err := os.Rename(portFileTmp, *portFile); err != nil {
-			return fmt.Errorf("error renaming port file from %s to %s:  %s", portFileTmp, *portFile, err)
+		if err := os.Rename(portFileTmp, f.portFile); err != nil {
+			return nil, fmt.Errorf("error renaming port file from %s to %s:  %s", portFileTmp, f.portFile, err)
 		}
 	}
 
-	if !*quiet {
+	if !f.quiet {
 		fmt.Printf("%s [pm serve] serving %s at http://%s\n",
-			time.Now().Format("2006-01-02 15:04:05"), config.RepoDir, addr)
+			time.Now().Format("2006-01-02 15:04:05"), f.config.RepoDir, addr)
 	}
 
-	return server.Serve(listener)
+	go func() {
+		s.err = srv.Serve(listener)
+		s.cleanup()
+		close(s.done)
+	}()
+	go func() {
+		select {
+		case <-ctx.Done():
+			srv.Shutdown(context.Background())
+		case <-s.done:
+		}
+	}()
+	return s, nil
 }
@@ -6,6 +6,7 @@ package serve
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -13,6 +14,7 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -25,47 +27,52 @@ import (
 	repov2 "go.fuchsia.dev/fuchsia/src/sys/pkg/lib/repo"
 )
 
-// poor mans reset, for flags used in the below tests
-func resetFlags() {
-	config.RepoDir = ""
-	*repoServeDir = ""
-	*publishList = ""
-	*portFile = ""
-}
-
 func resetServer() {
 	server = http.Server{}
 }
 
 func TestParseFlags(t *testing.T) {
-	defer resetFlags()
-	if err := ParseFlags([]string{"-repo", "amber-files"}); err != nil {
+	f, err := parseFlags(build.NewConfig(), []string{"-repo", "amber-files"})
+	if err != nil {
 		t.Fatal(err)
 	}
-	if got, want := config.RepoDir, "amber-files"; got != want {
+	if got, want := f.config.RepoDir, "amber-files"; got != want {
 		t.Errorf("got %q, want %q", got, want)
 	}
-	if got, want := *repoServeDir, "amber-files/repository"; got != want {
+	if got, want := f.repoServeDir, "amber-files/repository"; got != want {
 		t.Errorf("got %q, want %q", got, want)
 	}
 
-	resetFlags()
-	if err := ParseFlags([]string{"-d", "amber-files/repository"}); err != nil {
+	f, err = parseFlags(build.NewConfig(), []string{"-d", "amber-files/repository"})
+	if err != nil {
 		t.Fatal(err)
 	}
-	if got, want := config.RepoDir, "amber-files"; got != want {
+	if got, want := f.config.RepoDir, "amber-files"; got != want {
 		t.Errorf("got %q, want %q", got, want)
 	}
-	if got, want := *repoServeDir, "amber-files/repository"; got != want {
+	if got, want := f.repoServeDir, "amber-files/repository"; got != want {
 		t.Errorf("got %q, want %q", got, want)
 	}
 
-	// TODO: add additional coverage (needs some re-arrangement to be able to
-	// re-set flag defaults)
+	// Each call starts from the defaults, rather than the flags of the last.
+	f, err = parseFlags(build.NewConfig(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := f.repoServeDir, filepath.Join(f.config.RepoDir, "repository"); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if !f.auto || f.listen != ":8083" {
+		t.Errorf("got -a=%t -l %q, want the defaults", f.auto, f.listen)
+	}
+
+	// Bad flags are returned as errors rather than exiting.
+	if _, err := parseFlags(build.NewConfig(), []string{"-c", "two"}); err == nil {
+		t.Error("-c two: got nil error")
+	}
 }
 
 func TestServer(t *testing.T) {
-	defer resetFlags()
 	defer resetServer()
 
 	cfg := build.TestConfig()
@@ -285,7 +292,6 @@ func TestServer(t *testing.T) {
 }
 
 func TestServerV2(t *testing.T) {
-	defer resetFlags()
 	defer resetServer()
 
 	cfg := build.TestConfig()
@@ -383,7 +389,6 @@ func TestServerV2(t *testing.T) {
 }
 
 func TestServeAuto(t *testing.T) {
-	defer resetFlags()
 	defer resetServer()
 	defer pushPopMonitorPollInterval(20 * time.Millisecond)()
 
@@ -517,7 +522,6 @@ func TestServeAuto(t *testing.T) {
 }
 
 func TestServeAutoIncremental(t *testing.T) {
-	defer resetFlags()
 	defer resetServer()
 	defer pushPopMonitorPollInterval(20 * time.Millisecond)()
 
@@ -619,6 +623,98 @@ func TestServeAutoIncremental(t *testing.T) {
 	})
 }
 
+func TestServeTargetsFilter(t *testing.T) {
+	defer resetServer()
+
+	repoDir := t.TempDir()
+	r, err := repo.New(repoDir, filepath.Join(repoDir, "repository", "blobs"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Publish two packages, and serve only the first.
+	blobs := map[string]map[string]build.MerkleRoot{}
+	var cfg *build.Config
+	for _, name := range []string{"testpackage", "otherpackage"} {
+		cfg = build.TestConfig()
+		defer os.RemoveAll(filepath.Dir(cfg.TempDir))
+		cfg.PkgName = name
+		build.BuildTestPackage(cfg)
+		manifestPath := filepath.Join(cfg.OutputDir, "package_manifest.json")
+		if _, err := r.PublishManifest(manifestPath); err != nil {
+			t.Fatal(err)
+		}
+		manifest, err := build.LoadPackageManifest(manifestPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		blobs[name] = map[string]build.MerkleRoot{}
+		for _, blob := range manifest.Blobs {
+			blobs[name][blob.Path] = blob.Merkle
+		}
+	}
+	if err := r.CommitUpdates(false); err != nil {
+		t.Fatal(err)
+	}
+
+	addrChan := make(chan string)
+	var w sync.WaitGroup
+	w.Add(1)
+	go func() {
+		defer w.Done()
+		err := Run(cfg, []string{"-l", "127.0.0.1:0", "-repo", repoDir, "-a=false", "-q", "-targets-filter", "testpackage/*"}, addrChan)
+		if err != nil && err != http.ErrServerClosed {
+			t.Error(err)
+		}
+	}()
+	defer func() {
+		server.Close()
+		w.Wait()
+	}()
+	baseURL := fmt.Sprintf("http://%s", <-addrChan)
+
+	if !hasTarget(t, baseURL, "testpackage/0") {
+		t.Errorf("targets.json omits testpackage/0, which matches the filter")
+	}
+	if hasTarget(t, baseURL, "otherpackage/0") {
+		t.Errorf("targets.json lists otherpackage/0, which doesn't match the filter")
+	}
+
+	status := func(path string) int {
+		res, err := http.Get(baseURL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		return res.StatusCode
+	}
+	served := map[build.MerkleRoot]bool{}
+	for path, merkle := range blobs["testpackage"] {
+		served[merkle] = true
+		if got := status("/blobs/" + merkle.String()); got != http.StatusOK {
+			t.Errorf("testpackage blob %s: got status %d, want %d", path, got, http.StatusOK)
+		}
+	}
+	for path, merkle := range blobs["otherpackage"] {
+		// Blobs with the same content as a testpackage blob are still served.
+		if served[merkle] {
+			continue
+		}
+		if got := status("/blobs/" + merkle.String()); got != http.StatusNotFound {
+			t.Errorf("otherpackage blob %s: got status %d, want %d", path, got, http.StatusNotFound)
+		}
+	}
+	if got := status("/targets/otherpackage/0"); got != http.StatusNotFound {
+		t.Errorf("otherpackage target file: got status %d, want %d", got, http.StatusNotFound)
+	}
+	if got := status("/timestamp.json"); got != http.StatusOK {
+		t.Errorf("timestamp.json: got status %d, want %d", got, http.StatusOK)
+	}
+}
+
 func hasTarget(t *testing.T, baseURL, target string) bool {
 	res, err := http.Get(baseURL + "/targets.json")
 	if err != nil {
@@ -718,3 +814,172 @@ func (c *testAutoClient) readEvent() sse.Event {
 	}
 	return *res.event
 }
+
+// publishTestPackage creates a repository holding the test package, and
+// returns the repository's directory and the package's manifest.
+func publishTestPackage(t *testing.T, cfg *build.Config) (string, *build.PackageManifest) {
+	t.Helper()
+	repoDir := t.TempDir()
+	r, err := repo.New(repoDir, filepath.Join(repoDir, "repository", "blobs"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Init(); err != nil {
+		t.Fatal(err)
+	}
+	build.BuildTestPackage(cfg)
+	manifestPath := filepath.Join(cfg.OutputDir, "package_manifest.json")
+	if _, err := r.PublishManifest(manifestPath); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.CommitUpdates(false); err != nil {
+		t.Fatal(err)
+	}
+	manifest, err := build.LoadPackageManifest(manifestPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return repoDir, manifest
+}
+
+func TestServe(t *testing.T) {
+	cfg := build.TestConfig()
+	defer os.RemoveAll(filepath.Dir(cfg.TempDir))
+	repoDir, manifest := publishTestPackage(t, cfg)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s, err := Serve(ctx, cfg, []string{"-l", ":0", "-repo", repoDir, "-a=false", "-q"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, port, err := net.SplitHostPort(s.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if port == "0" {
+		t.Fatalf("got address %s, want the port the server was given", s.Addr())
+	}
+
+	blob := manifest.Blobs[0]
+	res, err := http.Get(fmt.Sprintf("http://127.0.0.1:%s/blobs/%s", port, blob.Merkle))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK || res.ContentLength != int64(blob.Size) {
+		t.Errorf("blob %s: got status %d and length %d, want %d and %d",
+			blob.Merkle, res.StatusCode, res.ContentLength, http.StatusOK, blob.Size)
+	}
+
+	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancelShutdown()
+	if err := s.Shutdown(shutdownCtx); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Wait(); err != http.ErrServerClosed {
+		t.Errorf("got %v once shut down, want %v", err, http.ErrServerClosed)
+	}
+	if _, err := http.Get(fmt.Sprintf("http://127.0.0.1:%s/", port)); err == nil {
+		t.Error("the server still answers once shut down")
+	}
+
+	// Canceling the context shuts the server down too.
+	s, err = Serve(ctx, cfg, []string{"-l", "127.0.0.1:0", "-repo", repoDir, "-a=false", "-q"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	if err := s.Wait(); err != http.ErrServerClosed {
+		t.Errorf("got %v once the context was canceled, want %v", err, http.ErrServerClosed)
+	}
+}
+
+func TestServeBlobContentType(t *testing.T) {
+	cfg := build.TestConfig()
+	defer os.RemoveAll(filepath.Dir(cfg.TempDir))
+	repoDir, manifest := publishTestPackage(t, cfg)
+
+	s, err := Serve(context.Background(), cfg, []string{"-l", "127.0.0.1:0", "-repo", repoDir, "-a=false", "-q", "-blob-content-type", "application/vnd.fuchsia.blob"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Shutdown(context.Background())
+
+	contentType := func(path string) string {
+		res, err := http.Get("http://" + s.Addr() + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		if res.StatusCode != http.StatusOK {
+			t.Fatalf("%s: got status %d, want %d", path, res.StatusCode, http.StatusOK)
+		}
+		return res.Header.Get("Content-Type")
+	}
+	for _, blob := range manifest.Blobs {
+		if got, want := contentType("/blobs/"+blob.Merkle.String()), "application/vnd.fuchsia.blob"; got != want {
+			t.Errorf("blob %s: got Content-Type %q, want %q", blob.Path, got, want)
+		}
+	}
+	if got, want := contentType("/targets.json"), "application/json"; got != want {
+		t.Errorf("targets.json: got Content-Type %q, want %q", got, want)
+	}
+}
+
+func TestServeAuth(t *testing.T) {
+	cfg := build.TestConfig()
+	defer os.RemoveAll(filepath.Dir(cfg.TempDir))
+	repoDir, manifest := publishTestPackage(t, cfg)
+
+	authFile := filepath.Join(t.TempDir(), "credentials")
+	if err := os.WriteFile(authFile, []byte("# test users\nalice:s3cret\n\nbob:hunter2\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, flags := range [][]string{
+		{"-auth", "alice:s3cret"},
+		{"-auth-file", authFile},
+	} {
+		s, err := Serve(context.Background(), cfg, append([]string{"-l", "127.0.0.1:0", "-repo", repoDir, "-a=false", "-q"}, flags...))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, path := range []string{"/targets.json", "/blobs/" + manifest.Blobs[0].Merkle.String()} {
+			for _, tc := range []struct {
+				name, user, password string
+				status               int
+			}{
+				{"no credentials", "", "", http.StatusUnauthorized},
+				{"wrong password", "alice", "guess", http.StatusUnauthorized},
+				{"unknown user", "mallory", "s3cret", http.StatusUnauthorized},
+				{"correct credentials", "alice", "s3cret", http.StatusOK},
+			} {
+				req, err := http.NewRequest("GET", "http://"+s.Addr()+path, nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if tc.user != "" {
+					req.SetBasicAuth(tc.user, tc.password)
+				}
+				res, err := http.DefaultClient.Do(req)
+				if err != nil {
+					t.Fatal(err)
+				}
+				res.Body.Close()
+				if res.StatusCode != tc.status {
+					t.Errorf("%v: %s with %s: got status %d, want %d", flags, path, tc.name, res.StatusCode, tc.status)
+				}
+				if challenge := res.Header.Get("WWW-Authenticate"); (tc.status == http.StatusUnauthorized) != strings.HasPrefix(challenge, "Basic ") {
+					t.Errorf("%v: %s with %s: got WWW-Authenticate %q", flags, path, tc.name, challenge)
+				}
+			}
+		}
+		s.Shutdown(context.Background())
+	}
+
+	if _, err := Serve(context.Background(), cfg, []string{"-l", "127.0.0.1:0", "-repo", repoDir, "-a=false", "-auth", "nocolon"}); err == nil {
+		t.Error("serving with malformed -auth succeeded")
+	}
+}
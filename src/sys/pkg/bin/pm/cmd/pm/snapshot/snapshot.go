@@ -7,9 +7,11 @@ package snapshot
 
 import (
 	"bufio"
+	"bytes"
 	"encoding/json"
 	"flag"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"regexp"
@@ -26,8 +28,17 @@ A package entry is of the form:
 name[#tag1[,tag2]*]=path/to/packages/blobs.json
 
 A manifest must contain a single package entry per line
+
+With -package-manifests or -targets, snapshot instead pins a set of packages:
+it lists the name, version and meta.far merkle root of each package that has
+a package manifest in the directory, or that the repository's targets.json
+lists, sorted by name and version. The package set is written to -output, or
+to stdout if no -output is given, in the -format chosen.
 `
 
+// stdout is where package sets are written if no -output is given.
+var stdout io.Writer = os.Stdout
+
 type packageEntry struct {
 	Name      string
 	BlobsPath string
@@ -82,9 +93,14 @@ type snapshotConfig struct {
 	packages     packageEntries
 	manifestPath string
 	outputPath   string
+
+	// manifestsDir and targetsPath are the sources of package sets.
+	manifestsDir string
+	targetsPath  string
+	format       string
 }
 
-func parseConfig(args []string) (*snapshotConfig, error) {
+func parseConfig(cfg *build.Config, args []string) (*snapshotConfig, error) {
 	fs := flag.NewFlagSet("snapshot", flag.ExitOnError)
 
 	var c snapshotConfig
@@ -92,6 +108,9 @@ func parseConfig(args []string) (*snapshotConfig, error) {
 	fs.StringVar(&c.manifestPath, "manifest", "", "The manifest of packages to include in the snapshot")
 	fs.StringVar(&c.outputPath, "output", "", "The path of the output snapshot file")
 	fs.Var(&c.packages, "package", "Add a package to the snapshot")
+	fs.StringVar(&c.manifestsDir, "package-manifests", "", "Pin the packages whose package manifests are the .json files in this `directory`")
+	fs.StringVar(&c.targetsPath, "targets", "", "Pin the packages listed by this repository `targets.json`")
+	fs.StringVar(&c.format, "format", "json", "Format of package sets, one of: json, text")
 
 	fs.Usage = func() {
 		fmt.Fprintf(os.Stderr, usage, filepath.Base(os.Args[0]))
@@ -104,7 +123,20 @@ func parseConfig(args []string) (*snapshotConfig, error) {
 	}
 
 	if len(fs.Args()) != 0 {
-		fmt.Fprintf(os.Stderr, "WARNING: unused arguments: %s\n", fs.Args())
+		cfg.Warnf("unused arguments: %s", fs.Args())
+	}
+
+	if c.manifestsDir != "" || c.targetsPath != "" {
+		if c.manifestsDir != "" && c.targetsPath != "" {
+			return nil, fmt.Errorf("only one of -package-manifests and -targets can be given")
+		}
+		if c.manifestPath != "" || len(c.packages) != 0 {
+			return nil, fmt.Errorf("-package-manifests and -targets can't be combined with -manifest or -package")
+		}
+		if c.format != "json" && c.format != "text" {
+			return nil, fmt.Errorf("unknown format %q, want json or text", c.format)
+		}
+		return &c, nil
 	}
 
 	if c.outputPath == "" {
@@ -186,11 +218,15 @@ func buildSnapshot(c snapshotConfig) (*build.Snapshot, error) {
 
 // Run executes the snapshot command
 func Run(cfg *build.Config, args []string) error {
-	config, err := parseConfig(args)
+	config, err := parseConfig(cfg, args)
 	if err != nil {
 		return err
 	}
 
+	if config.manifestsDir != "" || config.targetsPath != "" {
+		return writePackageSet(*config)
+	}
+
 	snapshot, err := buildSnapshot(*config)
 	if err != nil {
 		return err
@@ -207,3 +243,37 @@ func Run(cfg *build.Config, args []string) error {
 
 	return nil
 }
+
+// writePackageSet pins the packages of the package set c names, and writes
+// them in the format c chooses.
+func writePackageSet(c snapshotConfig) error {
+	var set build.PackageSet
+	var err error
+	if c.manifestsDir != "" {
+		set, err = build.PackageSetFromManifests(c.manifestsDir)
+	} else {
+		set, err = build.PackageSetFromTargets(c.targetsPath)
+	}
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	if c.format == "json" {
+		data, err := json.MarshalIndent(set, "", "  ")
+		if err != nil {
+			return err
+		}
+		buf.Write(append(data, '\n'))
+	} else {
+		for _, p := range set {
+			fmt.Fprintln(&buf, p)
+		}
+	}
+
+	if c.outputPath == "" {
+		_, err := stdout.Write(buf.Bytes())
+		return err
+	}
+	return os.WriteFile(c.outputPath, buf.Bytes(), 0644)
+}
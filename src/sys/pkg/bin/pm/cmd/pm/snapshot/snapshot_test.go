@@ -0,0 +1,132 @@
+// Copyright 2024 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package snapshot
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.fuchsia.dev/fuchsia/src/sys/pkg/bin/pm/build"
+	"go.fuchsia.dev/fuchsia/src/sys/pkg/bin/pm/repo"
+	"go.fuchsia.dev/fuchsia/src/sys/pkg/lib/merkle"
+)
+
+// publishPackages builds and publishes a test package for each name to a new
+// repository. It returns the repository, a directory of the packages'
+// manifests, and the merkle roots of their meta.fars, hashed from the files.
+func publishPackages(t *testing.T, names ...string) (string, string, map[string]string) {
+	t.Helper()
+	repoDir := t.TempDir()
+	r, err := repo.New(repoDir, filepath.Join(repoDir, "repository", "blobs"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	manifestsDir := t.TempDir()
+	roots := map[string]string{}
+	for _, name := range names {
+		cfg := build.TestConfig()
+		t.Cleanup(func() { os.RemoveAll(filepath.Dir(cfg.TempDir)) })
+		cfg.PkgName = name
+		build.BuildTestPackage(cfg)
+		manifestPath := filepath.Join(cfg.OutputDir, "package_manifest.json")
+		if _, err := r.PublishManifest(manifestPath); err != nil {
+			t.Fatal(err)
+		}
+		b, err := os.ReadFile(manifestPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(manifestsDir, name+".json"), b, 0o644); err != nil {
+			t.Fatal(err)
+		}
+
+		f, err := os.Open(cfg.MetaFAR())
+		if err != nil {
+			t.Fatal(err)
+		}
+		var tree merkle.Tree
+		_, err = tree.ReadFrom(f)
+		f.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		roots[name] = fmt.Sprintf("%x", tree.Root())
+	}
+	if err := r.CommitUpdates(false); err != nil {
+		t.Fatal(err)
+	}
+	return repoDir, manifestsDir, roots
+}
+
+func TestPackageSet(t *testing.T) {
+	repoDir, manifestsDir, roots := publishPackages(t, "zeta", "alpha")
+	targets := filepath.Join(repoDir, "repository", "targets.json")
+
+	var out bytes.Buffer
+	stdout = &out
+	defer func() { stdout = os.Stdout }()
+
+	for _, source := range [][]string{{"-targets", targets}, {"-package-manifests", manifestsDir}} {
+		out.Reset()
+		if err := Run(build.NewConfig(), append(source, "-format", "json")); err != nil {
+			t.Fatal(err)
+		}
+		var set []struct {
+			Name    string `json:"name"`
+			Version string `json:"version"`
+			Merkle  string `json:"merkle"`
+		}
+		if err := json.Unmarshal(out.Bytes(), &set); err != nil {
+			t.Fatalf("%s: got %q, which isn't a package set: %v", source[0], out.String(), err)
+		}
+		if len(set) != 2 || set[0].Name != "alpha" || set[1].Name != "zeta" {
+			t.Fatalf("%s: got package set %+v, want alpha and zeta, in order", source[0], set)
+		}
+		for _, p := range set {
+			if p.Version != "0" || p.Merkle != roots[p.Name] {
+				t.Errorf("%s: got %s/%s pinned to %s, want %s/0 pinned to %s", source[0], p.Name, p.Version, p.Merkle, p.Name, roots[p.Name])
+			}
+		}
+	}
+
+	// The text format lists the same packages, and is written to -output if
+	// it's given.
+	output := filepath.Join(t.TempDir(), "snapshot.txt")
+	if err := Run(build.NewConfig(), []string{"-targets", targets, "-format", "text", "-output", output}); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := fmt.Sprintf("alpha/0 %s\nzeta/0 %s\n", roots["alpha"], roots["zeta"])
+	if string(b) != want {
+		t.Errorf("got\n%s\nwant\n%s", b, want)
+	}
+}
+
+func TestPackageSetFlags(t *testing.T) {
+	for _, tc := range []struct {
+		args []string
+		want string
+	}{
+		{[]string{"-targets", "t.json", "-package-manifests", "dir"}, "only one of"},
+		{[]string{"-targets", "t.json", "-manifest", "m"}, "can't be combined"},
+		{[]string{"-targets", "t.json", "-format", "yaml"}, "unknown format"},
+	} {
+		if _, err := parseConfig(build.NewConfig(), tc.args); err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("parseConfig(%q) = %v, want an error containing %q", tc.args, err, tc.want)
+		}
+	}
+}
@@ -6,22 +6,43 @@
 package update
 
 import (
+	"context"
+	"encoding/json"
 	"flag"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 
 	"go.fuchsia.dev/fuchsia/src/sys/pkg/bin/pm/build"
 )
 
-const usage = `Usage: %s update
-update the merkle roots in meta/contents
+const usage = `Usage: %s update -update-config config.json -package-manifest package_manifest.json...
+assemble an update package in the output directory, holding a packages.json
+that pins each package given by its package manifest, a board file, and the
+images listed by the update configuration, such as:
+
+  {"board": "x64", "images": {"zbi": "fuchsia.zbi"}}
+
+Image paths are relative to the configuration. The package is named update,
+unless -n is given.
 `
 
+// stdout is where the result is reported.
+var stdout io.Writer = os.Stdout
+
 // Run executes the `pm update` command
 func Run(cfg *build.Config, args []string) error {
 	fs := flag.NewFlagSet("update", flag.ExitOnError)
 
+	var manifestPaths []string
+	fs.Func("package-manifest", "`path` to the package manifest of a package of the update; may be repeated", func(path string) error {
+		manifestPaths = append(manifestPaths, path)
+		return nil
+	})
+	var configPath = fs.String("update-config", "", "`path` to the JSON board and product configuration of the update")
+	var pkgManifestPath = fs.String("output-package-manifest", "", "If set, produce a package manifest of the update package at the given path")
+
 	fs.Usage = func() {
 		fmt.Fprintf(os.Stderr, usage, filepath.Base(os.Args[0]))
 		fmt.Fprintln(os.Stderr)
@@ -33,8 +54,45 @@ func Run(cfg *build.Config, args []string) error {
 	}
 
 	if len(fs.Args()) != 0 {
-		fmt.Fprintf(os.Stderr, "WARNING: unused arguments: %s\n", fs.Args())
+		cfg.Warnf("unused arguments: %s", fs.Args())
+	}
+	if *configPath == "" {
+		return fmt.Errorf("update: -update-config is required")
+	}
+	if len(manifestPaths) == 0 {
+		return fmt.Errorf("update: at least one -package-manifest is required")
 	}
 
-	return build.Update(cfg)
+	config, err := build.LoadUpdateConfig(*configPath)
+	if err != nil {
+		return fmt.Errorf("update: %w", err)
+	}
+	var manifests []*build.PackageManifest
+	for _, path := range manifestPaths {
+		m, err := build.LoadPackageManifest(path)
+		if err != nil {
+			return fmt.Errorf("update: %w", err)
+		}
+		manifests = append(manifests, m)
+	}
+
+	if cfg.PkgName == "" {
+		cfg.PkgName = "update"
+	}
+	pkgManifest, err := build.BuildUpdatePackage(context.Background(), cfg, config, manifests)
+	if err != nil {
+		return fmt.Errorf("update: %w", err)
+	}
+
+	if *pkgManifestPath != "" {
+		content, err := json.MarshalIndent(pkgManifest, "", "    ")
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(*pkgManifestPath, content, 0644); err != nil {
+			return err
+		}
+	}
+	fmt.Fprintf(stdout, "assembled %s of %d packages in %s\n", pkgManifest.Package.Name, len(manifests), cfg.MetaFAR())
+	return nil
 }
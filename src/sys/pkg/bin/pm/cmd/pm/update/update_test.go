@@ -0,0 +1,129 @@
+// Copyright 2024 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package update
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.fuchsia.dev/fuchsia/src/sys/pkg/bin/pm/build"
+)
+
+// buildInputPackage builds a test package named name, and returns the path of
+// its package manifest and the merkle root of its meta.far.
+func buildInputPackage(t *testing.T, name string) (string, string) {
+	t.Helper()
+	cfg := build.TestConfig()
+	t.Cleanup(func() { os.RemoveAll(filepath.Dir(cfg.TempDir)) })
+	cfg.PkgName = name
+	build.BuildTestPackage(cfg)
+	path := filepath.Join(cfg.OutputDir, "package_manifest.json")
+	m, err := build.LoadPackageManifest(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, blob := range m.Blobs {
+		if blob.Path == "meta/" {
+			return path, blob.Merkle.String()
+		}
+	}
+	t.Fatalf("the manifest of %s lists no meta.far", name)
+	return "", ""
+}
+
+func TestUpdate(t *testing.T) {
+	stdout = io.Discard
+	defer func() { stdout = os.Stdout }()
+
+	manifestA, merkleA := buildInputPackage(t, "system_image")
+	manifestB, merkleB := buildInputPackage(t, "other")
+
+	cfg := build.TestConfig()
+	defer os.RemoveAll(filepath.Dir(cfg.TempDir))
+	cfg.PkgName = ""
+	zbi := filepath.Join(cfg.TempDir, "fuchsia.zbi")
+	if err := os.WriteFile(zbi, []byte("zbi image\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	configPath := filepath.Join(cfg.TempDir, "update.json")
+	if err := os.WriteFile(configPath, []byte(`{"board": "x64", "images": {"zbi": "fuchsia.zbi"}}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	outputManifest := filepath.Join(cfg.TempDir, "update_manifest.json")
+
+	if err := Run(cfg, []string{
+		"-update-config", configPath,
+		"-package-manifest", manifestA,
+		"-package-manifest", manifestB,
+		"-output-package-manifest", outputManifest,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := os.ReadFile(filepath.Join(cfg.OutputDir, "packages.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var packages build.UpdatePackagesJSON
+	if err := json.Unmarshal(b, &packages); err != nil {
+		t.Fatalf("packages.json %q: %v", b, err)
+	}
+	want := []string{
+		"fuchsia-pkg://testrepository.com/other/0?hash=" + merkleB,
+		"fuchsia-pkg://testrepository.com/system_image/0?hash=" + merkleA,
+	}
+	if packages.Version != "1" || strings.Join(packages.Content, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got packages.json %+v, want version 1 with content %q", packages, want)
+	}
+
+	m, err := build.LoadPackageManifest(outputManifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Package.Name != "update" {
+		t.Errorf("got package name %q, want update", m.Package.Name)
+	}
+	var paths []string
+	for _, blob := range m.Blobs {
+		paths = append(paths, blob.Path)
+	}
+	if got, want := strings.Join(paths, " "), "meta/ board packages.json zbi"; got != want {
+		t.Errorf("got blobs %q, want %q", got, want)
+	}
+}
+
+func TestUpdateRequiredInputs(t *testing.T) {
+	manifest, _ := buildInputPackage(t, "system_image")
+	cfg := build.TestConfig()
+	defer os.RemoveAll(filepath.Dir(cfg.TempDir))
+	configPath := filepath.Join(cfg.TempDir, "update.json")
+	if err := os.WriteFile(configPath, []byte(`{"board": "x64", "images": {"zbi": "missing.zbi"}}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	noBoard := filepath.Join(cfg.TempDir, "no_board.json")
+	if err := os.WriteFile(noBoard, []byte(`{}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		args []string
+		want string
+	}{
+		{[]string{"-package-manifest", manifest}, "-update-config is required"},
+		{[]string{"-update-config", configPath}, "at least one -package-manifest is required"},
+		{[]string{"-update-config", noBoard, "-package-manifest", manifest}, "names no board"},
+		{[]string{"-update-config", configPath, "-package-manifest", manifest}, "the image zbi"},
+		{[]string{"-update-config", configPath, "-package-manifest", manifest, "-package-manifest", manifest}, "lists the package system_image twice"},
+	} {
+		err := Run(cfg, tc.args)
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("Run(%q) = %v, want an error containing %q", tc.args, err, tc.want)
+		}
+	}
+}
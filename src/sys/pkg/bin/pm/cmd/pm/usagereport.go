@@ -0,0 +1,36 @@
+// Copyright 2024 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"time"
+)
+
+// usageRecord is a line of a usage report, recording a run of a deprecated
+// command.
+type usageRecord struct {
+	Command string    `json:"command"`
+	Time    time.Time `json:"time"`
+}
+
+// reportUsage appends a record of a run of the deprecated command name to the
+// usage report at path, as a line of JSON. Reports are best effort: failing
+// to write one must not fail the command, so errors are ignored.
+func reportUsage(path, name string, now time.Time) {
+	b, err := json.Marshal(usageRecord{Command: name, Time: now.UTC()})
+	if err != nil {
+		return
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	// Write the record in one call, so that records of concurrent runs don't
+	// interleave.
+	f.Write(append(b, '\n'))
+}
@@ -0,0 +1,66 @@
+// Copyright 2024 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.fuchsia.dev/fuchsia/src/sys/pkg/bin/pm/build"
+)
+
+func TestUsageReport(t *testing.T) {
+	defer func(path string) { *usageReport = path }(*usageReport)
+	*usageReport = filepath.Join(t.TempDir(), "usage.jsonl")
+
+	before := time.Now().Add(-time.Second)
+	for _, args := range [][]string{{"build"}, {"schema", "far"}, {"serve", "-l", ":8083"}} {
+		var stderr bytes.Buffer
+		if got := runCommand(build.NewConfig(), "json", args, &stderr); got != 0 {
+			t.Fatalf("running %q exited with %d: %s", args, got, stderr.String())
+		}
+	}
+
+	f, err := os.Open(*usageReport)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var got []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var record usageRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			t.Fatalf("usage report line %q isn't a record: %v", scanner.Text(), err)
+		}
+		if record.Time.Before(before) || record.Time.After(time.Now()) {
+			t.Errorf("got record of %s at %s, want the time it ran", record.Command, record.Time)
+		}
+		got = append(got, record.Command)
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+	// The active schema command isn't reported.
+	if want := []string{"build", "serve"}; len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("got records of %q, want %q", got, want)
+	}
+}
+
+func TestUsageReportFailure(t *testing.T) {
+	defer func(path string) { *usageReport = path }(*usageReport)
+	// The report can't be created in a missing directory.
+	*usageReport = filepath.Join(t.TempDir(), "missing", "usage.jsonl")
+
+	var stderr bytes.Buffer
+	if got := runCommand(build.NewConfig(), "json", []string{"build"}, &stderr); got != 0 {
+		t.Errorf("running a deprecated command with a failing usage report exited with %d: %s", got, stderr.String())
+	}
+}
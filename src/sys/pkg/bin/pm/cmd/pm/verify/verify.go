@@ -8,19 +8,32 @@ package verify
 import (
 	"flag"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 
 	"go.fuchsia.dev/fuchsia/src/sys/pkg/bin/pm/build"
 )
 
-const usage = `Usage: %s verify
-ensure that the package metadata appears valid
+const usage = `Usage: %s verify [-against package_manifest.json -f package.far [-no-cache]]
+ensure that the package metadata appears valid. With -against, check instead
+that a package archive holds exactly the blobs a package manifest lists, with
+the merkle roots it lists for them. Blobs missing from the archive, extra blobs
+and mismatched merkle roots are reported separately. The merkle roots computed
+are cached in the archive's directory, and the blobs of an archive whose size
+and modification time are unchanged aren't hashed again unless -no-cache is
+given.
 `
 
+// stdout is where the differences found are written.
+var stdout io.Writer = os.Stdout
+
 // Run ensures that the package metadata appears valid
 func Run(cfg *build.Config, args []string) error {
 	fs := flag.NewFlagSet("verify", flag.ExitOnError)
+	manifestPath := fs.String("against", "", "path to the package manifest the archive must match")
+	archivePath := fs.String("f", "", "path to the package archive to check (with -against)")
+	noCache := fs.Bool("no-cache", false, "hash every blob, rather than skipping the blobs of an archive that is unchanged since it was last verified")
 
 	fs.Usage = func() {
 		fmt.Fprintf(os.Stderr, usage, filepath.Base(os.Args[0]))
@@ -33,8 +46,51 @@ func Run(cfg *build.Config, args []string) error {
 	}
 
 	if len(fs.Args()) != 0 {
-		fmt.Fprintf(os.Stderr, "WARNING: unused arguments: %s\n", fs.Args())
+		cfg.Warnf("unused arguments: %s", fs.Args())
+	}
+
+	if *manifestPath == "" && *archivePath == "" {
+		return build.Validate(cfg)
+	}
+	if *manifestPath == "" || *archivePath == "" {
+		return fmt.Errorf("verify: -against and -f must be given together")
 	}
 
-	return build.Validate(cfg)
+	manifest, err := build.LoadPackageManifest(*manifestPath)
+	if err != nil {
+		return err
+	}
+	var cache *build.MerkleCache
+	cacheDir := filepath.Dir(*archivePath)
+	if !*noCache {
+		if cache, err = build.LoadMerkleCache(os.DirFS(cacheDir), build.MerkleCacheFile); err != nil {
+			return err
+		}
+	}
+	check, err := build.CheckArchiveManifest(*archivePath, manifest, cache)
+	if err != nil {
+		return fmt.Errorf("verify: %s: %w", *archivePath, err)
+	}
+	if cache != nil {
+		if b, err := cache.Marshal(); err != nil {
+			cfg.Warnf("unable to save the merkle cache: %s", err)
+		} else if err := os.WriteFile(filepath.Join(cacheDir, build.MerkleCacheFile), b, 0o644); err != nil {
+			cfg.Warnf("unable to save the merkle cache: %s", err)
+		}
+	}
+	for _, d := range check.Missing {
+		fmt.Fprintf(stdout, "missing: %s\n", d)
+	}
+	for _, d := range check.Extra {
+		fmt.Fprintf(stdout, "extra: %s\n", d)
+	}
+	for _, d := range check.Mismatched {
+		fmt.Fprintf(stdout, "mismatch: %s\n", d)
+	}
+	if !check.OK() {
+		return fmt.Errorf("verify: %s doesn't match %s: %d missing, %d extra, %d mismatched",
+			*archivePath, *manifestPath, len(check.Missing), len(check.Extra), len(check.Mismatched))
+	}
+	fmt.Fprintf(stdout, "%s matches %s\n", *archivePath, *manifestPath)
+	return nil
 }
@@ -0,0 +1,118 @@
+// Copyright 2024 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package verify
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.fuchsia.dev/fuchsia/src/sys/pkg/bin/pm/build"
+)
+
+func TestVerifyAgainst(t *testing.T) {
+	cfg := build.TestConfig()
+	defer os.RemoveAll(filepath.Dir(cfg.TempDir))
+	build.BuildTestPackage(cfg)
+
+	archivePath := filepath.Join(cfg.TempDir, "testpackage")
+	if err := build.Archive(cfg, archivePath); err != nil {
+		t.Fatal(err)
+	}
+	archivePath += ".far"
+	manifestPath := filepath.Join(cfg.OutputDir, "package_manifest.json")
+
+	var out bytes.Buffer
+	stdout = &out
+	defer func() { stdout = os.Stdout }()
+
+	if err := Run(cfg, []string{"-against", manifestPath, "-f", archivePath}); err != nil {
+		t.Fatalf("matching archive: %v", err)
+	}
+	if got := out.String(); !strings.Contains(got, "matches") {
+		t.Errorf("got %q, want the archive reported as matching", got)
+	}
+
+	// Drop a blob from the manifest, so that the archive holds a blob the
+	// manifest doesn't list.
+	manifest, err := build.LoadPackageManifest(manifestPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var dropped build.PackageBlobInfo
+	for i, blob := range manifest.Blobs {
+		if blob.Path != "meta/" {
+			dropped = blob
+			manifest.Blobs = append(manifest.Blobs[:i], manifest.Blobs[i+1:]...)
+			break
+		}
+	}
+	b, err := json.Marshal(manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	shortPath := filepath.Join(cfg.TempDir, "short_manifest.json")
+	if err := os.WriteFile(shortPath, b, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	out.Reset()
+	err = Run(cfg, []string{"-against", shortPath, "-f", archivePath})
+	if err == nil || !strings.Contains(err.Error(), "0 missing, 1 extra, 0 mismatched") {
+		t.Errorf("got %v, want a single extra blob reported", err)
+	}
+	if want := "extra: " + dropped.Path + " (" + dropped.Merkle.String() + ")\n"; out.String() != want {
+		t.Errorf("got %q, want %q", out.String(), want)
+	}
+
+	if err := Run(cfg, []string{"-against", manifestPath}); err == nil {
+		t.Error("-against without -f succeeded")
+	}
+}
+
+func TestVerifyAgainstCache(t *testing.T) {
+	cfg := build.TestConfig()
+	defer os.RemoveAll(filepath.Dir(cfg.TempDir))
+	build.BuildTestPackage(cfg)
+
+	manifestPath := filepath.Join(cfg.OutputDir, "package_manifest.json")
+	stdout = &bytes.Buffer{}
+	defer func() { stdout = os.Stdout }()
+
+	for _, tc := range []struct {
+		name      string
+		args      []string
+		wantCache bool
+	}{
+		{"cache", nil, true},
+		{"no-cache", []string{"-no-cache"}, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := filepath.Join(cfg.TempDir, tc.name)
+			if err := os.MkdirAll(dir, 0o755); err != nil {
+				t.Fatal(err)
+			}
+			archivePath := filepath.Join(dir, "testpackage")
+			if err := build.Archive(cfg, archivePath); err != nil {
+				t.Fatal(err)
+			}
+			archivePath += ".far"
+
+			// The second run uses the cache written by the first, if any.
+			for i := 0; i < 2; i++ {
+				if err := Run(cfg, append([]string{"-against", manifestPath, "-f", archivePath}, tc.args...)); err != nil {
+					t.Fatalf("run %d: %v", i, err)
+				}
+			}
+			_, err := os.Stat(filepath.Join(dir, build.MerkleCacheFile))
+			if gotCache := err == nil; gotCache != tc.wantCache {
+				t.Errorf("got cache written %t, want %t", gotCache, tc.wantCache)
+			}
+		})
+	}
+}
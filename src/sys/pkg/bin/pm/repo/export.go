@@ -0,0 +1,206 @@
+// Copyright 2024 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package repo
+
+import (
+	"archive/tar"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"go.fuchsia.dev/fuchsia/src/sys/pkg/bin/pm/build"
+
+	tufData "github.com/theupdateframework/go-tuf/data"
+)
+
+// exportBlobsDir is the directory of an exported repository that holds its
+// blobs, wherever the repository keeps them.
+const exportBlobsDir = "blobs"
+
+// Export writes the repository's metadata, and the blobs of the packages its
+// targets refer to, to w as a tar archive. Blobs no target refers to, staged
+// changes and keys are left out. The archive only depends on the content of
+// the repository: its entries are sorted by name, and their headers record
+// nothing but their names and sizes.
+func (r *Repo) Export(w io.Writer) error {
+	repoDir := path.Join(r.path, "repository")
+	files := map[string]string{}
+	if err := fs.WalkDir(r.fsys, repoDir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() && p == r.blobsDir {
+			return fs.SkipDir
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		files[strings.TrimPrefix(p, repoDir+"/")] = p
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	blobs, err := r.liveBlobs()
+	if err != nil {
+		return err
+	}
+	for _, blob := range blobs {
+		files[path.Join(exportBlobsDir, blob)] = path.Join(r.blobsDir, blob)
+	}
+
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	tw := tar.NewWriter(w)
+	for _, name := range names {
+		if err := exportFile(tw, r.fsys, name, files[name]); err != nil {
+			return err
+		}
+	}
+	return tw.Close()
+}
+
+// exportFile writes the file at p in fsys to tw as name.
+func exportFile(tw *tar.Writer, fsys FS, name, p string) error {
+	f, err := fsys.Open(p)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if err := tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Mode:     0o644,
+		Size:     info.Size(),
+		ModTime:  time.Unix(0, 0),
+	}); err != nil {
+		return err
+	}
+	if _, err := io.Copy(tw, f); err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	return nil
+}
+
+// liveBlobs returns the merkle roots of the package blobs the targets refer
+// to, and of the blobs those packages list in their meta/contents.
+func (r *Repo) liveBlobs() ([]string, error) {
+	b, err := fs.ReadFile(r.fsys, path.Join(r.path, "repository", "targets.json"))
+	if err != nil {
+		return nil, err
+	}
+	var signed tufData.Signed
+	if err := json.Unmarshal(b, &signed); err != nil {
+		return nil, fmt.Errorf("targets.json: %w", err)
+	}
+	var targets tufData.Targets
+	if err := json.Unmarshal(signed.Signed, &targets); err != nil {
+		return nil, fmt.Errorf("targets.json: %w", err)
+	}
+
+	blobs := map[string]struct{}{}
+	for name, target := range targets.Targets {
+		if target.Custom == nil {
+			continue
+		}
+		var custom customTargetMetadata
+		if err := json.Unmarshal(*target.Custom, &custom); err != nil {
+			return nil, fmt.Errorf("target %s: %w", name, err)
+		}
+		contents, err := r.PackageContents(custom.Merkle)
+		if err != nil {
+			return nil, fmt.Errorf("target %s: %w", name, err)
+		}
+		blobs[custom.Merkle] = struct{}{}
+		for _, merkle := range contents {
+			blobs[merkle.String()] = struct{}{}
+		}
+	}
+
+	roots := make([]string, 0, len(blobs))
+	for root := range blobs {
+		roots = append(roots, root)
+	}
+	sort.Strings(roots)
+	return roots, nil
+}
+
+// Import writes the repository exported to the tar archive rd into the
+// repository, which must not have been initialized. The blobs aren't checked;
+// use Verify for that.
+func (r *Repo) Import(rd io.Reader) error {
+	repoDir := path.Join(r.path, "repository")
+	if _, err := r.fsys.Stat(path.Join(repoDir, "root.json")); err == nil {
+		return fmt.Errorf("repository %s already exists: %w", r.path, fs.ErrExist)
+	}
+
+	tr := tar.NewReader(rd)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if hdr.Typeflag == tar.TypeDir {
+			continue
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			return fmt.Errorf("%s: unsupported entry type %q", hdr.Name, hdr.Typeflag)
+		}
+		if err := build.ValidateArchivePath(hdr.Name); err != nil {
+			return err
+		}
+
+		dst := path.Join(repoDir, hdr.Name)
+		if dir, blob := path.Split(hdr.Name); dir == exportBlobsDir+"/" {
+			dst = path.Join(r.blobsDir, blob)
+		}
+		if err := importFile(r.fsys, dst, tr); err != nil {
+			return fmt.Errorf("%s: %w", hdr.Name, err)
+		}
+	}
+
+	if _, err := r.fsys.Stat(path.Join(repoDir, "root.json")); err != nil {
+		return fmt.Errorf("archive holds no repository: %w", err)
+	}
+	return nil
+}
+
+// importFile writes the content of rd to dst in fsys.
+func importFile(fsys FS, dst string, rd io.Reader) error {
+	if err := fsys.MkdirAll(path.Dir(dst), 0o755); err != nil {
+		return err
+	}
+	f, err := fsys.CreateTemp(path.Dir(dst), path.Base(dst))
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, rd); err != nil {
+		f.Close()
+		fsys.RemoveAll(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		fsys.RemoveAll(f.Name())
+		return err
+	}
+	return fsys.Rename(f.Name(), dst)
+}
@@ -0,0 +1,162 @@
+// Copyright 2024 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package repo
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+// FS is the storage a repository is read from and written to. As for fs.FS,
+// paths are slash-separated and unrooted.
+type FS interface {
+	fs.StatFS
+
+	// MkdirAll creates the named directory along with any missing parents.
+	MkdirAll(name string, perm fs.FileMode) error
+	// WriteFile atomically replaces the named file with data.
+	WriteFile(name string, data []byte, perm fs.FileMode) error
+	// CreateTemp creates a new file in dir whose name begins with pattern,
+	// to be moved into place with Rename once written.
+	CreateTemp(dir, pattern string) (File, error)
+	// Rename moves oldname to newname, replacing any existing file.
+	Rename(oldname, newname string) error
+	// RemoveAll removes the named file or directory and any children.
+	RemoveAll(name string) error
+}
+
+// File is a file being written to an FS.
+type File interface {
+	io.WriteCloser
+	// Name returns the path of the file in its FS.
+	Name() string
+}
+
+// linker is implemented by an FS that can hard link files rather than copy
+// them.
+type linker interface {
+	Link(oldname, newname string) error
+}
+
+// DirFS returns an FS for the tree of host files rooted at dir.
+func DirFS(dir string) FS {
+	return dirFS(dir)
+}
+
+type dirFS string
+
+func (d dirFS) join(name string) string {
+	return filepath.Join(string(d), filepath.FromSlash(name))
+}
+
+func (d dirFS) Open(name string) (fs.File, error) {
+	return os.Open(d.join(name))
+}
+
+func (d dirFS) Stat(name string) (fs.FileInfo, error) {
+	return os.Stat(d.join(name))
+}
+
+func (d dirFS) MkdirAll(name string, perm fs.FileMode) error {
+	return os.MkdirAll(d.join(name), perm)
+}
+
+func (d dirFS) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	f, err := os.CreateTemp(filepath.Dir(d.join(name)), path.Base(name))
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	if err := os.Chmod(f.Name(), perm); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), d.join(name))
+}
+
+func (d dirFS) CreateTemp(dir, pattern string) (File, error) {
+	f, err := os.CreateTemp(d.join(dir), pattern)
+	if err != nil {
+		return nil, err
+	}
+	return dirFile{f, path.Join(dir, filepath.Base(f.Name()))}, nil
+}
+
+func (d dirFS) Rename(oldname, newname string) error {
+	return os.Rename(d.join(oldname), d.join(newname))
+}
+
+func (d dirFS) RemoveAll(name string) error {
+	return os.RemoveAll(d.join(name))
+}
+
+func (d dirFS) Link(oldname, newname string) error {
+	return linkOrCopy(d.join(oldname), d.join(newname))
+}
+
+// dirFile is a host file named relative to its dirFS.
+type dirFile struct {
+	*os.File
+	name string
+}
+
+func (f dirFile) Name() string {
+	return f.name
+}
+
+// hostFS is the FS that New stores repositories in. Host paths are made
+// absolute and then named relative to the root of the host filesystem.
+var hostFS = DirFS(string(filepath.Separator))
+
+func hostPath(p string) (string, error) {
+	abs, err := filepath.Abs(p)
+	if err != nil {
+		return "", err
+	}
+	rel, err := filepath.Rel(string(filepath.Separator), abs)
+	if err != nil {
+		return "", err
+	}
+	return filepath.ToSlash(rel), nil
+}
+
+// copyInFS copies oldname to newname within fsys, linking it instead if fsys
+// supports it.
+func copyInFS(fsys FS, oldname, newname string) error {
+	if l, ok := fsys.(linker); ok {
+		return l.Link(oldname, newname)
+	}
+	src, err := fsys.Open(oldname)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := fsys.CreateTemp(path.Dir(newname), path.Base(newname))
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		fsys.RemoveAll(dst.Name())
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		fsys.RemoveAll(dst.Name())
+		return err
+	}
+	return fsys.Rename(dst.Name(), newname)
+}
@@ -0,0 +1,198 @@
+// Copyright 2024 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package repo
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+
+	"go.fuchsia.dev/fuchsia/src/sys/pkg/bin/pm/build"
+)
+
+// memFS is an in-memory FS.
+type memFS struct {
+	mu    sync.Mutex
+	files fstest.MapFS
+	temps int
+}
+
+func newMemFS() *memFS {
+	return &memFS{files: fstest.MapFS{}}
+}
+
+func (m *memFS) Open(name string) (fs.File, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	// Read a snapshot, so that files can be written while others are open.
+	snapshot := fstest.MapFS{}
+	for k, v := range m.files {
+		f := *v
+		snapshot[k] = &f
+	}
+	return snapshot.Open(name)
+}
+
+func (m *memFS) Stat(name string) (fs.FileInfo, error) {
+	f, err := m.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return f.Stat()
+}
+
+func (m *memFS) MkdirAll(name string, perm fs.FileMode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for p := name; p != "." && p != "/"; p = path.Dir(p) {
+		if f, ok := m.files[p]; ok {
+			if !f.Mode.IsDir() {
+				return &fs.PathError{Op: "mkdir", Path: p, Err: fs.ErrExist}
+			}
+			continue
+		}
+		m.files[p] = &fstest.MapFile{Mode: fs.ModeDir | perm}
+	}
+	return nil
+}
+
+func (m *memFS) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.files[name] = &fstest.MapFile{Data: bytes.Clone(data), Mode: perm}
+	return nil
+}
+
+// memFile is a file being written to a memFS, which appears once closed.
+type memFile struct {
+	bytes.Buffer
+	fsys   *memFS
+	name   string
+	closed bool
+}
+
+func (f *memFile) Name() string {
+	return f.name
+}
+
+func (f *memFile) Close() error {
+	if f.closed {
+		return fs.ErrClosed
+	}
+	f.closed = true
+	return f.fsys.WriteFile(f.name, f.Bytes(), 0o600)
+}
+
+func (m *memFS) CreateTemp(dir, pattern string) (File, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.temps++
+	return &memFile{fsys: m, name: path.Join(dir, fmt.Sprintf("%s%d", pattern, m.temps))}, nil
+}
+
+func (m *memFS) Rename(oldname, newname string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	f, ok := m.files[oldname]
+	if !ok {
+		return &fs.PathError{Op: "rename", Path: oldname, Err: fs.ErrNotExist}
+	}
+	delete(m.files, oldname)
+	m.files[newname] = f
+	return nil
+}
+
+func (m *memFS) RemoveAll(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for p := range m.files {
+		if p == name || strings.HasPrefix(p, name+"/") {
+			delete(m.files, p)
+		}
+	}
+	return nil
+}
+
+func TestPublishToMemFS(t *testing.T) {
+	cfg := build.TestConfig()
+	defer os.RemoveAll(filepath.Dir(cfg.TempDir))
+	build.BuildTestPackage(cfg)
+	manifestPath := filepath.Join(cfg.OutputDir, "package_manifest.json")
+
+	fsys := newMemFS()
+	r, err := NewWithFS(fsys, "repo", "repo/repository/blobs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Init(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.PublishManifest(manifestPath); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.CommitUpdates(false); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, rolejson := range roleJsons {
+		if _, err := fs.Stat(fsys, path.Join("repo", "repository", rolejson)); err != nil {
+			t.Error(err)
+		}
+		if _, err := fs.Stat(fsys, path.Join("repo", "keys", rolejson)); err != nil {
+			t.Error(err)
+		}
+	}
+
+	b, err := fs.ReadFile(fsys, "repo/repository/targets.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var targets targetsFile
+	if err := json.Unmarshal(b, &targets); err != nil {
+		t.Fatal(err)
+	}
+	target, ok := targets.Signed.Targets["testpackage/0"]
+	if !ok {
+		t.Fatalf("targets.json doesn't list testpackage/0: %s", b)
+	}
+
+	manifest, err := build.LoadPackageManifest(manifestPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, blob := range manifest.Blobs {
+		merkle := blob.Merkle.String()
+		if blob.Path == "meta/" && target.Custom.Merkle != merkle {
+			t.Errorf("got package merkle %s, want %s", target.Custom.Merkle, merkle)
+		}
+		if !r.HasBlob(merkle) {
+			t.Errorf("blob %s for %s wasn't published", merkle, blob.Path)
+		}
+	}
+
+	// A repository reopened from the same FS sees what was published.
+	r, err = NewWithFS(fsys, "repo", "repo/repository/blobs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Init(); err != os.ErrExist {
+		t.Errorf("Init of an existing repository: got %v, want %v", err, os.ErrExist)
+	}
+	if _, err := r.PublishManifest(manifestPath); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.CommitUpdates(false); err != nil {
+		t.Fatal(err)
+	}
+}
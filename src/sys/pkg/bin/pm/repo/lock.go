@@ -0,0 +1,83 @@
+// Copyright 2024 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package repo
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// LockFile is the name of the advisory lockfile, in the repository directory,
+// that serializes processes modifying the repository.
+const LockFile = ".pm.lock"
+
+// ErrLocked indicates that another process holds the repository lock.
+var ErrLocked = errors.New("repository is locked by another process")
+
+// lockPollInterval is how often AcquireLock retries a held lock.
+var lockPollInterval = 50 * time.Millisecond
+
+// Lock is an exclusive advisory lock on a repository directory.
+type Lock struct {
+	path string
+	f    *os.File
+	once sync.Once
+	err  error
+}
+
+// AcquireLock takes the lock on the repository at dir, waiting up to timeout
+// for another process to release it. If the lock is still held after timeout,
+// the returned error wraps ErrLocked.
+func AcquireLock(dir string, timeout time.Duration) (*Lock, error) {
+	path := filepath.Join(dir, LockFile)
+	deadline := time.Now().Add(timeout)
+	for {
+		f, err := tryLock(path)
+		if err == nil {
+			return &Lock{path: path, f: f}, nil
+		}
+		if !errors.Is(err, ErrLocked) {
+			return nil, fmt.Errorf("locking repository %s: %w", dir, err)
+		}
+		if !time.Now().Before(deadline) {
+			return nil, fmt.Errorf("could not lock repository %s within %s, %s is held: %w", dir, timeout, path, ErrLocked)
+		}
+		time.Sleep(lockPollInterval)
+	}
+}
+
+// Unlock releases the lock. It is safe to call more than once.
+func (l *Lock) Unlock() error {
+	l.once.Do(func() {
+		l.err = unlock(l.path, l.f)
+	})
+	return l.err
+}
+
+// UnlockOnInterrupt releases the lock and exits if the process is interrupted
+// while it holds the lock. The returned function stops watching for the
+// interrupt, and must be called once the lock has been released.
+func (l *Lock) UnlockOnInterrupt() (stop func()) {
+	c := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	signal.Notify(c, os.Interrupt)
+	go func() {
+		select {
+		case <-c:
+			l.Unlock()
+			os.Exit(130)
+		case <-done:
+		}
+	}()
+	return func() {
+		signal.Stop(c)
+		close(done)
+	}
+}
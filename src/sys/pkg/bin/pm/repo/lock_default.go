@@ -0,0 +1,28 @@
+// Copyright 2024 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+//go:build !aix && !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd && !solaris
+
+package repo
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+)
+
+// tryLock creates the lockfile at path, which must not already exist. Unlike
+// a flock, the lockfile outlives a process that exits without unlocking it.
+func tryLock(path string) (*os.File, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0o644)
+	if errors.Is(err, fs.ErrExist) {
+		return nil, ErrLocked
+	}
+	return f, err
+}
+
+func unlock(path string, f *os.File) error {
+	f.Close()
+	return os.Remove(path)
+}
@@ -0,0 +1,40 @@
+// Copyright 2024 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package repo
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestAcquireLock(t *testing.T) {
+	dir := t.TempDir()
+	lock, err := AcquireLock(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	if _, err := AcquireLock(dir, 100*time.Millisecond); !errors.Is(err, ErrLocked) {
+		t.Fatalf("second lock: got %v, want %v", err, ErrLocked)
+	}
+	if waited := time.Since(start); waited < 100*time.Millisecond {
+		t.Errorf("second lock failed after %s, want it to wait for the timeout", waited)
+	}
+
+	if err := lock.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+	if err := lock.Unlock(); err != nil {
+		t.Errorf("second unlock: %v", err)
+	}
+
+	lock, err = AcquireLock(dir, 0)
+	if err != nil {
+		t.Fatalf("lock after unlock: %v", err)
+	}
+	lock.Unlock()
+}
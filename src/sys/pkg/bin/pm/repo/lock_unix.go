@@ -0,0 +1,42 @@
+// Copyright 2024 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+//go:build aix || darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris
+
+package repo
+
+import (
+	"errors"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// tryLock takes a flock on the lockfile at path without blocking. The kernel
+// drops the flock when the process exits, however it exits, so a crashed
+// process never leaves the repository locked.
+func tryLock(path string) (*os.File, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	if err := unix.Flock(int(f.Fd()), unix.LOCK_EX|unix.LOCK_NB); err != nil {
+		f.Close()
+		if errors.Is(err, unix.EWOULDBLOCK) {
+			return nil, ErrLocked
+		}
+		return nil, err
+	}
+	return f, nil
+}
+
+func unlock(path string, f *os.File) error {
+	// The lockfile is left in place: removing it would let another process
+	// lock a new file while a third still waits on the old one.
+	if err := unix.Flock(int(f.Fd()), unix.LOCK_UN); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
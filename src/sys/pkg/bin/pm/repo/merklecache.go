@@ -0,0 +1,41 @@
+// Copyright 2024 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package repo
+
+import (
+	"path"
+
+	"go.fuchsia.dev/fuchsia/src/sys/pkg/bin/pm/build"
+)
+
+// MerkleCacheFile is the name of the file, in the repository directory, that
+// caches the merkle roots Verify computes for blobs.
+const MerkleCacheFile = build.MerkleCacheFile
+
+// EnableMerkleCache makes Verify skip hashing the blobs whose merkle roots it
+// computed on an earlier run, as long as they haven't been modified since,
+// loading the roots from MerkleCacheFile. A missing or unreadable cache is
+// treated as empty. Call SaveMerkleCache to record the roots computed.
+func (r *Repo) EnableMerkleCache() error {
+	c, err := build.LoadMerkleCache(r.fsys, path.Join(r.path, MerkleCacheFile))
+	if err != nil {
+		return err
+	}
+	r.merkleCache = c
+	return nil
+}
+
+// SaveMerkleCache writes the merkle roots computed with the cache enabled to
+// MerkleCacheFile.
+func (r *Repo) SaveMerkleCache() error {
+	if r.merkleCache == nil {
+		return nil
+	}
+	b, err := r.merkleCache.Marshal()
+	if err != nil {
+		return err
+	}
+	return r.fsys.WriteFile(path.Join(r.path, MerkleCacheFile), b, 0o644)
+}
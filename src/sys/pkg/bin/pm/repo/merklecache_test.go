@@ -0,0 +1,76 @@
+// Copyright 2024 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package repo
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestVerifyMerkleCache(t *testing.T) {
+	_, repoDir, manifest := publishTestRepo(t)
+
+	// verify runs Verify with the cache enabled on a freshly loaded repository,
+	// as separate runs of pm would, returning the problems found and the
+	// number of blobs hashed.
+	verify := func() ([]error, int) {
+		t.Helper()
+		r, err := New(repoDir, filepath.Join(repoDir, "repository", "blobs"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := r.EnableMerkleCache(); err != nil {
+			t.Fatal(err)
+		}
+		problems := r.Verify(false)
+		if err := r.SaveMerkleCache(); err != nil {
+			t.Fatal(err)
+		}
+		return problems, r.merkleCache.Hashed
+	}
+
+	problems, hashed := verify()
+	if len(problems) != 0 {
+		t.Fatalf("healthy repository: got problems %v", problems)
+	}
+	if hashed == 0 {
+		t.Fatalf("first run hashed no blobs")
+	}
+
+	if problems, hashed := verify(); len(problems) != 0 || hashed != 0 {
+		t.Errorf("second run: got problems %v and %d blobs hashed, want none", problems, hashed)
+	}
+
+	// Modify a blob without changing its size.
+	var modified string
+	for _, blob := range manifest.Blobs {
+		if blob.Path == "a" {
+			modified = blob.Merkle.String()
+		}
+	}
+	blobPath := filepath.Join(repoDir, "repository", "blobs", modified)
+	b, err := os.ReadFile(blobPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(blobPath, []byte(strings.Repeat("x", len(b))), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Hour)
+	if err := os.Chtimes(blobPath, later, later); err != nil {
+		t.Fatal(err)
+	}
+
+	problems, hashed = verify()
+	if hashed != 1 {
+		t.Errorf("after modifying a blob: %d blobs hashed, want 1", hashed)
+	}
+	if len(problems) != 1 || !strings.Contains(problems[0].Error(), modified) {
+		t.Errorf("after modifying a blob: got problems %v, want one for %s", problems, modified)
+	}
+}
@@ -0,0 +1,229 @@
+// Copyright 2024 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package repo
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	tufData "github.com/theupdateframework/go-tuf/data"
+)
+
+// PublishPlan lists the changes publishing makes to a repository, as found by
+// comparing the repository before and after. Every list is sorted, so that
+// plans for the same changes are identical.
+type PublishPlan struct {
+	// Blobs lists the blobs copied into the repository.
+	Blobs []PlannedBlob `json:"blobs"`
+	// TargetsAdded lists the targets added. A target whose metadata changed
+	// is listed as removed with its old metadata and added with its new.
+	TargetsAdded []PlannedTarget `json:"targets_added"`
+	// TargetsRemoved lists the targets removed.
+	TargetsRemoved []PlannedTarget `json:"targets_removed"`
+	// Versions lists the metadata whose version changed.
+	Versions []VersionBump `json:"versions"`
+}
+
+// PlannedBlob is a blob publishing copies into the repository. Size is the
+// size of the stored blob, which is encrypted if the repository encrypts
+// blobs.
+type PlannedBlob struct {
+	Merkle string `json:"merkle"`
+	Size   int64  `json:"size"`
+}
+
+// PlannedTarget is a target publishing adds or removes, with the merkle root
+// its custom metadata gives.
+type PlannedTarget struct {
+	Name   string `json:"name"`
+	Merkle string `json:"merkle,omitempty"`
+}
+
+// VersionBump is a change of the version of the metadata of a role. From is 0
+// for metadata that didn't exist.
+type VersionBump struct {
+	Role string `json:"role"`
+	From int64  `json:"from"`
+	To   int64  `json:"to"`
+}
+
+// planRoles are the roles whose metadata versions a PublishPlan compares.
+var planRoles = []string{"root", "targets", "snapshot", "timestamp"}
+
+// CloneRepository clones the repository at dir to clone, which must not
+// exist, for a dry run. Blobs are hard linked rather than copied where
+// possible, as they are never written to once stored. Everything else is
+// copied, since committing TUF metadata rewrites its files in place. The
+// repository lock file isn't cloned.
+func CloneRepository(dir, clone string) error {
+	if err := os.Mkdir(clone, 0o755); err != nil {
+		return err
+	}
+	return filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		dst := filepath.Join(clone, rel)
+		switch {
+		case rel == ".":
+			return nil
+		case d.IsDir():
+			return os.Mkdir(dst, 0o755)
+		case !d.Type().IsRegular() || rel == LockFile:
+			return nil
+		}
+		if strings.HasPrefix(filepath.ToSlash(rel), "repository/blobs/") {
+			return linkOrCopy(p, dst)
+		}
+		return copyRepoFile(p, dst)
+	})
+}
+
+// copyRepoFile copies src to the new file dst, keeping its permissions.
+func copyRepoFile(src, dst string) error {
+	b, err := os.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	fi, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(dst, b, fi.Mode().Perm())
+}
+
+// PlanPublish compares r with after, the same repository once published to,
+// and returns the changes publishing made.
+func (r *Repo) PlanPublish(after *Repo) (*PublishPlan, error) {
+	plan := &PublishPlan{
+		Blobs:          []PlannedBlob{},
+		TargetsAdded:   []PlannedTarget{},
+		TargetsRemoved: []PlannedTarget{},
+		Versions:       []VersionBump{},
+	}
+
+	before, err := r.storedBlobs()
+	if err != nil {
+		return nil, err
+	}
+	blobs, err := after.storedBlobs()
+	if err != nil {
+		return nil, err
+	}
+	for root, size := range blobs {
+		if _, ok := before[root]; !ok {
+			plan.Blobs = append(plan.Blobs, PlannedBlob{Merkle: root, Size: size})
+		}
+	}
+	sort.Slice(plan.Blobs, func(i, j int) bool { return plan.Blobs[i].Merkle < plan.Blobs[j].Merkle })
+
+	var oldTargets, newTargets tufData.Targets
+	if err := r.committedMetadata("targets", &oldTargets); err != nil {
+		return nil, err
+	}
+	if err := after.committedMetadata("targets", &newTargets); err != nil {
+		return nil, err
+	}
+	if plan.TargetsRemoved, err = missingTargets(oldTargets.Targets, newTargets.Targets); err != nil {
+		return nil, err
+	}
+	if plan.TargetsAdded, err = missingTargets(newTargets.Targets, oldTargets.Targets); err != nil {
+		return nil, err
+	}
+
+	for _, role := range planRoles {
+		var from, to struct {
+			Version int64 `json:"version"`
+		}
+		if err := r.committedMetadata(role, &from); err != nil {
+			return nil, err
+		}
+		if err := after.committedMetadata(role, &to); err != nil {
+			return nil, err
+		}
+		if from.Version != to.Version {
+			plan.Versions = append(plan.Versions, VersionBump{Role: role, From: from.Version, To: to.Version})
+		}
+	}
+	return plan, nil
+}
+
+// storedBlobs returns the sizes of the blobs stored in the repository, by
+// merkle root.
+func (r *Repo) storedBlobs() (map[string]int64, error) {
+	entries, err := fs.ReadDir(r.fsys, r.blobsDir)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	blobs := map[string]int64{}
+	for _, e := range entries {
+		// Skip blobs still being written, which have temporary names.
+		if len(e.Name()) != 64 || !e.Type().IsRegular() {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			return nil, err
+		}
+		blobs[e.Name()] = info.Size()
+	}
+	return blobs, nil
+}
+
+// committedMetadata decodes the signed part of the committed metadata of role
+// into v, leaving v as it was if there is none.
+func (r *Repo) committedMetadata(role string, v interface{}) error {
+	b, err := fs.ReadFile(r.fsys, path.Join(r.path, "repository", role+".json"))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	var signed tufData.Signed
+	if err := json.Unmarshal(b, &signed); err != nil {
+		return fmt.Errorf("%s.json: %w", role, err)
+	}
+	if err := json.Unmarshal(signed.Signed, v); err != nil {
+		return fmt.Errorf("%s.json: %w", role, err)
+	}
+	return nil
+}
+
+// missingTargets returns the targets of a that b lacks, or holds with other
+// metadata, sorted by name.
+func missingTargets(a, b tufData.TargetFiles) ([]PlannedTarget, error) {
+	missing := []PlannedTarget{}
+	for name, target := range a {
+		if other, ok := b[name]; ok {
+			if equal, err := targetsEqual(target, other); err != nil {
+				return nil, fmt.Errorf("target %s: %w", name, err)
+			} else if equal {
+				continue
+			}
+		}
+		planned := PlannedTarget{Name: name}
+		if target.Custom != nil {
+			var custom customTargetMetadata
+			if err := json.Unmarshal(*target.Custom, &custom); err != nil {
+				return nil, fmt.Errorf("target %s: %w", name, err)
+			}
+			planned.Merkle = custom.Merkle
+		}
+		missing = append(missing, planned)
+	}
+	sort.Slice(missing, func(i, j int) bool { return missing[i].Name < missing[j].Name })
+	return missing, nil
+}
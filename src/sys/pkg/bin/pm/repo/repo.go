@@ -16,7 +16,9 @@ import (
 	"io"
 	"io/fs"
 	"os"
+	"path"
 	"path/filepath"
+	"reflect"
 	"syscall"
 	"time"
 
@@ -44,6 +46,10 @@ type customTargetMetadata struct {
 	Size   int64  `json:"size"`
 }
 
+// reservedCustomFields are the fields of the custom target metadata that are
+// computed from the package, and so can't be set with SetTargetCustom.
+var reservedCustomFields = map[string]bool{"merkle": true, "size": true}
+
 // TimeProvider provides the service to get Unix timestamp.
 type TimeProvider interface {
 	// UnixTimestamp returns the Unix timestamp.
@@ -52,19 +58,24 @@ type TimeProvider interface {
 
 type Repo struct {
 	*tuf.Repo
+	fsys          FS
 	path          string
 	blobsDir      string
 	encryptionKey []byte
 	timeProvider  TimeProvider
+	targetCustom  map[string]string
+	merkleCache   *build.MerkleCache
+	progress      build.Progress
 }
 
 var NotCreatingNonExistentRepoError = errors.New("repo does not exist and createIfNotExist is false, so not creating one")
 
-// SystemProvider uses the time pkg to get Unix timestamp.
+// SystemProvider uses the time pkg to get Unix timestamp, honoring
+// SourceDateEpochEnv.
 type SystemTimeProvider struct{}
 
 func (*SystemTimeProvider) UnixTimestamp() int {
-	return int(time.Now().Unix())
+	return int(now().Unix())
 }
 
 func passphrase(role string, confirm bool) ([]byte, error) { return []byte{}, nil }
@@ -72,10 +83,30 @@ func passphrase(role string, confirm bool) ([]byte, error) { return []byte{}, ni
 // New initializes a new Repo structure that may read/write repository data at
 // the given path.
 func New(path, blobsDir string) (*Repo, error) {
-	info, err := os.Stat(path)
+	fsPath, err := hostPath(path)
+	if err != nil {
+		return nil, fmt.Errorf("repository directory %q: %w", path, err)
+	}
+	fsBlobsDir, err := hostPath(blobsDir)
 	if err != nil {
-		if os.IsNotExist(err) {
-			err = os.MkdirAll(path, 0755)
+		return nil, fmt.Errorf("blobs directory %q: %w", blobsDir, err)
+	}
+	return newRepo(hostFS, fsPath, fsBlobsDir, tuf.FileSystemStore(path, passphrase))
+}
+
+// NewWithFS initializes a new Repo structure that may read/write repository
+// data at the given path in fsys, with blobs stored in blobsDir in fsys.
+func NewWithFS(fsys FS, path, blobsDir string) (*Repo, error) {
+	return newRepo(fsys, path, blobsDir, newFSStore(fsys, path, passphrase))
+}
+
+// newRepo initializes a Repo whose TUF metadata and keys are kept in store,
+// which must store them in path in fsys.
+func newRepo(fsys FS, path, blobsDir string, store tuf.LocalStore) (*Repo, error) {
+	info, err := fsys.Stat(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			err = fsys.MkdirAll(path, 0755)
 		}
 		if err != nil {
 			return nil, fmt.Errorf("repository directory %q: %w", path, err)
@@ -85,16 +116,16 @@ func New(path, blobsDir string) (*Repo, error) {
 		return nil, fmt.Errorf("repository path %q: %w", path, syscall.ENOTDIR)
 	}
 
-	repo, err := tuf.NewRepo(tuf.FileSystemStore(path, passphrase), "sha512")
+	repo, err := tuf.NewRepo(store, "sha512")
 	if err != nil {
 		return nil, err
 	}
-	r := &Repo{repo, path, blobsDir, nil, &SystemTimeProvider{}}
+	r := &Repo{repo, fsys, path, blobsDir, nil, &SystemTimeProvider{}, nil, nil, nil}
 
-	if err := os.MkdirAll(blobsDir, os.ModePerm); err != nil {
+	if err := fsys.MkdirAll(blobsDir, os.ModePerm); err != nil {
 		return nil, err
 	}
-	if err := os.MkdirAll(r.stagedFilesPath(), os.ModePerm); err != nil {
+	if err := fsys.MkdirAll(r.stagedFilesPath(), os.ModePerm); err != nil {
 		return nil, err
 	}
 
@@ -122,7 +153,7 @@ func (r *Repo) Init() error {
 // location and createIfNotExists is true.
 // If a repository already exists, either os.ErrExist, or a TUF error are returned.
 func (r *Repo) OptionallyInitAtLocation(createIfNotExists bool) error {
-	if _, err := os.Stat(filepath.Join(r.path, "repository", "root.json")); err == nil {
+	if _, err := r.fsys.Stat(path.Join(r.path, "repository", "root.json")); err == nil {
 		return os.ErrExist
 	}
 
@@ -170,19 +201,18 @@ func (r *Repo) AddPackage(name string, rd io.Reader, merkle string) error {
 		return NewAddErr("adding package blob", err)
 	}
 
-	stagingPath := filepath.Join(r.stagedFilesPath(), name)
-	os.MkdirAll(filepath.Dir(stagingPath), os.ModePerm)
+	stagingPath := path.Join(r.stagedFilesPath(), name)
+	r.fsys.MkdirAll(path.Dir(stagingPath), os.ModePerm)
 
 	// add merkle root as custom JSON
-	metadata := customTargetMetadata{Merkle: root, Size: size}
-	jsonStr, err := json.Marshal(metadata)
+	jsonStr, err := r.customMetadata(root, size)
 	if err != nil {
-		return NewAddErr(fmt.Sprintf("serializing %v", metadata), err)
+		return NewAddErr(fmt.Sprintf("serializing custom metadata for %s", root), err)
 	}
 
-	blobPath := filepath.Join(r.blobsDir, root)
+	blobPath := path.Join(r.blobsDir, root)
 
-	if err := linkOrCopy(blobPath, stagingPath); err != nil {
+	if err := copyInFS(r.fsys, blobPath, stagingPath); err != nil {
 		return NewAddErr("creating file in staging directory", err)
 	}
 
@@ -194,6 +224,37 @@ func (r *Repo) AddPackage(name string, rd io.Reader, merkle string) error {
 	return nil
 }
 
+// SetProgress sets where events are reported as blobs are published.
+func (r *Repo) SetProgress(p build.Progress) {
+	r.progress = p
+}
+
+// SetTargetCustom sets fields to add to the custom metadata of the targets
+// added after, alongside the merkle root and size of the package. The fields
+// must not be ones that are computed from the package.
+func (r *Repo) SetTargetCustom(fields map[string]string) error {
+	for key := range fields {
+		if reservedCustomFields[key] {
+			return fmt.Errorf("custom target field %q is reserved", key)
+		}
+	}
+	r.targetCustom = fields
+	return nil
+}
+
+// customMetadata returns the custom metadata of a target for the package blob
+// with the given merkle root and size.
+func (r *Repo) customMetadata(merkle string, size int64) ([]byte, error) {
+	if len(r.targetCustom) == 0 {
+		return json.Marshal(customTargetMetadata{Merkle: merkle, Size: size})
+	}
+	fields := map[string]interface{}{"merkle": merkle, "size": size}
+	for key, value := range r.targetCustom {
+		fields[key] = value
+	}
+	return json.Marshal(fields)
+}
+
 func cryptingWriter(dst io.Writer, key []byte) (io.WriteCloser, error) {
 	block, err := aes.NewCipher(key)
 	if err != nil {
@@ -216,8 +277,8 @@ func cryptingWriter(dst io.Writer, key []byte) (io.WriteCloser, error) {
 // HasBlob returns true if the given merkleroot is already in the repository
 // blob store.
 func (r *Repo) HasBlob(root string) bool {
-	blobPath := filepath.Join(r.blobsDir, root)
-	fi, err := os.Stat(blobPath)
+	blobPath := path.Join(r.blobsDir, root)
+	fi, err := r.fsys.Stat(blobPath)
 	return err == nil && fi.Mode().IsRegular()
 }
 
@@ -230,9 +291,9 @@ func (r *Repo) AddBlob(root string, rd io.Reader) (string, int64, error) {
 
 	// Exit early if the blob already exists.
 	if root != "" {
-		dstPath = filepath.Join(r.blobsDir, root)
+		dstPath = path.Join(r.blobsDir, root)
 
-		if fi, err := os.Stat(dstPath); err == nil {
+		if fi, err := r.fsys.Stat(dstPath); err == nil {
 			fileSize := fi.Size()
 
 			if r.encryptionKey != nil {
@@ -244,7 +305,7 @@ func (r *Repo) AddBlob(root string, rd io.Reader) (string, int64, error) {
 	}
 
 	// Otherwise write the blob into a temporary file.
-	f, err := os.CreateTemp(r.blobsDir, "blob")
+	f, err := r.fsys.CreateTemp(r.blobsDir, "blob")
 	if err != nil {
 		return "", 0, err
 	}
@@ -268,7 +329,7 @@ func (r *Repo) AddBlob(root string, rd io.Reader) (string, int64, error) {
 		}
 
 		root = hex.EncodeToString(tree.Root())
-		dstPath = filepath.Join(r.blobsDir, root)
+		dstPath = path.Join(r.blobsDir, root)
 	} else {
 		n, err = io.Copy(dst, rd)
 		if err != nil {
@@ -276,10 +337,14 @@ func (r *Repo) AddBlob(root string, rd io.Reader) (string, int64, error) {
 		}
 	}
 
+	if err := f.Close(); err != nil {
+		return "", n, err
+	}
+
 	// Atomically rename the blob to the destination path. Ignore "file
 	// exists" error, since that means we lost a race with some other
 	// process trying to create this blob.
-	if err = os.Rename(f.Name(), dstPath); err != nil {
+	if err = r.fsys.Rename(f.Name(), dstPath); err != nil {
 		if !errors.Is(err, fs.ErrExist) {
 			return "", n, err
 		}
@@ -320,19 +385,108 @@ func (r *Repo) CommitUpdates(dateVersioning bool) error {
 	return r.commitUpdates()
 }
 
+// CommitUpdatesIfChanged is like CommitUpdates, except that if the staged
+// changes leave the targets as they were last committed and force is false, it
+// discards them rather than re-signing unchanged metadata. It reports whether
+// the changes were committed. The Repo must not be used after changes have
+// been discarded.
+func (r *Repo) CommitUpdatesIfChanged(dateVersioning, force bool) (bool, error) {
+	if !force {
+		changed, err := r.TargetsChanged()
+		if err != nil {
+			return false, err
+		}
+		if !changed {
+			return false, r.Clean()
+		}
+	}
+	return true, r.CommitUpdates(dateVersioning)
+}
+
+// TargetsChanged reports whether the staged targets differ from the targets
+// last committed to the repository.
+func (r *Repo) TargetsChanged() (bool, error) {
+	staged, err := r.Targets()
+	if err != nil {
+		return false, err
+	}
+	b, err := fs.ReadFile(r.fsys, path.Join(r.path, "repository", "targets.json"))
+	if errors.Is(err, fs.ErrNotExist) {
+		return true, nil
+	} else if err != nil {
+		return false, err
+	}
+	var signed tufData.Signed
+	if err := json.Unmarshal(b, &signed); err != nil {
+		return false, err
+	}
+	var committed tufData.Targets
+	if err := json.Unmarshal(signed.Signed, &committed); err != nil {
+		return false, err
+	}
+
+	if len(staged) != len(committed.Targets) {
+		return true, nil
+	}
+	for name, target := range staged {
+		old, ok := committed.Targets[name]
+		if !ok {
+			return true, nil
+		}
+		equal, err := targetsEqual(target, old)
+		if err != nil || !equal {
+			return true, err
+		}
+	}
+	return false, nil
+}
+
+// targetsEqual reports whether two targets describe the same file, comparing
+// their custom metadata by value rather than by encoding.
+func targetsEqual(a, b tufData.TargetFileMeta) (bool, error) {
+	if a.Length != b.Length || !reflect.DeepEqual(a.Hashes, b.Hashes) {
+		return false, nil
+	}
+	if a.Custom == nil || b.Custom == nil {
+		return a.Custom == b.Custom, nil
+	}
+	var aCustom, bCustom interface{}
+	if err := json.Unmarshal(*a.Custom, &aCustom); err != nil {
+		return false, err
+	}
+	if err := json.Unmarshal(*b.Custom, &bCustom); err != nil {
+		return false, err
+	}
+	return reflect.DeepEqual(aCustom, bCustom), nil
+}
+
 // hasTarget returns true if the given targetFiles contains a target matching
 // exactly all of name, version and merkle, and false otherwise.
 func (r *Repo) hasTarget(name, version, merkle string, targets tufData.TargetFiles) (bool, error) {
-	path := filepath.Join(name, version)
-	if targets[path].Custom == nil {
+	targetPath := path.Join(name, version)
+	if targets[targetPath].Custom == nil {
 		return false, nil
 	}
-	var custom customTargetMetadata
+	var custom map[string]interface{}
 
-	if err := json.Unmarshal(*targets[path].Custom, &custom); err != nil {
+	if err := json.Unmarshal(*targets[targetPath].Custom, &custom); err != nil {
 		return false, err
 	}
-	return custom.Merkle == merkle, nil
+	if custom["merkle"] != merkle {
+		return false, nil
+	}
+	// The target must also have exactly the configured custom fields.
+	for key, value := range custom {
+		if !reservedCustomFields[key] && r.targetCustom[key] != value {
+			return false, nil
+		}
+	}
+	for key := range r.targetCustom {
+		if _, ok := custom[key]; !ok {
+			return false, nil
+		}
+	}
+	return true, nil
 }
 
 // PublishManifests publishes the packages and blobs identified in the package
@@ -394,7 +548,8 @@ func (r *Repo) publishManifest(path string, targets tufData.TargetFiles) ([]stri
 	}
 
 	// publish the package if it's not already in targets.json
-	for _, blob := range packageManifest.Blobs {
+	pkgName := packageManifest.Package.Name + "/" + packageManifest.Package.Version
+	for i, blob := range packageManifest.Blobs {
 		if err := func() error {
 			if blob.Path == "meta/" {
 				p := packageManifest.Package
@@ -424,6 +579,7 @@ func (r *Repo) publishManifest(path string, targets tufData.TargetFiles) ([]stri
 		}(); err != nil {
 			return nil, err
 		}
+		r.progress.Report(build.ProgressEvent{Phase: "publish", Item: pkgName, Current: i + 1, Total: len(packageManifest.Blobs)})
 	}
 	return deps, nil
 }
@@ -431,7 +587,7 @@ func (r *Repo) publishManifest(path string, targets tufData.TargetFiles) ([]stri
 func (r *Repo) commitUpdates() error {
 	// TUF-1.0 section 4.4.2 states that the expiration must be in the
 	// ISO-8601 format in the UTC timezone with no nanoseconds.
-	expires := time.Now().AddDate(0, 0, 30).UTC().Round(time.Second)
+	expires := now().AddDate(0, 0, 30).UTC().Round(time.Second)
 	if err := r.SnapshotWithExpires(expires); err != nil {
 		return fmt.Errorf("snapshot: %s", err)
 	}
@@ -446,7 +602,7 @@ func (r *Repo) commitUpdates() error {
 }
 
 func (r *Repo) stagedFilesPath() string {
-	return filepath.Join(r.path, "staged", "targets")
+	return path.Join(r.path, "staged", "targets")
 }
 
 // when the repository is "pre-initialized" by a root.json from the build, but
@@ -454,14 +610,14 @@ func (r *Repo) stagedFilesPath() string {
 // not produce a consistent snapshot file for the root json manifest. This
 // method implements that production.
 func (r *Repo) fixupRootConsistentSnapshot() error {
-	b, err := os.ReadFile(filepath.Join(r.path, "repository", "root.json"))
+	b, err := fs.ReadFile(r.fsys, path.Join(r.path, "repository", "root.json"))
 	if err != nil {
 		return err
 	}
 	sum512 := sha512.Sum512(b)
-	rootSnap := filepath.Join(r.path, "repository", fmt.Sprintf("%x.root.json", sum512))
-	if _, err := os.Stat(rootSnap); os.IsNotExist(err) {
-		if err := os.WriteFile(rootSnap, b, 0666); err != nil {
+	rootSnap := path.Join(r.path, "repository", fmt.Sprintf("%x.root.json", sum512))
+	if _, err := r.fsys.Stat(rootSnap); errors.Is(err, fs.ErrNotExist) {
+		if err := r.fsys.WriteFile(rootSnap, b, 0666); err != nil {
 			return err
 		}
 	}
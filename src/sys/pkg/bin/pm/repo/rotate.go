@@ -0,0 +1,94 @@
+// Copyright 2024 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package repo
+
+import (
+	"encoding/json"
+	"fmt"
+
+	tufData "github.com/theupdateframework/go-tuf/data"
+)
+
+// RotateKey generates a new key for role and lists it in root.json, returning
+// its IDs. If revoke is set, the keys the role had before are removed from
+// root.json. The role's metadata is re-signed with its new keys; the snapshot
+// and timestamp metadata are re-signed by CommitUpdates, which must be called
+// to write the changes out.
+//
+// When the root key is rotated, the new root.json is also signed with the old
+// root keys, so that clients trusting the previous root.json accept it. The
+// private keys of revoked keys are left in the keys directory.
+func (r *Repo) RotateKey(role string, revoke bool) ([]string, error) {
+	if role != "root" && !contains(roles, role) {
+		return nil, fmt.Errorf("unknown role %q", role)
+	}
+
+	root, err := r.stagedRoot()
+	if err != nil {
+		return nil, err
+	}
+	var oldKeys []*tufData.PublicKey
+	if roleKeys, ok := root.Roles[role]; ok {
+		seen := map[string]bool{}
+		for _, id := range roleKeys.KeyIDs {
+			key, ok := root.Keys[id]
+			if !ok || seen[id] {
+				continue
+			}
+			for _, id := range key.IDs() {
+				seen[id] = true
+			}
+			oldKeys = append(oldKeys, key)
+		}
+	}
+
+	ids, err := r.GenKey(role)
+	if err != nil {
+		return nil, fmt.Errorf("generating %s key: %w", role, err)
+	}
+	if revoke {
+		for _, key := range oldKeys {
+			if err := r.RevokeKeyWithExpires(role, key.IDs()[0], defaultExpires("root")); err != nil {
+				return nil, fmt.Errorf("revoking %s key %s: %w", role, key.IDs()[0], err)
+			}
+		}
+	}
+
+	// root.json was re-signed when it was updated, and the snapshot and
+	// timestamp metadata are re-signed on commit, but the targets metadata
+	// is only re-signed when it changes.
+	if role == "targets" {
+		version, err := r.TargetsVersion()
+		if err != nil {
+			return nil, err
+		}
+		if err := r.SetTargetsVersion(version + 1); err != nil {
+			return nil, fmt.Errorf("re-signing targets.json: %w", err)
+		}
+	}
+	return ids, nil
+}
+
+// stagedRoot returns the root metadata, including any staged changes.
+func (r *Repo) stagedRoot() (*tufData.Root, error) {
+	s, err := r.SignedMeta("root.json")
+	if err != nil {
+		return nil, err
+	}
+	root := &tufData.Root{}
+	if err := json.Unmarshal(s.Signed, root); err != nil {
+		return nil, fmt.Errorf("root.json: %w", err)
+	}
+	return root, nil
+}
+
+func contains(list []string, s string) bool {
+	for _, e := range list {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,74 @@
+// Copyright 2024 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package repo
+
+import (
+	"encoding/json"
+	"os"
+	"strconv"
+	"time"
+)
+
+// SourceDateEpochEnv is the environment variable that, when set to a Unix
+// timestamp, pins the time that the timestamps embedded in repository metadata
+// are based on, so that builds of the repository are reproducible. See
+// https://reproducible-builds.org/specs/source-date-epoch/. Metadata can't be
+// signed once it has expired, so the pinned time must be recent enough that
+// the metadata expirations counted from it are still in the future.
+const SourceDateEpochEnv = "SOURCE_DATE_EPOCH"
+
+// now returns the time in SourceDateEpochEnv if it's set to a valid Unix
+// timestamp, and the current time otherwise.
+func now() time.Time {
+	if epoch, ok := os.LookupEnv(SourceDateEpochEnv); ok {
+		if secs, err := strconv.ParseInt(epoch, 10, 64); err == nil {
+			return time.Unix(secs, 0)
+		}
+	}
+	return time.Now()
+}
+
+// defaultExpires returns the expiration of a role's metadata, which is the
+// go-tuf default lifetime for the role counted from now().
+func defaultExpires(role string) time.Time {
+	var t time.Time
+	switch role {
+	case "root":
+		t = now().AddDate(1, 0, 0)
+	case "targets":
+		t = now().AddDate(0, 3, 0)
+	case "snapshot":
+		t = now().AddDate(0, 0, 7)
+	case "timestamp":
+		t = now().AddDate(0, 0, 1)
+	}
+	// TUF-1.0 section 4.4.2 states that the expiration must be in the
+	// ISO-8601 format in the UTC timezone with no nanoseconds.
+	return t.UTC().Round(time.Second)
+}
+
+// GenKey generates a key for role, like tuf.Repo.GenKey, with the root
+// metadata expiring relative to now().
+func (r *Repo) GenKey(role string) ([]string, error) {
+	return r.GenKeyWithExpires(role, defaultExpires("root"))
+}
+
+// AddTarget stages a target, like tuf.Repo.AddTarget, with the targets
+// metadata expiring relative to now().
+func (r *Repo) AddTarget(path string, custom json.RawMessage) error {
+	return r.AddTargetWithExpires(path, custom, defaultExpires("targets"))
+}
+
+// AddTargets stages targets, like tuf.Repo.AddTargets, with the targets
+// metadata expiring relative to now().
+func (r *Repo) AddTargets(paths []string, custom json.RawMessage) error {
+	return r.AddTargetsWithExpires(paths, custom, defaultExpires("targets"))
+}
+
+// RemoveTargets removes targets, like tuf.Repo.RemoveTargets, with the targets
+// metadata expiring relative to now().
+func (r *Repo) RemoveTargets(paths []string) error {
+	return r.RemoveTargetsWithExpires(paths, defaultExpires("targets"))
+}
@@ -0,0 +1,73 @@
+// Copyright 2024 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package repo
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"go.fuchsia.dev/fuchsia/src/sys/pkg/bin/pm/build"
+)
+
+func TestSourceDateEpoch(t *testing.T) {
+	// go-tuf won't sign metadata that has already expired, so pin a recent
+	// time.
+	epoch := time.Now().AddDate(0, 0, -2).Truncate(time.Hour).UTC()
+	t.Setenv(SourceDateEpochEnv, strconv.FormatInt(epoch.Unix(), 10))
+
+	cfg := build.TestConfig()
+	defer os.RemoveAll(filepath.Dir(cfg.TempDir))
+	build.BuildTestPackage(cfg)
+
+	repoDir := t.TempDir()
+	r, err := New(repoDir, filepath.Join(repoDir, "repository", "blobs"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Init(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.PublishManifest(filepath.Join(cfg.OutputDir, "package_manifest.json")); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.CommitUpdates(true); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		role        string
+		wantExpires time.Time
+		wantVersion int
+	}{
+		{"root.json", epoch.AddDate(1, 0, 0), 1},
+		{"targets.json", epoch.AddDate(0, 3, 0), int(epoch.Unix())},
+		{"snapshot.json", epoch.AddDate(0, 0, 30), int(epoch.Unix())},
+		{"timestamp.json", epoch.AddDate(0, 0, 30), int(epoch.Unix())},
+	} {
+		b, err := os.ReadFile(filepath.Join(repoDir, "repository", tc.role))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var metadata struct {
+			Signed struct {
+				Version int       `json:"version"`
+				Expires time.Time `json:"expires"`
+			} `json:"signed"`
+		}
+		if err := json.Unmarshal(b, &metadata); err != nil {
+			t.Fatal(err)
+		}
+		if got := metadata.Signed.Expires; !got.Equal(tc.wantExpires) {
+			t.Errorf("%s expires %s, want %s", tc.role, got, tc.wantExpires)
+		}
+		if got := metadata.Signed.Version; got != tc.wantVersion {
+			t.Errorf("%s version %d, want %d", tc.role, got, tc.wantVersion)
+		}
+	}
+}
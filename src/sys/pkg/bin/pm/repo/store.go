@@ -0,0 +1,348 @@
+// Copyright 2024 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package repo
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"path"
+	"strings"
+
+	tuf "github.com/theupdateframework/go-tuf"
+	tufData "github.com/theupdateframework/go-tuf/data"
+	"github.com/theupdateframework/go-tuf/encrypted"
+	"github.com/theupdateframework/go-tuf/pkg/keys"
+	"github.com/theupdateframework/go-tuf/util"
+)
+
+// topLevelMetadata lists the metadata files a repository is made of.
+var topLevelMetadata = []string{
+	"root.json",
+	"targets.json",
+	"snapshot.json",
+	"timestamp.json",
+}
+
+// persistedKeys is the on-disk form of a role's signing keys, compatible with
+// tuf.FileSystemStore.
+type persistedKeys struct {
+	Encrypted bool            `json:"encrypted"`
+	Data      json.RawMessage `json:"data"`
+}
+
+// fsStore is a tuf.LocalStore that keeps a repository in an FS, laid out the
+// same way as tuf.FileSystemStore lays it out on disk. Repositories on the
+// host filesystem use tuf.FileSystemStore itself; NewWithFS uses fsStore.
+type fsStore struct {
+	fsys           FS
+	dir            string
+	passphraseFunc util.PassphraseFunc
+
+	// signers caches loaded keys so they're only decrypted once.
+	signers map[string][]keys.Signer
+}
+
+func newFSStore(fsys FS, dir string, p util.PassphraseFunc) *fsStore {
+	return &fsStore{
+		fsys:           fsys,
+		dir:            dir,
+		passphraseFunc: p,
+		signers:        make(map[string][]keys.Signer),
+	}
+}
+
+func (s *fsStore) repoDir() string {
+	return path.Join(s.dir, "repository")
+}
+
+func (s *fsStore) stagedDir() string {
+	return path.Join(s.dir, "staged")
+}
+
+func (s *fsStore) keysPath(role string) string {
+	return path.Join(s.dir, "keys", role+".json")
+}
+
+func (s *fsStore) exists(name string) (bool, error) {
+	_, err := s.fsys.Stat(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (s *fsStore) GetMeta() (map[string]json.RawMessage, error) {
+	meta := make(map[string]json.RawMessage)
+	for _, name := range topLevelMetadata {
+		p := path.Join(s.stagedDir(), name)
+		ok, err := s.exists(p)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			p = path.Join(s.repoDir(), name)
+			if ok, err = s.exists(p); err != nil {
+				return nil, err
+			} else if !ok {
+				continue
+			}
+		}
+		if meta[name], err = fs.ReadFile(s.fsys, p); err != nil {
+			return nil, err
+		}
+	}
+	return meta, nil
+}
+
+func (s *fsStore) SetMeta(name string, meta json.RawMessage) error {
+	if err := s.createDirs(); err != nil {
+		return err
+	}
+	return s.fsys.WriteFile(path.Join(s.stagedDir(), name), meta, 0644)
+}
+
+func (s *fsStore) createDirs() error {
+	for _, dir := range []string{"keys", "repository", "staged/targets"} {
+		if err := s.fsys.MkdirAll(path.Join(s.dir, dir), 0755); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *fsStore) walkStagedTarget(name, p string, targetsFn tuf.TargetsWalkFunc) error {
+	f, err := s.fsys.Open(p)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return tuf.ErrFileNotFound{Path: p}
+		}
+		return err
+	}
+	defer f.Close()
+	return targetsFn(name, f)
+}
+
+func (s *fsStore) WalkStagedTargets(paths []string, targetsFn tuf.TargetsWalkFunc) error {
+	targetsDir := path.Join(s.stagedDir(), "targets")
+	if len(paths) == 0 {
+		return fs.WalkDir(s.fsys, targetsDir, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !d.Type().IsRegular() {
+				return nil
+			}
+			return s.walkStagedTarget(strings.TrimPrefix(p, targetsDir+"/"), p, targetsFn)
+		})
+	}
+
+	// Check all the files exist before processing any of them.
+	for _, name := range paths {
+		p := path.Join(targetsDir, name)
+		if ok, err := s.exists(p); err != nil {
+			return err
+		} else if !ok {
+			return tuf.ErrFileNotFound{Path: p}
+		}
+	}
+	for _, name := range paths {
+		if err := s.walkStagedTarget(name, path.Join(targetsDir, name), targetsFn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *fsStore) Commit(consistentSnapshot bool, versions map[string]int, hashes map[string]tufData.Hashes) error {
+	isTarget := func(name string) bool {
+		return strings.HasPrefix(name, "targets/")
+	}
+	copyToRepo := func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		rel := strings.TrimPrefix(p, s.stagedDir()+"/")
+
+		var paths []string
+		if isTarget(rel) {
+			paths = []string{rel}
+			if consistentSnapshot {
+				paths = util.HashedPaths(rel, hashes[rel])
+			}
+		} else {
+			paths = []string{rel}
+			if rel == "root.json" || (consistentSnapshot && rel != "timestamp.json") {
+				paths = append(paths, util.VersionedPath(rel, versions[rel]))
+			}
+		}
+		b, err := fs.ReadFile(s.fsys, p)
+		if err != nil {
+			return err
+		}
+		for _, name := range paths {
+			dst := path.Join(s.repoDir(), name)
+			if err := s.fsys.MkdirAll(path.Dir(dst), 0755); err != nil {
+				return err
+			}
+			if err := s.fsys.WriteFile(dst, b, 0644); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	needsRemoval := func(name string) bool {
+		if consistentSnapshot {
+			// Strip out the hash.
+			parts := strings.SplitN(path.Base(name), ".", 2)
+			if len(parts) != 2 || parts[1] == "" {
+				return false
+			}
+			name = path.Join(path.Dir(name), parts[1])
+		}
+		_, ok := hashes[name]
+		return !ok
+	}
+	var removals []string
+	findRemovals := func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel := strings.TrimPrefix(p, s.repoDir()+"/")
+		if !d.IsDir() && isTarget(rel) && needsRemoval(rel) {
+			removals = append(removals, p)
+		}
+		return nil
+	}
+	if err := fs.WalkDir(s.fsys, s.stagedDir(), copyToRepo); err != nil {
+		return err
+	}
+	if err := fs.WalkDir(s.fsys, s.repoDir(), findRemovals); err != nil {
+		return err
+	}
+	for _, p := range removals {
+		// Like tuf.FileSystemStore, stale targets are removed on a best
+		// effort basis.
+		s.fsys.RemoveAll(p)
+	}
+	return s.Clean()
+}
+
+func (s *fsStore) GetSigners(role string) ([]keys.Signer, error) {
+	if signers, ok := s.signers[role]; ok {
+		return signers, nil
+	}
+	privateKeys, _, err := s.loadPrivateKeys(role)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	for _, k := range privateKeys {
+		signer, err := keys.GetSigner(k)
+		if err != nil {
+			continue
+		}
+		s.signers[role] = append(s.signers[role], signer)
+	}
+	return s.signers[role], nil
+}
+
+func (s *fsStore) SaveSigner(role string, signer keys.Signer) error {
+	if err := s.createDirs(); err != nil {
+		return err
+	}
+
+	// Add the key to the existing keys, if any.
+	privateKeys, pass, err := s.loadPrivateKeys(role)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	key, err := signer.MarshalPrivateKey()
+	if err != nil {
+		return err
+	}
+	privateKeys = append(privateKeys, key)
+
+	// A nil passphraseFunc means the keys file isn't encrypted.
+	if pass == nil && s.passphraseFunc != nil {
+		if pass, err = s.passphraseFunc(role, true); err != nil {
+			return err
+		}
+	}
+
+	pk := &persistedKeys{}
+	if pass != nil {
+		if pk.Data, err = encrypted.Marshal(privateKeys, pass); err != nil {
+			return err
+		}
+		pk.Encrypted = true
+	} else if pk.Data, err = json.MarshalIndent(privateKeys, "", "\t"); err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(pk, "", "\t")
+	if err != nil {
+		return err
+	}
+	if err := s.fsys.WriteFile(s.keysPath(role), append(b, '\n'), 0600); err != nil {
+		return err
+	}
+	s.signers[role] = append(s.signers[role], signer)
+	return nil
+}
+
+// loadPrivateKeys loads the keys for a role, along with the passphrase they
+// were decrypted with, if any.
+func (s *fsStore) loadPrivateKeys(role string) ([]*tufData.PrivateKey, []byte, error) {
+	f, err := s.fsys.Open(s.keysPath(role))
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+
+	pk := &persistedKeys{}
+	if err := json.NewDecoder(f).Decode(pk); err != nil {
+		return nil, nil, err
+	}
+
+	var privateKeys []*tufData.PrivateKey
+	if !pk.Encrypted {
+		if err := json.Unmarshal(pk.Data, &privateKeys); err != nil {
+			return nil, nil, err
+		}
+		return privateKeys, nil, nil
+	}
+	if s.passphraseFunc == nil {
+		return nil, nil, tuf.ErrPassphraseRequired{Role: role}
+	}
+
+	// Try the empty passphrase first.
+	pass := []byte("")
+	if err := encrypted.Unmarshal(pk.Data, &privateKeys, pass); err != nil {
+		if pass, err = s.passphraseFunc(role, false); err != nil {
+			return nil, nil, err
+		}
+		if err := encrypted.Unmarshal(pk.Data, &privateKeys, pass); err != nil {
+			return nil, nil, err
+		}
+	}
+	return privateKeys, pass, nil
+}
+
+func (s *fsStore) Clean() error {
+	if ok, err := s.exists(path.Join(s.repoDir(), "root.json")); err != nil {
+		return err
+	} else if !ok {
+		return tuf.ErrNewRepository
+	}
+	if err := s.fsys.RemoveAll(s.stagedDir()); err != nil {
+		return err
+	}
+	return s.fsys.MkdirAll(path.Join(s.stagedDir(), "targets"), 0755)
+}
@@ -0,0 +1,253 @@
+// Copyright 2024 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package repo
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"go.fuchsia.dev/fuchsia/src/sys/pkg/bin/pm/build"
+	"go.fuchsia.dev/fuchsia/src/sys/pkg/lib/far/go"
+	"go.fuchsia.dev/fuchsia/src/sys/pkg/lib/merkle"
+
+	tufData "github.com/theupdateframework/go-tuf/data"
+	tufVerify "github.com/theupdateframework/go-tuf/verify"
+)
+
+// timeNow is available for stubbing in tests.
+var timeNow = time.Now
+
+// Verify checks the consistency of the repository. The metadata must be signed
+// by the keys root.json lists for each role and, unless allowExpired is set,
+// must not have expired. Every target must refer to a package blob with the
+// size and merkle root recorded for it, and every blob the package lists in
+// its meta/contents must be present with the right merkle root. Verify returns
+// every problem it finds. See EnableMerkleCache to avoid hashing unchanged
+// blobs again.
+func (r *Repo) Verify(allowExpired bool) []error {
+	var problems []error
+	problemf := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Errorf(format, args...))
+	}
+
+	signed := map[string]*tufData.Signed{}
+	for _, role := range topLevelMetadata {
+		b, err := fs.ReadFile(r.fsys, path.Join(r.path, "repository", role))
+		if err != nil {
+			problemf("%s: %w", role, err)
+			continue
+		}
+		s := &tufData.Signed{}
+		if err := json.Unmarshal(b, s); err != nil {
+			problemf("%s: %w", role, err)
+			continue
+		}
+		signed[role] = s
+	}
+
+	rootSigned, ok := signed["root.json"]
+	if !ok {
+		return problems
+	}
+	var root tufData.Root
+	if err := json.Unmarshal(rootSigned.Signed, &root); err != nil {
+		return append(problems, fmt.Errorf("root.json: %w", err))
+	}
+	db := tufVerify.NewDB()
+	for id, k := range root.Keys {
+		if err := db.AddKey(id, k); err != nil {
+			problemf("root.json: key %s: %w", id, err)
+		}
+	}
+	for name, role := range root.Roles {
+		if err := db.AddRole(name, role); err != nil {
+			problemf("root.json: role %s: %w", name, err)
+		}
+	}
+
+	for _, name := range topLevelMetadata {
+		s, ok := signed[name]
+		if !ok {
+			continue
+		}
+		role := strings.TrimSuffix(name, ".json")
+		if err := db.VerifyIgnoreExpiredCheck(s, role, 0); err != nil {
+			problemf("%s: signature: %w", name, err)
+		}
+		var meta struct {
+			Expires time.Time `json:"expires"`
+		}
+		if err := json.Unmarshal(s.Signed, &meta); err != nil {
+			problemf("%s: %w", name, err)
+			continue
+		}
+		if !allowExpired && !meta.Expires.After(timeNow()) {
+			problemf("%s: %w", name, tufVerify.ErrExpired{Expired: meta.Expires})
+		}
+	}
+
+	if targetsSigned, ok := signed["targets.json"]; ok {
+		var targets tufData.Targets
+		if err := json.Unmarshal(targetsSigned.Signed, &targets); err != nil {
+			return append(problems, fmt.Errorf("targets.json: %w", err))
+		}
+		names := make([]string, 0, len(targets.Targets))
+		for name := range targets.Targets {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			for _, err := range r.verifyTarget(targets.Targets[name]) {
+				problemf("target %s: %w", name, err)
+			}
+		}
+	}
+
+	return problems
+}
+
+// verifyTarget checks the package blob of a target, and the blobs it lists.
+func (r *Repo) verifyTarget(target tufData.TargetFileMeta) []error {
+	if target.Custom == nil {
+		return nil
+	}
+	var custom customTargetMetadata
+	if err := json.Unmarshal(*target.Custom, &custom); err != nil {
+		return []error{err}
+	}
+	b, err := r.readVerifiedBlob(custom.Merkle)
+	if err != nil {
+		return []error{err}
+	}
+	if int64(len(b)) != custom.Size {
+		return []error{fmt.Errorf("package blob %s is %d bytes, want %d", custom.Merkle, len(b), custom.Size)}
+	}
+
+	metaContents, err := parseMetaContents(b)
+	if err != nil {
+		return []error{fmt.Errorf("package blob %s: %w", custom.Merkle, err)}
+	}
+	paths := make([]string, 0, len(metaContents))
+	for p := range metaContents {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+
+	var problems []error
+	for _, p := range paths {
+		if err := r.verifyBlob(metaContents[p].String()); err != nil {
+			problems = append(problems, fmt.Errorf("%s: %w", p, err))
+		}
+	}
+	return problems
+}
+
+// PackageContents returns the meta/contents of the package whose meta.far
+// has the given merkle root.
+func (r *Repo) PackageContents(root string) (build.MetaContents, error) {
+	b, err := r.readVerifiedBlob(root)
+	if err != nil {
+		return nil, err
+	}
+	contents, err := parseMetaContents(b)
+	if err != nil {
+		return nil, fmt.Errorf("package blob %s: %w", root, err)
+	}
+	return contents, nil
+}
+
+// parseMetaContents parses the meta/contents of the meta.far b.
+func parseMetaContents(b []byte) (build.MetaContents, error) {
+	archive, err := far.NewReader(bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	contents, err := archive.ReadFile("meta/contents")
+	if err != nil {
+		return nil, err
+	}
+	metaContents, err := build.ParseMetaContents(bytes.NewReader(contents))
+	if err != nil {
+		return nil, fmt.Errorf("meta/contents: %w", err)
+	}
+	return metaContents, nil
+}
+
+// verifyBlob checks that the content of the blob with the given merkle root
+// matches the merkle root, without reading the blob if the merkle cache
+// already holds its root.
+func (r *Repo) verifyBlob(root string) error {
+	if _, cached, err := r.statCachedBlob(path.Join(r.blobsDir, root), root); err == nil && cached {
+		return nil
+	}
+	_, err := r.readVerifiedBlob(root)
+	return err
+}
+
+// statCachedBlob stats the blob file at name, if the merkle cache is enabled,
+// and reports whether the cache holds the merkle root root for the file as it
+// is now.
+func (r *Repo) statCachedBlob(name, root string) (fs.FileInfo, bool, error) {
+	if r.merkleCache == nil {
+		return nil, false, nil
+	}
+	info, err := r.fsys.Stat(name)
+	if err != nil {
+		return nil, false, err
+	}
+	return info, r.merkleCache.Cached(name, info, root), nil
+}
+
+// readVerifiedBlob returns the plaintext of the blob with the given merkle
+// root, checking that its content matches the merkle root unless the merkle
+// cache already holds its root.
+func (r *Repo) readVerifiedBlob(root string) ([]byte, error) {
+	name := path.Join(r.blobsDir, root)
+	info, cached, err := r.statCachedBlob(name, root)
+	if err != nil {
+		return nil, fmt.Errorf("blob %s: %w", root, err)
+	}
+	b, err := fs.ReadFile(r.fsys, name)
+	if err != nil {
+		return nil, fmt.Errorf("blob %s: %w", root, err)
+	}
+	if r.encryptionKey != nil {
+		block, err := aes.NewCipher(r.encryptionKey)
+		if err != nil {
+			return nil, err
+		}
+		if len(b) < aes.BlockSize {
+			return nil, fmt.Errorf("blob %s is too short to be encrypted", root)
+		}
+		iv, ciphertext := b[:aes.BlockSize], b[aes.BlockSize:]
+		b = make([]byte, len(ciphertext))
+		cipher.NewCTR(block, iv).XORKeyStream(b, ciphertext)
+	}
+	if cached {
+		return b, nil
+	}
+
+	var tree merkle.Tree
+	if _, err := tree.ReadFrom(bytes.NewReader(b)); err != nil {
+		return nil, err
+	}
+	if r.merkleCache != nil {
+		r.merkleCache.Hashed++
+	}
+	if got := hex.EncodeToString(tree.Root()); got != root {
+		return nil, fmt.Errorf("blob %s has merkle root %s", root, got)
+	}
+	r.merkleCache.Record(name, info, root)
+	return b, nil
+}
@@ -0,0 +1,143 @@
+// Copyright 2024 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package repo
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"go.fuchsia.dev/fuchsia/src/sys/pkg/bin/pm/build"
+
+	tufVerify "github.com/theupdateframework/go-tuf/verify"
+)
+
+// publishTestRepo publishes the test package to a new repository, returning
+// the repository and the package's manifest.
+func publishTestRepo(t *testing.T) (*Repo, string, *build.PackageManifest) {
+	t.Helper()
+	cfg := build.TestConfig()
+	t.Cleanup(func() { os.RemoveAll(filepath.Dir(cfg.TempDir)) })
+	build.BuildTestPackage(cfg)
+	manifestPath := filepath.Join(cfg.OutputDir, "package_manifest.json")
+
+	repoDir := t.TempDir()
+	r, err := New(repoDir, filepath.Join(repoDir, "repository", "blobs"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Init(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.PublishManifest(manifestPath); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.CommitUpdates(false); err != nil {
+		t.Fatal(err)
+	}
+	manifest, err := build.LoadPackageManifest(manifestPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r, repoDir, manifest
+}
+
+func TestVerifyClean(t *testing.T) {
+	r, _, _ := publishTestRepo(t)
+	if problems := r.Verify(false); len(problems) != 0 {
+		t.Errorf("healthy repository: got problems %v", problems)
+	}
+}
+
+func TestVerifyMissingBlob(t *testing.T) {
+	r, repoDir, manifest := publishTestRepo(t)
+
+	var missing []string
+	for _, blob := range manifest.Blobs {
+		if blob.Path == "a" || blob.Path == "dir/c" {
+			missing = append(missing, blob.Merkle.String())
+		}
+	}
+	for _, merkle := range missing {
+		if err := os.Remove(filepath.Join(repoDir, "repository", "blobs", merkle)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	problems := r.Verify(false)
+	if len(problems) != len(missing) {
+		t.Fatalf("got problems %v, want one for each of %v", problems, missing)
+	}
+	for i, err := range problems {
+		if !errors.Is(err, fs.ErrNotExist) || !strings.Contains(err.Error(), missing[i]) {
+			t.Errorf("got %v, want missing blob %s", err, missing[i])
+		}
+	}
+}
+
+func TestVerifyBadSignature(t *testing.T) {
+	r, repoDir, _ := publishTestRepo(t)
+
+	// Change the signed snapshot metadata without re-signing it.
+	snapshotPath := filepath.Join(repoDir, "repository", "snapshot.json")
+	b, err := os.ReadFile(snapshotPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var snapshot struct {
+		Signed     map[string]interface{} `json:"signed"`
+		Signatures json.RawMessage        `json:"signatures"`
+	}
+	if err := json.Unmarshal(b, &snapshot); err != nil {
+		t.Fatal(err)
+	}
+	snapshot.Signed["version"] = 100
+	if b, err = json.Marshal(snapshot); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(snapshotPath, b, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	problems := r.Verify(false)
+	if len(problems) != 1 {
+		t.Fatalf("got problems %v, want one bad signature", problems)
+	}
+	if err := problems[0]; !errors.Is(err, tufVerify.ErrInvalid) || !strings.HasPrefix(err.Error(), "snapshot.json") {
+		t.Errorf("got %v, want bad snapshot.json signature", err)
+	}
+}
+
+func TestVerifyExpiredTimestamp(t *testing.T) {
+	r, _, _ := publishTestRepo(t)
+
+	now := time.Now()
+	if err := r.TimestampWithExpires(now.Add(24 * time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	timeNow = func() time.Time { return now.Add(48 * time.Hour) }
+	defer func() { timeNow = time.Now }()
+
+	problems := r.Verify(false)
+	if len(problems) != 1 {
+		t.Fatalf("got problems %v, want one expired timestamp", problems)
+	}
+	var expired tufVerify.ErrExpired
+	if err := problems[0]; !errors.As(err, &expired) || !strings.HasPrefix(err.Error(), "timestamp.json") {
+		t.Errorf("got %v, want expired timestamp.json", err)
+	}
+
+	if problems := r.Verify(true); len(problems) != 0 {
+		t.Errorf("allowing expired metadata: got problems %v", problems)
+	}
+}
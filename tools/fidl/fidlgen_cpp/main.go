@@ -5,6 +5,8 @@
 package main
 
 import (
+	"log"
+
 	"go.fuchsia.dev/fuchsia/tools/fidl/fidlgen_cpp/codegen"
 	cpp "go.fuchsia.dev/fuchsia/tools/fidl/lib/fidlgen_cpp"
 )
@@ -28,4 +30,7 @@ func main() {
 		"driver/NaturalMessagingHeader", "driver/NaturalMessagingSource",
 		"driver/UnifiedHeader",
 	})
+	if err := flags.WriteZirconUsage(); err != nil {
+		log.Fatalf("Failed to write the zircon usage report: %v", err)
+	}
 }
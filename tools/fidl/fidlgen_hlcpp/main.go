@@ -5,6 +5,7 @@
 package main
 
 import (
+	"log"
 	"text/template"
 
 	"go.fuchsia.dev/fuchsia/tools/fidl/fidlgen_hlcpp/codegen"
@@ -21,4 +22,7 @@ func main() {
 		"GetCodingTables": func() coding_tables.Root { return tables },
 	})
 	generator.GenerateFiles(root, []string{"Header", "Implementation", "TestBase", "CodingTables"})
+	if err := flags.WriteZirconUsage(); err != nil {
+		log.Fatalf("Failed to write the zircon usage report: %v", err)
+	}
 }
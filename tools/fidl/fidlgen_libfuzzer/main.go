@@ -5,6 +5,8 @@
 package main
 
 import (
+	"log"
+
 	"go.fuchsia.dev/fuchsia/tools/fidl/fidlgen_libfuzzer/codegen"
 	cpp "go.fuchsia.dev/fuchsia/tools/fidl/lib/fidlgen_cpp"
 )
@@ -15,4 +17,7 @@ func main() {
 	generator := codegen.NewGenerator(flags)
 	generator.GenerateFiles(root, []string{"Header", "Source",
 		"DecoderEncoderHeader", "DecoderEncoderSource"})
+	if err := flags.WriteZirconUsage(); err != nil {
+		log.Fatalf("Failed to write the zircon usage report: %v", err)
+	}
 }
@@ -6,6 +6,7 @@ package fidlgen_cpp
 
 import (
 	"flag"
+	"fmt"
 	"log"
 	"os"
 	"strings"
@@ -13,13 +14,14 @@ import (
 	"go.fuchsia.dev/fuchsia/tools/fidl/lib/fidlgen"
 )
 
-type experiments []string
+// stringList is a repeatable command-line flag that accumulates its values.
+type stringList []string
 
-func (e *experiments) String() string {
+func (e *stringList) String() string {
 	return strings.Join(*e, ", ")
 }
 
-func (e *experiments) Set(value string) error {
+func (e *stringList) Set(value string) error {
 	*e = append(*e, value)
 	return nil
 }
@@ -35,7 +37,24 @@ type CmdlineFlags struct {
 	// clangFormatPath is the path to the clang-format binary.
 	clangFormatPath string
 	// Experiments is a list of experiments that are enabled.
-	experiments experiments
+	experiments stringList
+	// zirconLibraryAliases is a list of libraries that are mapped like zx.
+	zirconLibraryAliases stringList
+	// zirconSpelling selects the C or C++ spelling of zircon types.
+	zirconSpelling string
+	// zirconWrapperTypes is the deprecated spelling of
+	// --zircon-spelling=cpp.
+	zirconWrapperTypes bool
+	// zirconConstexprConsts renders known zircon constants as constexpr values.
+	zirconConstexprConsts bool
+	// zirconStrictConsts only accepts known zircon constants.
+	zirconStrictConsts bool
+	// zirconAllowlist restricts which zircon names may be referenced.
+	zirconAllowlist stringList
+	// zirconUsageOut is where the zircon identifiers used are reported.
+	zirconUsageOut string
+	// dumpZirconNames prints the known zircon name mappings and exits.
+	dumpZirconNames bool
 
 	// Configuration
 
@@ -43,6 +62,9 @@ type CmdlineFlags struct {
 	name string
 	// validExperiments is the list of supported experiments in this generator
 	validExperiments []string
+	// zirconUsage records the zircon identifiers used, if zirconUsageOut is
+	// set.
+	zirconUsage *ZirconUsageRecorder
 }
 
 // NewCmdlineFlags returns a new instance of CmdlineFlags, which holds the
@@ -61,10 +83,41 @@ func NewCmdlineFlags(name string, validExperiments []string) *CmdlineFlags {
 		flag.Var(&flags.experiments, "experiment",
 			"turn on an experiment, one of: "+strings.Join(validExperiments, ", "))
 	}
+	flag.Var(&flags.zirconLibraryAliases, "zircon-library-alias",
+		"a library to treat as an alias of library zx; may be repeated.")
+	flag.StringVar(&flags.zirconSpelling, "zircon-spelling", "default",
+		"spelling of zircon types, one of: default, c, cpp.")
+	flag.BoolVar(&flags.zirconWrapperTypes, "zircon-wrapper-types", false,
+		"deprecated: use --zircon-spelling=cpp.")
+	flag.BoolVar(&flags.zirconConstexprConsts, "zircon-constexpr-consts", false,
+		"render known zx constants as fidl:: constexpr values instead of ZX_ macros.")
+	flag.BoolVar(&flags.zirconStrictConsts, "zircon-strict-consts", false,
+		"reject all-caps zircon constants that aren't known, rather than assuming a ZX_ macro exists.")
+	flag.Var(&flags.zirconAllowlist, "zircon-allow",
+		"a zircon name, such as Rights, that may be referenced; may be repeated. If unset, all names are allowed.")
+	flag.StringVar(&flags.zirconUsageOut, "zircon-usage-out", "",
+		"path to write a JSON report of the zircon identifiers the bindings use.")
+	flag.BoolVar(&flags.dumpZirconNames, "dump-zircon-names", false,
+		"print all known FIDL to C++ zircon name mappings and exit.")
 
 	return &flags
 }
 
+// parseZirconSpellingFlags returns the ZirconSpelling selected by
+// --zircon-spelling and the deprecated --zircon-wrapper-types, which is kept
+// for the build rules that still pass it and means --zircon-spelling=cpp.
+func parseZirconSpellingFlags(spelling string, wrapperTypes bool) (ZirconSpelling, error) {
+	s, err := ParseZirconSpelling(spelling)
+	if err != nil || !wrapperTypes {
+		return s, err
+	}
+	if s != ZirconDefaultSpelling && s != ZirconCppSpelling {
+		return s, fmt.Errorf("--zircon-wrapper-types can't be combined with --zircon-spelling=%s", spelling)
+	}
+	log.Print("Warning: --zircon-wrapper-types is deprecated, use --zircon-spelling=cpp")
+	return ZirconCppSpelling, nil
+}
+
 func (c *CmdlineFlags) ParseAndLoadIR() fidlgen.Root {
 	flag.Parse()
 	if !flag.Parsed() {
@@ -72,6 +125,25 @@ func (c *CmdlineFlags) ParseAndLoadIR() fidlgen.Root {
 		os.Exit(1)
 	}
 
+	SetZirconLibraryAliases(c.zirconLibraryAliases)
+	spelling, err := parseZirconSpellingFlags(c.zirconSpelling, c.zirconWrapperTypes)
+	if err != nil {
+		log.Fatal(err)
+	}
+	SetZirconSpelling(spelling)
+	SetZirconConstexprConsts(c.zirconConstexprConsts)
+	SetZirconStrictConsts(c.zirconStrictConsts)
+	SetZirconAllowlist(c.zirconAllowlist)
+	if c.zirconUsageOut != "" {
+		c.zirconUsage = NewZirconUsageRecorder()
+		SetZirconUsageRecorder(c.zirconUsage)
+	}
+
+	if c.dumpZirconNames {
+		DumpZirconNames(os.Stdout)
+		os.Exit(0)
+	}
+
 	// Check that --json is specified.
 	if c.json == "" {
 		log.Fatal("Missing required flag: --json")
@@ -108,6 +180,24 @@ func (c *CmdlineFlags) ParseAndLoadIR() fidlgen.Root {
 	return ir.ForBindings(c.name)
 }
 
+// WriteZirconUsage writes the report of the zircon identifiers used, if one was
+// asked for with --zircon-usage-out. Generators call it once the bindings have
+// been generated.
+func (c *CmdlineFlags) WriteZirconUsage() error {
+	if c.zirconUsage == nil {
+		return nil
+	}
+	f, err := os.Create(c.zirconUsageOut)
+	if err != nil {
+		return err
+	}
+	if err := c.zirconUsage.WriteJSON(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
 func (c *CmdlineFlags) ExperimentEnabled(experiment string) bool {
 	for _, e := range c.experiments {
 		if e == experiment {
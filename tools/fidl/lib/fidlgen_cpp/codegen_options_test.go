@@ -0,0 +1,118 @@
+// Copyright 2024 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package fidlgen_cpp
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go.fuchsia.dev/fuchsia/tools/fidl/lib/fidlgentest"
+)
+
+// TestZirconUsageOut runs a generator's command line with --zircon-usage-out
+// and checks the report it writes. It is the only test to parse the command
+// line, as the flags are registered globally.
+func TestZirconUsageOut(t *testing.T) {
+	ir := fidlgentest.EndToEndTest{T: t}.WithDependency(`
+library zx;
+
+type Rights = strict bits : uint32 {
+	READ = 0x4;
+};
+
+alias InstantMono = int64;
+
+const CHANNEL_MAX_MSG_BYTES uint64 = 65536;
+`).Single(`
+library example;
+
+using zx;
+
+type S = struct {
+	rights zx.Rights;
+	deadline zx.InstantMono;
+};
+
+const MAX uint64 = zx.CHANNEL_MAX_MSG_BYTES;
+const READ zx.Rights = zx.Rights.READ;
+`)
+	dir := t.TempDir()
+	irPath := filepath.Join(dir, "example.fidl.json")
+	b, err := json.Marshal(ir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(irPath, b, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	out := filepath.Join(dir, "zircon_usage.json")
+
+	args := os.Args
+	defer func() { os.Args = args }()
+	os.Args = []string{"fidlgen_cpp", "--json", irPath, "--root", dir, "--zircon-usage-out", out}
+	defer SetZirconUsageRecorder(nil)
+
+	flags := NewCmdlineFlags("cpp", nil)
+	Compile(flags.ParseAndLoadIR())
+	if err := flags.WriteZirconUsage(); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `[
+  {
+    "identifier": "zx/CHANNEL_MAX_MSG_BYTES",
+    "kind": "const",
+    "name": "ZX_CHANNEL_MAX_MSG_BYTES"
+  },
+  {
+    "identifier": "zx/InstantMono",
+    "kind": "time",
+    "name": "::fidl::basic_time<ZX_CLOCK_MONOTONIC>"
+  },
+  {
+    "identifier": "zx/Rights",
+    "kind": "type",
+    "name": "zx_rights_t"
+  },
+  {
+    "identifier": "zx/Rights.READ",
+    "kind": "member",
+    "name": "ZX_RIGHT_READ"
+  }
+]
+`
+	assertEqual(t, string(got), want)
+}
+
+func TestParseZirconSpellingFlags(t *testing.T) {
+	for _, tc := range []struct {
+		spelling     string
+		wrapperTypes bool
+		want         ZirconSpelling
+	}{
+		{"default", false, ZirconDefaultSpelling},
+		{"c", false, ZirconCSpelling},
+		{"cpp", false, ZirconCppSpelling},
+		{"default", true, ZirconCppSpelling},
+		{"cpp", true, ZirconCppSpelling},
+	} {
+		got, err := parseZirconSpellingFlags(tc.spelling, tc.wrapperTypes)
+		assertEqual(t, err, nil)
+		assertEqual(t, got, tc.want)
+	}
+
+	if _, err := parseZirconSpellingFlags("c", true); err == nil {
+		t.Error("parseZirconSpellingFlags(c, true) succeeded, want error")
+	}
+	if _, err := parseZirconSpellingFlags("wrapper", false); err == nil {
+		t.Error("parseZirconSpellingFlags(wrapper, false) succeeded, want error")
+	}
+}
@@ -30,12 +30,12 @@ func FieldHandleInformation(val fidlgen.Type, decls fidlgen.DeclInfoMap) *Handle
 		}
 	}
 	if val.Kind == fidlgen.HandleType {
-		subtype, ok := handleSubtypeConsts[val.HandleSubtype]
+		objType, ok := zirconHandleSubtype(val.HandleSubtype)
 		if !ok {
 			panic(fmt.Sprintf("unknown handle type for const: %v", val))
 		}
 		return &HandleInformation{
-			ObjectType: fmt.Sprintf("ZX_OBJ_TYPE_%s", subtype),
+			ObjectType: objType.String(),
 			Rights:     fmt.Sprintf("0x%x", val.HandleRights),
 		}
 	}
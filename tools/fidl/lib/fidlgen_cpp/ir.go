@@ -219,6 +219,9 @@ type Root struct {
 	Decls                    []Kinded
 	Dependencies             []fidlgen.LibraryIdentifier
 	ContainsDriverReferences bool
+	// ZirconIncludes lists the headers of the zircon names the library
+	// references, in the order to include them.
+	ZirconIncludes []string
 }
 
 func (r *Root) declsOfKind(kind declKind) []Kinded {
@@ -487,6 +490,45 @@ type compiler struct {
 	// simplicity.
 	anonymousChildren        map[namingContextKey][]ScopedLayout
 	containsDriverReferences bool
+	// zirconReferences lists the zircon names the library references, whose
+	// headers the generated code includes.
+	zirconReferences []fidlgen.CompoundIdentifier
+	// currentDecl is the declaration being compiled, which diagnostics name.
+	currentDecl fidlgen.EncodedCompoundIdentifier
+	// zirconClock is the clock that clock-generic zircon time types, such as
+	// zx.Instant, are mapped on in the members being compiled. It's taken from
+	// their sibling members' time types.
+	zirconClock string
+}
+
+// setZirconClock sets c.zirconClock to the clock of the zircon time types
+// among aliases, the type aliases of the members of a declaration, and
+// returns a function restoring it. If the members are on different clocks,
+// none is chosen, so that a clock-generic member is reported as having none.
+func (c *compiler) setZirconClock(aliases []*fidlgen.PartialTypeConstructor) (restore func()) {
+	saved := c.zirconClock
+	c.zirconClock = ""
+	for _, alias := range aliases {
+		if alias == nil {
+			continue
+		}
+		clock, ok := zirconTimeClock(alias.Name.Parse())
+		if !ok {
+			continue
+		}
+		if c.zirconClock != "" && c.zirconClock != clock {
+			c.zirconClock = ""
+			break
+		}
+		c.zirconClock = clock
+	}
+	return func() { c.zirconClock = saved }
+}
+
+// zirconNameFailed reports that the declaration being compiled references a
+// zircon name that can't be mapped, as err explains.
+func (c *compiler) zirconNameFailed(err error) {
+	zirconFatalf("%s: %s", c.currentDecl, err)
 }
 
 func (c *compiler) isInExternalLibrary(ci fidlgen.CompoundIdentifier) bool {
@@ -512,7 +554,15 @@ func (c *compiler) compileNameVariants(eci fidlgen.EncodedCompoundIdentifier) na
 	referencingZx := isZirconLibrary(ci.Library)
 	currentlyCompilingZx := isZirconLibrary(c.library)
 	if referencingZx && !currentlyCompilingZx {
-		return commonNameVariants(zirconName(ci))
+		if !IsZirconIdentifier(ci) {
+			c.zirconNameFailed(zirconNameDiagnosis(ci))
+		}
+		zn, err := zirconName(ci)
+		if err != nil {
+			c.zirconNameFailed(err)
+		}
+		c.zirconReferences = append(c.zirconReferences, ci)
+		return commonNameVariants(zn)
 	}
 
 	declInfo, ok := c.decls[ci.EncodeDecl()]
@@ -536,8 +586,21 @@ func (c *compiler) compileCodingTableType(eci fidlgen.EncodedCompoundIdentifier)
 func (c *compiler) compileType(val fidlgen.Type, maybeAlias *fidlgen.PartialTypeConstructor) Type {
 	if maybeAlias != nil {
 		ci := maybeAlias.Name.Parse()
+		// An alias the allowlist excludes mustn't be compiled as the type it
+		// aliases instead.
+		if isZirconLibrary(ci.Library) && !isZirconLibrary(c.library) && !zirconAllowed(ci) {
+			c.zirconNameFailed(newZirconAllowlistError(ci))
+		}
 		name, ok := zirconTime(ci)
+		if isZirconGenericTime(ci) && !isZirconLibrary(c.library) {
+			zt, err := zirconTimeOnClock(ci, c.zirconClock)
+			if err != nil {
+				c.zirconNameFailed(err)
+			}
+			name, ok = zt, true
+		}
 		if ok {
+			c.zirconReferences = append(c.zirconReferences, ci)
 			return Type{
 				nameVariants: nameVariants{
 					HLCPP:   name,
@@ -630,12 +693,12 @@ func (c *compiler) compileType(val fidlgen.Type, maybeAlias *fidlgen.PartialType
 		r.Kind = TypeKinds.Handle
 		r.IsResource = true
 
-		subtype, ok := handleSubtypeConsts[val.HandleSubtype]
+		objType, ok := zirconHandleSubtype(val.HandleSubtype)
 		if !ok {
 			panic(fmt.Sprintf("unknown handle type for const: %v", val))
 		}
-		r.NaturalFieldConstraint = fmt.Sprintf("fidl::internal::NaturalCodingConstraintHandle<ZX_OBJ_TYPE_%s, 0x%x, %t>", subtype, val.HandleRights, val.Nullable)
-		r.WireFieldConstraint = fmt.Sprintf("fidl::internal::WireCodingConstraintHandle<ZX_OBJ_TYPE_%s, 0x%x, %t>", subtype, val.HandleRights, val.Nullable)
+		r.NaturalFieldConstraint = fmt.Sprintf("fidl::internal::NaturalCodingConstraintHandle<%s, 0x%x, %t>", objType, val.HandleRights, val.Nullable)
+		r.WireFieldConstraint = fmt.Sprintf("fidl::internal::WireCodingConstraintHandle<%s, 0x%x, %t>", objType, val.HandleRights, val.Nullable)
 	case fidlgen.EndpointType:
 		p := c.compileNameVariants(val.Protocol)
 		if val.ProtocolTransport == "Driver" {
@@ -814,36 +877,44 @@ func Compile(r fidlgen.Root) *Root {
 	extDecls := make(map[fidlgen.EncodedCompoundIdentifier]Kinded)
 
 	for _, v := range r.Aliases {
+		c.currentDecl = v.Name
 		decls[v.Name] = c.compileAlias(v)
 	}
 
 	for _, v := range r.Bits {
+		c.currentDecl = v.Name
 		decls[v.Name] = c.compileBits(v)
 	}
 
 	for _, v := range r.Consts {
+		c.currentDecl = v.Name
 		decls[v.Name] = c.compileConst(v)
 	}
 
 	for _, v := range r.Enums {
+		c.currentDecl = v.Name
 		decls[v.Name] = c.compileEnum(v)
 	}
 
 	for _, v := range r.Tables {
+		c.currentDecl = v.Name
 		decls[v.Name] = c.compileTable(v)
 	}
 
 	// Note: for results calculation, we must first compile unions, and structs.
 	for _, v := range r.Unions {
+		c.currentDecl = v.Name
 		decls[v.Name] = c.compileUnion(v)
 	}
 
 	for _, v := range r.Structs {
+		c.currentDecl = v.Name
 		c.structs[v.Name] = v
 		decls[v.Name] = c.compileStruct(v)
 	}
 
 	for _, v := range r.ExternalStructs {
+		c.currentDecl = v.Name
 		c.structs[v.Name] = v
 		extDecls[v.Name] = c.compileStruct(v)
 	}
@@ -854,6 +925,7 @@ func Compile(r fidlgen.Root) *Root {
 	// rather than the entire, flattenable declaration with all of its members.
 	for _, v := range r.Libraries {
 		for name, decl := range v.Decls {
+			c.currentDecl = name
 			if decl.Type == fidlgen.TableDeclType {
 				extDecls[name] = &TableName{nameVariants: c.compileNameVariants(name)}
 			} else if decl.Type == fidlgen.UnionDeclType {
@@ -863,6 +935,7 @@ func Compile(r fidlgen.Root) *Root {
 	}
 
 	for _, v := range r.Protocols {
+		c.currentDecl = v.Name
 		for _, m := range v.Methods {
 			if m.HasResultUnion() {
 				var p Payloader
@@ -898,6 +971,7 @@ func Compile(r fidlgen.Root) *Root {
 	}
 
 	for _, v := range r.Protocols {
+		c.currentDecl = v.Name
 		if p := c.compileProtocol(v); p != nil {
 			_, isDriver := v.Transports()["Driver"]
 			if isDriver {
@@ -908,6 +982,7 @@ func Compile(r fidlgen.Root) *Root {
 	}
 
 	for _, v := range r.Services {
+		c.currentDecl = v.Name
 		decls[v.Name] = c.compileService(v)
 	}
 
@@ -925,7 +1000,7 @@ func Compile(r fidlgen.Root) *Root {
 			// We don't need to include our own header.
 			continue
 		}
-		if l.Name == "zx" {
+		if isZirconLibrary(l.Name.Parse()) {
 			// Skip the zircon types library.
 			continue
 		}
@@ -944,6 +1019,7 @@ func Compile(r fidlgen.Root) *Root {
 	}
 	sort.Sort(sort.StringSlice(handleTypes))
 	root.HandleTypes = handleTypes
+	root.ZirconIncludes = zirconIncludes(c.zirconReferences)
 
 	root.ContainsDriverReferences = c.containsDriverReferences
 
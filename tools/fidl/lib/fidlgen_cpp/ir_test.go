@@ -5,6 +5,7 @@
 package fidlgen_cpp
 
 import (
+	"fmt"
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
@@ -188,3 +189,127 @@ func TestAnonymousLayoutAliases(t *testing.T) {
 		})
 	}
 }
+
+func TestCompileHandleCodingConstraint(t *testing.T) {
+	root := Compile(fidlgentest.EndToEndTest{T: t}.Single(`
+library example;
+
+type obj_type = strict enum : uint32 {
+	NONE = 0;
+	VMO = 3;
+};
+
+resource_definition handle : uint32 {
+	properties {
+		subtype obj_type;
+	};
+};
+
+type S = resource struct {
+	h handle:VMO;
+};
+`))
+	var s *Struct
+	for _, decl := range root.Decls {
+		if d, ok := decl.(*Struct); ok {
+			s = d
+		}
+	}
+	if s == nil || len(s.Members) != 1 {
+		t.Fatal("Must have a single struct with a single member defined")
+	}
+	m := s.Members[0]
+	expectEqual(t, m.NaturalConstraint, "fidl::internal::NaturalCodingConstraintHandle<ZX_OBJ_TYPE_VMO, 0x80000000, false>")
+	expectEqual(t, m.WireConstraint, "fidl::internal::WireCodingConstraintHandle<ZX_OBJ_TYPE_VMO, 0x80000000, false>")
+}
+
+func TestCompileClockGenericZirconTime(t *testing.T) {
+	ir := fidlgentest.EndToEndTest{T: t}.WithDependency(`
+library zx;
+
+alias InstantBoot = int64;
+alias Instant = int64;
+`).Single(`
+library example;
+
+using zx;
+
+type S = struct {
+	boot zx.InstantBoot;
+	at zx.Instant;
+};
+`)
+	root := Compile(ir)
+	var s *Struct
+	for _, decl := range root.Decls {
+		if d, ok := decl.(*Struct); ok {
+			s = d
+		}
+	}
+	if s == nil || len(s.Members) != 2 {
+		t.Fatal("Must have a single struct with two members defined")
+	}
+	// zx.Instant is on the clock of its sibling zx.InstantBoot.
+	expectEqual(t, s.Members[1].Type.Unified.String(), s.Members[0].Type.Unified.String())
+	expectEqual(t, s.Members[1].Type.Unified.String(), "::fidl::basic_time<ZX_CLOCK_BOOT>")
+}
+
+func TestCompileUnmappableZirconName(t *testing.T) {
+	defer func(f func(string, ...interface{})) { zirconFatalf = f }(zirconFatalf)
+	zirconFatalf = func(format string, a ...interface{}) {
+		panic(fmt.Sprintf(format, a...))
+	}
+	defer SetZirconAllowlist(nil)
+
+	for _, tc := range []struct {
+		name      string
+		allowlist []string
+		member    string
+		want      string
+	}{
+		{
+			name:   "unknown",
+			member: "u zx.Unknown;",
+			want:   "example/S: zircon identifier zx/Unknown is not a known zircon name",
+		},
+		{
+			name:      "not allowed",
+			allowlist: []string{"Rights"},
+			member:    "deadline zx.InstantMono;",
+			want:      "example/S: zircon identifier zx/InstantMono is not in the zircon allowlist",
+		},
+		{
+			name:   "no clock",
+			member: "at zx.Instant;",
+			want:   "example/S: zircon identifier zx/Instant is the clock-generic time type Instant, and no clock was given; valid clocks are Boot, Mono",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ir := fidlgentest.EndToEndTest{T: t}.WithDependency(`
+library zx;
+
+type Unknown = strict enum : uint32 {
+	A = 1;
+};
+
+alias InstantMono = int64;
+alias Instant = int64;
+`).Single(`
+library example;
+
+using zx;
+
+type S = struct {
+	` + tc.member + `
+};
+`)
+			SetZirconAllowlist(tc.allowlist)
+			var got interface{}
+			func() {
+				defer func() { got = recover() }()
+				Compile(ir)
+			}()
+			assertEqual(t, got, tc.want)
+		})
+	}
+}
@@ -482,6 +482,19 @@ func (n name) appendNamespace(part string) name {
 	return name{name: n.name, ns: n.ns.append(part)}
 }
 
+// makeTemplateName is like makeName, but also accepts a template
+// instantiation such as "fidl::basic_time<ZX_CLOCK_MONOTONIC>". The namespace
+// is split off the template itself, so the arguments may contain "::", and
+// Self returns the template's name without its arguments.
+func makeTemplateName(n string) name {
+	i := strings.Index(n, "<")
+	if i == -1 || !strings.HasSuffix(n, ">") {
+		return makeName(n)
+	}
+	t := makeName(n[:i])
+	return name{name: t.name.template(n[i+1 : len(n)-1]), ns: t.ns}
+}
+
 // makeTupleName returns a Name for a std::tuple of the supplied names.
 func makeTupleName(members []name) name {
 	t := makeName("std::tuple")
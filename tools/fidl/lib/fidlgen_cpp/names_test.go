@@ -31,3 +31,20 @@ func TestName(t *testing.T) {
 	assertEqual(t, tmpl_nest.String(), "::foo::bar::Baz<::hello::World>::Inner")
 
 }
+
+func TestMakeTemplateName(t *testing.T) {
+	plain := makeTemplateName("fidl::Foo")
+	assertEqual(t, plain.String(), "::fidl::Foo")
+	assertEqual(t, plain.Self(), "Foo")
+
+	tmpl := makeTemplateName("fidl::basic_time<ZX_CLOCK_MONOTONIC>")
+	assertEqual(t, tmpl.String(), "::fidl::basic_time<ZX_CLOCK_MONOTONIC>")
+	assertEqual(t, tmpl.NoLeading(), "fidl::basic_time<ZX_CLOCK_MONOTONIC>")
+	assertEqual(t, tmpl.Name(), "basic_time<ZX_CLOCK_MONOTONIC>")
+	assertEqual(t, tmpl.Self(), "basic_time")
+	assertEqual(t, tmpl.Namespace(), namespace([]string{"fidl"}))
+
+	qualifiedArg := makeTemplateName("fidl::basic_time<zx::clock::monotonic>")
+	assertEqual(t, qualifiedArg.String(), "::fidl::basic_time<zx::clock::monotonic>")
+	assertEqual(t, qualifiedArg.Self(), "basic_time")
+}
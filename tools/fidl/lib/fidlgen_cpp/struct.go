@@ -173,6 +173,11 @@ func (c *compiler) compileStruct(val fidlgen.Struct) *Struct {
 		PaddingV2:  val.BuildPaddingMarkers(fidlgen.PaddingConfig{}),
 	}
 
+	var aliases []*fidlgen.PartialTypeConstructor
+	for _, v := range val.Members {
+		aliases = append(aliases, v.MaybeFromAlias)
+	}
+	defer c.setZirconClock(aliases)()
 	for _, v := range val.Members {
 		r.Members = append(r.Members, c.compileStructMember(v))
 	}
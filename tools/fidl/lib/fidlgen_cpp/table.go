@@ -139,6 +139,11 @@ func (c *compiler) compileTable(val fidlgen.Table) *Table {
 		WireTableExternalBuilder: WireTableExternalBuilder.template(name.Wire),
 	}
 
+	var aliases []*fidlgen.PartialTypeConstructor
+	for _, v := range val.Members {
+		aliases = append(aliases, v.MaybeFromAlias)
+	}
+	defer c.setZirconClock(aliases)()
 	for i, v := range val.Members {
 		m := c.compileTableMember(v, i)
 		if m.Ordinal > r.BiggestOrdinal {
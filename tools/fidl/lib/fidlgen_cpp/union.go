@@ -111,6 +111,11 @@ func (c *compiler) compileUnion(val fidlgen.Union) *Union {
 			BackingBufferType(),
 	}
 
+	var aliases []*fidlgen.PartialTypeConstructor
+	for _, mem := range val.Members {
+		aliases = append(aliases, mem.MaybeFromAlias)
+	}
+	defer c.setZirconClock(aliases)()
 	naturalIndex := 1
 	for _, mem := range val.Members {
 		name := unionMemberContext.transform(mem.Name)
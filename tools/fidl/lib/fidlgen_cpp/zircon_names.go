@@ -5,103 +5,1603 @@
 package fidlgen_cpp
 
 import (
+	"encoding/json"
 	"fmt"
+	"io"
+	"log"
+	"sort"
 	"strings"
+	"unicode"
 
 	"go.fuchsia.dev/fuchsia/tools/fidl/lib/fidlgen"
 )
 
 type zxName = struct {
+	// typeName is the plain C spelling of the type, e.g. zx_rights_t.
 	typeName string
-	prefix   string
+	// cppTypeName, if set, is a strongly-typed C++ wrapper spelling of the
+	// type, e.g. fidl::basic_rights<zx_rights_t>.
+	cppTypeName string
+	prefix      string
+	// include is the header that declares typeName and the prefix macros.
+	include string
+	// cppInclude is the header that declares cppTypeName.
+	cppInclude string
+	// isStruct is true for struct types, which have fields rather than value
+	// members.
+	isStruct bool
+	// members, if set, lists the only valid (normalized) value members.
+	// Otherwise any member is accepted and mapped by prefix.
+	members []string
+	// memberCasing is how value members are spelled after the prefix. Out of
+	// tree headers may spell their macros other than in upper case.
+	memberCasing zirconCasing
+}
+
+// zirconCasing is how the member part of a value member macro is spelled.
+type zirconCasing int
+
+const (
+	// zirconUpperCase spells members in upper snake case, as zx does:
+	// Rights.sameRights is ZX_RIGHT_SAME_RIGHTS.
+	zirconUpperCase zirconCasing = iota
+	// zirconLowerCase spells members in lower snake case: Rights.sameRights
+	// is <prefix>_same_rights.
+	zirconLowerCase
+	// zirconPreserveCase spells members as the reference does, for mixed
+	// case macros: Rights.sameRights is <prefix>_sameRights.
+	zirconPreserveCase
+)
+
+func (c zirconCasing) String() string {
+	switch c {
+	case zirconUpperCase:
+		return "upper"
+	case zirconLowerCase:
+		return "lower"
+	case zirconPreserveCase:
+		return "preserve"
+	}
+	return fmt.Sprintf("zirconCasing(%d)", int(c))
+}
+
+// spell spells the member that normalizeZirconMember normalized to
+// normalized, as written in the reference.
+func (c zirconCasing) spell(written, normalized string) string {
+	switch c {
+	case zirconLowerCase:
+		return strings.ToLower(normalized)
+	case zirconPreserveCase:
+		return written
+	}
+	return normalized
 }
 
 var zirconNames = map[string]zxName{
 	"Rights": {
-		typeName: "zx_rights_t",
-		prefix:   "ZX_RIGHT",
+		typeName:    "zx_rights_t",
+		include:     "<zircon/types.h>",
+		cppTypeName: "fidl::basic_rights<zx_rights_t>",
+		cppInclude:  "<lib/fidl/cpp/zircon.h>",
+		prefix:      "ZX_RIGHT",
+		// The rights of <zircon/rights.h>, so that a misspelled right fails
+		// rather than naming a macro that doesn't exist.
+		members: []string{
+			"APPLY_PROFILE",
+			"ATTACH_VMO",
+			"BASIC",
+			"DESTROY",
+			"DUPLICATE",
+			"ENUMERATE",
+			"EXECUTE",
+			"GET_POLICY",
+			"GET_PROPERTY",
+			"INSPECT",
+			"IO",
+			"MANAGE_JOB",
+			"MANAGE_PROCESS",
+			"MANAGE_SOCKET",
+			"MANAGE_THREAD",
+			"MANAGE_VMO",
+			"MAP",
+			"NONE",
+			"OP_CHILDREN",
+			"POLICY",
+			"PROPERTY",
+			"READ",
+			"RESIZE",
+			"SAME_RIGHTS",
+			"SET_POLICY",
+			"SET_PROPERTY",
+			"SIGNAL",
+			"SIGNAL_PEER",
+			"TRANSFER",
+			"WAIT",
+			"WRITE",
+		},
 	},
 	"ObjType": {
-		typeName: "zx_obj_type_t",
-		prefix:   "ZX_OBJ_TYPE",
+		typeName:    "zx_obj_type_t",
+		include:     "<zircon/types.h>",
+		cppTypeName: "fidl::basic_obj_type<zx_obj_type_t>",
+		cppInclude:  "<lib/fidl/cpp/zircon.h>",
+		prefix:      "ZX_OBJ_TYPE",
+	},
+	// Handle subtypes are object types, so members such as
+	// zx.HandleSubtype.channel render as ZX_OBJ_TYPE_CHANNEL.
+	"HandleSubtype": {
+		typeName:    "zx_obj_type_t",
+		include:     "<zircon/types.h>",
+		cppTypeName: "fidl::basic_obj_type<zx_obj_type_t>",
+		cppInclude:  "<lib/fidl/cpp/zircon.h>",
+		prefix:      "ZX_OBJ_TYPE",
+	},
+	// Resource kinds, from zircon/syscalls/resource.h, e.g. ZX_RSRC_KIND_ROOT.
+	"ResourceKind": {
+		typeName: "zx_rsrc_kind_t",
+		include:  "<zircon/syscalls/resource.h>",
+		prefix:   "ZX_RSRC_KIND",
+	},
+	"Rsrc": {
+		typeName: "zx_rsrc_kind_t",
+		include:  "<zircon/syscalls/resource.h>",
+		prefix:   "ZX_RSRC_KIND",
+	},
+	"Signals": {
+		typeName: "zx_signals_t",
+		include:  "<zircon/types.h>",
+		prefix:   "ZX_SIGNAL",
+	},
+	"ExceptionType": {
+		typeName: "zx_excp_type_t",
+		include:  "<zircon/syscalls/exception.h>",
+		prefix:   "ZX_EXCP",
+	},
+	// Port packets carry their type in a plain uint32_t field; there is no
+	// typedef for it in the C API.
+	"PacketType": {
+		typeName: "uint32_t",
+		include:  "<zircon/syscalls/port.h>",
+		prefix:   "ZX_PKT_TYPE",
+	},
+	"FeatureKind": {
+		typeName: "zx_feature_kind_t",
+		include:  "<zircon/features.h>",
+		prefix:   "ZX_FEATURE_KIND",
+		members: []string{
+			"ADDRESS_TAGGING",
+			"CPU",
+			"HW_BREAKPOINT_COUNT",
+			"HW_WATCHPOINT_COUNT",
+			"VM",
+		},
+	},
+	"SystemPowerState": {
+		typeName: "zx_system_power_state_t",
+		include:  "<zircon/syscalls/system.h>",
+		prefix:   "ZX_SYSTEM_POWER_STATE",
+		members: []string{
+			"REBOOT",
+			"REBOOT_BOOTLOADER",
+			"REBOOT_RECOVERY",
+			"SHUTDOWN",
+		},
+	},
+	// Scheduling profiles. Priorities are plain int32_t values in
+	// zx_profile_info_t, with named classes such as ZX_PRIORITY_DEFAULT.
+	"Priority": {
+		typeName: "int32_t",
+		include:  "<zircon/syscalls/profile.h>",
+		prefix:   "ZX_PRIORITY",
+		members: []string{
+			"DEFAULT",
+			"HIGH",
+			"HIGHEST",
+			"LOW",
+			"LOWEST",
+		},
+	},
+	"ProfileInfo": {
+		typeName: "zx_profile_info_t",
+		include:  "<zircon/syscalls/profile.h>",
+		isStruct: true,
+	},
+	"CpuSet": {
+		typeName: "zx_cpu_set_t",
+		include:  "<zircon/syscalls/profile.h>",
+		isStruct: true,
+	},
+	// Interrupt options are passed as a plain uint32_t; there is no typedef
+	// for them in the C API.
+	"InterruptFlags": {
+		typeName: "uint32_t",
+		include:  "<zircon/types.h>",
+		prefix:   "ZX_INTERRUPT",
+		members: []string{
+			"MODE_DEFAULT",
+			"MODE_EDGE_BOTH",
+			"MODE_EDGE_HIGH",
+			"MODE_EDGE_LOW",
+			"MODE_LEVEL_HIGH",
+			"MODE_LEVEL_LOW",
+			"REMAP_IRQ",
+			"TIMESTAMP_MONO",
+			"VIRTUAL",
+			"WAKE_VECTOR",
+		},
+	},
+	// VMO child options, passed to zx_vmo_create_child as a plain uint32_t;
+	// there is no typedef for them in the C API. Their macros are spelled
+	// ZX_VMO_CHILD_*, unlike the ZX_VMO_* options of zx_vmo_create.
+	"VmoChildOptions": {
+		typeName: "uint32_t",
+		include:  "<zircon/types.h>",
+		prefix:   "ZX_VMO_CHILD",
+		members: []string{
+			"NO_WRITE",
+			"REFERENCE",
+			"RESIZABLE",
+			"SLICE",
+			"SNAPSHOT",
+			"SNAPSHOT_AT_LEAST_ON_WRITE",
+			"SNAPSHOT_MODIFIED",
+		},
+	},
+	// IOBs, from zircon/syscalls/iob.h.
+	"IobAccess": {
+		typeName: "zx_iob_access_t",
+		include:  "<zircon/syscalls/iob.h>",
+		prefix:   "ZX_IOB_ACCESS",
+		members: []string{
+			"EP0_CAN_MAP_READ",
+			"EP0_CAN_MAP_WRITE",
+			"EP0_CAN_MEDIATED_READ",
+			"EP0_CAN_MEDIATED_WRITE",
+			"EP1_CAN_MAP_READ",
+			"EP1_CAN_MAP_WRITE",
+			"EP1_CAN_MEDIATED_READ",
+			"EP1_CAN_MEDIATED_WRITE",
+		},
 	},
+	"IobDisciplineType": {
+		typeName: "zx_iob_discipline_type_t",
+		include:  "<zircon/syscalls/iob.h>",
+		prefix:   "ZX_IOB_DISCIPLINE_TYPE",
+		members: []string{
+			"ID_ALLOCATOR",
+			"MEDIATED_WRITE_RING_BUFFER",
+			"NONE",
+		},
+	},
+	"IobRegionType": {
+		typeName: "zx_iob_region_type_t",
+		include:  "<zircon/syscalls/iob.h>",
+		prefix:   "ZX_IOB_REGION_TYPE",
+		members: []string{
+			"PRIVATE",
+			"SHARED",
+		},
+	},
+	// Address and offset scalars, used by MMU and IOMMU APIs. Scalars have no
+	// prefix, since they have no value members.
+	"Vaddr": {
+		typeName: "zx_vaddr_t",
+		include:  "<zircon/types.h>",
+	},
+	"Paddr": {
+		typeName: "zx_paddr_t",
+		include:  "<zircon/types.h>",
+	},
+	"Gpaddr": {
+		typeName: "zx_gpaddr_t",
+		include:  "<zircon/types.h>",
+	},
+	"Off": {
+		typeName: "zx_off_t",
+		include:  "<zircon/types.h>",
+	},
+}
+
+// ZirconSpelling selects between the C and C++ spellings of zircon types.
+type ZirconSpelling int
+
+const (
+	// ZirconDefaultSpelling uses C++ wrappers for time types, which need them
+	// to carry their clock, and plain C names for everything else.
+	ZirconDefaultSpelling ZirconSpelling = iota
+	// ZirconCSpelling uses plain C names, such as zx_rights_t, throughout.
+	ZirconCSpelling
+	// ZirconCppSpelling uses C++ wrappers, such as
+	// fidl::basic_rights<zx_rights_t>, wherever one exists.
+	ZirconCppSpelling
+)
+
+var zirconSpellingNames = map[string]ZirconSpelling{
+	"default": ZirconDefaultSpelling,
+	"c":       ZirconCSpelling,
+	"cpp":     ZirconCppSpelling,
+}
+
+// zirconSpelling is the spelling used for zircon types.
+var zirconSpelling = ZirconDefaultSpelling
+
+// SetZirconSpelling selects how zircon types are spelled. Value members, such
+// as zx.Rights.READ, always render as the underlying macros.
+func SetZirconSpelling(spelling ZirconSpelling) {
+	zirconSpelling = spelling
+}
+
+// ParseZirconSpelling parses the name of a ZirconSpelling: "default", "c", or
+// "cpp".
+func ParseZirconSpelling(s string) (ZirconSpelling, error) {
+	if spelling, ok := zirconSpellingNames[s]; ok {
+		return spelling, nil
+	}
+	return ZirconDefaultSpelling, fmt.Errorf("unknown zircon spelling %q, must be one of %s",
+		s, strings.Join(sortedKeys(zirconSpellingNames), ", "))
+}
+
+// spell returns the spelling of zn to emit. preferCpp is true for types whose
+// default spelling is the C++ wrapper.
+func (s ZirconSpelling) spell(zn zxName, preferCpp bool) string {
+	if s.usesCpp(zn, preferCpp) {
+		return zn.cppTypeName
+	}
+	return zn.typeName
+}
+
+// usesCpp reports whether spell picks the C++ spelling of zn.
+func (s ZirconSpelling) usesCpp(zn zxName, preferCpp bool) bool {
+	useCpp := s == ZirconCppSpelling || (s == ZirconDefaultSpelling && preferCpp)
+	return (useCpp && zn.cppTypeName != "") || zn.typeName == ""
+}
+
+// ZirconTypeSpelling describes a zircon type or time type being formatted by a
+// ZirconNameFormatter.
+type ZirconTypeSpelling struct {
+	// Name is the canonical FIDL name of the type, e.g. "Rights".
+	Name string
+	// C is the C spelling, e.g. "zx_rights_t".
+	C string
+	// Cpp is the C++ wrapper spelling, or "" if the type has none.
+	Cpp string
+	// Time is true for time types, such as InstantMono.
+	Time bool
+}
+
+// ZirconNameFormatter produces the final spelling of zircon types and time
+// types, so that binding flavors can spell the same type differently. Value
+// members and constants are not affected.
+type ZirconNameFormatter interface {
+	FormatZirconType(t ZirconTypeSpelling) string
+}
+
+// defaultZirconNameFormatter spells types according to the configured
+// ZirconSpelling.
+type defaultZirconNameFormatter struct{}
+
+func (defaultZirconNameFormatter) FormatZirconType(t ZirconTypeSpelling) string {
+	return zirconSpelling.spell(zxName{typeName: t.C, cppTypeName: t.Cpp}, t.Time)
+}
+
+var zirconNameFormatter ZirconNameFormatter = defaultZirconNameFormatter{}
+
+// SetZirconNameFormatter installs f to format zircon types. Passing nil
+// restores the default formatter.
+func SetZirconNameFormatter(f ZirconNameFormatter) {
+	if f == nil {
+		f = defaultZirconNameFormatter{}
+	}
+	zirconNameFormatter = f
+}
+
+func formatZirconType(n string, zn zxName, time bool) name {
+	return makeTemplateName(zirconNameFormatter.FormatZirconType(ZirconTypeSpelling{
+		Name: n,
+		C:    zn.typeName,
+		Cpp:  zn.cppTypeName,
+		Time: time,
+	}))
+}
+
+// zirconClockInstant returns the time type of instants on the clock with the
+// given ID, spelled typeName in C. The clock ID, such as ZX_CLOCK_MONOTONIC,
+// is the template argument of the C++ wrapper.
+func zirconClockInstant(typeName, clockID string) zxName {
+	return zxName{
+		typeName:    typeName,
+		include:     "<zircon/time.h>",
+		cppTypeName: fmt.Sprintf("fidl::basic_time<%s>", clockID),
+		cppInclude:  "<lib/fidl/cpp/time.h>",
+	}
+}
+
+// zirconClockTicks is like zirconClockInstant, for the ticks of the clock.
+func zirconClockTicks(typeName, clockID string) zxName {
+	zn := zirconClockInstant(typeName, clockID)
+	zn.cppTypeName = fmt.Sprintf("fidl::basic_ticks<%s>", clockID)
+	return zn
 }
 
 var zirconTimes = map[string]zxName{
-	"InstantMono": {
-		typeName: "fidl::basic_time<ZX_CLOCK_MONOTONIC>",
+	"InstantMono":      zirconClockInstant("zx_instant_mono_t", "ZX_CLOCK_MONOTONIC"),
+	"InstantBoot":      zirconClockInstant("zx_instant_boot_t", "ZX_CLOCK_BOOT"),
+	"InstantMonoTicks": zirconClockTicks("zx_instant_mono_ticks_t", "ZX_CLOCK_MONOTONIC"),
+	"InstantBootTicks": zirconClockTicks("zx_instant_boot_ticks_t", "ZX_CLOCK_BOOT"),
+	// Ticks isn't tied to a particular clock, so it has no C++ wrapper.
+	"Ticks": {
+		typeName: "zx_ticks_t",
+		include:  "<zircon/types.h>",
 		prefix:   "",
 	},
-	"InstantBoot": {
-		typeName: "fidl::basic_time<ZX_CLOCK_BOOT>",
-		prefix:   "",
+}
+
+// zirconGenericTimes maps clock-generic time types, which don't name their
+// clock, to the time types they specialize to, by clock name. zx.Instant on
+// the Mono clock is zx.InstantMono.
+var zirconGenericTimes = map[string]map[string]string{
+	"Instant": {
+		"Boot": "InstantBoot",
+		"Mono": "InstantMono",
 	},
-	"InstantMonoTicks": {
-		typeName: "fidl::basic_ticks<ZX_CLOCK_MONOTONIC>",
-		prefix:   "",
+}
+
+// zirconLibraryAliases holds the names of libraries, other than zx itself,
+// whose references are mapped as if they were references to library zx.
+var zirconLibraryAliases = map[fidlgen.EncodedLibraryIdentifier]struct{}{}
+
+// SetZirconLibraryAliases configures additional libraries (e.g. "zircon" or
+// "fuchsia.zx") that are treated as aliases of library zx. Passing no aliases
+// restores the default, where only zx itself is recognized.
+func SetZirconLibraryAliases(aliases []string) {
+	zirconLibraryAliases = map[fidlgen.EncodedLibraryIdentifier]struct{}{}
+	for _, a := range aliases {
+		zirconLibraryAliases[fidlgen.EncodedLibraryIdentifier(a)] = struct{}{}
+	}
+}
+
+// zirconDurationUnits maps the zx duration unit constants to the function-like
+// macros that construct durations of that unit. Referenced as a constant, a
+// unit denotes a duration of exactly one of that unit, e.g. zx.MSEC is
+// ZX_MSEC(1).
+var zirconDurationUnits = map[string]string{
+	"NSEC": "ZX_NSEC",
+	"USEC": "ZX_USEC",
+	"MSEC": "ZX_MSEC",
+	"SEC":  "ZX_SEC",
+	"MIN":  "ZX_MIN",
+	"HOUR": "ZX_HOUR",
+}
+
+// zirconConstexprConsts maps zx constants to constexpr equivalents in the fidl
+// namespace, for use when generated code must avoid the ZX_ macros.
+var zirconConstexprConsts = map[string]string{
+	"CHANNEL_MAX_MSG_BYTES":   "fidl::kChannelMaxMsgBytes",
+	"CHANNEL_MAX_MSG_HANDLES": "fidl::kChannelMaxMsgHandles",
+	"HANDLE_INVALID":          "fidl::kHandleInvalid",
+}
+
+// zirconKnownConsts lists the zx constants that are accepted in strict
+// constant mode, in addition to zirconDurationUnits and zirconConstexprConsts.
+var zirconKnownConsts = map[string]struct{}{
+	"CPRNG_ADD_ENTROPY_MAX_LEN": {},
+	"CPRNG_DRAW_MAX_LEN":        {},
+	"DEFAULT_CHANNEL_RIGHTS":    {},
+	"KOID_INVALID":              {},
+	"KOID_KERNEL":               {},
+	"MAX_NAME_LEN":              {},
+	"TIME_INFINITE":             {},
+	"TIME_INFINITE_PAST":        {},
+}
+
+// zirconStrictConsts controls whether zirconConst only accepts known constants
+// rather than any all-caps name.
+var zirconStrictConsts = false
+
+// SetZirconStrictConsts enables or disables strict constant mode. By default
+// any all-caps name, such as zx.SOME_CONSTANT, maps to the corresponding ZX_
+// macro, so a typo only shows up when the generated code fails to compile. In
+// strict mode only known constants are accepted.
+func SetZirconStrictConsts(enabled bool) {
+	zirconStrictConsts = enabled
+}
+
+// zirconConstexpr controls whether constants in zirconConstexprConsts render
+// as their constexpr equivalents rather than as ZX_ macros.
+var zirconConstexpr = false
+
+// SetZirconConstexprConsts enables or disables rendering of known zx constants
+// such as zx.CHANNEL_MAX_MSG_BYTES as fidl:: constexpr values instead of their
+// ZX_ macros. Constants without a constexpr equivalent always use the macro.
+func SetZirconConstexprConsts(enabled bool) {
+	zirconConstexpr = enabled
+}
+
+// zirconAllowlist, if non-nil, holds the only zircon names that may be
+// referenced. Names are matched against the canonical spelling of the
+// identifier's name, so allowing Rights also allows zx.rights and its value
+// members, such as Rights.READ.
+var zirconAllowlist map[string]struct{}
+
+// SetZirconAllowlist restricts references into zircon-family libraries to the
+// given names, e.g. "Rights" or "CHANNEL_MAX_MSG_BYTES". Passing no names
+// removes the restriction.
+func SetZirconAllowlist(names []string) {
+	if len(names) == 0 {
+		zirconAllowlist = nil
+		return
+	}
+	zirconAllowlist = map[string]struct{}{}
+	for _, n := range names {
+		zirconAllowlist[n] = struct{}{}
+	}
+}
+
+// zirconAllowed reports whether the allowlist lets ci be referenced. Every
+// way of mapping a zircon name checks it, so that no spelling or kind of name
+// gets around the allowlist.
+func zirconAllowed(ci fidlgen.CompoundIdentifier) bool {
+	if zirconAllowlist == nil {
+		return true
+	}
+	_, ok := zirconAllowlist[canonicalZirconName(ci)]
+	return ok
+}
+
+// canonicalZirconName returns the canonical spelling of the name of ci, that
+// of the type, time type or clock-generic time type it names, or the name as
+// it is for constants and names that aren't known.
+func canonicalZirconName(ci fidlgen.CompoundIdentifier) string {
+	n := string(ci.Name)
+	lib, ok := lookupZirconLibrary(ci.Library)
+	if !ok {
+		return n
+	}
+	if canonical, ok := findZirconType(lib, n); ok {
+		return canonical
+	}
+	if canonical, ok := findZirconTime(lib, n); ok {
+		return canonical
+	}
+	if canonical, ok := findZirconGenericTime(lib, n); ok {
+		return canonical
+	}
+	return n
+}
+
+// newZirconAllowlistError returns the error for ci being left out of the
+// allowlist.
+func newZirconAllowlistError(ci fidlgen.CompoundIdentifier) *ZirconNameError {
+	return newZirconNameError(ci, "is not in the zircon allowlist")
+}
+
+// zirconFunctionMacros lists all-caps zx names whose ZX_ macro is function-like
+// and takes arguments that can't be inferred, so it can't be used as a
+// constant.
+var zirconFunctionMacros = map[string]struct{}{
+	"CLOCK_ARGS_VERSION": {},
+	"EXCP_IS_ARCH":       {},
+	"PKT_IS_EXCEPTION":   {},
+	"PKT_IS_SIGNAL_ONE":  {},
+	"PKT_IS_USER":        {},
+	"PKT_TYPE_EXCEPTION": {},
+}
+
+// zirconMemberFamily routes value members carrying a qualifier to a macro
+// family other than their type's prefix.
+type zirconMemberFamily struct {
+	// qualifier is the normalized member prefix that selects the family,
+	// including its trailing separator, e.g. "USER_".
+	qualifier string
+	// prefix replaces both the type's prefix and the qualifier.
+	prefix string
+}
+
+// zirconMemberFamilies maps type names to the qualified member families they
+// have. User signals are ZX_USER_SIGNAL_0, not ZX_SIGNAL_USER_0.
+var zirconMemberFamilies = map[string][]zirconMemberFamily{
+	"Signals": {
+		{qualifier: "USER_", prefix: "ZX_USER_SIGNAL"},
 	},
-	"InstantBootTicks": {
-		typeName: "fidl::basic_ticks<ZX_CLOCK_BOOT>",
-		prefix:   "",
+}
+
+// zirconMemberMacros maps type names to the value members whose macros don't
+// follow their type's prefix. Composite rights are ZX_RIGHTS_BASIC and so on,
+// though ZX_RIGHT_SAME_RIGHTS follows the prefix.
+var zirconMemberMacros = map[string]map[string]string{
+	"Rights": {
+		"BASIC":    "ZX_RIGHTS_BASIC",
+		"IO":       "ZX_RIGHTS_IO",
+		"POLICY":   "ZX_RIGHTS_POLICY",
+		"PROPERTY": "ZX_RIGHTS_PROPERTY",
 	},
 }
 
+// zirconLibrary holds the C/C++ names for one zircon-family library.
+type zirconLibrary struct {
+	// names maps type names to their C type and value member macro prefix.
+	names map[string]zxName
+	// times maps time type names to their C++ time types.
+	times map[string]zxName
+	// genericTimes maps clock-generic time type names to their time types,
+	// by clock name.
+	genericTimes map[string]map[string]string
+	// constPrefix is prepended to all-caps constant names to form their macro.
+	constPrefix string
+	// durationUnits maps duration unit constants to their constructor macros.
+	durationUnits map[string]string
+	// constexprConsts maps constants to their constexpr equivalents.
+	constexprConsts map[string]string
+	// functionMacros lists constants whose macros are function-like.
+	functionMacros map[string]struct{}
+	// memberFamilies maps type names to their qualified member families.
+	memberFamilies map[string][]zirconMemberFamily
+	// memberMacros maps type names to the exact macros of their members
+	// that don't follow the type's prefix. The members must be valid ones.
+	memberMacros map[string]map[string]string
+	// knownConsts lists other constants accepted in strict constant mode.
+	knownConsts map[string]struct{}
+}
+
+// zxLibrary is the identifier of library zx itself.
+var zxLibrary = fidlgen.LibraryIdentifier{"zx"}
+
+// zirconLibraries is the registry of zircon-family libraries. References into
+// these libraries map to C/C++ names rather than to generated bindings.
+var zirconLibraries = map[fidlgen.EncodedLibraryIdentifier]zirconLibrary{
+	"zx": {
+		names:           zirconNames,
+		times:           zirconTimes,
+		genericTimes:    zirconGenericTimes,
+		constPrefix:     "ZX_",
+		durationUnits:   zirconDurationUnits,
+		constexprConsts: zirconConstexprConsts,
+		functionMacros:  zirconFunctionMacros,
+		memberFamilies:  zirconMemberFamilies,
+		memberMacros:    zirconMemberMacros,
+		knownConsts:     zirconKnownConsts,
+	},
+}
+
+func init() {
+	for library, lib := range zirconLibraries {
+		if err := lib.validate(); err != nil {
+			panic(fmt.Sprintf("zircon library %s: %s", library, err))
+		}
+	}
+}
+
+// validate checks that every name in lib resolves unambiguously. Types and
+// time types are looked up case-insensitively, so their names must differ by
+// more than case. Members with exact macros must be listed as members, and
+// clock-generic time types must specialize to time types.
+func (lib zirconLibrary) validate() error {
+	for _, n := range sortedKeys(lib.genericTimes) {
+		if _, ok := findZirconCanonical(lib.times, n); ok {
+			return fmt.Errorf("%s is both a clock-generic time type and a time type", n)
+		}
+		if _, ok := findZirconCanonical(lib.names, n); ok {
+			return fmt.Errorf("%s is both a clock-generic time type and a type", n)
+		}
+		for _, clock := range sortedKeys(lib.genericTimes[n]) {
+			if _, ok := lib.times[lib.genericTimes[n][clock]]; !ok {
+				return fmt.Errorf("%s on clock %s is %s, which isn't a time type", n, clock, lib.genericTimes[n][clock])
+			}
+		}
+	}
+	for _, n := range sortedKeys(lib.memberMacros) {
+		zn, ok := lib.names[n]
+		if !ok {
+			return fmt.Errorf("%s has member macros but is not a type", n)
+		}
+		for _, m := range sortedKeys(lib.memberMacros[n]) {
+			if !zirconHasMember(zn, m) {
+				return fmt.Errorf("%s has a macro for %s, which isn't one of its members", n, m)
+			}
+		}
+	}
+	for _, n := range sortedKeys(lib.names) {
+		for _, t := range sortedKeys(lib.times) {
+			if strings.EqualFold(n, t) {
+				return fmt.Errorf("%s is both a type and a time type", n)
+			}
+		}
+	}
+	return nil
+}
+
+// registerZirconLibrary adds a zircon-family library to the registry.
+func registerZirconLibrary(library fidlgen.EncodedLibraryIdentifier, lib zirconLibrary) error {
+	if _, ok := zirconLibraries[library]; ok {
+		return fmt.Errorf("zircon library %s is already registered", library)
+	}
+	if err := lib.validate(); err != nil {
+		return fmt.Errorf("zircon library %s: %w", library, err)
+	}
+	zirconLibraries[library] = lib
+	return nil
+}
+
+// lookupZirconLibrary returns the zircon-family library that li refers to,
+// treating aliases of zx as zx itself.
+func lookupZirconLibrary(li fidlgen.LibraryIdentifier) (zirconLibrary, bool) {
+	library := normalizeZirconLibrary(li)
+	if _, ok := zirconLibraryAliases[library]; ok {
+		library = "zx"
+	}
+	lib, ok := zirconLibraries[library]
+	return lib, ok
+}
+
+// normalizeZirconLibrary encodes li, tolerating identifiers that a frontend
+// split into segments oddly: segments are trimmed and split on ".", and empty
+// segments are dropped, so {"zx", ""} and {" zx"} both encode as "zx".
+func normalizeZirconLibrary(li fidlgen.LibraryIdentifier) fidlgen.EncodedLibraryIdentifier {
+	// Fast path: a single canonical segment, such as the "zx" of almost every
+	// reference, encodes as itself without allocating.
+	if len(li) == 1 {
+		if segment := string(li[0]); segment != "" && !strings.Contains(segment, ".") && strings.TrimSpace(segment) == segment {
+			return fidlgen.EncodedLibraryIdentifier(segment)
+		}
+	}
+	var parts []string
+	for _, segment := range li {
+		for _, part := range strings.Split(string(segment), ".") {
+			if part = strings.TrimSpace(part); part != "" {
+				parts = append(parts, part)
+			}
+		}
+	}
+	return fidlgen.EncodedLibraryIdentifier(strings.Join(parts, "."))
+}
+
 func isZirconLibrary(li fidlgen.LibraryIdentifier) bool {
-	return len(li) == 1 && li[0] == fidlgen.Identifier("zx")
+	_, ok := lookupZirconLibrary(li)
+	return ok
+}
+
+// ZirconNameError is returned when a reference into a zircon-family library
+// can't be mapped to a C/C++ name. Callers that know where the reference
+// appears can wrap it with that location, e.g. using fmt.Errorf and %w, and
+// later recover it with errors.As.
+type ZirconNameError struct {
+	// Identifier is the offending identifier.
+	Identifier fidlgen.EncodedCompoundIdentifier
+	// Reason describes why Identifier couldn't be mapped.
+	Reason string
+}
+
+func (e *ZirconNameError) Error() string {
+	return fmt.Sprintf("zircon identifier %s %s", e.Identifier, e.Reason)
+}
+
+func newZirconNameError(ci fidlgen.CompoundIdentifier, format string, a ...interface{}) *ZirconNameError {
+	return &ZirconNameError{
+		Identifier: ci.Encode(),
+		Reason:     fmt.Sprintf(format, a...),
+	}
 }
 
-func zirconName(ci fidlgen.CompoundIdentifier) name {
+// zirconName maps a reference into a zircon-family library to the
+// corresponding C/C++ name. It returns a *ZirconNameError if the identifier is
+// malformed, doesn't correspond to any known zircon name, or is excluded by
+// the allowlist.
+func zirconName(ci fidlgen.CompoundIdentifier) (name, error) {
+	zn, err := resolveZirconName(ci)
+	if err != nil {
+		return name{}, err
+	}
+	if !zirconAllowed(ci) {
+		return name{}, newZirconAllowlistError(ci)
+	}
+	if zirconUsageRecorder != nil {
+		zirconUsageRecorder.record(ci, zn, false)
+	}
+	return zn, nil
+}
+
+func resolveZirconName(ci fidlgen.CompoundIdentifier) (name, error) {
+	lib, ok := lookupZirconLibrary(ci.Library)
+	if !ok {
+		if normalizeZirconLibrary(ci.Library) == "" {
+			return name{}, newZirconNameError(ci, "has an empty library name")
+		}
+		return name{}, newZirconNameError(ci, "is not in a zircon library")
+	}
+	if ci.Name == "" {
+		return name{}, newZirconNameError(ci, "has an empty name")
+	}
+
 	if ci.Member != "" {
-		if zn, ok := zirconValueMember(ci.Name, ci.Member); ok {
-			return zn
+		if normalizeZirconMember(string(ci.Member)) == "" {
+			return name{}, newZirconNameError(ci,
+				"has member %q, which has no characters other than separators", ci.Member)
+		}
+		if zn, ok := zirconValueMember(ci.Library, ci.Name, ci.Member); ok {
+			return zn, nil
+		}
+		if canonical, ok := findZirconType(lib, string(ci.Name)); ok {
+			zn := lib.names[canonical]
+			if zn.isStruct {
+				return name{}, newZirconNameError(ci,
+					"refers to a member of struct type %s, which has fields rather than value members", ci.Name)
+			}
+			if zn.prefix == "" {
+				return name{}, newZirconNameError(ci,
+					"refers to a member of scalar type %s, which has no value members", ci.Name)
+			}
+			return name{}, newZirconNameError(ci,
+				"is not a known member of %s; valid members are %s", canonical, strings.Join(zn.members, ", "))
+		}
+		if _, ok := resolveZirconTime(fidlgen.CompoundIdentifier{Library: ci.Library, Name: ci.Name}); ok {
+			return name{}, newZirconNameError(ci,
+				"refers to a member of time type %s, which has no value members", ci.Name)
+		}
+		if _, ok := lookupZirconConst(lib, string(ci.Name)); ok {
+			return name{}, newZirconNameError(ci,
+				"refers to member %s of constant %s, but constants can't be member-accessed", ci.Member, ci.Name)
 		}
 	} else {
-		if zn, ok := zirconType(ci.Name); ok {
-			return zn
+		if zn, ok := zirconType(ci.Library, ci.Name); ok {
+			return zn, nil
 		}
-		if zn, ok := zirconConst(ci.Name); ok {
-			return zn
+		if _, ok := lib.functionMacros[string(ci.Name)]; ok {
+			return name{}, newZirconNameError(ci,
+				"refers to the function-like macro %s%s(...), which can't be used as a constant",
+				lib.constPrefix, ci.Name)
+		}
+		if zn, ok := zirconConst(ci.Library, ci.Name); ok {
+			return zn, nil
+		}
+		if n := string(ci.Name); n == strings.ToUpper(n) && zirconStrictConsts {
+			return name{}, newZirconNameError(ci,
+				"is not a known zircon constant, and strict constant mode is enabled")
+		}
+		if generic, ok := findZirconGenericTime(lib, string(ci.Name)); ok {
+			var times []string
+			for _, clock := range sortedKeys(lib.genericTimes[generic]) {
+				times = append(times, lib.genericTimes[generic][clock])
+			}
+			return name{}, newZirconNameError(ci,
+				"is the clock-generic time type %s, which can't be mapped without a clock; use one of %s",
+				generic, strings.Join(times, ", "))
+		}
+		if isZirconTimeLike(string(ci.Name)) && len(lib.times) > 0 {
+			return name{}, newZirconNameError(ci,
+				"is not a known zircon time type; valid time types are %s",
+				strings.Join(sortedKeys(lib.times), ", "))
 		}
 	}
 
-	panic(fmt.Sprintf("Unknown zircon identifier: %s", ci.Encode()))
+	return name{}, newZirconNameError(ci, "is not a known zircon name")
 }
 
-func zirconType(id fidlgen.Identifier) (name, bool) {
-	n := string(id)
-	if zn, ok := zirconNames[n]; ok {
-		return makeName(zn.typeName), true
+func zirconType(li fidlgen.LibraryIdentifier, id fidlgen.Identifier) (name, bool) {
+	lib, ok := lookupZirconLibrary(li)
+	if !ok {
+		return name{}, false
+	}
+	if canonical, zn, ok := lookupZirconType(li, lib, id); ok {
+		return formatZirconType(canonical, zn, false), true
 	}
 
 	return name{}, false
 }
 
+// zirconWarningf reports non-fatal problems found while mapping zircon names.
+var zirconWarningf = func(format string, a ...interface{}) {
+	log.Printf("Warning: "+format, a...)
+}
+
+// zirconFatalf reports a zircon name that a declaration references but that
+// can't be mapped, and stops generation.
+var zirconFatalf = func(format string, a ...interface{}) {
+	log.Fatalf(format, a...)
+}
+
+// lookupZirconType finds the canonical name and entry for type id in lib. Exact matches are
+// preferred; failing that, a case-insensitive match is accepted with a warning
+// so that frontends which normalize names differently still resolve. All-caps
+// names are never matched case-insensitively since they denote constants.
+func lookupZirconType(li fidlgen.LibraryIdentifier, lib zirconLibrary, id fidlgen.Identifier) (string, zxName, bool) {
+	n := string(id)
+	canonical, ok := findZirconType(lib, n)
+	if !ok {
+		return "", zxName{}, false
+	}
+	if canonical != n {
+		zirconWarningf("zircon type %s.%s should be spelled %s.%s\n", li.Encode(), n, li.Encode(), canonical)
+	}
+	return canonical, lib.names[canonical], true
+}
+
+// findZirconType returns the canonical spelling of type n in lib, following the
+// matching rules of lookupZirconType but without reporting any warnings.
+func findZirconType(lib zirconLibrary, n string) (string, bool) {
+	return findZirconCanonical(lib.names, n)
+}
+
+// findZirconTime is the time type counterpart of findZirconType.
+func findZirconTime(lib zirconLibrary, n string) (string, bool) {
+	return findZirconCanonical(lib.times, n)
+}
+
+func findZirconCanonical(names map[string]zxName, n string) (string, bool) {
+	if _, ok := names[n]; ok {
+		return n, true
+	}
+	if n == strings.ToUpper(n) {
+		return "", false
+	}
+	for _, canonical := range sortedKeys(names) {
+		if strings.EqualFold(canonical, n) {
+			return canonical, true
+		}
+	}
+	return "", false
+}
+
+// IsZirconIdentifier reports whether ci is a reference into a zircon-family
+// library that maps to a C/C++ name, as a type, value member, constant, or
+// time type, and that the allowlist lets be referenced. It is cheaper than
+// mapping the name, and unlike zirconName never fails, so it can be used to
+// decide whether to map ci at all.
+func IsZirconIdentifier(ci fidlgen.CompoundIdentifier) bool {
+	lib, ok := lookupZirconLibrary(ci.Library)
+	if !ok || ci.Name == "" || !zirconAllowed(ci) {
+		return false
+	}
+	n := string(ci.Name)
+	if ci.Member != "" {
+		canonical, ok := findZirconType(lib, n)
+		if !ok || lib.names[canonical].prefix == "" {
+			return false
+		}
+		m := normalizeZirconMember(string(ci.Member))
+		return m != "" && zirconHasMember(lib.names[canonical], m)
+	}
+	if _, ok := findZirconTime(lib, n); ok {
+		return true
+	}
+	if _, ok := findZirconType(lib, n); ok {
+		return true
+	}
+	if _, ok := lib.functionMacros[n]; ok {
+		return false
+	}
+	if _, ok := lib.durationUnits[n]; ok {
+		return true
+	}
+	return n == strings.ToUpper(n) && (!zirconStrictConsts || isKnownZirconConst(lib, n))
+}
+
+// zirconNameDiagnosis explains why ci, which IsZirconIdentifier rejects,
+// can't be mapped to a C/C++ name.
+func zirconNameDiagnosis(ci fidlgen.CompoundIdentifier) error {
+	if _, err := zirconName(ci); err != nil {
+		return err
+	}
+	return newZirconNameError(ci, "is not a known zircon name")
+}
+
+// zirconTime maps the time type ci to its C/C++ name. It reports false if ci
+// isn't a time type, or the allowlist excludes it.
 func zirconTime(ci fidlgen.CompoundIdentifier) (name, bool) {
-	if isZirconLibrary(ci.Library) {
+	if !zirconAllowed(ci) {
+		return name{}, false
+	}
+	return recordZirconTime(ci)
+}
+
+// recordZirconTime maps ci like zirconTime, and records its use, without
+// checking the allowlist.
+func recordZirconTime(ci fidlgen.CompoundIdentifier) (name, bool) {
+	zt, ok := resolveZirconTime(ci)
+	if ok && zirconUsageRecorder != nil {
+		zirconUsageRecorder.record(ci, zt, true)
+	}
+	return zt, ok
+}
+
+// resolveZirconTime maps ci like zirconTime, without checking the allowlist or
+// recording its use.
+func resolveZirconTime(ci fidlgen.CompoundIdentifier) (name, bool) {
+	if ci.Member != "" {
+		return name{}, false
+	}
+	if lib, ok := lookupZirconLibrary(ci.Library); ok {
 		n := string(ci.Name)
-		if zt, ok := zirconTimes[n]; ok {
-			return makeName(zt.typeName), true
+		if canonical, ok := findZirconTime(lib, n); ok {
+			if canonical != n {
+				zirconWarningf("zircon time type %s.%s should be spelled %s.%s\n",
+					ci.Library.Encode(), n, ci.Library.Encode(), canonical)
+			}
+			return formatZirconType(canonical, lib.times[canonical], true), true
 		}
 	}
 	return name{}, false
 }
 
-func zirconValueMember(id fidlgen.Identifier, mem fidlgen.Identifier) (name, bool) {
-	n := string(id)
-	m := string(mem)
-	if zn, ok := zirconNames[n]; ok {
-		return makeName(fmt.Sprintf("%s_%s", zn.prefix, strings.ToUpper(m))), true
+// findZirconGenericTime returns the canonical name of the clock-generic time
+// type n, looked up like the time types.
+func findZirconGenericTime(lib zirconLibrary, n string) (string, bool) {
+	for _, generic := range sortedKeys(lib.genericTimes) {
+		if generic == n || (n != strings.ToUpper(n) && strings.EqualFold(generic, n)) {
+			return generic, true
+		}
+	}
+	return "", false
+}
+
+// zirconClockID returns the clock ID that is the template argument of the
+// C++ wrapper of the time type zn, such as ZX_CLOCK_MONOTONIC, or "" if the
+// time type isn't tied to a clock.
+func zirconClockID(zn zxName) string {
+	i := strings.Index(zn.cppTypeName, "<")
+	if i < 0 || !strings.HasSuffix(zn.cppTypeName, ">") {
+		return ""
+	}
+	return zn.cppTypeName[i+1 : len(zn.cppTypeName)-1]
+}
+
+// zirconTimeOnClock maps the time type ci on the given clock. The clock is
+// either a clock name, such as "Mono", or a time type on that clock, such as
+// the InstantBoot of a sibling field, so that a clock-generic time type such
+// as zx.Instant maps to fidl::basic_time<ZX_CLOCK_BOOT>. A time type that is
+// already on a clock maps as zirconTime maps it, and the clock, if given, must
+// be the same. It returns a *ZirconNameError if the clock can't be determined,
+// or the allowlist excludes ci.
+func zirconTimeOnClock(ci fidlgen.CompoundIdentifier, clock string) (name, error) {
+	lib, ok := lookupZirconLibrary(ci.Library)
+	if !ok || ci.Member != "" {
+		return name{}, newZirconNameError(ci, "is not a zircon time type")
+	}
+	generic, ok := findZirconGenericTime(lib, string(ci.Name))
+	if !ok {
+		canonical, ok := findZirconTime(lib, string(ci.Name))
+		if !ok {
+			return name{}, newZirconNameError(ci, "is not a zircon time type")
+		}
+		if clock != "" {
+			own := zirconClockID(lib.times[canonical])
+			if own == "" {
+				return name{}, newZirconNameError(ci,
+					"is the time type %s, which isn't tied to a clock, but clock %q was given", canonical, clock)
+			}
+			if id, ok := lookupZirconClockID(lib, clock); !ok || id != own {
+				return name{}, newZirconNameError(ci,
+					"is the time type %s, which is on clock %s, but clock %q was given", canonical, own, clock)
+			}
+		}
+		if !zirconAllowed(ci) {
+			return name{}, newZirconAllowlistError(ci)
+		}
+		zt, _ := recordZirconTime(ci)
+		return zt, nil
+	}
+
+	clocks := lib.genericTimes[generic]
+	// onClock maps the time type of the generic one on a clock, which the
+	// allowlist lets be referenced if it lets the generic one be.
+	onClock := func(time string) (name, error) {
+		if !zirconAllowed(ci) {
+			return name{}, newZirconAllowlistError(ci)
+		}
+		zt, _ := recordZirconTime(fidlgen.CompoundIdentifier{Library: ci.Library, Name: fidlgen.Identifier(time)})
+		return zt, nil
+	}
+	if clock == "" {
+		return name{}, newZirconNameError(ci,
+			"is the clock-generic time type %s, and no clock was given; valid clocks are %s",
+			generic, strings.Join(sortedKeys(clocks), ", "))
+	}
+	for _, c := range sortedKeys(clocks) {
+		if strings.EqualFold(c, clock) {
+			return onClock(clocks[c])
+		}
+	}
+	if id, ok := lookupZirconClockID(lib, clock); ok {
+		for _, c := range sortedKeys(clocks) {
+			if zirconClockID(lib.times[clocks[c]]) == id {
+				return onClock(clocks[c])
+			}
+		}
+		return name{}, newZirconNameError(ci,
+			"is the clock-generic time type %s, which has no time type on clock %s", generic, id)
+	}
+	return name{}, newZirconNameError(ci,
+		"is the clock-generic time type %s, and %q is neither a clock nor a time type on one; valid clocks are %s",
+		generic, clock, strings.Join(sortedKeys(clocks), ", "))
+}
+
+// isZirconGenericTime reports whether ci is a clock-generic time type, such as
+// zx.Instant, which only maps given a clock.
+func isZirconGenericTime(ci fidlgen.CompoundIdentifier) bool {
+	lib, ok := lookupZirconLibrary(ci.Library)
+	if !ok || ci.Member != "" {
+		return false
+	}
+	_, ok = findZirconGenericTime(lib, string(ci.Name))
+	return ok
+}
+
+// zirconTimeClock returns the clock the time type ci is on, as the name of
+// its time type, which zirconTimeOnClock accepts as a clock. It reports false
+// if ci isn't a time type tied to a clock.
+func zirconTimeClock(ci fidlgen.CompoundIdentifier) (string, bool) {
+	lib, ok := lookupZirconLibrary(ci.Library)
+	if !ok || ci.Member != "" {
+		return "", false
+	}
+	canonical, ok := findZirconTime(lib, string(ci.Name))
+	if !ok || zirconClockID(lib.times[canonical]) == "" {
+		return "", false
+	}
+	return canonical, true
+}
+
+// lookupZirconClockID returns the clock ID of the time type named by clock,
+// or of the clock it names if it is a clock name of a clock-generic time type.
+func lookupZirconClockID(lib zirconLibrary, clock string) (string, bool) {
+	for _, generic := range sortedKeys(lib.genericTimes) {
+		for _, c := range sortedKeys(lib.genericTimes[generic]) {
+			if strings.EqualFold(c, clock) {
+				return zirconClockID(lib.times[lib.genericTimes[generic][c]]), true
+			}
+		}
+	}
+	if canonical, ok := findZirconTime(lib, clock); ok {
+		id := zirconClockID(lib.times[canonical])
+		return id, id != ""
+	}
+	return "", false
+}
+
+// isZirconTimeLike reports whether n looks like it was meant to name a time
+// type, so that failing to resolve it can list the time types that exist.
+func isZirconTimeLike(n string) bool {
+	lower := strings.ToLower(n)
+	return strings.HasPrefix(lower, "instant") || strings.HasSuffix(lower, "ticks")
+}
+
+func zirconValueMember(li fidlgen.LibraryIdentifier, id fidlgen.Identifier, mem fidlgen.Identifier) (name, bool) {
+	lib, ok := lookupZirconLibrary(li)
+	if !ok {
+		return name{}, false
+	}
+	m := normalizeZirconMember(string(mem))
+	if m == "" {
+		return name{}, false
+	}
+	if canonical, zn, ok := lookupZirconType(li, lib, id); ok && zn.prefix != "" && zirconHasMember(zn, m) {
+		if macro, ok := lib.memberMacros[canonical][m]; ok {
+			return makeName(macro), true
+		}
+		for _, f := range lib.memberFamilies[canonical] {
+			// The qualifier is matched on the normalized member, so only
+			// the normalized rest of it is known to spell.
+			if rest := strings.TrimPrefix(m, f.qualifier); rest != m && rest != "" {
+				return makeName(fmt.Sprintf("%s_%s", f.prefix, zn.memberCasing.spell(rest, rest))), true
+			}
+		}
+		return makeName(fmt.Sprintf("%s_%s", zn.prefix, zn.memberCasing.spell(string(mem), m))), true
 	}
 
 	return name{}, false
 }
 
-func zirconConst(id fidlgen.Identifier) (name, bool) {
-	n := string(id)
-	if n == strings.ToUpper(n) {
-		// All-caps names like `CHANNEL_MAX_MSG_BYTES`` get a ZX_ prefix.
-		return makeName(fmt.Sprintf("ZX_%s", n)), true
+// ZirconType returns the C/C++ spelling of the zx type n, such as "Rights".
+func ZirconType(n string) (string, bool) {
+	if zn, ok := zirconType(zxLibrary, fidlgen.Identifier(n)); ok {
+		return zn.String(), true
+	}
+	return "", false
+}
+
+// ZirconConst returns the C/C++ spelling of the zx constant n, such as
+// "CHANNEL_MAX_MSG_BYTES".
+func ZirconConst(n string) (string, bool) {
+	if zn, ok := zirconConst(zxLibrary, fidlgen.Identifier(n)); ok {
+		return zn.String(), true
+	}
+	return "", false
+}
+
+// ZirconValueMember returns the macro for value member member of the zx type
+// n, such as "READ" of "Rights".
+func ZirconValueMember(n, member string) (string, bool) {
+	if zn, ok := zirconValueMember(zxLibrary, fidlgen.Identifier(n), fidlgen.Identifier(member)); ok {
+		return zn.String(), true
+	}
+	return "", false
+}
+
+// zirconHasMember reports whether m, a normalized member name, is a valid
+// value member of zn.
+func zirconHasMember(zn zxName, m string) bool {
+	if zn.members == nil {
+		return true
+	}
+	for _, member := range zn.members {
+		if member == m {
+			return true
+		}
+	}
+	return false
+}
+
+// zirconIncludeKind describes how generated code must declare a zircon name
+// before using it.
+type zirconIncludeKind int
+
+const (
+	// zirconTypedefInclude names are plain C typedefs and macros, such as
+	// zx_rights_t. Their C header must be included, and a typedef can't be
+	// forward-declared.
+	zirconTypedefInclude zirconIncludeKind = iota
+	// zirconFullInclude names are C++ wrapper templates, such as
+	// fidl::basic_time<ZX_CLOCK_MONOTONIC>. Their header must be included in
+	// full, after the C headers they wrap, and can't be forward-declared.
+	zirconFullInclude
+	// zirconForwardDeclarable names are C structs, such as zx_profile_info_t,
+	// which code that only refers to them by pointer may forward-declare.
+	zirconForwardDeclarable
+)
+
+// zirconInclude returns the header that generated code must include to use
+// the name that ci maps to. Headers are returned with their delimiters, e.g.
+// "<zircon/types.h>", so that callers can collect them into a set. Constants,
+// names whose header isn't known, and C++ wrappers the C++ spelling wasn't
+// asked for report false.
+func zirconInclude(ci fidlgen.CompoundIdentifier) (string, bool) {
+	include, _, ok := resolveZirconInclude(ci)
+	return include, ok
+}
+
+// zirconIncludeKindOf reports how generated code must declare the name that
+// ci maps to, or false for constants and names whose header isn't known.
+func zirconIncludeKindOf(ci fidlgen.CompoundIdentifier) (zirconIncludeKind, bool) {
+	_, kind, ok := resolveZirconInclude(ci)
+	return kind, ok
+}
+
+func resolveZirconInclude(ci fidlgen.CompoundIdentifier) (string, zirconIncludeKind, bool) {
+	lib, ok := lookupZirconLibrary(ci.Library)
+	if !ok {
+		return "", 0, false
+	}
+	n := string(ci.Name)
+	var zn zxName
+	preferCpp := false
+	if canonical, ok := findZirconType(lib, n); ok {
+		zn = lib.names[canonical]
+	} else if canonical, ok := findZirconTime(lib, n); ok && ci.Member == "" {
+		zn = lib.times[canonical]
+		preferCpp = true
+	} else {
+		return "", 0, false
+	}
+	include, kind := zn.include, zirconTypedefInclude
+	if ci.Member == "" {
+		switch {
+		case zirconSpelling.usesCpp(zn, preferCpp):
+			// The headers of the C++ wrappers are only included when the
+			// C++ spelling is asked for. Time types, which are wrapped by
+			// default, rely on the includes of the bindings as they always
+			// have.
+			if zirconSpelling != ZirconCppSpelling {
+				return "", 0, false
+			}
+			include, kind = zn.cppInclude, zirconFullInclude
+		case zn.isStruct:
+			kind = zirconForwardDeclarable
+		}
+	}
+	return include, kind, include != ""
+}
+
+// zirconIncludes returns the headers generated code must include to use the
+// names that cis map to, in the order to emit them: the C headers, sorted,
+// then the headers of C++ wrappers, sorted, since the wrappers depend on the
+// C typedefs. Names without a known header are skipped.
+func zirconIncludes(cis []fidlgen.CompoundIdentifier) []string {
+	c, cpp := map[string]struct{}{}, map[string]struct{}{}
+	for _, ci := range cis {
+		include, kind, ok := resolveZirconInclude(ci)
+		if !ok {
+			continue
+		}
+		if kind == zirconFullInclude {
+			cpp[include] = struct{}{}
+		} else {
+			c[include] = struct{}{}
+		}
+	}
+	includes := sortedKeys(c)
+	for _, include := range sortedKeys(cpp) {
+		if _, ok := c[include]; !ok {
+			includes = append(includes, include)
+		}
+	}
+	return includes
+}
+
+// zirconHandleSubtype returns the ZX_OBJ_TYPE_* macro for a handle subtype,
+// spelled the same way as the corresponding zx.ObjType member.
+func zirconHandleSubtype(t fidlgen.HandleSubtype) (name, bool) {
+	subtype, ok := handleSubtypeConsts[t]
+	if !ok {
+		return name{}, false
+	}
+	return zirconValueMember(fidlgen.LibraryIdentifier{"zx"}, "ObjType", fidlgen.Identifier(subtype))
+}
+
+// zirconAcronyms are the acronyms used to split runs of capitals in member
+// names, e.g. "VMOIO" into "VMO" and "IO". Longer acronyms come first so that
+// they are preferred when splitting.
+var zirconAcronyms = []string{"VMAR", "VMO", "CPU", "IO"}
+
+// normalizeZirconMember converts a FIDL member name to the SCREAMING_SNAKE
+// spelling used in zircon macros. Camel-case words are split apart, keeping
+// runs of capitals together, so that "ioBufferRx" becomes "IO_BUFFER_RX" and
+// "VMOChild" becomes "VMO_CHILD". Names that are already all-caps are left
+// unchanged. Members consisting only of separators normalize to "".
+func normalizeZirconMember(m string) string {
+	if strings.Trim(m, "_") == "" {
+		return ""
+	}
+	if m == strings.ToUpper(m) {
+		return m
+	}
+	var words []string
+	for _, part := range strings.Split(m, "_") {
+		for _, w := range splitCamelCase(part) {
+			w = strings.ToUpper(w)
+			if acronyms := splitAcronyms(w); acronyms != nil {
+				words = append(words, acronyms...)
+			} else {
+				words = append(words, w)
+			}
+		}
+	}
+	return strings.Join(words, "_")
+}
+
+// splitCamelCase splits s into words at lower-to-upper transitions and before
+// the last capital of a run of capitals that is followed by a lowercase letter.
+func splitCamelCase(s string) []string {
+	var words []string
+	runes := []rune(s)
+	start := 0
+	for i := 1; i < len(runes); i++ {
+		prev, cur := runes[i-1], runes[i]
+		lowerToUpper := !unicode.IsUpper(prev) && unicode.IsUpper(cur)
+		endOfRun := unicode.IsUpper(prev) && unicode.IsUpper(cur) &&
+			i+1 < len(runes) && unicode.IsLower(runes[i+1])
+		if lowerToUpper || endOfRun {
+			words = append(words, string(runes[start:i]))
+			start = i
+		}
+	}
+	if start < len(runes) {
+		words = append(words, string(runes[start:]))
+	}
+	return words
+}
+
+// splitAcronyms splits an upper-case word into known acronyms, returning nil
+// if the word isn't made up entirely of them.
+func splitAcronyms(w string) []string {
+	for _, a := range zirconAcronyms {
+		if w == a {
+			return []string{a}
+		}
+		if strings.HasPrefix(w, a) {
+			if rest := splitAcronyms(w[len(a):]); rest != nil {
+				return append([]string{a}, rest...)
+			}
+		}
+	}
+	return nil
+}
+
+// zirconConstFallbackHook, if set, is called whenever a constant is mapped by
+// the all-caps rule rather than by a table entry.
+var zirconConstFallbackHook func(ci fidlgen.EncodedCompoundIdentifier, macro string)
+
+// SetZirconConstFallbackHook installs hook to be called with the FIDL name and
+// synthesized macro of each constant that only maps by virtue of being
+// all-caps, which is often a sign of an unvetted symbol. Passing nil removes
+// the hook.
+func SetZirconConstFallbackHook(hook func(ci fidlgen.EncodedCompoundIdentifier, macro string)) {
+	zirconConstFallbackHook = hook
+}
+
+// ZirconUsage is a zircon identifier that generation mapped, and what it
+// mapped to.
+type ZirconUsage struct {
+	// Identifier is the canonical FIDL identifier, e.g. "zx/Rights.READ".
+	// Aliases of zx are recorded as zx.
+	Identifier string `json:"identifier"`
+	// Kind is one of "type", "member", "const", or "time".
+	Kind string `json:"kind"`
+	// Name is the C/C++ spelling, e.g. "ZX_RIGHT_READ".
+	Name string `json:"name"`
+}
+
+// ZirconUsageRecorder accumulates the zircon identifiers generation maps, so
+// that the ones a FIDL library uses can be audited. Each is recorded once,
+// however often and however it is spelled.
+type ZirconUsageRecorder struct {
+	usages map[string]ZirconUsage
+}
+
+// NewZirconUsageRecorder returns an empty ZirconUsageRecorder.
+func NewZirconUsageRecorder() *ZirconUsageRecorder {
+	return &ZirconUsageRecorder{usages: map[string]ZirconUsage{}}
+}
+
+// zirconUsageRecorder, if set, records the zircon identifiers that zirconName
+// and zirconTime map.
+var zirconUsageRecorder *ZirconUsageRecorder
+
+// SetZirconUsageRecorder installs r to record the zircon identifiers mapped
+// from then on. Passing nil removes the recorder.
+func SetZirconUsageRecorder(r *ZirconUsageRecorder) {
+	zirconUsageRecorder = r
+}
+
+// record records that ci mapped to n. time is true for time types.
+func (r *ZirconUsageRecorder) record(ci fidlgen.CompoundIdentifier, n name, time bool) {
+	library := normalizeZirconLibrary(ci.Library)
+	if _, ok := zirconLibraryAliases[library]; ok {
+		library = "zx"
+	}
+	lib := zirconLibraries[library]
+	canonical := fidlgen.CompoundIdentifier{Library: library.Parse(), Name: ci.Name}
+	var kind string
+	switch {
+	case time:
+		kind = "time"
+		if c, ok := findZirconTime(lib, string(ci.Name)); ok {
+			canonical.Name = fidlgen.Identifier(c)
+		}
+	case ci.Member != "":
+		kind = "member"
+		if c, ok := findZirconType(lib, string(ci.Name)); ok {
+			canonical.Name = fidlgen.Identifier(c)
+		}
+		canonical.Member = fidlgen.Identifier(normalizeZirconMember(string(ci.Member)))
+	default:
+		kind = "const"
+		if c, ok := findZirconType(lib, string(ci.Name)); ok {
+			kind = "type"
+			canonical.Name = fidlgen.Identifier(c)
+		}
+	}
+	id := string(canonical.Encode())
+	r.usages[id] = ZirconUsage{Identifier: id, Kind: kind, Name: n.String()}
+}
+
+// Usages returns the recorded identifiers, sorted by identifier.
+func (r *ZirconUsageRecorder) Usages() []ZirconUsage {
+	usages := []ZirconUsage{}
+	for _, id := range sortedKeys(r.usages) {
+		usages = append(usages, r.usages[id])
+	}
+	return usages
+}
+
+// WriteJSON writes the recorded identifiers to w as a JSON array, sorted by
+// identifier.
+func (r *ZirconUsageRecorder) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r.Usages())
+}
+
+func zirconConst(li fidlgen.LibraryIdentifier, id fidlgen.Identifier) (name, bool) {
+	lib, ok := lookupZirconLibrary(li)
+	if !ok {
+		return name{}, false
+	}
+	zn, ok := lookupZirconConst(lib, string(id))
+	if ok && zirconConstFallbackHook != nil && !isKnownZirconConst(lib, string(id)) {
+		zirconConstFallbackHook(fidlgen.CompoundIdentifier{Library: li, Name: id}.Encode(), zn.String())
+	}
+	return zn, ok
+}
+
+// lookupZirconConst maps constant n in lib, without calling the fallback hook.
+func lookupZirconConst(lib zirconLibrary, n string) (name, bool) {
+	if macro, ok := lib.durationUnits[n]; ok {
+		return makeName(fmt.Sprintf("%s(1)", macro)), true
+	}
+	if constexpr, ok := lib.constexprConsts[n]; ok && zirconConstexpr {
+		return makeName(constexpr), true
+	}
+	if n == strings.ToUpper(n) && (!zirconStrictConsts || isKnownZirconConst(lib, n)) {
+		// All-caps names like `CHANNEL_MAX_MSG_BYTES`` get the library's
+		// constant prefix, e.g. ZX_ for library zx.
+		return makeName(fmt.Sprintf("%s%s", lib.constPrefix, n)), true
 	}
 
 	return name{}, false
 }
+
+// isKnownZirconConst reports whether n is a constant that lib knows about, as
+// opposed to one that's only assumed to exist because it's all-caps.
+func isKnownZirconConst(lib zirconLibrary, n string) bool {
+	if _, ok := lib.durationUnits[n]; ok {
+		return true
+	}
+	if _, ok := lib.constexprConsts[n]; ok {
+		return true
+	}
+	_, ok := lib.knownConsts[n]
+	return ok
+}
+
+// DumpZirconNames writes every known FIDL to C/C++ zircon name mapping to w,
+// one per line and in a stable sorted order. This covers types, time types,
+// the macro prefixes used for value members, and the rules for constants.
+func DumpZirconNames(w io.Writer) {
+	var libraries []string
+	for l := range zirconLibraries {
+		libraries = append(libraries, string(l))
+	}
+	sort.Strings(libraries)
+
+	for _, l := range libraries {
+		li := fidlgen.EncodedLibraryIdentifier(l).Parse()
+		lib := zirconLibraries[fidlgen.EncodedLibraryIdentifier(l)]
+		for _, n := range sortedKeys(lib.names) {
+			zn, _ := zirconType(li, fidlgen.Identifier(n))
+			fmt.Fprintf(w, "%s.%s → %s\n", l, n, zn)
+			if prefix := lib.names[n].prefix; prefix != "" {
+				fmt.Fprintf(w, "%s.%s.<MEMBER> → %s_%s\n", l, n, prefix, lib.names[n].memberCasing.spell("<Member>", "<MEMBER>"))
+			}
+			for _, m := range sortedKeys(lib.memberMacros[n]) {
+				fmt.Fprintf(w, "%s.%s.%s → %s\n", l, n, m, lib.memberMacros[n][m])
+			}
+			for _, f := range lib.memberFamilies[n] {
+				fmt.Fprintf(w, "%s.%s.%s<MEMBER> → %s_<MEMBER>\n", l, n, f.qualifier, f.prefix)
+			}
+		}
+		for _, n := range sortedKeys(lib.times) {
+			zt, _ := resolveZirconTime(fidlgen.CompoundIdentifier{Library: li, Name: fidlgen.Identifier(n)})
+			fmt.Fprintf(w, "%s.%s → %s\n", l, n, zt)
+		}
+		for _, n := range sortedKeys(lib.genericTimes) {
+			for _, c := range sortedKeys(lib.genericTimes[n]) {
+				fmt.Fprintf(w, "%s.%s on clock %s → %s.%s\n", l, n, c, l, lib.genericTimes[n][c])
+			}
+		}
+		for _, n := range sortedKeys(lib.durationUnits) {
+			fmt.Fprintf(w, "%s.%s → %s(1)\n", l, n, lib.durationUnits[n])
+		}
+		for _, n := range sortedKeys(lib.functionMacros) {
+			fmt.Fprintf(w, "%s.%s → %s%s(...) (function-like, not a constant)\n", l, n, lib.constPrefix, n)
+		}
+		fmt.Fprintf(w, "%s.<ALL_CAPS_CONST> → %s<ALL_CAPS_CONST>\n", l, lib.constPrefix)
+	}
+
+	var aliases []string
+	for a := range zirconLibraryAliases {
+		aliases = append(aliases, string(a))
+	}
+	sort.Strings(aliases)
+	for _, a := range aliases {
+		fmt.Fprintf(w, "library %s → zx\n", a)
+	}
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
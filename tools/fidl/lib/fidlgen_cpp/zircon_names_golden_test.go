@@ -0,0 +1,162 @@
+// Copyright 2024 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package fidlgen_cpp
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"go.fuchsia.dev/fuchsia/tools/fidl/lib/fidlgen"
+)
+
+var (
+	update     = flag.Bool("update", false, "Whether to update goldens")
+	goldensDir = flag.String("goldens-dir", "testdata", "Directory containing goldens")
+)
+
+// zirconGoldenIdentifiers are the identifiers fed through the zircon name
+// mapping by TestZirconNamesGolden. There should be at least one case per
+// branch in zirconName and zirconTime.
+var zirconGoldenIdentifiers = []fidlgen.CompoundIdentifier{
+	// Types.
+	parseIdent("zx/Rights"),
+	parseIdent("zx/ObjType"),
+	// Value members.
+	parseIdent("zx/Rights.READ"),
+	parseIdent("zx/Rights.SAME_RIGHTS"),
+	parseIdent("zx/Rights.BASIC"),
+	parseIdent("zx/ObjType.CHANNEL"),
+	parseIdent("zx/ObjType.vmo"),
+	// Constants.
+	parseIdent("zx/CHANNEL_MAX_MSG_BYTES"),
+	parseIdent("zx/HANDLE_INVALID"),
+	parseIdent("zx/MSEC"),
+	parseIdent("zx/CLOCK_ARGS_VERSION"),
+	// Time types.
+	parseIdent("zx/InstantMono"),
+	parseIdent("zx/InstantBoot"),
+	parseIdent("zx/InstantMonoTicks"),
+	parseIdent("zx/InstantBootTicks"),
+	parseIdent("zx/Ticks"),
+	parseIdent("zx/InstantMono.ZERO"),
+	parseIdent("zx/CHANNEL_MAX_MSG_BYTES.FOO"),
+	// Errors.
+	{Library: fidlgen.LibraryIdentifier{"zx"}},
+	parseIdent("fuchsia.io/Rights"),
+	parseIdent("zx/Unknown"),
+	parseIdent("zx/Instant"),
+	parseIdent("zx/Unknown.MEMBER"),
+	parseIdent("zx/Rights.DUPLICTE"),
+}
+
+// resolveZirconGolden resolves ci the way the compiler does, trying the time
+// types before falling back to zirconName.
+func resolveZirconGolden(ci fidlgen.CompoundIdentifier) string {
+	if zt, ok := zirconTime(ci); ok {
+		return zt.String()
+	}
+	zn, err := zirconName(ci)
+	if err != nil {
+		return fmt.Sprintf("error: %s", err)
+	}
+	return zn.String()
+}
+
+func TestZirconNamesGolden(t *testing.T) {
+	var b strings.Builder
+	for _, ci := range zirconGoldenIdentifiers {
+		fmt.Fprintf(&b, "%s -> %s\n", ci.Encode(), resolveZirconGolden(ci))
+	}
+	got := b.String()
+
+	compareZirconGolden(t, "zircon_names.golden", "TestZirconNamesGolden", got)
+}
+
+// TestZirconTablesGolden snapshots every table of every zircon library, so
+// that edits to the tables, which directly affect generated code, show up as
+// golden changes to be reviewed. Entries are written one per line, in sorted
+// order and with their fields named, so that the diff of a change names what
+// changed.
+func TestZirconTablesGolden(t *testing.T) {
+	var libraries []string
+	for library := range zirconLibraries {
+		libraries = append(libraries, string(library))
+	}
+	sort.Strings(libraries)
+
+	var b strings.Builder
+	for _, library := range libraries {
+		lib := zirconLibraries[fidlgen.EncodedLibraryIdentifier(library)]
+		fmt.Fprintf(&b, "library %s constPrefix=%q\n", library, lib.constPrefix)
+		for _, n := range sortedKeys(lib.names) {
+			fmt.Fprintf(&b, "  type %s %s\n", n, formatZxNameGolden(lib.names[n]))
+		}
+		for _, n := range sortedKeys(lib.times) {
+			fmt.Fprintf(&b, "  time %s %s\n", n, formatZxNameGolden(lib.times[n]))
+		}
+		for _, n := range sortedKeys(lib.genericTimes) {
+			for _, clock := range sortedKeys(lib.genericTimes[n]) {
+				fmt.Fprintf(&b, "  genericTime %s clock=%s time=%s\n", n, clock, lib.genericTimes[n][clock])
+			}
+		}
+		for _, n := range sortedKeys(lib.durationUnits) {
+			fmt.Fprintf(&b, "  durationUnit %s macro=%s\n", n, lib.durationUnits[n])
+		}
+		for _, n := range sortedKeys(lib.constexprConsts) {
+			fmt.Fprintf(&b, "  constexprConst %s value=%s\n", n, lib.constexprConsts[n])
+		}
+		for _, n := range sortedKeys(lib.functionMacros) {
+			fmt.Fprintf(&b, "  functionMacro %s\n", n)
+		}
+		for _, n := range sortedKeys(lib.memberFamilies) {
+			for _, family := range lib.memberFamilies[n] {
+				fmt.Fprintf(&b, "  memberFamily %s qualifier=%q prefix=%q\n", n, family.qualifier, family.prefix)
+			}
+		}
+		for _, n := range sortedKeys(lib.memberMacros) {
+			for _, member := range sortedKeys(lib.memberMacros[n]) {
+				fmt.Fprintf(&b, "  memberMacro %s.%s macro=%s\n", n, member, lib.memberMacros[n][member])
+			}
+		}
+		for _, n := range sortedKeys(lib.knownConsts) {
+			fmt.Fprintf(&b, "  knownConst %s\n", n)
+		}
+	}
+	compareZirconGolden(t, "zircon_tables.golden", "TestZirconTablesGolden", b.String())
+}
+
+// formatZxNameGolden formats every field of zn by name. Strings are quoted so
+// that unset ones show.
+func formatZxNameGolden(zn zxName) string {
+	return fmt.Sprintf("typeName=%q cppTypeName=%q prefix=%q include=%q cppInclude=%q isStruct=%t members=%q memberCasing=%s",
+		zn.typeName, zn.cppTypeName, zn.prefix, zn.include, zn.cppInclude, zn.isStruct, zn.members, zn.memberCasing)
+}
+
+// compareZirconGolden compares got against the named golden file, or rewrites
+// the golden file if -update is set.
+func compareZirconGolden(t *testing.T, golden, test, got string) {
+	t.Helper()
+	goldenFile := filepath.Join(*goldensDir, golden)
+	if *update {
+		if err := os.WriteFile(goldenFile, []byte(got), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	want, err := os.ReadFile(goldenFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(string(want), got); diff != "" {
+		t.Errorf("Golden file mismatch (-want +got):\n%s\nTo fix, run `go test -run %s -update`", diff, test)
+	}
+}
@@ -0,0 +1,1404 @@
+// Copyright 2024 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package fidlgen_cpp
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"go.fuchsia.dev/fuchsia/tools/fidl/lib/fidlgen"
+)
+
+func TestIsZirconLibrary(t *testing.T) {
+	assertEqual(t, isZirconLibrary(parseIdent("zx/Rights").Library), true)
+	assertEqual(t, isZirconLibrary(parseIdent("zircon/Rights").Library), false)
+	assertEqual(t, isZirconLibrary(parseIdent("fuchsia.zx/Rights").Library), false)
+}
+
+func TestZirconLibraryAliases(t *testing.T) {
+	SetZirconLibraryAliases([]string{"zircon", "fuchsia.zx"})
+	defer SetZirconLibraryAliases(nil)
+
+	assertEqual(t, isZirconLibrary(parseIdent("zx/Rights").Library), true)
+	assertEqual(t, isZirconLibrary(parseIdent("zircon/Rights").Library), true)
+	assertEqual(t, isZirconLibrary(parseIdent("fuchsia.zx/Rights").Library), true)
+	assertEqual(t, isZirconLibrary(parseIdent("fuchsia.zircon/Rights").Library), false)
+}
+
+func TestZirconTimeWithLibraryAlias(t *testing.T) {
+	if _, ok := zirconTime(parseIdent("zircon/InstantMono")); ok {
+		t.Fatal("zircon/InstantMono resolved without an alias configured")
+	}
+
+	SetZirconLibraryAliases([]string{"zircon"})
+	defer SetZirconLibraryAliases(nil)
+
+	mono, ok := zirconTime(parseIdent("zircon/InstantMono"))
+	assertEqual(t, ok, true)
+	assertEqual(t, mono.String(), "::fidl::basic_time<ZX_CLOCK_MONOTONIC>")
+
+	boot, ok := zirconTime(parseIdent("zircon/InstantBoot"))
+	assertEqual(t, ok, true)
+	assertEqual(t, boot.String(), "::fidl::basic_time<ZX_CLOCK_BOOT>")
+
+	// The canonical library still resolves identically.
+	zxMono, ok := zirconTime(parseIdent("zx/InstantMono"))
+	assertEqual(t, ok, true)
+	assertEqual(t, zxMono.String(), mono.String())
+}
+
+func TestZirconTypeRights(t *testing.T) {
+	rights, ok := zirconType(zxLibrary, "Rights")
+	assertEqual(t, ok, true)
+	assertEqual(t, rights.String(), "zx_rights_t")
+
+	read, ok := zirconValueMember(zxLibrary, "Rights", "READ")
+	assertEqual(t, ok, true)
+	assertEqual(t, read.String(), "ZX_RIGHT_READ")
+}
+
+func TestZirconTypeSpellings(t *testing.T) {
+	defer SetZirconSpelling(ZirconDefaultSpelling)
+
+	for _, tc := range []struct {
+		spelling ZirconSpelling
+		rights   string
+		objType  string
+		mono     string
+	}{
+		{
+			spelling: ZirconDefaultSpelling,
+			rights:   "zx_rights_t",
+			objType:  "zx_obj_type_t",
+			mono:     "::fidl::basic_time<ZX_CLOCK_MONOTONIC>",
+		},
+		{
+			spelling: ZirconCSpelling,
+			rights:   "zx_rights_t",
+			objType:  "zx_obj_type_t",
+			mono:     "zx_instant_mono_t",
+		},
+		{
+			spelling: ZirconCppSpelling,
+			rights:   "::fidl::basic_rights<zx_rights_t>",
+			objType:  "::fidl::basic_obj_type<zx_obj_type_t>",
+			mono:     "::fidl::basic_time<ZX_CLOCK_MONOTONIC>",
+		},
+	} {
+		SetZirconSpelling(tc.spelling)
+
+		rights, ok := zirconType(zxLibrary, "Rights")
+		assertEqual(t, ok, true)
+		assertEqual(t, rights.String(), tc.rights)
+
+		objType, ok := zirconType(zxLibrary, "ObjType")
+		assertEqual(t, ok, true)
+		assertEqual(t, objType.String(), tc.objType)
+
+		mono, ok := zirconTime(parseIdent("zx/InstantMono"))
+		assertEqual(t, ok, true)
+		assertEqual(t, mono.String(), tc.mono)
+
+		// Types without a C++ wrapper keep their C spelling.
+		ticks, ok := zirconTime(parseIdent("zx/Ticks"))
+		assertEqual(t, ok, true)
+		assertEqual(t, ticks.String(), "zx_ticks_t")
+
+		// Value members are unaffected by the spelling.
+		read, ok := zirconValueMember(zxLibrary, "Rights", "READ")
+		assertEqual(t, ok, true)
+		assertEqual(t, read.String(), "ZX_RIGHT_READ")
+	}
+}
+
+func TestParseZirconSpelling(t *testing.T) {
+	spelling, err := ParseZirconSpelling("cpp")
+	assertEqual(t, err, nil)
+	assertEqual(t, spelling, ZirconCppSpelling)
+
+	if _, err := ParseZirconSpelling("rust"); err == nil {
+		t.Error("ParseZirconSpelling(rust) succeeded, want error")
+	}
+}
+
+func TestZirconName(t *testing.T) {
+	rights, err := zirconName(parseIdent("zx/Rights"))
+	assertEqual(t, err, nil)
+	assertEqual(t, rights.String(), "zx_rights_t")
+
+	read, err := zirconName(parseIdent("zx/Rights.READ"))
+	assertEqual(t, err, nil)
+	assertEqual(t, read.String(), "ZX_RIGHT_READ")
+
+	maxBytes, err := zirconName(parseIdent("zx/CHANNEL_MAX_MSG_BYTES"))
+	assertEqual(t, err, nil)
+	assertEqual(t, maxBytes.String(), "ZX_CHANNEL_MAX_MSG_BYTES")
+}
+
+func TestZirconNameErrors(t *testing.T) {
+	for _, tc := range []struct {
+		desc string
+		ci   fidlgen.CompoundIdentifier
+		want string
+	}{
+		{
+			desc: "empty name",
+			ci:   fidlgen.CompoundIdentifier{Library: fidlgen.LibraryIdentifier{"zx"}},
+			want: "has an empty name",
+		},
+		{
+			desc: "member in a non-zx library",
+			ci:   parseIdent("fuchsia.io/Rights.READ"),
+			want: "is not in a zircon library",
+		},
+		{
+			desc: "unknown type",
+			ci:   parseIdent("zx/Unknown"),
+			want: "zircon identifier zx/Unknown is not a known zircon name",
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			_, err := zirconName(tc.ci)
+			if err == nil {
+				t.Fatalf("zirconName(%s) succeeded, want error", tc.ci.Encode())
+			}
+			if !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("zirconName(%s) = %q, want error containing %q", tc.ci.Encode(), err, tc.want)
+			}
+		})
+	}
+}
+
+func TestZirconConstDurationUnits(t *testing.T) {
+	msec, err := zirconName(parseIdent("zx/MSEC"))
+	assertEqual(t, err, nil)
+	assertEqual(t, msec.String(), "ZX_MSEC(1)")
+
+	sec, err := zirconName(parseIdent("zx/SEC"))
+	assertEqual(t, err, nil)
+	assertEqual(t, sec.String(), "ZX_SEC(1)")
+}
+
+func TestZirconConstFunctionLikeMacro(t *testing.T) {
+	_, err := zirconName(parseIdent("zx/CLOCK_ARGS_VERSION"))
+	if err == nil {
+		t.Fatal("zirconName(zx/CLOCK_ARGS_VERSION) succeeded, want error")
+	}
+	want := "function-like macro ZX_CLOCK_ARGS_VERSION(...)"
+	if !strings.Contains(err.Error(), want) {
+		t.Errorf("got error %q, want error containing %q", err, want)
+	}
+}
+
+func TestNormalizeZirconMember(t *testing.T) {
+	for _, tc := range []struct {
+		member string
+		want   string
+	}{
+		{"READ", "READ"},
+		{"SAME_RIGHTS", "SAME_RIGHTS"},
+		{"vmo", "VMO"},
+		{"ioBufferRx", "IO_BUFFER_RX"},
+		{"vmoChildSnapshot", "VMO_CHILD_SNAPSHOT"},
+		{"VMOChild", "VMO_CHILD"},
+		{"cpuVMARRoot", "CPU_VMAR_ROOT"},
+		{"VMOIOBuffer", "VMO_IO_BUFFER"},
+		{"READProperty", "READ_PROPERTY"},
+	} {
+		assertEqual(t, normalizeZirconMember(tc.member), tc.want)
+	}
+}
+
+func TestZirconValueMemberAcronyms(t *testing.T) {
+	zn, ok := zirconValueMember(zxLibrary, "Rights", "opChildren")
+	assertEqual(t, ok, true)
+	assertEqual(t, zn.String(), "ZX_RIGHT_OP_CHILDREN")
+
+	zn, ok = zirconValueMember(zxLibrary, "ObjType", "vmoChildSnapshot")
+	assertEqual(t, ok, true)
+	assertEqual(t, zn.String(), "ZX_OBJ_TYPE_VMO_CHILD_SNAPSHOT")
+}
+
+func TestRegisterZirconLibrary(t *testing.T) {
+	err := registerZirconLibrary("zx.next", zirconLibrary{
+		names: map[string]zxName{
+			"Rights": {
+				typeName: "zx_next_rights_t",
+				prefix:   "ZX_NEXT_RIGHT",
+			},
+		},
+		times: map[string]zxName{
+			"InstantMono": {
+				cppTypeName: "fidl::next::basic_time<ZX_CLOCK_MONOTONIC>",
+			},
+		},
+	})
+	assertEqual(t, err, nil)
+	defer delete(zirconLibraries, "zx.next")
+
+	assertEqual(t, isZirconLibrary(parseIdent("zx.next/Rights").Library), true)
+
+	rights, err := zirconName(parseIdent("zx.next/Rights"))
+	assertEqual(t, err, nil)
+	assertEqual(t, rights.String(), "zx_next_rights_t")
+
+	read, err := zirconName(parseIdent("zx.next/Rights.READ"))
+	assertEqual(t, err, nil)
+	assertEqual(t, read.String(), "ZX_NEXT_RIGHT_READ")
+
+	mono, ok := zirconTime(parseIdent("zx.next/InstantMono"))
+	assertEqual(t, ok, true)
+	assertEqual(t, mono.String(), "::fidl::next::basic_time<ZX_CLOCK_MONOTONIC>")
+
+	// Names that only exist in zx don't leak into the sibling library.
+	if _, err := zirconName(parseIdent("zx.next/ObjType")); err == nil {
+		t.Error("zx.next/ObjType resolved, but zx.next doesn't define ObjType")
+	}
+
+	// zx resolution is unaffected.
+	zxRights, err := zirconName(parseIdent("zx/Rights"))
+	assertEqual(t, err, nil)
+	assertEqual(t, zxRights.String(), "zx_rights_t")
+
+	if err := registerZirconLibrary("zx", zirconLibrary{}); err == nil {
+		t.Error("registering zx a second time succeeded")
+	}
+}
+
+func TestDumpZirconNames(t *testing.T) {
+	var b strings.Builder
+	DumpZirconNames(&b)
+	dump := b.String()
+
+	for _, want := range []string{
+		"zx.Rights → zx_rights_t\n",
+		"zx.ObjType.<MEMBER> → ZX_OBJ_TYPE_<MEMBER>\n",
+		"zx.InstantMono → ::fidl::basic_time<ZX_CLOCK_MONOTONIC>\n",
+		"zx.Instant on clock Boot → zx.InstantBoot\n",
+	} {
+		if !strings.Contains(dump, want) {
+			t.Errorf("DumpZirconNames output doesn't contain %q:\n%s", want, dump)
+		}
+	}
+
+	// The output is stable across calls.
+	var again strings.Builder
+	DumpZirconNames(&again)
+	assertEqual(t, again.String(), dump)
+}
+
+func TestZirconTimeTicks(t *testing.T) {
+	ticks, ok := zirconTime(parseIdent("zx/Ticks"))
+	assertEqual(t, ok, true)
+	assertEqual(t, ticks.String(), "zx_ticks_t")
+
+	monoTicks, ok := zirconTime(parseIdent("zx/InstantMonoTicks"))
+	assertEqual(t, ok, true)
+	assertEqual(t, monoTicks.String(), "::fidl::basic_ticks<ZX_CLOCK_MONOTONIC>")
+
+	bootTicks, ok := zirconTime(parseIdent("zx/InstantBootTicks"))
+	assertEqual(t, ok, true)
+	assertEqual(t, bootTicks.String(), "::fidl::basic_ticks<ZX_CLOCK_BOOT>")
+}
+
+func TestZirconClockTimes(t *testing.T) {
+	// The presets are spelled as they were before they took a clock, which
+	// TestZirconTablesGolden also checks.
+	for _, tc := range []struct {
+		name, c, cpp string
+	}{
+		{"InstantMono", "zx_instant_mono_t", "fidl::basic_time<ZX_CLOCK_MONOTONIC>"},
+		{"InstantBoot", "zx_instant_boot_t", "fidl::basic_time<ZX_CLOCK_BOOT>"},
+		{"InstantMonoTicks", "zx_instant_mono_ticks_t", "fidl::basic_ticks<ZX_CLOCK_MONOTONIC>"},
+		{"InstantBootTicks", "zx_instant_boot_ticks_t", "fidl::basic_ticks<ZX_CLOCK_BOOT>"},
+	} {
+		zn := zirconTimes[tc.name]
+		assertEqual(t, zn.typeName, tc.c)
+		assertEqual(t, zn.cppTypeName, tc.cpp)
+		assertEqual(t, zn.include, "<zircon/time.h>")
+		assertEqual(t, zn.cppInclude, "<lib/fidl/cpp/time.h>")
+	}
+
+	err := registerZirconLibrary("zx.clocks", zirconLibrary{
+		times: map[string]zxName{
+			"InstantUtc":      zirconClockInstant("zx_instant_utc_t", "ZX_CLOCK_UTC"),
+			"InstantUtcTicks": zirconClockTicks("zx_instant_utc_ticks_t", "ZX_CLOCK_UTC"),
+		},
+	})
+	assertEqual(t, err, nil)
+	defer delete(zirconLibraries, "zx.clocks")
+
+	utc, ok := zirconTime(parseIdent("zx.clocks/InstantUtc"))
+	assertEqual(t, ok, true)
+	assertEqual(t, utc.String(), "::fidl::basic_time<ZX_CLOCK_UTC>")
+	assertEqual(t, utc.Name(), "basic_time<ZX_CLOCK_UTC>")
+
+	utcTicks, ok := zirconTime(parseIdent("zx.clocks/InstantUtcTicks"))
+	assertEqual(t, ok, true)
+	assertEqual(t, utcTicks.String(), "::fidl::basic_ticks<ZX_CLOCK_UTC>")
+
+	SetZirconSpelling(ZirconCSpelling)
+	defer SetZirconSpelling(ZirconDefaultSpelling)
+	utc, ok = zirconTime(parseIdent("zx.clocks/InstantUtc"))
+	assertEqual(t, ok, true)
+	assertEqual(t, utc.String(), "zx_instant_utc_t")
+}
+
+func TestZirconTimeOnClock(t *testing.T) {
+	for _, tc := range []struct {
+		ident, clock, want string
+	}{
+		{"zx/Instant", "Mono", "::fidl::basic_time<ZX_CLOCK_MONOTONIC>"},
+		{"zx/Instant", "boot", "::fidl::basic_time<ZX_CLOCK_BOOT>"},
+		// The clock of a sibling time type, ticks or not.
+		{"zx/Instant", "InstantBoot", "::fidl::basic_time<ZX_CLOCK_BOOT>"},
+		{"zx/Instant", "InstantMonoTicks", "::fidl::basic_time<ZX_CLOCK_MONOTONIC>"},
+		{"zx/InstantBoot", "", "::fidl::basic_time<ZX_CLOCK_BOOT>"},
+		{"zx/InstantBoot", "Boot", "::fidl::basic_time<ZX_CLOCK_BOOT>"},
+	} {
+		got, err := zirconTimeOnClock(parseIdent(tc.ident), tc.clock)
+		if err != nil {
+			t.Errorf("zirconTimeOnClock(%s, %q): %s", tc.ident, tc.clock, err)
+			continue
+		}
+		assertEqual(t, got.String(), tc.want)
+	}
+
+	for _, tc := range []struct {
+		ident, clock, want string
+	}{
+		{"zx/Instant", "", "is the clock-generic time type Instant, and no clock was given; valid clocks are Boot, Mono"},
+		{"zx/Instant", "Utc", `"Utc" is neither a clock nor a time type on one; valid clocks are Boot, Mono`},
+		{"zx/Instant", "Ticks", `"Ticks" is neither a clock nor a time type on one`},
+		{"zx/InstantBoot", "Mono", `on clock ZX_CLOCK_BOOT, but clock "Mono" was given`},
+		{"zx/Ticks", "Mono", `isn't tied to a clock, but clock "Mono" was given`},
+		{"zx/Rights", "Mono", "is not a zircon time type"},
+	} {
+		_, err := zirconTimeOnClock(parseIdent(tc.ident), tc.clock)
+		var zerr *ZirconNameError
+		if !errors.As(err, &zerr) {
+			t.Errorf("zirconTimeOnClock(%s, %q): got error %v, want a *ZirconNameError", tc.ident, tc.clock, err)
+		} else if !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("zirconTimeOnClock(%s, %q): got error %q, want error containing %q", tc.ident, tc.clock, err, tc.want)
+		}
+	}
+
+	// Without a clock, the generic time type maps to neither a time type nor
+	// a name.
+	if _, ok := zirconTime(parseIdent("zx/Instant")); ok {
+		t.Error("zirconTime(zx/Instant) succeeded, want no mapping")
+	}
+	_, err := zirconName(parseIdent("zx/Instant"))
+	if err == nil || !strings.Contains(err.Error(), "can't be mapped without a clock; use one of InstantBoot, InstantMono") {
+		t.Errorf("zirconName(zx/Instant): got error %v, want one naming the clock-specialized time types", err)
+	}
+
+	lib := zirconLibrary{
+		times:        map[string]zxName{"InstantMono": zirconTimes["InstantMono"]},
+		genericTimes: map[string]map[string]string{"Instant": {"Utc": "InstantUtc"}},
+	}
+	if err := lib.validate(); err == nil {
+		t.Error("validate succeeded for a clock-generic time type on a missing time type, want error")
+	}
+	lib.genericTimes = map[string]map[string]string{"instantMono": {"Mono": "InstantMono"}}
+	if err := lib.validate(); err == nil {
+		t.Error("validate succeeded for a clock-generic time type that is also a time type, want error")
+	}
+}
+
+func TestZirconTimeClock(t *testing.T) {
+	for _, tc := range []struct {
+		ident   string
+		generic bool
+		clock   string
+	}{
+		{"zx/Instant", true, ""},
+		{"zx/instant", true, ""},
+		{"zx/InstantBoot", false, "InstantBoot"},
+		{"zx/InstantMonoTicks", false, "InstantMonoTicks"},
+		{"zx/Ticks", false, ""},
+		{"zx/Rights", false, ""},
+		{"fuchsia.io/Instant", false, ""},
+	} {
+		ci := parseIdent(tc.ident)
+		assertEqual(t, isZirconGenericTime(ci), tc.generic)
+		clock, ok := zirconTimeClock(ci)
+		assertEqual(t, clock, tc.clock)
+		assertEqual(t, ok, tc.clock != "")
+	}
+
+	// The clock of a time type maps a generic one onto the same clock.
+	clock, _ := zirconTimeClock(parseIdent("zx/InstantBoot"))
+	zt, err := zirconTimeOnClock(parseIdent("zx/Instant"), clock)
+	assertEqual(t, err, nil)
+	assertEqual(t, zt.String(), "::fidl::basic_time<ZX_CLOCK_BOOT>")
+}
+
+func TestZirconTimeMember(t *testing.T) {
+	_, err := zirconName(parseIdent("zx/InstantMono.ZERO"))
+	if err == nil {
+		t.Fatal("zirconName(zx/InstantMono.ZERO) succeeded, want error")
+	}
+	want := "time type InstantMono, which has no value members"
+	if !strings.Contains(err.Error(), want) {
+		t.Errorf("got error %q, want error containing %q", err, want)
+	}
+}
+
+func TestZirconTimeCasing(t *testing.T) {
+	var warnings []string
+	defer func(f func(string, ...interface{})) { zirconWarningf = f }(zirconWarningf)
+	zirconWarningf = func(format string, a ...interface{}) {
+		warnings = append(warnings, fmt.Sprintf(format, a...))
+	}
+
+	exact, ok := zirconTime(parseIdent("zx/InstantMono"))
+	assertEqual(t, ok, true)
+	assertEqual(t, exact.String(), "::fidl::basic_time<ZX_CLOCK_MONOTONIC>")
+	assertEqual(t, len(warnings), 0)
+
+	fallback, ok := zirconTime(parseIdent("zx/instantMono"))
+	assertEqual(t, ok, true)
+	assertEqual(t, fallback.String(), "::fidl::basic_time<ZX_CLOCK_MONOTONIC>")
+	assertEqual(t, warnings, []string{"zircon time type zx.instantMono should be spelled zx.InstantMono\n"})
+	assertEqual(t, IsZirconIdentifier(parseIdent("zx/instantMono")), true)
+
+	_, err := zirconName(parseIdent("zx/InstantUtc"))
+	if err == nil {
+		t.Fatal("zirconName(zx/InstantUtc) succeeded, want error")
+	}
+	assertEqual(t, err.Error(), "zircon identifier zx/InstantUtc is not a known zircon time type; "+
+		"valid time types are InstantBoot, InstantBootTicks, InstantMono, InstantMonoTicks, Ticks")
+}
+
+func TestZirconConstConstexpr(t *testing.T) {
+	maxBytes, ok := zirconConst(zxLibrary, "CHANNEL_MAX_MSG_BYTES")
+	assertEqual(t, ok, true)
+	assertEqual(t, maxBytes.String(), "ZX_CHANNEL_MAX_MSG_BYTES")
+
+	SetZirconConstexprConsts(true)
+	defer SetZirconConstexprConsts(false)
+
+	maxBytes, ok = zirconConst(zxLibrary, "CHANNEL_MAX_MSG_BYTES")
+	assertEqual(t, ok, true)
+	assertEqual(t, maxBytes.String(), "::fidl::kChannelMaxMsgBytes")
+
+	// Constants without a constexpr equivalent keep their macro spelling.
+	other, ok := zirconConst(zxLibrary, "MAX_NAME_LEN")
+	assertEqual(t, ok, true)
+	assertEqual(t, other.String(), "ZX_MAX_NAME_LEN")
+}
+
+func TestZirconNameErrorWithLocation(t *testing.T) {
+	_, err := zirconName(parseIdent("zx/Unknown.MEMBER"))
+	if err == nil {
+		t.Fatal("zirconName(zx/Unknown.MEMBER) succeeded, want error")
+	}
+
+	var zerr *ZirconNameError
+	if !errors.As(err, &zerr) {
+		t.Fatalf("got error %T, want *ZirconNameError", err)
+	}
+	assertEqual(t, zerr.Identifier, parseIdent("zx/Unknown.MEMBER").Encode())
+
+	located := fmt.Errorf("example.fidl:12:5: %w", err)
+	if !errors.Is(located, err) {
+		t.Errorf("wrapping with a location lost the underlying error")
+	}
+	var locatedZerr *ZirconNameError
+	if !errors.As(located, &locatedZerr) {
+		t.Fatalf("got error %T, want a wrapped *ZirconNameError", located)
+	}
+	assertEqual(t, locatedZerr.Identifier, zerr.Identifier)
+	assertEqual(t, located.Error(), "example.fidl:12:5: "+err.Error())
+}
+
+func TestZirconHandleSubtype(t *testing.T) {
+	// An explicit zx.ObjType member.
+	channel, err := zirconName(parseIdent("zx/ObjType.CHANNEL"))
+	assertEqual(t, err, nil)
+	assertEqual(t, channel.String(), "ZX_OBJ_TYPE_CHANNEL")
+
+	// A handle-subtype member renders as the same object type macro.
+	subtype, err := zirconName(parseIdent("zx/HandleSubtype.channel"))
+	assertEqual(t, err, nil)
+	assertEqual(t, subtype.String(), "ZX_OBJ_TYPE_CHANNEL")
+
+	subtypeType, err := zirconName(parseIdent("zx/HandleSubtype"))
+	assertEqual(t, err, nil)
+	assertEqual(t, subtypeType.String(), "zx_obj_type_t")
+
+	// Handle subtypes from the IR, as used in handle-rights tables.
+	fromIR, ok := zirconHandleSubtype(fidlgen.HandleSubtypeChannel)
+	assertEqual(t, ok, true)
+	assertEqual(t, fromIR.String(), "ZX_OBJ_TYPE_CHANNEL")
+
+	suspendToken, ok := zirconHandleSubtype(fidlgen.HandleSubtypeSuspendToken)
+	assertEqual(t, ok, true)
+	assertEqual(t, suspendToken.String(), "ZX_OBJ_TYPE_SUSPEND_TOKEN")
+}
+
+// zirconBenchmarkIdentifiers approximates the mix of zircon references in a
+// large library: mostly rights and object types on handles, with fewer
+// constants and bare types.
+var zirconBenchmarkIdentifiers = func() []fidlgen.CompoundIdentifier {
+	var ids []fidlgen.CompoundIdentifier
+	add := func(s string, weight int) {
+		for i := 0; i < weight; i++ {
+			ids = append(ids, parseIdent(s))
+		}
+	}
+	add("zx/Rights.READ", 8)
+	add("zx/Rights.WRITE", 6)
+	add("zx/Rights.SAME_RIGHTS", 4)
+	add("zx/ObjType.CHANNEL", 6)
+	add("zx/ObjType.VMO", 4)
+	add("zx/Rights", 3)
+	add("zx/ObjType", 2)
+	add("zx/CHANNEL_MAX_MSG_BYTES", 2)
+	add("zx/MAX_NAME_LEN", 1)
+	return ids
+}()
+
+// BenchmarkZirconName measures mapping zircon identifiers, both one path at a
+// time and as a realistic mix. The target budget is at most 4 allocs/op for
+// each of the type, member and const paths, i.e. at most 4 allocs per
+// identifier in the mixed case. Camel-case members such as vmoChildSnapshot
+// need to be split into words and are expected to cost more, but are rare.
+func BenchmarkZirconName(b *testing.B) {
+	for _, bc := range []struct {
+		desc string
+		ids  []fidlgen.CompoundIdentifier
+	}{
+		{"type", []fidlgen.CompoundIdentifier{parseIdent("zx/Rights")}},
+		{"member", []fidlgen.CompoundIdentifier{parseIdent("zx/Rights.READ")}},
+		{"camel_member", []fidlgen.CompoundIdentifier{parseIdent("zx/ObjType.vmoChildSnapshot")}},
+		{"const", []fidlgen.CompoundIdentifier{parseIdent("zx/CHANNEL_MAX_MSG_BYTES")}},
+		{"mixed", zirconBenchmarkIdentifiers},
+	} {
+		b.Run(bc.desc, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				for _, ci := range bc.ids {
+					if _, err := zirconName(ci); err != nil {
+						b.Fatal(err)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestZirconConstPrefixPerLibrary(t *testing.T) {
+	err := registerZirconLibrary("zx.sibling", zirconLibrary{
+		constPrefix: "ZXS_",
+	})
+	assertEqual(t, err, nil)
+	defer delete(zirconLibraries, "zx.sibling")
+
+	sibling, err := zirconName(parseIdent("zx.sibling/CHANNEL_MAX_MSG_BYTES"))
+	assertEqual(t, err, nil)
+	assertEqual(t, sibling.String(), "ZXS_CHANNEL_MAX_MSG_BYTES")
+
+	// zx-specific constants don't apply to the sibling library.
+	msec, err := zirconName(parseIdent("zx.sibling/MSEC"))
+	assertEqual(t, err, nil)
+	assertEqual(t, msec.String(), "ZXS_MSEC")
+
+	zx, err := zirconName(parseIdent("zx/CHANNEL_MAX_MSG_BYTES"))
+	assertEqual(t, err, nil)
+	assertEqual(t, zx.String(), "ZX_CHANNEL_MAX_MSG_BYTES")
+}
+
+func TestZirconConstMember(t *testing.T) {
+	_, err := zirconName(parseIdent("zx/CHANNEL_MAX_MSG_BYTES.FOO"))
+	if err == nil {
+		t.Fatal("zirconName(zx/CHANNEL_MAX_MSG_BYTES.FOO) succeeded, want error")
+	}
+	assertEqual(t, err.Error(),
+		"zircon identifier zx/CHANNEL_MAX_MSG_BYTES.FOO refers to member FOO of constant CHANNEL_MAX_MSG_BYTES, but constants can't be member-accessed")
+}
+
+func TestZirconResourceKind(t *testing.T) {
+	for _, typeName := range []string{"ResourceKind", "Rsrc"} {
+		kind, err := zirconName(parseIdent("zx/" + typeName))
+		assertEqual(t, err, nil)
+		assertEqual(t, kind.String(), "zx_rsrc_kind_t")
+
+		root, err := zirconName(parseIdent("zx/" + typeName + ".ROOT"))
+		assertEqual(t, err, nil)
+		assertEqual(t, root.String(), "ZX_RSRC_KIND_ROOT")
+
+		mmio, err := zirconName(parseIdent("zx/" + typeName + ".MMIO"))
+		assertEqual(t, err, nil)
+		assertEqual(t, mmio.String(), "ZX_RSRC_KIND_MMIO")
+	}
+}
+
+func TestZirconTypeCaseInsensitiveFallback(t *testing.T) {
+	var warnings []string
+	defer func(f func(string, ...interface{})) { zirconWarningf = f }(zirconWarningf)
+	zirconWarningf = func(format string, a ...interface{}) {
+		warnings = append(warnings, fmt.Sprintf(format, a...))
+	}
+
+	exact, ok := zirconType(zxLibrary, "Rights")
+	assertEqual(t, ok, true)
+	assertEqual(t, exact.String(), "zx_rights_t")
+	assertEqual(t, len(warnings), 0)
+
+	fallback, ok := zirconType(zxLibrary, "rights")
+	assertEqual(t, ok, true)
+	assertEqual(t, fallback.String(), "zx_rights_t")
+	assertEqual(t, warnings, []string{"zircon type zx.rights should be spelled zx.Rights\n"})
+
+	member, ok := zirconValueMember(zxLibrary, "rights", "READ")
+	assertEqual(t, ok, true)
+	assertEqual(t, member.String(), "ZX_RIGHT_READ")
+
+	// All-caps names are constants, never case-insensitive type matches.
+	constant, err := zirconName(parseIdent("zx/RIGHTS"))
+	assertEqual(t, err, nil)
+	assertEqual(t, constant.String(), "ZX_RIGHTS")
+}
+
+func TestIsZirconIdentifier(t *testing.T) {
+	for _, tc := range []struct {
+		ident string
+		want  bool
+	}{
+		{"zx/Rights", true},
+		{"zx/Rights.READ", true},
+		{"zx/CHANNEL_MAX_MSG_BYTES", true},
+		{"zx/MSEC", true},
+		{"zx/InstantMono", true},
+		{"zx/Unknown", false},
+		{"zx/Unknown.MEMBER", false},
+		{"zx/InstantMono.ZERO", false},
+		{"zx/CLOCK_ARGS_VERSION", false},
+		{"fuchsia.io/Rights", false},
+	} {
+		ci := parseIdent(tc.ident)
+		assertEqual(t, IsZirconIdentifier(ci), tc.want)
+
+		// IsZirconIdentifier agrees with the full mapping.
+		_, isTime := zirconTime(ci)
+		_, err := zirconName(ci)
+		assertEqual(t, isTime || err == nil, tc.want)
+		if !tc.want {
+			assertEqual(t, zirconNameDiagnosis(ci) != nil, true)
+		}
+	}
+}
+
+func TestZirconValueMemberEmptyAfterNormalization(t *testing.T) {
+	assertEqual(t, normalizeZirconMember("__"), "")
+
+	if zn, ok := zirconValueMember(zxLibrary, "Rights", "__"); ok {
+		t.Errorf("zirconValueMember(Rights, __) = %s, want no match", zn)
+	}
+
+	_, err := zirconName(parseIdent("zx/Rights.__"))
+	if err == nil {
+		t.Fatal("zirconName(zx/Rights.__) succeeded, want error")
+	}
+	assertEqual(t, err.Error(),
+		`zircon identifier zx/Rights.__ has member "__", which has no characters other than separators`)
+}
+
+func TestZirconAddressTypes(t *testing.T) {
+	for _, tc := range []struct {
+		ident string
+		want  string
+	}{
+		{"zx/Vaddr", "zx_vaddr_t"},
+		{"zx/Paddr", "zx_paddr_t"},
+		{"zx/Gpaddr", "zx_gpaddr_t"},
+		{"zx/Off", "zx_off_t"},
+	} {
+		zn, err := zirconName(parseIdent(tc.ident))
+		assertEqual(t, err, nil)
+		assertEqual(t, zn.String(), tc.want)
+	}
+
+	_, err := zirconName(parseIdent("zx/Vaddr.ZERO"))
+	if err == nil {
+		t.Fatal("zirconName(zx/Vaddr.ZERO) succeeded, want error")
+	}
+	assertEqual(t, err.Error(),
+		"zircon identifier zx/Vaddr.ZERO refers to a member of scalar type Vaddr, which has no value members")
+	assertEqual(t, IsZirconIdentifier(parseIdent("zx/Vaddr.ZERO")), false)
+}
+
+type wireZirconNameFormatter struct{}
+
+func (wireZirconNameFormatter) FormatZirconType(t ZirconTypeSpelling) string {
+	return "wire::" + t.Name
+}
+
+func TestZirconNameFormatter(t *testing.T) {
+	rights, ok := zirconType(zxLibrary, "Rights")
+	assertEqual(t, ok, true)
+	assertEqual(t, rights.String(), "zx_rights_t")
+
+	SetZirconNameFormatter(wireZirconNameFormatter{})
+	defer SetZirconNameFormatter(nil)
+
+	rights, ok = zirconType(zxLibrary, "Rights")
+	assertEqual(t, ok, true)
+	assertEqual(t, rights.String(), "::wire::Rights")
+
+	mono, ok := zirconTime(parseIdent("zx/InstantMono"))
+	assertEqual(t, ok, true)
+	assertEqual(t, mono.String(), "::wire::InstantMono")
+
+	// Value members are unaffected by the formatter.
+	read, err := zirconName(parseIdent("zx/Rights.READ"))
+	assertEqual(t, err, nil)
+	assertEqual(t, read.String(), "ZX_RIGHT_READ")
+
+	SetZirconNameFormatter(nil)
+	rights, ok = zirconType(zxLibrary, "Rights")
+	assertEqual(t, ok, true)
+	assertEqual(t, rights.String(), "zx_rights_t")
+}
+
+func TestZirconLibraryValidate(t *testing.T) {
+	for library, lib := range zirconLibraries {
+		if err := lib.validate(); err != nil {
+			t.Errorf("zircon library %s: %s", library, err)
+		}
+	}
+
+	err := registerZirconLibrary("zx.overlap", zirconLibrary{
+		names: map[string]zxName{
+			"Ticks": {typeName: "zx_overlap_ticks_t"},
+		},
+		times: map[string]zxName{
+			"ticks": {typeName: "zx_ticks_t"},
+		},
+	})
+	if err == nil {
+		defer delete(zirconLibraries, "zx.overlap")
+		t.Fatal("registerZirconLibrary(zx.overlap) succeeded, want error")
+	}
+	assertEqual(t, err.Error(), "zircon library zx.overlap: Ticks is both a type and a time type")
+	_, ok := zirconLibraries["zx.overlap"]
+	assertEqual(t, ok, false)
+}
+
+func TestZirconExceptionAndPacketTypes(t *testing.T) {
+	for _, tc := range []struct {
+		ident string
+		want  string
+	}{
+		{"zx/ExceptionType", "zx_excp_type_t"},
+		{"zx/ExceptionType.GENERAL", "ZX_EXCP_GENERAL"},
+		{"zx/ExceptionType.FatalPageFault", "ZX_EXCP_FATAL_PAGE_FAULT"},
+		{"zx/PacketType", "uint32_t"},
+		{"zx/PacketType.SIGNAL_ONE", "ZX_PKT_TYPE_SIGNAL_ONE"},
+		{"zx/PacketType.GuestBell", "ZX_PKT_TYPE_GUEST_BELL"},
+	} {
+		zn, err := zirconName(parseIdent(tc.ident))
+		assertEqual(t, err, nil)
+		assertEqual(t, zn.String(), tc.want)
+	}
+}
+
+func TestZirconSignalFamilies(t *testing.T) {
+	for _, tc := range []struct {
+		ident string
+		want  string
+	}{
+		{"zx/Signals", "zx_signals_t"},
+		{"zx/Signals.NONE", "ZX_SIGNAL_NONE"},
+		{"zx/Signals.USER_0", "ZX_USER_SIGNAL_0"},
+		{"zx/Signals.USER_ALL", "ZX_USER_SIGNAL_ALL"},
+		// A bare qualifier isn't a member of the family.
+		{"zx/Signals.USER", "ZX_SIGNAL_USER"},
+	} {
+		zn, err := zirconName(parseIdent(tc.ident))
+		assertEqual(t, err, nil)
+		assertEqual(t, zn.String(), tc.want)
+	}
+}
+
+func TestZirconAllowlist(t *testing.T) {
+	SetZirconAllowlist([]string{"Rights"})
+	defer SetZirconAllowlist(nil)
+
+	rights, err := zirconName(parseIdent("zx/Rights"))
+	assertEqual(t, err, nil)
+	assertEqual(t, rights.String(), "zx_rights_t")
+
+	read, err := zirconName(parseIdent("zx/Rights.READ"))
+	assertEqual(t, err, nil)
+	assertEqual(t, read.String(), "ZX_RIGHT_READ")
+
+	_, err = zirconName(parseIdent("zx/ObjType"))
+	if err == nil {
+		t.Fatal("zirconName(zx/ObjType) succeeded, want error")
+	}
+	assertEqual(t, err.Error(), "zircon identifier zx/ObjType is not in the zircon allowlist")
+
+	// Invalid names report why they're invalid, not that they're disallowed.
+	_, err = zirconName(parseIdent("zx/Unknown.MEMBER"))
+	assertEqual(t, err.Error(), "zircon identifier zx/Unknown.MEMBER is not a known zircon name")
+
+	// The allowlist holds canonical names, which other spellings match.
+	rights, err = zirconName(parseIdent("zx/rights"))
+	assertEqual(t, err, nil)
+	assertEqual(t, rights.String(), "zx_rights_t")
+	assertEqual(t, IsZirconIdentifier(parseIdent("zx/rights.READ")), true)
+
+	// Time types and the other ways of mapping a name check it too.
+	assertEqual(t, IsZirconIdentifier(parseIdent("zx/ObjType")), false)
+	assertEqual(t, IsZirconIdentifier(parseIdent("zx/InstantMono")), false)
+	if _, ok := zirconTime(parseIdent("zx/InstantMono")); ok {
+		t.Error("zirconTime(zx/InstantMono) succeeded, want it excluded")
+	}
+	_, err = zirconTimeOnClock(parseIdent("zx/InstantMono"), "")
+	assertEqual(t, err.Error(), "zircon identifier zx/InstantMono is not in the zircon allowlist")
+	_, err = zirconTimeOnClock(parseIdent("zx/Instant"), "Mono")
+	assertEqual(t, err.Error(), "zircon identifier zx/Instant is not in the zircon allowlist")
+
+	SetZirconAllowlist([]string{"InstantMono", "Instant"})
+	mono, ok := zirconTime(parseIdent("zx/instantMono"))
+	assertEqual(t, ok, true)
+	assertEqual(t, mono.String(), "::fidl::basic_time<ZX_CLOCK_MONOTONIC>")
+	onClock, err := zirconTimeOnClock(parseIdent("zx/instant"), "Mono")
+	assertEqual(t, err, nil)
+	assertEqual(t, onClock.String(), mono.String())
+
+	SetZirconAllowlist(nil)
+	objType, err := zirconName(parseIdent("zx/ObjType"))
+	assertEqual(t, err, nil)
+	assertEqual(t, objType.String(), "zx_obj_type_t")
+}
+
+func TestZirconInclude(t *testing.T) {
+	for _, tc := range []struct {
+		ident string
+		want  string
+	}{
+		{"zx/Rights", "<zircon/types.h>"},
+		{"zx/Rights.READ", "<zircon/types.h>"},
+		{"zx/ExceptionType.GENERAL", "<zircon/syscalls/exception.h>"},
+		{"zx/Ticks", "<zircon/types.h>"},
+	} {
+		include, ok := zirconInclude(parseIdent(tc.ident))
+		assertEqual(t, ok, true)
+		assertEqual(t, include, tc.want)
+	}
+
+	_, ok := zirconInclude(parseIdent("zx/CHANNEL_MAX_MSG_BYTES"))
+	assertEqual(t, ok, false)
+
+	// Time types are spelled as C++ wrappers by default, whose headers are
+	// only included if the C++ spelling is asked for.
+	_, ok = zirconInclude(parseIdent("zx/InstantMono"))
+	assertEqual(t, ok, false)
+
+	defer SetZirconSpelling(ZirconDefaultSpelling)
+	SetZirconSpelling(ZirconCSpelling)
+	include, ok := zirconInclude(parseIdent("zx/InstantMono"))
+	assertEqual(t, ok, true)
+	assertEqual(t, include, "<zircon/time.h>")
+
+	SetZirconSpelling(ZirconCppSpelling)
+	include, ok = zirconInclude(parseIdent("zx/InstantMono"))
+	assertEqual(t, ok, true)
+	assertEqual(t, include, "<lib/fidl/cpp/time.h>")
+	include, ok = zirconInclude(parseIdent("zx/Rights"))
+	assertEqual(t, ok, true)
+	assertEqual(t, include, "<lib/fidl/cpp/zircon.h>")
+}
+
+func TestZirconIncludeKind(t *testing.T) {
+	for _, tc := range []struct {
+		ident string
+		want  zirconIncludeKind
+	}{
+		{"zx/Rights", zirconTypedefInclude},
+		{"zx/Rights.READ", zirconTypedefInclude},
+		{"zx/Ticks", zirconTypedefInclude},
+		{"zx/ProfileInfo", zirconForwardDeclarable},
+	} {
+		kind, ok := zirconIncludeKindOf(parseIdent(tc.ident))
+		assertEqual(t, ok, true)
+		assertEqual(t, kind, tc.want)
+	}
+
+	_, ok := zirconIncludeKindOf(parseIdent("zx/CHANNEL_MAX_MSG_BYTES"))
+	assertEqual(t, ok, false)
+	_, ok = zirconIncludeKindOf(parseIdent("zx/InstantMono"))
+	assertEqual(t, ok, false)
+
+	// With C spellings, time types are plain typedefs too.
+	defer SetZirconSpelling(ZirconDefaultSpelling)
+	SetZirconSpelling(ZirconCSpelling)
+	kind, ok := zirconIncludeKindOf(parseIdent("zx/InstantMono"))
+	assertEqual(t, ok, true)
+	assertEqual(t, kind, zirconTypedefInclude)
+
+	// With C++ spellings, the wrappers must be included in full.
+	SetZirconSpelling(ZirconCppSpelling)
+	for _, ident := range []string{"zx/InstantMono", "zx/InstantBootTicks", "zx/Rights"} {
+		kind, ok := zirconIncludeKindOf(parseIdent(ident))
+		assertEqual(t, ok, true)
+		assertEqual(t, kind, zirconFullInclude)
+	}
+}
+
+func TestZirconIncludes(t *testing.T) {
+	includes := zirconIncludes([]fidlgen.CompoundIdentifier{
+		parseIdent("zx/InstantMono"),
+		parseIdent("zx/ProfileInfo"),
+		parseIdent("zx/Rights"),
+		parseIdent("zx/Rights.READ"),
+		parseIdent("zx/CHANNEL_MAX_MSG_BYTES"),
+		parseIdent("zx/InstantBoot"),
+	})
+	assertEqual(t, includes, []string{
+		"<zircon/syscalls/profile.h>",
+		"<zircon/types.h>",
+	})
+
+	defer SetZirconSpelling(ZirconDefaultSpelling)
+	SetZirconSpelling(ZirconCppSpelling)
+	includes = zirconIncludes([]fidlgen.CompoundIdentifier{
+		parseIdent("zx/InstantMono"),
+		parseIdent("zx/Rights"),
+		parseIdent("zx/Rights.READ"),
+	})
+	assertEqual(t, includes, []string{
+		"<zircon/types.h>",
+		"<lib/fidl/cpp/time.h>",
+		"<lib/fidl/cpp/zircon.h>",
+	})
+}
+
+func TestZirconPlatformTypes(t *testing.T) {
+	for _, tc := range []struct {
+		ident string
+		want  string
+	}{
+		{"zx/FeatureKind", "zx_feature_kind_t"},
+		{"zx/FeatureKind.CPU", "ZX_FEATURE_KIND_CPU"},
+		{"zx/SystemPowerState", "zx_system_power_state_t"},
+		{"zx/SystemPowerState.REBOOT", "ZX_SYSTEM_POWER_STATE_REBOOT"},
+		{"zx/SystemPowerState.RebootBootloader", "ZX_SYSTEM_POWER_STATE_REBOOT_BOOTLOADER"},
+	} {
+		zn, err := zirconName(parseIdent(tc.ident))
+		assertEqual(t, err, nil)
+		assertEqual(t, zn.String(), tc.want)
+	}
+
+	_, err := zirconName(parseIdent("zx/SystemPowerState.HIBERNATE"))
+	if err == nil {
+		t.Fatal("zirconName(zx/SystemPowerState.HIBERNATE) succeeded, want error")
+	}
+	assertEqual(t, err.Error(), "zircon identifier zx/SystemPowerState.HIBERNATE is not a known member of "+
+		"SystemPowerState; valid members are REBOOT, REBOOT_BOOTLOADER, REBOOT_RECOVERY, SHUTDOWN")
+	assertEqual(t, IsZirconIdentifier(parseIdent("zx/SystemPowerState.HIBERNATE")), false)
+}
+
+type qualifiedArgZirconNameFormatter struct{}
+
+func (qualifiedArgZirconNameFormatter) FormatZirconType(t ZirconTypeSpelling) string {
+	return "fidl::basic_time<zx::clock::monotonic>"
+}
+
+func TestZirconTimeTemplateName(t *testing.T) {
+	mono, ok := zirconTime(parseIdent("zx/InstantMono"))
+	assertEqual(t, ok, true)
+	assertEqual(t, mono.String(), "::fidl::basic_time<ZX_CLOCK_MONOTONIC>")
+	assertEqual(t, mono.NoLeading(), "fidl::basic_time<ZX_CLOCK_MONOTONIC>")
+	assertEqual(t, mono.Self(), "basic_time")
+	assertEqual(t, mono.Namespace(), namespace([]string{"fidl"}))
+
+	// Template arguments containing "::" must not be split as namespaces.
+	SetZirconNameFormatter(qualifiedArgZirconNameFormatter{})
+	defer SetZirconNameFormatter(nil)
+	mono, ok = zirconTime(parseIdent("zx/InstantMono"))
+	assertEqual(t, ok, true)
+	assertEqual(t, mono.String(), "::fidl::basic_time<zx::clock::monotonic>")
+	assertEqual(t, mono.Namespace(), namespace([]string{"fidl"}))
+}
+
+func TestZirconStrictConsts(t *testing.T) {
+	defer SetZirconStrictConsts(false)
+	for _, strict := range []bool{false, true} {
+		SetZirconStrictConsts(strict)
+		for _, tc := range []struct {
+			ident string
+			want  string
+		}{
+			{"zx/CHANNEL_MAX_MSG_BYTES", "ZX_CHANNEL_MAX_MSG_BYTES"},
+			{"zx/KOID_INVALID", "ZX_KOID_INVALID"},
+			{"zx/MSEC", "ZX_MSEC(1)"},
+		} {
+			zn, err := zirconName(parseIdent(tc.ident))
+			assertEqual(t, err, nil)
+			assertEqual(t, zn.String(), tc.want)
+		}
+	}
+
+	SetZirconStrictConsts(false)
+	typo, err := zirconName(parseIdent("zx/CHANEL_MAX_MSG_BYTES"))
+	assertEqual(t, err, nil)
+	assertEqual(t, typo.String(), "ZX_CHANEL_MAX_MSG_BYTES")
+
+	SetZirconStrictConsts(true)
+	_, err = zirconName(parseIdent("zx/CHANEL_MAX_MSG_BYTES"))
+	if err == nil {
+		t.Fatal("zirconName(zx/CHANEL_MAX_MSG_BYTES) succeeded in strict mode, want error")
+	}
+	assertEqual(t, err.Error(), "zircon identifier zx/CHANEL_MAX_MSG_BYTES "+
+		"is not a known zircon constant, and strict constant mode is enabled")
+	assertEqual(t, IsZirconIdentifier(parseIdent("zx/CHANEL_MAX_MSG_BYTES")), false)
+}
+
+func TestZirconSchedulingTypes(t *testing.T) {
+	for _, tc := range []struct {
+		ident string
+		want  string
+	}{
+		{"zx/ProfileInfo", "zx_profile_info_t"},
+		{"zx/CpuSet", "zx_cpu_set_t"},
+		{"zx/Priority", "int32_t"},
+		{"zx/Priority.DEFAULT", "ZX_PRIORITY_DEFAULT"},
+		{"zx/Priority.Highest", "ZX_PRIORITY_HIGHEST"},
+	} {
+		zn, err := zirconName(parseIdent(tc.ident))
+		assertEqual(t, err, nil)
+		assertEqual(t, zn.String(), tc.want)
+	}
+
+	_, err := zirconName(parseIdent("zx/CpuSet.MASK"))
+	if err == nil {
+		t.Fatal("zirconName(zx/CpuSet.MASK) succeeded, want error")
+	}
+	assertEqual(t, err.Error(), "zircon identifier zx/CpuSet.MASK refers to a member of struct type CpuSet, "+
+		"which has fields rather than value members")
+}
+
+func TestZirconExportedLookups(t *testing.T) {
+	rights, ok := ZirconType("Rights")
+	assertEqual(t, ok, true)
+	assertEqual(t, rights, "zx_rights_t")
+
+	_, ok = ZirconType("NotAType")
+	assertEqual(t, ok, false)
+
+	maxBytes, ok := ZirconConst("CHANNEL_MAX_MSG_BYTES")
+	assertEqual(t, ok, true)
+	assertEqual(t, maxBytes, "ZX_CHANNEL_MAX_MSG_BYTES")
+
+	_, ok = ZirconConst("NotAConst")
+	assertEqual(t, ok, false)
+
+	read, ok := ZirconValueMember("Rights", "READ")
+	assertEqual(t, ok, true)
+	assertEqual(t, read, "ZX_RIGHT_READ")
+
+	_, ok = ZirconValueMember("Vaddr", "ZERO")
+	assertEqual(t, ok, false)
+}
+
+func TestZirconConstFallbackHook(t *testing.T) {
+	type fallback struct {
+		ci    fidlgen.EncodedCompoundIdentifier
+		macro string
+	}
+	var fallbacks []fallback
+	SetZirconConstFallbackHook(func(ci fidlgen.EncodedCompoundIdentifier, macro string) {
+		fallbacks = append(fallbacks, fallback{ci, macro})
+	})
+	defer SetZirconConstFallbackHook(nil)
+
+	for _, ident := range []string{"zx/Rights", "zx/Rights.READ", "zx/KOID_INVALID", "zx/MSEC"} {
+		_, err := zirconName(parseIdent(ident))
+		assertEqual(t, err, nil)
+	}
+	assertEqual(t, len(fallbacks), 0)
+
+	zn, err := zirconName(parseIdent("zx/UNVETTED_CONST"))
+	assertEqual(t, err, nil)
+	assertEqual(t, zn.String(), "ZX_UNVETTED_CONST")
+	if len(fallbacks) != 1 {
+		t.Fatalf("got %d fallbacks, want 1", len(fallbacks))
+	}
+	assertEqual(t, string(fallbacks[0].ci), "zx/UNVETTED_CONST")
+	assertEqual(t, fallbacks[0].macro, "ZX_UNVETTED_CONST")
+}
+
+func TestZirconInterruptAndIobTypes(t *testing.T) {
+	for _, tc := range []struct {
+		ident string
+		want  string
+	}{
+		{"zx/InterruptFlags", "uint32_t"},
+		{"zx/InterruptFlags.VIRTUAL", "ZX_INTERRUPT_VIRTUAL"},
+		{"zx/InterruptFlags.ModeEdgeHigh", "ZX_INTERRUPT_MODE_EDGE_HIGH"},
+		{"zx/IobAccess", "zx_iob_access_t"},
+		{"zx/IobAccess.EP0_CAN_MAP_READ", "ZX_IOB_ACCESS_EP0_CAN_MAP_READ"},
+		{"zx/IobDisciplineType", "zx_iob_discipline_type_t"},
+		{"zx/IobDisciplineType.ID_ALLOCATOR", "ZX_IOB_DISCIPLINE_TYPE_ID_ALLOCATOR"},
+		{"zx/IobRegionType", "zx_iob_region_type_t"},
+		{"zx/IobRegionType.Private", "ZX_IOB_REGION_TYPE_PRIVATE"},
+	} {
+		zn, err := zirconName(parseIdent(tc.ident))
+		assertEqual(t, err, nil)
+		assertEqual(t, zn.String(), tc.want)
+	}
+
+	_, err := zirconName(parseIdent("zx/IobRegionType.PUBLIC"))
+	if err == nil {
+		t.Fatal("zirconName(zx/IobRegionType.PUBLIC) succeeded, want error")
+	}
+	assertEqual(t, err.Error(), "zircon identifier zx/IobRegionType.PUBLIC is not a known member of "+
+		"IobRegionType; valid members are PRIVATE, SHARED")
+}
+
+func TestZirconVmoChildOptions(t *testing.T) {
+	for _, tc := range []struct {
+		ident string
+		want  string
+	}{
+		{"zx/VmoChildOptions", "uint32_t"},
+		{"zx/VmoChildOptions.SNAPSHOT", "ZX_VMO_CHILD_SNAPSHOT"},
+		{"zx/VmoChildOptions.SnapshotAtLeastOnWrite", "ZX_VMO_CHILD_SNAPSHOT_AT_LEAST_ON_WRITE"},
+		{"zx/VmoChildOptions.NO_WRITE", "ZX_VMO_CHILD_NO_WRITE"},
+		{"zx/VmoChildOptions.Reference", "ZX_VMO_CHILD_REFERENCE"},
+		{"zx/VmoChildOptions.SNAPSHOT_MODIFIED", "ZX_VMO_CHILD_SNAPSHOT_MODIFIED"},
+	} {
+		zn, err := zirconName(parseIdent(tc.ident))
+		assertEqual(t, err, nil)
+		assertEqual(t, zn.String(), tc.want)
+	}
+
+	// zx_vmo_create's options aren't child options.
+	if _, err := zirconName(parseIdent("zx/VmoChildOptions.DISCARDABLE")); err == nil {
+		t.Fatal("zirconName(zx/VmoChildOptions.DISCARDABLE) succeeded, want error")
+	}
+}
+
+func TestZirconRightsMembers(t *testing.T) {
+	for _, tc := range []struct {
+		ident string
+		want  string
+	}{
+		{"zx/Rights.SAME_RIGHTS", "ZX_RIGHT_SAME_RIGHTS"},
+		{"zx/Rights.sameRights", "ZX_RIGHT_SAME_RIGHTS"},
+		{"zx/Rights.BASIC", "ZX_RIGHTS_BASIC"},
+		{"zx/Rights.IO", "ZX_RIGHTS_IO"},
+		{"zx/Rights.MANAGE_VMO", "ZX_RIGHT_MANAGE_VMO"},
+	} {
+		zn, err := zirconName(parseIdent(tc.ident))
+		assertEqual(t, err, nil)
+		assertEqual(t, zn.String(), tc.want)
+	}
+
+	// A misspelled right would name a macro that doesn't exist.
+	if _, ok := zirconValueMember(zxLibrary, "Rights", "DUPLICTE"); ok {
+		t.Fatal("zirconValueMember(Rights, DUPLICTE) succeeded, want failure")
+	}
+	if _, err := zirconName(parseIdent("zx/Rights.DUPLICTE")); err == nil {
+		t.Fatal("zirconName(zx/Rights.DUPLICTE) succeeded, want error")
+	}
+}
+
+func TestZirconMemberMacrosValidate(t *testing.T) {
+	lib := zirconLibrary{
+		names: map[string]zxName{
+			"Rights": {typeName: "zx_rights_t", prefix: "ZX_RIGHT", members: []string{"READ"}},
+		},
+		memberMacros: map[string]map[string]string{
+			"Rights": {"BASIC": "ZX_RIGHTS_BASIC"},
+		},
+	}
+	if err := lib.validate(); err == nil {
+		t.Fatal("validate succeeded for a macro of a member that isn't listed, want error")
+	}
+	lib.memberMacros = map[string]map[string]string{"Unknown": {"BASIC": "ZX_RIGHTS_BASIC"}}
+	if err := lib.validate(); err == nil {
+		t.Fatal("validate succeeded for member macros of an unknown type, want error")
+	}
+}
+
+func TestZirconLibraryNormalization(t *testing.T) {
+	for _, tc := range []struct {
+		library fidlgen.LibraryIdentifier
+		want    bool
+	}{
+		{fidlgen.LibraryIdentifier{"zx"}, true},
+		{fidlgen.LibraryIdentifier{"zx", ""}, true},
+		{fidlgen.LibraryIdentifier{" zx "}, true},
+		{fidlgen.LibraryIdentifier{"zx."}, true},
+		{fidlgen.LibraryIdentifier{""}, false},
+		{fidlgen.LibraryIdentifier{"fuchsia", "zx"}, false},
+		{fidlgen.LibraryIdentifier{}, false},
+	} {
+		assertEqual(t, isZirconLibrary(tc.library), tc.want)
+	}
+
+	rights, err := zirconName(fidlgen.CompoundIdentifier{
+		Library: fidlgen.LibraryIdentifier{"zx", ""},
+		Name:    "Rights",
+	})
+	assertEqual(t, err, nil)
+	assertEqual(t, rights.String(), "zx_rights_t")
+
+	_, err = zirconName(fidlgen.CompoundIdentifier{
+		Library: fidlgen.LibraryIdentifier{"fuchsia", "zx"},
+		Name:    "Rights",
+	})
+	assertEqual(t, err.Error(), "zircon identifier fuchsia.zx/Rights is not in a zircon library")
+
+	_, err = zirconName(fidlgen.CompoundIdentifier{Name: "Rights"})
+	assertEqual(t, err.Error(), "zircon identifier /Rights has an empty library name")
+}
+
+func TestZirconUsageRecorder(t *testing.T) {
+	r := NewZirconUsageRecorder()
+	SetZirconUsageRecorder(r)
+	defer SetZirconUsageRecorder(nil)
+	SetZirconLibraryAliases([]string{"zircon"})
+	defer SetZirconLibraryAliases(nil)
+
+	// resolve maps ci the way the compiler does, recording its use.
+	resolve := func(ident string) {
+		t.Helper()
+		ci := parseIdent(ident)
+		if _, ok := zirconTime(ci); ok {
+			return
+		}
+		if _, err := zirconName(ci); err != nil {
+			t.Fatalf("zirconName(%s): %s", ident, err)
+		}
+	}
+	for _, ident := range []string{
+		"zx/Rights",
+		"zx/Rights.READ",
+		"zx/ObjType.vmo",
+		"zx/CHANNEL_MAX_MSG_BYTES",
+		"zx/InstantMono",
+		// The same identifiers again, spelled differently or through an
+		// alias, are recorded once.
+		"zx/rights",
+		"zircon/Rights.READ",
+		"zx/ObjType.VMO",
+		"zircon/CHANNEL_MAX_MSG_BYTES",
+		"zx/instantMono",
+	} {
+		resolve(ident)
+	}
+	// Identifiers that fail to map aren't recorded.
+	if _, err := zirconName(parseIdent("zx/Rights.DUPLICTE")); err == nil {
+		t.Fatal("zirconName(zx/Rights.DUPLICTE) succeeded, want error")
+	}
+	if _, err := zirconName(parseIdent("zx/InstantMono.ZERO")); err == nil {
+		t.Fatal("zirconName(zx/InstantMono.ZERO) succeeded, want error")
+	}
+
+	var b strings.Builder
+	if err := r.WriteJSON(&b); err != nil {
+		t.Fatal(err)
+	}
+	want := `[
+  {
+    "identifier": "zx/CHANNEL_MAX_MSG_BYTES",
+    "kind": "const",
+    "name": "ZX_CHANNEL_MAX_MSG_BYTES"
+  },
+  {
+    "identifier": "zx/InstantMono",
+    "kind": "time",
+    "name": "::fidl::basic_time<ZX_CLOCK_MONOTONIC>"
+  },
+  {
+    "identifier": "zx/ObjType.VMO",
+    "kind": "member",
+    "name": "ZX_OBJ_TYPE_VMO"
+  },
+  {
+    "identifier": "zx/Rights",
+    "kind": "type",
+    "name": "zx_rights_t"
+  },
+  {
+    "identifier": "zx/Rights.READ",
+    "kind": "member",
+    "name": "ZX_RIGHT_READ"
+  }
+]
+`
+	assertEqual(t, b.String(), want)
+
+	// Without a recorder, nothing more is recorded.
+	SetZirconUsageRecorder(nil)
+	resolve("zx/HANDLE_INVALID")
+	assertEqual(t, len(r.Usages()), 5)
+}
+
+func TestZirconMemberCasing(t *testing.T) {
+	err := registerZirconLibrary("zx.casing", zirconLibrary{
+		names: map[string]zxName{
+			"Rights": {
+				typeName:     "zx_casing_rights_t",
+				prefix:       "zx_casing_right",
+				memberCasing: zirconLowerCase,
+			},
+			"Options": {
+				typeName:     "zx_casing_options_t",
+				prefix:       "ZxCasingOption",
+				members:      []string{"SAME_RIGHTS", "READ"},
+				memberCasing: zirconPreserveCase,
+			},
+		},
+	})
+	assertEqual(t, err, nil)
+	defer delete(zirconLibraries, "zx.casing")
+
+	for _, tc := range []struct {
+		ident, want string
+	}{
+		{"zx.casing/Rights.READ", "zx_casing_right_read"},
+		{"zx.casing/Rights.sameRights", "zx_casing_right_same_rights"},
+		{"zx.casing/Rights.SAME_RIGHTS", "zx_casing_right_same_rights"},
+		{"zx.casing/Options.sameRights", "ZxCasingOption_sameRights"},
+		{"zx.casing/Options.READ", "ZxCasingOption_READ"},
+		// zx keeps spelling members in upper case.
+		{"zx/Rights.sameRights", "ZX_RIGHT_SAME_RIGHTS"},
+		{"zx/Rights.read", "ZX_RIGHT_READ"},
+	} {
+		zn, err := zirconName(parseIdent(tc.ident))
+		if err != nil {
+			t.Errorf("zirconName(%s): %s", tc.ident, err)
+			continue
+		}
+		assertEqual(t, zn.String(), tc.want)
+	}
+
+	// Members are still checked in their normalized form.
+	if _, err := zirconName(parseIdent("zx.casing/Options.write")); err == nil {
+		t.Error("zirconName(zx.casing/Options.write) succeeded, want error")
+	}
+
+	var b strings.Builder
+	DumpZirconNames(&b)
+	for _, want := range []string{
+		"zx.casing.Rights.<MEMBER> → zx_casing_right_<member>\n",
+		"zx.casing.Options.<MEMBER> → ZxCasingOption_<Member>\n",
+		"zx.Rights.<MEMBER> → ZX_RIGHT_<MEMBER>\n",
+	} {
+		if !strings.Contains(b.String(), want) {
+			t.Errorf("DumpZirconNames output doesn't contain %q", want)
+		}
+	}
+}